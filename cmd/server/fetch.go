@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+	"github.com/stackloklabs/gofetch/pkg/server"
+)
+
+// Output formats of the fetch subcommand
+const (
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+)
+
+// fetchJSON is the fetch subcommand's JSON output: the tool's structured
+// output together with the content
+type fetchJSON struct {
+	*server.FetchOutput
+	Content string `json:"content"`
+}
+
+// runFetch implements the fetch subcommand, which fetches one URL through
+// the same code path as the fetch tool and writes the result to stdout. The
+// server flags and environment apply, so robots.txt handling, the proxy and
+// the user agent match a running server. It returns the process exit code.
+func runFetch(ctx context.Context, args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s fetch [flags] <url>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	raw := flags.Bool("raw", false, "Return the content without converting HTML to markdown")
+	maxLength := flags.Int("max-length", 0, "Maximum number of characters to return (0 for the server default)")
+	startIndex := flags.Int("start-index", 0, "Start index for truncated content")
+	expected := flags.String("expected-content", "", "Expected content: html (default), json, text, markdown or any")
+	strict := flags.Bool("strict", false, "Fail instead of returning degraded content when processing fails")
+	convertRST := flags.Bool("convert-rst", false, "Convert reStructuredText documents to markdown")
+	ifNoneMatch := flags.String("if-none-match", "", "Only return the content if its ETag does not match this one")
+	ifModifiedSince := flags.String("if-modified-since", "", "Only return the content if it changed after this HTTP date")
+	format := flags.String("format", formatMarkdown, "Output format: markdown or json")
+
+	cfg, err := config.ParseFlagsFromArgs(flags, args, nil)
+	if err != nil {
+		log.Printf("Invalid configuration: %v", err)
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	if *format != formatMarkdown && *format != formatJSON {
+		log.Printf("Invalid -format value %q: must be %q or %q", *format, formatMarkdown, formatJSON)
+		return 2
+	}
+
+	fs, err := server.NewFetchServer(cfg)
+	if err != nil {
+		log.Printf("Failed to create fetcher: %v", err)
+		return 1
+	}
+
+	params := server.FetchParams{
+		URL:             flags.Arg(0),
+		StartIndex:      startIndex,
+		Raw:             *raw,
+		ExpectedContent: *expected,
+		Strict:          *strict,
+		ConvertRST:      *convertRST,
+		IfNoneMatch:     *ifNoneMatch,
+		IfModifiedSince: *ifModifiedSince,
+	}
+	if *maxLength > 0 {
+		params.MaxLength = maxLength
+	}
+
+	content, output, err := fs.Fetch(ctx, params)
+	if err != nil {
+		log.Printf("Fetch failed: %v", err)
+		return 1
+	}
+
+	if *format == formatJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(fetchJSON{FetchOutput: output, Content: content})
+	} else {
+		_, err = fmt.Fprintln(stdout, content)
+	}
+	if err != nil {
+		log.Printf("Failed to write output: %v", err)
+		return 1
+	}
+	return 0
+}
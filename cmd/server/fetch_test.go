@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunFetch(t *testing.T) {
+	page := "<html><head><title>Release notes</title></head><body><article><p>" +
+		strings.Repeat("This release fixes several bugs and improves performance. ", 10) +
+		"</p></article></body></html>"
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}))
+	defer target.Close()
+
+	t.Run("markdown", func(t *testing.T) {
+		var stdout bytes.Buffer
+		if code := runFetch(t.Context(), []string{target.URL + "/notes"}, &stdout); code != 0 {
+			t.Fatalf("expected exit code 0, got %d", code)
+		}
+		if !strings.HasPrefix(stdout.String(), "# Release notes\n") {
+			t.Errorf("expected converted markdown, got %q", stdout.String())
+		}
+	})
+
+	t.Run("raw json with max length", func(t *testing.T) {
+		var stdout bytes.Buffer
+		args := []string{"-raw", "-max-length", "20", "-format", "json", target.URL + "/notes"}
+		if code := runFetch(t.Context(), args, &stdout); code != 0 {
+			t.Fatalf("expected exit code 0, got %d", code)
+		}
+		var output struct {
+			Content     string `json:"content"`
+			ContentType string `json:"content_type"`
+			Truncated   bool   `json:"truncated"`
+			MaxLength   int    `json:"max_length"`
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+			t.Fatalf("invalid JSON output %q: %v", stdout.String(), err)
+		}
+		if !strings.HasPrefix(output.Content, "<html><head><title>") || !output.Truncated || output.MaxLength != 20 {
+			t.Errorf("unexpected output: %+v", output)
+		}
+		if output.ContentType != "text/html; charset=utf-8" {
+			t.Errorf("expected the response content type, got %q", output.ContentType)
+		}
+	})
+
+	t.Run("robots.txt applies", func(t *testing.T) {
+		var stdout bytes.Buffer
+		if code := runFetch(t.Context(), []string{target.URL + "/private"}, &stdout); code != 1 {
+			t.Errorf("expected exit code 1, got %d", code)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("expected nothing on stdout, got %q", stdout.String())
+		}
+	})
+
+	t.Run("server flags apply", func(t *testing.T) {
+		var stdout bytes.Buffer
+		if code := runFetch(t.Context(), []string{"-ignore-robots-txt", target.URL + "/private"}, &stdout); code != 0 {
+			t.Errorf("expected exit code 0 with robots.txt ignored, got %d", code)
+		}
+	})
+}
+
+func TestRunFetchUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"https://example.com/a", "https://example.com/b"},
+		{"-format", "yaml", "https://example.com/"},
+		{"-port", "-1", "https://example.com/"},
+	} {
+		if code := runFetch(t.Context(), args, &bytes.Buffer{}); code != 2 {
+			t.Errorf("%q: expected exit code 2, got %d", args, code)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+// healthcheckTimeout bounds a healthcheck so that probes get a prompt answer
+const healthcheckTimeout = 3 * time.Second
+
+// runHealthcheck implements the healthcheck subcommand. It reads the same
+// flags and environment as the server, so it probes the port and base path
+// the server was started with, and returns the process exit code.
+func runHealthcheck(args []string) int {
+	cfg, err := config.ParseFlagsFromArgs(flag.NewFlagSet("healthcheck", flag.ContinueOnError), args, nil)
+	if err != nil {
+		log.Printf("Invalid configuration: %v", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthcheckTimeout)
+	defer cancel()
+
+	if err := healthcheck(ctx, healthURL(cfg)); err != nil {
+		log.Printf("Healthcheck failed: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// healthURL returns the health endpoint of a server running on this host
+// with cfg
+func healthURL(cfg config.Config) string {
+	return fmt.Sprintf("http://127.0.0.1:%d%s/healthz", cfg.Port, cfg.BasePath)
+}
+
+// healthcheck requests endpoint and fails unless it answers 200 OK
+func healthcheck(ctx context.Context, endpoint string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+	"github.com/stackloklabs/gofetch/pkg/server"
+)
+
+func TestRunHealthcheckAgainstServer(t *testing.T) {
+	port := freePort(t)
+	args := []string{"-port", strconv.Itoa(port), "-base-path", "/tools/fetch"}
+
+	// Nothing is listening yet
+	if code := runHealthcheck(args); code != 1 {
+		t.Fatalf("expected exit code 1 without a server, got %d", code)
+	}
+
+	cfg, err := config.New(config.WithPort(port), config.WithBasePath("/tools/fetch"))
+	if err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	fs, err := server.NewFetchServer(cfg)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	go fs.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		fs.Shutdown(ctx)
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runHealthcheck(args) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("healthcheck did not pass against the running server")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHealthcheckRequiresOK(t *testing.T) {
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	err := healthcheck(t.Context(), unhealthy.URL+"/healthz")
+	if err == nil || err.Error() != "unexpected status 503 Service Unavailable" {
+		t.Errorf("expected a status error, got %v", err)
+	}
+}
+
+func TestHealthURL(t *testing.T) {
+	cfg, err := config.New(config.WithPort(9090), config.WithBasePath("tools/fetch/"))
+	if err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	if got, want := healthURL(cfg), "http://127.0.0.1:9090/tools/fetch/healthz"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+// freePort returns a TCP port that was free when checked
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
@@ -3,37 +3,119 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/stackloklabs/gofetch/pkg/config"
 	"github.com/stackloklabs/gofetch/pkg/server"
 )
 
+// shutdownTimeout bounds how long a graceful shutdown may take
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	// Parse configuration
-	cfg := config.ParseFlags()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "healthcheck":
+			// "gofetch healthcheck [flags]" probes a running server, so
+			// container images need no extra tools for their health checks
+			os.Exit(runHealthcheck(os.Args[2:]))
+		case "fetch":
+			// "gofetch fetch [flags] <url>" fetches one URL without a server
+			os.Exit(runFetch(context.Background(), os.Args[2:], os.Stdout))
+		}
+	}
 
-	// Create context for clean shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Parse configuration
+	cfg, err := config.ParseFlags()
+	if cfg.SelfTest {
+		// The self-test reports an invalid configuration in its report
+		os.Exit(runSelfTest(context.Background(), cfg, os.Stdout))
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Create and configure server
-	fs := server.NewFetchServer(cfg)
+	fs, err := server.NewFetchServer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
+
+	// Listen for SIGINT/SIGTERM for the whole run, so a second signal can
+	// still be received while a shutdown is in progress
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	// SIGHUP reloads the host profiles file
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go reloadOnHangup(hangups, fs.ReloadHostProfiles)
+
+	forceExit := func() {
+		log.Println("Second signal received, exiting immediately")
+		os.Exit(1)
+	}
+	if err := run(fs, signals, shutdownTimeout, forceExit); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Shutdown completed")
+}
 
-	// Start server
+// reloadOnHangup calls reload for each signal received until hangups is
+// closed. A failed reload is logged and the previous settings stay in use.
+func reloadOnHangup(hangups <-chan os.Signal, reload func() error) {
+	for range hangups {
+		if err := reload(); err != nil {
+			log.Printf("Reload failed, keeping the current host profiles: %v", err)
+		}
+	}
+}
+
+// service is the part of *server.FetchServer that run drives
+type service interface {
+	Start() error
+	Shutdown(ctx context.Context) error
+}
+
+// run starts srv and blocks until it fails or a signal arrives, then shuts it
+// down within timeout. A second signal during the shutdown cancels it and
+// calls forceExit, so a shutdown stuck on a hung connection can be cut short.
+func run(srv service, signals <-chan os.Signal, timeout time.Duration, forceExit func()) error {
 	serverErrCh := make(chan error, 1)
 	go func() {
-		if err := fs.Start(); err != nil {
-			log.Printf("Server error: %v", err)
-			serverErrCh <- err
-		}
+		serverErrCh <- srv.Start()
 	}()
 
 	// Wait for error or shutdown signal
 	select {
 	case err := <-serverErrCh:
-		log.Fatalf("Server failed to start: %v", err)
-	case <-ctx.Done():
-		log.Println("Shutdown signal received")
+		if err != nil {
+			return fmt.Errorf("server failed to start: %w", err)
+		}
+		return nil
+	case sig := <-signals:
+		log.Printf("Shutdown signal received (%s)", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+			forceExit()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown completed with errors: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeService is a service whose shutdown can be made to hang
+type fakeService struct {
+	startErr error
+	stopped  chan struct{}
+	hang     bool
+}
+
+func newFakeService() *fakeService {
+	return &fakeService{stopped: make(chan struct{})}
+}
+
+func (s *fakeService) Start() error {
+	if s.startErr != nil {
+		return s.startErr
+	}
+	<-s.stopped
+	return nil
+}
+
+func (s *fakeService) Shutdown(ctx context.Context) error {
+	defer close(s.stopped)
+	if !s.hang {
+		return nil
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRunShutsDownOnSignal(t *testing.T) {
+	srv := newFakeService()
+	signals := make(chan os.Signal, 2)
+	signals <- syscall.SIGTERM
+
+	if err := run(srv, signals, time.Second, func() { t.Error("unexpected forced exit") }); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRunReportsStartFailure(t *testing.T) {
+	srv := newFakeService()
+	srv.startErr = errors.New("address already in use")
+
+	err := run(srv, make(chan os.Signal), time.Second, func() {})
+	if !errors.Is(err, srv.startErr) {
+		t.Errorf("expected the start error, got %v", err)
+	}
+}
+
+func TestRunSecondSignalForcesExit(t *testing.T) {
+	srv := newFakeService()
+	srv.hang = true
+	signals := make(chan os.Signal, 2)
+	signals <- os.Interrupt
+
+	forced := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- run(srv, signals, time.Minute, func() { close(forced) })
+	}()
+
+	// The shutdown hangs until the second signal cancels it
+	signals <- os.Interrupt
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the shutdown to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown was not cut short by the second signal")
+	}
+	select {
+	case <-forced:
+	case <-time.After(5 * time.Second):
+		t.Error("expected a forced exit")
+	}
+}
+
+func TestReloadOnHangup(t *testing.T) {
+	hangups := make(chan os.Signal, 2)
+	hangups <- syscall.SIGHUP
+	hangups <- syscall.SIGHUP
+	close(hangups)
+
+	// A failed reload does not stop later ones
+	calls := 0
+	reloadOnHangup(hangups, func() error {
+		calls++
+		if calls == 1 {
+			return errors.New("invalid host profiles")
+		}
+		return nil
+	})
+	if calls != 2 {
+		t.Errorf("expected 2 reloads, got %d", calls)
+	}
+}
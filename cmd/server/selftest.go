@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+	"github.com/stackloklabs/gofetch/pkg/server"
+)
+
+// runSelfTest implements -self-test: it checks that a server can run with
+// cfg, writes the report to stdout as JSON and returns the process exit
+// code, 0 when every check passed or was skipped
+func runSelfTest(ctx context.Context, cfg config.Config, stdout io.Writer) int {
+	report := server.SelfTest(ctx, cfg)
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Printf("Failed to write the self-test report: %v", err)
+		return 1
+	}
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
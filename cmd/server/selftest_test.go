@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+	"github.com/stackloklabs/gofetch/pkg/server"
+)
+
+func TestRunSelfTest(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		w.Write([]byte("canary"))
+	}))
+	defer target.Close()
+
+	tests := map[string]int{
+		target.URL + "/canary":  0,
+		target.URL + "/private": 1,
+	}
+	for canary, want := range tests {
+		cfg := config.Config{Transport: config.TransportStreamableHTTP, SelfTest: true, SelfTestURL: canary}
+		var stdout bytes.Buffer
+		if code := runSelfTest(t.Context(), cfg, &stdout); code != want {
+			t.Errorf("%s: expected exit code %d, got %d", canary, want, code)
+		}
+		var report server.SelfTestReport
+		if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+			t.Fatalf("invalid JSON report %q: %v", stdout.String(), err)
+		}
+		if report.OK != (want == 0) || len(report.Checks) != 4 {
+			t.Errorf("%s: unexpected report %+v", canary, report)
+		}
+	}
+}
@@ -2,9 +2,18 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
-	"strconv"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/redact"
+	"golang.org/x/net/http/httpguts"
 )
 
 // Constants
@@ -12,6 +21,36 @@ const (
 	ServerName    = "fetch-server"
 	ServerVersion = "1.0.0"
 	DefaultUA     = "Mozilla/5.0 (compatible; MCPFetchBot/1.0)"
+
+	DefaultFetchTimeout  = 30 * time.Second
+	DefaultRobotsTimeout = 10 * time.Second
+	DefaultStallTimeout  = 15 * time.Second
+	// DefaultNegativeCacheTTL is how long a failed fetch is remembered
+	DefaultNegativeCacheTTL = 30 * time.Second
+
+	DefaultMaxConnsPerHost = 2
+
+	DefaultMaxURLLength   = 8 << 10
+	DefaultMaxQueryParams = 100
+
+	DefaultMaxDecompressionRatio = 100
+	DefaultMaxDecompressedBytes  = 50 << 20
+
+	DefaultMaxResponseHeaderBytes = 256 << 10
+	DefaultMaxResponseHeaders     = 256
+
+	DefaultMaxBatchURLs  = 10
+	DefaultMaxBatchBytes = 10 << 20
+
+	DefaultCircuitFailures = 5
+	DefaultCircuitWindow   = time.Minute
+	DefaultCircuitCooldown = 30 * time.Second
+
+	DefaultEventRetention      = 5 * time.Minute
+	DefaultEventRetentionBytes = 1 << 20
+
+	DefaultSessionIdleTimeout = 5 * time.Minute
+	DefaultSessionPingTimeout = 10 * time.Second
 )
 
 // Transport types
@@ -20,51 +59,756 @@ const (
 	TransportStreamableHTTP = "streamable-http"
 )
 
-// Config holds the server configuration
+// Config holds the server configuration.
+//
+// Fields holding secrets must carry a redact tag so that String and
+// MarshalJSON never expose them: redact:"secret" masks the whole value and
+// redact:"url" strips credentials and sensitive query parameters from a URL.
 type Config struct {
-	Port         int
-	UserAgent    string
-	IgnoreRobots bool
-	ProxyURL     string
-	Transport    string
+	Port         int    `json:"port"`
+	UserAgent    string `json:"user_agent"`
+	IgnoreRobots bool   `json:"ignore_robots_txt"`
+	ProxyURL     string `json:"proxy_url" redact:"url"`
+	Transport    string `json:"transport"`
+	// RobotsUserAgent is matched against robots.txt groups and robots meta
+	// tags in place of UserAgent, which is still sent with every request.
+	// Empty uses UserAgent.
+	RobotsUserAgent string `json:"robots_user_agent"`
+	// RequireProxy refuses every connection that does not go to ProxyURL, so
+	// fetches fail instead of going out directly
+	RequireProxy bool `json:"require_proxy"`
+	// SourceAddress is the local IP address fetches and robots.txt lookups
+	// connect from. Empty lets the system choose.
+	SourceAddress string `json:"source_address"`
+	// DNSServer is the DNS server, an IP address with an optional port,
+	// that fetches and robots.txt lookups resolve hosts with. Empty uses the
+	// system's resolvers.
+	DNSServer string `json:"dns_server"`
+	// DNSOverHTTPS is a DNS over HTTPS endpoint used instead of DNSServer
+	DNSOverHTTPS string `json:"dns_over_https" redact:"url"`
+	// HostProfilesFile is a JSON file of per-host politeness profiles,
+	// reloaded on SIGHUP. Empty sets no profiles.
+	HostProfilesFile string `json:"host_profiles_file"`
+	// RespectRobotsMeta withholds pages that opt out through X-Robots-Tag
+	// headers or robots meta tags (noindex, none, noai)
+	RespectRobotsMeta bool `json:"respect_robots_meta"`
+	// StripTrackingParams removes tracking query parameters (utm_*, fbclid and
+	// similar) from the final and canonical URLs reported to clients
+	StripTrackingParams bool `json:"strip_tracking_params"`
+	// RewriteKnownHosts fetches the raw file behind GitHub and GitLab blob
+	// pages and gists instead of the page
+	RewriteKnownHosts bool `json:"rewrite_known_hosts"`
+	// DisableTitleHeader stops converted HTML from starting with the page
+	// title and source URL
+	DisableTitleHeader bool `json:"disable_title_header"`
+	// DisableReadability converts whole pages instead of extracting their
+	// main content first. It is set with -readability=false.
+	DisableReadability bool `json:"disable_readability"`
+	// AllowInlineHTML keeps a few formatting elements markdown cannot
+	// express, such as <sup> and <details>, as bare HTML tags in converted
+	// pages. Other HTML is always dropped.
+	AllowInlineHTML bool `json:"allow_inline_html"`
+	// AllowMetadataEndpoints permits fetching cloud instance metadata
+	// services, which are blocked by default
+	AllowMetadataEndpoints bool `json:"allow_metadata_endpoints"`
+	// FetchTimeout bounds a whole fetch request. Zero selects DefaultFetchTimeout.
+	FetchTimeout time.Duration `json:"fetch_timeout"`
+	// RobotsTimeout bounds a robots.txt lookup. Zero selects DefaultRobotsTimeout.
+	RobotsTimeout time.Duration `json:"robots_timeout"`
+	// StallTimeout aborts a download that receives no bytes for this long.
+	// Zero selects DefaultStallTimeout.
+	StallTimeout time.Duration `json:"stall_timeout"`
+	// NegativeCacheTTL is how long a failed fetch is returned again for
+	// fetches of the same request instead of being retried. Zero disables it.
+	NegativeCacheTTL time.Duration `json:"negative_cache_ttl"`
+	// ProcessingBudget bounds the time spent converting one fetched page to
+	// markdown, after which its plain text is returned instead. Zero sets no
+	// budget.
+	ProcessingBudget time.Duration `json:"processing_budget"`
+	// MaxConnsPerHost caps concurrent fetches to a single host. Zero selects
+	// DefaultMaxConnsPerHost.
+	MaxConnsPerHost int `json:"max_conns_per_host"`
+	// MaxURLLength is the longest URL accepted for fetching, in bytes. Zero
+	// selects DefaultMaxURLLength.
+	MaxURLLength int `json:"max_url_length"`
+	// MaxQueryParams is the most query parameters a fetched URL may carry.
+	// Zero selects DefaultMaxQueryParams.
+	MaxQueryParams int `json:"max_query_params"`
+	// MaxDecompressionRatio is the most bytes a gzip-encoded response body
+	// may decompress to per compressed byte. Zero selects
+	// DefaultMaxDecompressionRatio.
+	MaxDecompressionRatio int `json:"max_decompression_ratio"`
+	// MaxDecompressedBytes is the most bytes a gzip-encoded response body may
+	// decompress to. Zero selects DefaultMaxDecompressedBytes.
+	MaxDecompressedBytes int64 `json:"max_decompressed_bytes"`
+	// MaxResponseHeaderBytes is the most bytes of headers read from a
+	// response, redirects included. Zero selects
+	// DefaultMaxResponseHeaderBytes.
+	MaxResponseHeaderBytes int64 `json:"max_response_header_bytes"`
+	// MaxResponseHeaders is the most header lines a response may carry.
+	// Zero selects DefaultMaxResponseHeaders.
+	MaxResponseHeaders int `json:"max_response_headers"`
+	// OverloadMaxInFlight is the number of fetches in progress at which new
+	// fetch calls and sessions are refused. Zero means no limit.
+	OverloadMaxInFlight int `json:"overload_max_in_flight"`
+	// OverloadQueueWait refuses new fetch calls and sessions while a fetch
+	// has been queued behind -max-conns-per-host for longer than this. Zero
+	// disables the check.
+	OverloadQueueWait time.Duration `json:"overload_queue_wait"`
+	// CircuitFailures is the number of consecutive failures of a host within
+	// CircuitWindow after which fetches to it fail at once for
+	// CircuitCooldown. Zero disables the circuit breaker.
+	CircuitFailures int `json:"circuit_failures"`
+	// CircuitWindow is the time the failures must fall within. Zero selects
+	// DefaultCircuitWindow.
+	CircuitWindow time.Duration `json:"circuit_window"`
+	// CircuitCooldown is how long fetches to a failing host fail before one
+	// is let through to probe it. Zero selects DefaultCircuitCooldown.
+	CircuitCooldown time.Duration `json:"circuit_cooldown"`
+	// RateLimit caps the requests per minute each client IP may make to the
+	// MCP endpoints. Zero means unlimited.
+	RateLimit int `json:"rate_limit"`
+	// TrustedProxies lists the IPs and CIDR ranges of reverse proxies whose
+	// X-Forwarded-For header identifies the client for rate limiting
+	TrustedProxies []string `json:"trusted_proxies"`
+	// AllowedContentTypes restricts fetched responses to media types matching
+	// one of these patterns, such as text/* or application/json. Empty allows
+	// every type.
+	AllowedContentTypes []string `json:"allowed_content_types"`
+	// ContentProcessors are pattern=processor rules, such as
+	// text/csv=table, choosing how each content type is processed ahead of
+	// the built-in rules. The server checks the processor names at startup.
+	ContentProcessors []string `json:"content_processors"`
+	// Debug logs the whole configuration at startup, redacted, in place of
+	// the summary of its main settings
+	Debug bool `json:"debug"`
+	// DebugHeaders logs selected request and response headers of every fetch,
+	// to help work out why a site blocks the fetcher
+	DebugHeaders bool `json:"debug_headers"`
+	// DebugHeaderNames lists headers logged with DebugHeaders in addition to
+	// the defaults. Credentials and cookies are never logged.
+	DebugHeaderNames []string `json:"debug_header_names"`
+	// RedactQueryParams lists query parameter name fragments whose values are
+	// masked when URLs are logged. Empty selects redact.DefaultSensitiveParams.
+	RedactQueryParams []string `json:"redact_query_params"`
+	// DefaultMaxLength is applied when a client omits max_length. Zero means unlimited.
+	DefaultMaxLength int `json:"default_max_length"`
+	// MaxMaxLength caps every max_length, requested or defaulted. Zero means no cap.
+	MaxMaxLength int `json:"max_max_length"`
+	// MaxBytes caps the response body bytes downloaded per fetch, and every
+	// max_bytes a client requests. Zero means no cap.
+	MaxBytes int `json:"max_bytes"`
+	// MaxResultSize is the most characters a fetch result may carry in one
+	// message. Larger results return their first chunk and keep the rest as
+	// resources. Zero sends results whole.
+	MaxResultSize int `json:"max_result_size"`
+	// SessionByteQuota caps the response body bytes the fetches of one MCP
+	// session may download. Once it is used up the session's fetches fail.
+	// Zero means no quota.
+	SessionByteQuota int64 `json:"session_byte_quota"`
+	// MaxBatchURLs is the most URLs one fetch_batch call may list. Zero
+	// selects DefaultMaxBatchURLs.
+	MaxBatchURLs int `json:"max_batch_urls"`
+	// MaxBatchBytes caps the response body bytes one fetch_batch call
+	// downloads across all its URLs. Zero selects DefaultMaxBatchBytes.
+	MaxBatchBytes int64 `json:"max_batch_bytes"`
+	// EventRetention is how long streamable HTTP events are kept so clients
+	// can resume a dropped stream. Zero selects DefaultEventRetention.
+	EventRetention time.Duration `json:"event_retention"`
+	// EventRetentionBytes caps the event data kept per session. Zero selects
+	// DefaultEventRetentionBytes.
+	EventRetentionBytes int `json:"event_retention_bytes"`
+	// SessionIdleTimeout is how long a session may stay silent before the
+	// server pings it. Zero selects DefaultSessionIdleTimeout.
+	SessionIdleTimeout time.Duration `json:"session_idle_timeout"`
+	// SessionPingTimeout is how long an idle session has to answer a ping
+	// before it is closed. Zero selects DefaultSessionPingTimeout.
+	SessionPingTimeout time.Duration `json:"session_ping_timeout"`
+	// BasePath prefixes every HTTP route, e.g. "/tools/fetch". Empty serves
+	// routes from the root. WithDefaults normalizes it.
+	BasePath string `json:"base_path"`
+	// SelfTest checks that the server can run with this configuration and
+	// exits with a report instead of serving
+	SelfTest bool `json:"self_test"`
+	// SelfTestURL is fetched as a canary by SelfTest, under every fetch
+	// policy. Empty skips the canary.
+	SelfTestURL string `json:"self_test_url" redact:"url"`
+}
+
+// ParseFlags parses the process command line and environment and returns configuration
+func ParseFlags() (Config, error) {
+	return ParseFlagsFromArgs(flag.NewFlagSet(os.Args[0], flag.ExitOnError), os.Args[1:], os.LookupEnv)
 }
 
-var transport string
-var port int
+// ParseFlagsFromArgs registers the server flags on fs, parses args and applies
+// environment overrides read through lookupEnv. It uses no global state, so it
+// can be called repeatedly with fresh flag sets. A nil lookupEnv uses os.LookupEnv.
+// Flags the caller registered on fs beforehand are parsed but never read from
+// the environment. As with New, a configuration that fails validation is
+// returned with the error.
+func ParseFlagsFromArgs(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+
+	defaults := defaultConfig()
 
-// ParseFlags parses command line flags and returns configuration
-func ParseFlags() Config {
-	var config Config
+	// Flags the caller registered, such as a subcommand's, are not config's
+	// and are not read from the environment
+	callerFlags := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		callerFlags[f.Name] = true
+	})
 
-	parseConfig(&config)
+	var (
+		transport, userAgent, proxyURL, redactQueryParams, basePath string
+		sourceAddress, dnsServer, dnsOverHTTPS, hostProfilesFile    string
+		allowedContentTypes, trustedProxies, debugHeaderNames       string
+		contentProcessors, selfTestURL, robotsUserAgent             string
+		port, defaultMaxLength, maxMaxLength, eventRetentionBytes   int
+		ignoreRobots, respectRobotsMeta, stripTrackingParams        bool
+		disableTitleHeader, allowMetadataEndpoints, requireProxy    bool
+		readability, allowInlineHTML                                bool
+		debugHeaders, rewriteKnownHosts, selfTest, debug            bool
+		fetchTimeout, robotsTimeout, stallTimeout, eventRetention   time.Duration
+		sessionIdleTimeout, sessionPingTimeout, negativeCacheTTL    time.Duration
+		processingBudget, overloadQueueWait                         time.Duration
+		circuitWindow, circuitCooldown                              time.Duration
+		maxConnsPerHost, maxURLLength, maxQueryParams, rateLimit    int
+		maxBytes, maxResultSize, maxDecompressionRatio              int
+		overloadMaxInFlight, circuitFailures, maxBatchURLs          int
+		maxResponseHeaders                                          int
+		sessionByteQuota, maxDecompressedBytes, maxBatchBytes       int64
+		maxResponseHeaderBytes                                      int64
+	)
 
-	config.Port = port
-	config.Transport = transport
+	fs.StringVar(&transport, "transport", defaults.Transport, "Transport type: sse or streamable-http")
+	fs.IntVar(&port, "port", defaults.Port, "Port number for HTTP-based transports")
+	fs.StringVar(&userAgent, "user-agent", defaults.UserAgent, "Custom User-Agent string")
+	fs.StringVar(&robotsUserAgent, "robots-user-agent", defaults.RobotsUserAgent,
+		"User agent matched against robots.txt groups and robots meta tags instead of -user-agent, which is still sent")
+	fs.BoolVar(&ignoreRobots, "ignore-robots-txt", defaults.IgnoreRobots, "Ignore robots.txt rules")
+	fs.BoolVar(&respectRobotsMeta, "respect-robots-meta", defaults.RespectRobotsMeta,
+		"Refuse pages marked noindex, none or noai by X-Robots-Tag headers or robots meta tags")
+	fs.BoolVar(&stripTrackingParams, "strip-tracking-params", defaults.StripTrackingParams,
+		"Remove tracking parameters such as utm_* and fbclid from reported final and canonical URLs")
+	fs.BoolVar(&rewriteKnownHosts, "rewrite-known-hosts", defaults.RewriteKnownHosts,
+		"Fetch the raw file behind GitHub and GitLab blob pages and gists instead of the page")
+	fs.BoolVar(&disableTitleHeader, "disable-title-header", defaults.DisableTitleHeader,
+		"Do not start converted pages with the page title and source URL")
+	fs.BoolVar(&readability, "readability", !defaults.DisableReadability,
+		"Extract the main content of pages before converting them to markdown; false converts whole pages")
+	fs.BoolVar(&allowInlineHTML, "allow-inline-html", defaults.AllowInlineHTML,
+		"Keep formatting elements markdown cannot express, such as <sup> and <details>, as bare HTML tags")
+	fs.BoolVar(&allowMetadataEndpoints, "allow-metadata-endpoints", defaults.AllowMetadataEndpoints,
+		"Allow fetching cloud metadata endpoints such as 169.254.169.254, which can expose credentials")
+	fs.StringVar(&proxyURL, "proxy-url", defaults.ProxyURL, "Proxy URL for requests")
+	fs.BoolVar(&requireProxy, "require-proxy", defaults.RequireProxy,
+		"Refuse connections that bypass -proxy-url, including robots.txt lookups and redirects")
+	fs.StringVar(&sourceAddress, "source-address", defaults.SourceAddress,
+		"Local IP address to connect from, which must be assigned to an interface of this host")
+	fs.StringVar(&dnsServer, "dns-server", defaults.DNSServer,
+		"DNS server (IP address, optionally with :port) to resolve fetched hosts with instead of the system's")
+	fs.StringVar(&dnsOverHTTPS, "dns-over-https", defaults.DNSOverHTTPS,
+		"DNS over HTTPS endpoint URL to resolve fetched hosts with instead of the system's")
+	fs.StringVar(&hostProfilesFile, "host-profiles", defaults.HostProfilesFile,
+		"JSON file of per-host pace, concurrency and user agent overrides, reloaded on SIGHUP")
+	fs.DurationVar(&fetchTimeout, "fetch-timeout", defaults.FetchTimeout, "Timeout for fetch requests (e.g. 30s, 1m)")
+	fs.DurationVar(&robotsTimeout, "robots-timeout", defaults.RobotsTimeout,
+		"Timeout for robots.txt lookups; must not exceed -fetch-timeout")
+	fs.DurationVar(&stallTimeout, "stall-timeout", defaults.StallTimeout,
+		"Abort a download when no data arrives for this long (e.g. 15s)")
+	fs.DurationVar(&negativeCacheTTL, "negative-cache-ttl", defaults.NegativeCacheTTL,
+		"How long a failed fetch is returned again for the same request instead of being retried (0 to disable)")
+	fs.DurationVar(&processingBudget, "processing-budget", defaults.ProcessingBudget,
+		"Return a page's plain text when converting it to markdown takes longer than this (0 for no limit)")
+	fs.IntVar(&maxConnsPerHost, "max-conns-per-host", defaults.MaxConnsPerHost,
+		"Maximum concurrent fetches to a single host; further fetches wait their turn")
+	fs.IntVar(&overloadMaxInFlight, "overload-max-in-flight", defaults.OverloadMaxInFlight,
+		"Refuse new fetches and sessions while this many fetches are in progress (0 for no limit)")
+	fs.DurationVar(&overloadQueueWait, "overload-queue-wait", defaults.OverloadQueueWait,
+		"Refuse new fetches and sessions while a fetch has waited this long for a connection slot (0 to disable)")
+	fs.IntVar(&circuitFailures, "circuit-failures", defaults.CircuitFailures,
+		"Fail fetches to a host at once after this many consecutive failures (0 to disable)")
+	fs.DurationVar(&circuitWindow, "circuit-window", defaults.CircuitWindow,
+		"Time within which -circuit-failures consecutive failures open a host's circuit")
+	fs.DurationVar(&circuitCooldown, "circuit-cooldown", defaults.CircuitCooldown,
+		"How long fetches to a failing host fail before one is let through to probe it")
+	fs.IntVar(&maxURLLength, "max-url-length", defaults.MaxURLLength,
+		"Reject URLs longer than this many bytes")
+	fs.IntVar(&maxQueryParams, "max-query-params", defaults.MaxQueryParams,
+		"Reject URLs with more query parameters than this")
+	fs.IntVar(&maxDecompressionRatio, "max-decompression-ratio", defaults.MaxDecompressionRatio,
+		"Refuse gzip-encoded responses that decompress to more than this many bytes per compressed byte")
+	fs.Int64Var(&maxDecompressedBytes, "max-decompressed-bytes", defaults.MaxDecompressedBytes,
+		"Refuse gzip-encoded responses that decompress to more than this many bytes")
+	fs.Int64Var(&maxResponseHeaderBytes, "max-response-header-bytes", defaults.MaxResponseHeaderBytes,
+		"Refuse responses, redirects included, whose headers exceed this many bytes")
+	fs.IntVar(&maxResponseHeaders, "max-response-headers", defaults.MaxResponseHeaders,
+		"Refuse responses, redirects included, with more header lines than this")
+	fs.IntVar(&defaultMaxLength, "default-max-length", defaults.DefaultMaxLength,
+		"Maximum characters returned when a client omits max_length (0 for unlimited)")
+	fs.IntVar(&maxMaxLength, "max-max-length", defaults.MaxMaxLength,
+		"Upper limit applied to every max_length, including client-requested values (0 for no limit)")
+	fs.IntVar(&maxBytes, "max-bytes", defaults.MaxBytes,
+		"Maximum response body bytes downloaded per fetch, including client-requested max_bytes (0 for no limit)")
+	fs.IntVar(&maxResultSize, "max-result-size", defaults.MaxResultSize,
+		"Maximum characters of a fetch result sent in one message; the rest is served as resources (0 for no limit)")
+	fs.Int64Var(&sessionByteQuota, "session-byte-quota", defaults.SessionByteQuota,
+		"Maximum response body bytes the fetches of one MCP session may download (0 for no limit)")
+	fs.IntVar(&maxBatchURLs, "max-batch-urls", defaults.MaxBatchURLs,
+		"Maximum URLs one fetch_batch call may list")
+	fs.Int64Var(&maxBatchBytes, "max-batch-bytes", defaults.MaxBatchBytes,
+		"Maximum response body bytes one fetch_batch call downloads across all its URLs")
+	fs.DurationVar(&eventRetention, "event-retention", defaults.EventRetention,
+		"How long streamable HTTP events are kept for clients resuming with Last-Event-ID")
+	fs.IntVar(&eventRetentionBytes, "event-retention-bytes", defaults.EventRetentionBytes,
+		"Maximum bytes of streamable HTTP events kept per session for resumption")
+	fs.DurationVar(&sessionIdleTimeout, "session-idle-timeout", defaults.SessionIdleTimeout,
+		"Ping sessions that have been silent for this long")
+	fs.DurationVar(&sessionPingTimeout, "session-ping-timeout", defaults.SessionPingTimeout,
+		"Close idle sessions that do not answer a ping within this long")
+	fs.StringVar(&basePath, "base-path", defaults.BasePath,
+		"Path prefix for all HTTP endpoints, e.g. /tools/fetch when served behind a reverse proxy")
+	fs.IntVar(&rateLimit, "rate-limit", defaults.RateLimit,
+		"Maximum requests per minute from one client IP to the MCP endpoints (0 for unlimited)")
+	fs.StringVar(&trustedProxies, "trusted-proxies", "",
+		"Comma-separated IPs or CIDR ranges of proxies whose X-Forwarded-For header is trusted")
+	fs.StringVar(&allowedContentTypes, "allowed-content-types", "",
+		"Comma-separated media type patterns (e.g. text/*,application/json) responses must match; empty allows all")
+	fs.StringVar(&contentProcessors, "content-processors", "",
+		"Comma-separated pattern=processor rules (e.g. application/json=pretty,text/csv=table,*/*=reject); "+
+			"processors are markdown, pretty, table, text and reject")
+	fs.BoolVar(&debug, "debug", defaults.Debug,
+		"Log the whole configuration at startup, with secrets redacted, instead of a summary")
+	fs.BoolVar(&debugHeaders, "debug-headers", defaults.DebugHeaders,
+		"Log selected request and response headers of every fetch, never including credentials or cookies")
+	fs.StringVar(&debugHeaderNames, "debug-header-names", "",
+		"Comma-separated extra header names to log with -debug-headers")
+	fs.StringVar(&redactQueryParams, "redact-query-params", "",
+		"Comma-separated query parameter name fragments to redact from logged URLs (default: token,key,secret,password,signature)")
+	fs.BoolVar(&selfTest, "self-test", defaults.SelfTest,
+		"Check that the server can run with this configuration, print a JSON report and exit instead of serving")
+	fs.StringVar(&selfTestURL, "self-test-url", defaults.SelfTestURL,
+		"URL fetched as a canary by -self-test, under every fetch policy")
+
+	configFlags := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		if !callerFlags[f.Name] {
+			configFlags[f.Name] = true
+		}
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
 
+	if err := applyEnv(fs, configFlags, lookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	return New(
+		WithTransport(transport),
+		WithPort(port),
+		WithUserAgent(userAgent),
+		WithRobotsUserAgent(robotsUserAgent),
+		WithIgnoreRobots(ignoreRobots),
+		WithRespectRobotsMeta(respectRobotsMeta),
+		WithStripTrackingParams(stripTrackingParams),
+		WithRewriteKnownHosts(rewriteKnownHosts),
+		WithDisableTitleHeader(disableTitleHeader),
+		WithDisableReadability(!readability),
+		WithAllowInlineHTML(allowInlineHTML),
+		WithAllowMetadataEndpoints(allowMetadataEndpoints),
+		WithProxyURL(proxyURL),
+		WithRequireProxy(requireProxy),
+		WithSourceAddress(sourceAddress),
+		WithDNSServer(dnsServer),
+		WithDNSOverHTTPS(dnsOverHTTPS),
+		WithHostProfilesFile(hostProfilesFile),
+		WithFetchTimeout(fetchTimeout),
+		WithRobotsTimeout(robotsTimeout),
+		WithStallTimeout(stallTimeout),
+		WithNegativeCacheTTL(negativeCacheTTL),
+		WithProcessingBudget(processingBudget),
+		WithMaxConnsPerHost(maxConnsPerHost),
+		WithOverloadThresholds(overloadMaxInFlight, overloadQueueWait),
+		WithCircuitBreaker(circuitFailures, circuitWindow, circuitCooldown),
+		WithURLLimits(maxURLLength, maxQueryParams),
+		WithDecompressionLimits(maxDecompressionRatio, maxDecompressedBytes),
+		WithResponseHeaderLimits(maxResponseHeaderBytes, maxResponseHeaders),
+		WithRateLimit(rateLimit, splitList(trustedProxies)...),
+		WithAllowedContentTypes(splitList(allowedContentTypes)...),
+		WithContentProcessors(splitList(contentProcessors)...),
+		WithDebug(debug),
+		WithDebugHeaders(debugHeaders, splitList(debugHeaderNames)...),
+		WithRedactQueryParams(splitList(redactQueryParams)...),
+		WithDefaultMaxLength(defaultMaxLength),
+		WithMaxMaxLength(maxMaxLength),
+		WithMaxBytes(maxBytes),
+		WithMaxResultSize(maxResultSize),
+		WithSessionByteQuota(sessionByteQuota),
+		WithBatchLimits(maxBatchURLs, maxBatchBytes),
+		WithBasePath(basePath),
+		WithEventRetention(eventRetention, eventRetentionBytes),
+		WithSessionTimeouts(sessionIdleTimeout, sessionPingTimeout),
+		WithSelfTest(selfTest, selfTestURL),
+	)
+}
+
+// WithDefaults returns a copy of the configuration with defaults filled in
+// for unset fields that have no meaningful zero value
+func (c Config) WithDefaults() Config {
 	// Set default user agent if not provided
-	if config.UserAgent == "" {
-		config.UserAgent = DefaultUA
+	if c.UserAgent == "" {
+		c.UserAgent = DefaultUA
+	}
+	if c.FetchTimeout == 0 {
+		c.FetchTimeout = DefaultFetchTimeout
+	}
+	if c.RobotsTimeout == 0 {
+		c.RobotsTimeout = DefaultRobotsTimeout
+	}
+	if c.StallTimeout == 0 {
+		c.StallTimeout = DefaultStallTimeout
+	}
+	if c.MaxConnsPerHost == 0 {
+		c.MaxConnsPerHost = DefaultMaxConnsPerHost
+	}
+	if c.MaxURLLength == 0 {
+		c.MaxURLLength = DefaultMaxURLLength
+	}
+	if c.MaxQueryParams == 0 {
+		c.MaxQueryParams = DefaultMaxQueryParams
+	}
+	if c.MaxDecompressionRatio == 0 {
+		c.MaxDecompressionRatio = DefaultMaxDecompressionRatio
+	}
+	if c.MaxDecompressedBytes == 0 {
+		c.MaxDecompressedBytes = DefaultMaxDecompressedBytes
+	}
+	if c.MaxResponseHeaderBytes == 0 {
+		c.MaxResponseHeaderBytes = DefaultMaxResponseHeaderBytes
+	}
+	if c.MaxResponseHeaders == 0 {
+		c.MaxResponseHeaders = DefaultMaxResponseHeaders
+	}
+	if c.MaxBatchURLs == 0 {
+		c.MaxBatchURLs = DefaultMaxBatchURLs
+	}
+	if c.MaxBatchBytes == 0 {
+		c.MaxBatchBytes = DefaultMaxBatchBytes
+	}
+	if c.CircuitWindow == 0 {
+		c.CircuitWindow = DefaultCircuitWindow
+	}
+	if c.CircuitCooldown == 0 {
+		c.CircuitCooldown = DefaultCircuitCooldown
+	}
+	if c.EventRetention == 0 {
+		c.EventRetention = DefaultEventRetention
+	}
+	if c.EventRetentionBytes == 0 {
+		c.EventRetentionBytes = DefaultEventRetentionBytes
+	}
+	if c.SessionIdleTimeout == 0 {
+		c.SessionIdleTimeout = DefaultSessionIdleTimeout
+	}
+	if c.SessionPingTimeout == 0 {
+		c.SessionPingTimeout = DefaultSessionPingTimeout
+	}
+	c.BasePath = normalizeBasePath(c.BasePath)
+	return c
+}
+
+// envAliases maps flags to environment variable names that predate the
+// generic naming scheme
+var envAliases = map[string]string{
+	"port": "MCP_PORT",
+}
+
+// envName returns the environment variable that sets the named flag: the flag
+// name upper-cased with dashes replaced by underscores (e.g. -proxy-url is
+// PROXY_URL), except for -port, which is read from MCP_PORT.
+func envName(flagName string) string {
+	if alias, ok := envAliases[flagName]; ok {
+		return alias
+	}
+	return strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag named in configFlags that was not given on the
+// command line from its environment variable, so flags win over the
+// environment and the environment wins over defaults
+func applyEnv(fs *flag.FlagSet, configFlags map[string]bool, lookupEnv func(string) (string, bool)) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] || !configFlags[f.Name] {
+			return
+		}
+		name := envName(f.Name)
+		value, ok := lookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s value %q for -%s: %w", name, value, f.Name, err))
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the configuration and reports every invalid setting, naming
+// the flag and the offending value
+func (c Config) Validate() error {
+	var errs []error
+
+	// Port 0 lets the operating system pick a free port
+	if c.Port < 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid -port value %d: must be between 0 and 65535", c.Port))
+	}
+
+	switch c.Transport {
+	case TransportSSE, TransportStreamableHTTP:
+	default:
+		errs = append(errs, fmt.Errorf("invalid -transport value %q: must be %q or %q",
+			c.Transport, TransportSSE, TransportStreamableHTTP))
+	}
+
+	if c.FetchTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -fetch-timeout value %s: must be positive", c.FetchTimeout))
+	}
+	if c.RobotsTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -robots-timeout value %s: must be positive", c.RobotsTimeout))
+	} else if c.RobotsTimeout > c.FetchTimeout && c.FetchTimeout > 0 {
+		errs = append(errs, fmt.Errorf("invalid -robots-timeout value %s: must not exceed -fetch-timeout (%s)",
+			c.RobotsTimeout, c.FetchTimeout))
 	}
 
-	return config
+	if c.StallTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -stall-timeout value %s: must be positive", c.StallTimeout))
+	}
+	if c.NegativeCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("invalid -negative-cache-ttl value %s: must not be negative", c.NegativeCacheTTL))
+	}
+	if c.ProcessingBudget < 0 {
+		errs = append(errs, fmt.Errorf("invalid -processing-budget value %s: must not be negative", c.ProcessingBudget))
+	}
+
+	if c.MaxConnsPerHost <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-conns-per-host value %d: must be positive", c.MaxConnsPerHost))
+	}
+	if c.OverloadMaxInFlight < 0 {
+		errs = append(errs, fmt.Errorf("invalid -overload-max-in-flight value %d: must not be negative", c.OverloadMaxInFlight))
+	}
+	if c.OverloadQueueWait < 0 {
+		errs = append(errs, fmt.Errorf("invalid -overload-queue-wait value %s: must not be negative", c.OverloadQueueWait))
+	}
+	if c.CircuitFailures < 0 {
+		errs = append(errs, fmt.Errorf("invalid -circuit-failures value %d: must not be negative", c.CircuitFailures))
+	}
+	if c.CircuitWindow <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -circuit-window value %s: must be positive", c.CircuitWindow))
+	}
+	if c.CircuitCooldown <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -circuit-cooldown value %s: must be positive", c.CircuitCooldown))
+	}
+	if c.MaxURLLength <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-url-length value %d: must be positive", c.MaxURLLength))
+	}
+	if c.MaxQueryParams <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-query-params value %d: must be positive", c.MaxQueryParams))
+	}
+	if c.MaxDecompressionRatio <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-decompression-ratio value %d: must be positive", c.MaxDecompressionRatio))
+	}
+	if c.MaxDecompressedBytes <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-decompressed-bytes value %d: must be positive", c.MaxDecompressedBytes))
+	}
+	if c.MaxResponseHeaderBytes <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-response-header-bytes value %d: must be positive", c.MaxResponseHeaderBytes))
+	}
+	if c.MaxResponseHeaders <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-response-headers value %d: must be positive", c.MaxResponseHeaders))
+	}
+	if c.MaxBatchURLs <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-batch-urls value %d: must be positive", c.MaxBatchURLs))
+	}
+	if c.MaxBatchBytes <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-batch-bytes value %d: must be positive", c.MaxBatchBytes))
+	}
+
+	if c.EventRetention <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -event-retention value %s: must be positive", c.EventRetention))
+	}
+	if c.EventRetentionBytes <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -event-retention-bytes value %d: must be positive", c.EventRetentionBytes))
+	}
+
+	if c.SessionIdleTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -session-idle-timeout value %s: must be positive", c.SessionIdleTimeout))
+	}
+	if c.SessionPingTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid -session-ping-timeout value %s: must be positive", c.SessionPingTimeout))
+	}
+
+	if c.DefaultMaxLength < 0 {
+		errs = append(errs, fmt.Errorf("invalid -default-max-length value %d: must not be negative", c.DefaultMaxLength))
+	}
+	if c.MaxMaxLength < 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-max-length value %d: must not be negative", c.MaxMaxLength))
+	} else if c.MaxMaxLength > 0 && c.DefaultMaxLength > c.MaxMaxLength {
+		errs = append(errs, fmt.Errorf("invalid -default-max-length value %d: must not exceed -max-max-length (%d)",
+			c.DefaultMaxLength, c.MaxMaxLength))
+	}
+	if c.MaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-bytes value %d: must not be negative", c.MaxBytes))
+	}
+	if c.MaxResultSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid -max-result-size value %d: must not be negative", c.MaxResultSize))
+	}
+	if c.SessionByteQuota < 0 {
+		errs = append(errs, fmt.Errorf("invalid -session-byte-quota value %d: must not be negative", c.SessionByteQuota))
+	}
+
+	if c.RateLimit < 0 {
+		errs = append(errs, fmt.Errorf("invalid -rate-limit value %d: must not be negative", c.RateLimit))
+	}
+	for _, proxy := range c.TrustedProxies {
+		if !validIPOrPrefix(proxy) {
+			errs = append(errs, fmt.Errorf("invalid -trusted-proxies entry %q: must be an IP address or CIDR range", proxy))
+		}
+	}
+
+	for _, pattern := range c.AllowedContentTypes {
+		if !validContentTypePattern(pattern) {
+			errs = append(errs, fmt.Errorf(
+				"invalid -allowed-content-types entry %q: must be a media type pattern such as text/html or text/*", pattern))
+		}
+	}
+
+	for _, rule := range c.ContentProcessors {
+		if pattern, _, ok := strings.Cut(rule, "="); !ok || !validContentTypePattern(strings.TrimSpace(pattern)) {
+			errs = append(errs, fmt.Errorf(
+				"invalid -content-processors entry %q: must be a media type pattern and processor such as text/csv=table", rule))
+		}
+	}
+
+	for _, name := range c.DebugHeaderNames {
+		if !httpguts.ValidHeaderFieldName(name) {
+			errs = append(errs, fmt.Errorf("invalid -debug-header-names entry %q: must be a header name", name))
+		}
+	}
+
+	if strings.ContainsAny(c.BasePath, "?#") {
+		errs = append(errs, fmt.Errorf("invalid -base-path value %q: must be a path without query or fragment", c.BasePath))
+	}
+
+	if c.ProxyURL != "" {
+		if err := validateProxyURL(c.ProxyURL); err != nil {
+			// Proxy URLs often carry credentials, so never echo them verbatim
+			errs = append(errs, fmt.Errorf("invalid -proxy-url value %q: %w", redact.New(nil).URL(c.ProxyURL), err))
+		}
+	}
+	if c.RequireProxy && c.ProxyURL == "" {
+		errs = append(errs, errors.New("invalid -require-proxy value true: requires -proxy-url"))
+	}
+	if c.SourceAddress != "" {
+		if addr, err := netip.ParseAddr(c.SourceAddress); err != nil || addr.IsUnspecified() || addr.IsMulticast() {
+			errs = append(errs, fmt.Errorf("invalid -source-address value %q: must be a unicast IP address", c.SourceAddress))
+		}
+	}
+	if c.DNSServer != "" && !validDNSServer(c.DNSServer) {
+		errs = append(errs, fmt.Errorf("invalid -dns-server value %q: must be an IP address with an optional port", c.DNSServer))
+	}
+	if c.DNSOverHTTPS != "" {
+		if u, err := url.Parse(c.DNSOverHTTPS); err != nil || u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid -dns-over-https value %q: must be an https URL", redact.New(nil).URL(c.DNSOverHTTPS)))
+		}
+		if c.DNSServer != "" {
+			errs = append(errs, errors.New("invalid -dns-over-https value: cannot be combined with -dns-server"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateProxyURL checks that a proxy URL can be used by http.ProxyURL
+func validateProxyURL(proxyURL string) error {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported scheme %q: must be http, https, socks5 or socks5h", parsed.Scheme)
+	}
+
+	if parsed.Host == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
+
+// normalizeBasePath returns basePath with a single leading slash and no
+// trailing slash, so that routes can be built as BasePath + "/mcp". A prefix
+// made only of slashes normalizes to the empty string.
+func normalizeBasePath(basePath string) string {
+	basePath = strings.Trim(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		return ""
+	}
+	return "/" + basePath
+}
+
+// validContentTypePattern reports whether pattern has the form type/subtype,
+// where either part may use path.Match wildcards
+func validContentTypePattern(pattern string) bool {
+	typ, subtype, ok := strings.Cut(pattern, "/")
+	if !ok || typ == "" || subtype == "" || strings.Contains(subtype, "/") {
+		return false
+	}
+	_, err := path.Match(pattern, "")
+	return err == nil
+}
+
+// validIPOrPrefix reports whether s is an IP address or a CIDR range
+func validIPOrPrefix(s string) bool {
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// validDNSServer reports whether s is an IP address, optionally with a port
+func validDNSServer(s string) bool {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Port() != 0
+	}
+	_, err := netip.ParseAddr(s)
+	return err == nil
 }
 
-// parseConfig parses the command line flags and environment variables
-// to set the transport and port for the MCP server
-func parseConfig(config *Config) {
-	flag.StringVar(&transport, "transport", "streamable-http", "Transport type: sse or streamable-http")
-	flag.IntVar(&port, "port", 8080, "Port number for HTTP-based transports")
-	flag.StringVar(&config.UserAgent, "user-agent", "", "Custom User-Agent string")
-	flag.BoolVar(&config.IgnoreRobots, "ignore-robots-txt", false, "Ignore robots.txt rules")
-	flag.StringVar(&config.ProxyURL, "proxy-url", "", "Proxy URL for requests")
-	flag.Parse()
-
-	if t, ok := os.LookupEnv("TRANSPORT"); ok {
-		transport = t
-	}
-	if p, ok := os.LookupEnv("MCP_PORT"); ok {
-		if intValue, err := strconv.Atoi(p); err == nil {
-			port = intValue
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
+	return items
 }
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/redact"
+)
+
+// redactedValue replaces secret values in configuration dumps
+const redactedValue = "[REDACTED]"
+
+// MarshalJSON encodes every configuration field, applying the redaction
+// declared by each field's redact tag. Durations are encoded as strings.
+func (c Config) MarshalJSON() ([]byte, error) {
+	v := reflect.ValueOf(c)
+	t := v.Type()
+
+	redactor := redact.New(c.RedactQueryParams)
+	fields := make(map[string]any, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name := field.Tag.Get("json")
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+
+		value, err := redactField(redactor, field, v.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = value
+	}
+
+	return json.Marshal(fields)
+}
+
+// String returns the redacted configuration as JSON
+func (c Config) String() string {
+	data, err := c.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("<config: %v>", err)
+	}
+	return string(data)
+}
+
+// redactField returns the value to dump for a configuration field
+func redactField(redactor *redact.Redactor, field reflect.StructField, value reflect.Value) (any, error) {
+	switch tag := field.Tag.Get("redact"); tag {
+	case "":
+	case "secret":
+		if value.IsZero() {
+			return "", nil
+		}
+		return redactedValue, nil
+	case "url":
+		if value.Kind() != reflect.String {
+			return nil, fmt.Errorf("redact:\"url\" requires a string field, %s is %s", field.Name, value.Kind())
+		}
+		if value.String() == "" {
+			return "", nil
+		}
+		return redactor.URL(value.String()), nil
+	default:
+		return nil, fmt.Errorf("unknown redact tag %q on field %s", tag, field.Name)
+	}
+
+	if d, ok := value.Interface().(time.Duration); ok {
+		return d.String(), nil
+	}
+	return value.Interface(), nil
+}
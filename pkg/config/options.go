@@ -0,0 +1,421 @@
+package config
+
+import "time"
+
+// DefaultPort is the port used when none is configured
+const DefaultPort = 8080
+
+// Option configures a Config built by New
+type Option func(*Config)
+
+// New builds a validated configuration from the given options. Defaults are
+// the same ones ParseFlags uses, so programmatic and command line
+// configuration cannot drift apart. A configuration that fails validation is
+// returned along with the error, so that -self-test can still report on it.
+func New(opts ...Option) (Config, error) {
+	config := defaultConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+	config = config.WithDefaults()
+
+	return config, config.Validate()
+}
+
+// defaultConfig returns the configuration used when nothing is overridden
+func defaultConfig() Config {
+	return Config{
+		Port:          DefaultPort,
+		Transport:     TransportStreamableHTTP,
+		UserAgent:     DefaultUA,
+		FetchTimeout:  DefaultFetchTimeout,
+		RobotsTimeout: DefaultRobotsTimeout,
+		StallTimeout:  DefaultStallTimeout,
+
+		NegativeCacheTTL: DefaultNegativeCacheTTL,
+
+		MaxConnsPerHost: DefaultMaxConnsPerHost,
+		MaxURLLength:    DefaultMaxURLLength,
+		MaxQueryParams:  DefaultMaxQueryParams,
+
+		MaxDecompressionRatio: DefaultMaxDecompressionRatio,
+		MaxDecompressedBytes:  DefaultMaxDecompressedBytes,
+
+		MaxResponseHeaderBytes: DefaultMaxResponseHeaderBytes,
+		MaxResponseHeaders:     DefaultMaxResponseHeaders,
+
+		MaxBatchURLs:  DefaultMaxBatchURLs,
+		MaxBatchBytes: DefaultMaxBatchBytes,
+
+		CircuitFailures: DefaultCircuitFailures,
+		CircuitWindow:   DefaultCircuitWindow,
+		CircuitCooldown: DefaultCircuitCooldown,
+
+		EventRetention:      DefaultEventRetention,
+		EventRetentionBytes: DefaultEventRetentionBytes,
+		SessionIdleTimeout:  DefaultSessionIdleTimeout,
+		SessionPingTimeout:  DefaultSessionPingTimeout,
+	}
+}
+
+// WithPort sets the port for HTTP-based transports. Zero selects a free port.
+func WithPort(port int) Option {
+	return func(c *Config) {
+		c.Port = port
+	}
+}
+
+// WithTransport sets the transport type (TransportSSE or TransportStreamableHTTP)
+func WithTransport(transport string) Option {
+	return func(c *Config) {
+		c.Transport = transport
+	}
+}
+
+// WithUserAgent sets the User-Agent sent with requests. Empty selects DefaultUA.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Config) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithRobotsUserAgent sets the user agent robots.txt groups and robots meta
+// tags are matched against. Empty uses the User-Agent sent with requests.
+func WithRobotsUserAgent(userAgent string) Option {
+	return func(c *Config) {
+		c.RobotsUserAgent = userAgent
+	}
+}
+
+// WithIgnoreRobots disables robots.txt checks when ignore is true
+func WithIgnoreRobots(ignore bool) Option {
+	return func(c *Config) {
+		c.IgnoreRobots = ignore
+	}
+}
+
+// WithRespectRobotsMeta sets whether X-Robots-Tag headers and robots meta
+// tags are honoured
+func WithRespectRobotsMeta(respect bool) Option {
+	return func(c *Config) {
+		c.RespectRobotsMeta = respect
+	}
+}
+
+// WithRewriteKnownHosts sets whether the raw file behind GitHub and GitLab
+// blob pages and gists is fetched instead of the page
+func WithRewriteKnownHosts(rewrite bool) Option {
+	return func(c *Config) {
+		c.RewriteKnownHosts = rewrite
+	}
+}
+
+// WithStripTrackingParams sets whether tracking parameters are removed from
+// reported URLs
+func WithStripTrackingParams(strip bool) Option {
+	return func(c *Config) {
+		c.StripTrackingParams = strip
+	}
+}
+
+// WithDisableTitleHeader sets whether converted pages omit the leading page
+// title and source URL
+func WithDisableTitleHeader(disable bool) Option {
+	return func(c *Config) {
+		c.DisableTitleHeader = disable
+	}
+}
+
+// WithDisableReadability sets whether whole pages are converted to markdown
+// instead of only their main content
+func WithDisableReadability(disable bool) Option {
+	return func(c *Config) {
+		c.DisableReadability = disable
+	}
+}
+
+// WithAllowInlineHTML sets whether converted pages keep formatting elements
+// markdown cannot express as bare HTML tags
+func WithAllowInlineHTML(allow bool) Option {
+	return func(c *Config) {
+		c.AllowInlineHTML = allow
+	}
+}
+
+// WithAllowMetadataEndpoints permits fetching cloud instance metadata services
+func WithAllowMetadataEndpoints(allow bool) Option {
+	return func(c *Config) {
+		c.AllowMetadataEndpoints = allow
+	}
+}
+
+// WithProxyURL routes requests through the given proxy
+func WithProxyURL(proxyURL string) Option {
+	return func(c *Config) {
+		c.ProxyURL = proxyURL
+	}
+}
+
+// WithSourceAddress makes fetches and robots.txt lookups connect from the
+// given local IP address
+func WithSourceAddress(addr string) Option {
+	return func(c *Config) {
+		c.SourceAddress = addr
+	}
+}
+
+// WithDNSServer makes fetches and robots.txt lookups resolve hosts with the
+// DNS server at the given IP address, with an optional port
+func WithDNSServer(server string) Option {
+	return func(c *Config) {
+		c.DNSServer = server
+	}
+}
+
+// WithDNSOverHTTPS makes fetches and robots.txt lookups resolve hosts with
+// the given DNS over HTTPS endpoint
+func WithDNSOverHTTPS(endpoint string) Option {
+	return func(c *Config) {
+		c.DNSOverHTTPS = endpoint
+	}
+}
+
+// WithHostProfilesFile loads per-host politeness profiles from path, a JSON
+// file reloaded on SIGHUP
+func WithHostProfilesFile(path string) Option {
+	return func(c *Config) {
+		c.HostProfilesFile = path
+	}
+}
+
+// WithRequireProxy makes every fetch go through the proxy set by
+// WithProxyURL, failing rather than connecting directly
+func WithRequireProxy(require bool) Option {
+	return func(c *Config) {
+		c.RequireProxy = require
+	}
+}
+
+// WithFetchTimeout sets the timeout for fetch requests
+func WithFetchTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.FetchTimeout = timeout
+	}
+}
+
+// WithRobotsTimeout sets the timeout for robots.txt lookups
+func WithRobotsTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.RobotsTimeout = timeout
+	}
+}
+
+// WithNegativeCacheTTL sets how long a failed fetch is returned again for
+// fetches of the same request. Zero disables it.
+func WithNegativeCacheTTL(ttl time.Duration) Option {
+	return func(c *Config) {
+		c.NegativeCacheTTL = ttl
+	}
+}
+
+// WithProcessingBudget sets how long converting one fetched page to markdown
+// may take before its plain text is returned instead. Zero sets no budget.
+func WithProcessingBudget(budget time.Duration) Option {
+	return func(c *Config) {
+		c.ProcessingBudget = budget
+	}
+}
+
+// WithStallTimeout sets how long a download may go without receiving data
+func WithStallTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.StallTimeout = timeout
+	}
+}
+
+// WithMaxConnsPerHost sets how many fetches may run against a single host at once
+func WithMaxConnsPerHost(limit int) Option {
+	return func(c *Config) {
+		c.MaxConnsPerHost = limit
+	}
+}
+
+// WithOverloadThresholds refuses new fetch calls and sessions while
+// maxInFlight fetches are in progress or a fetch has been queued for longer
+// than queueWait. Zero disables either check.
+func WithOverloadThresholds(maxInFlight int, queueWait time.Duration) Option {
+	return func(c *Config) {
+		c.OverloadMaxInFlight = maxInFlight
+		c.OverloadQueueWait = queueWait
+	}
+}
+
+// WithCircuitBreaker fails fetches to a host at once for cooldown after
+// failures consecutive failures within window. Zero failures disables the
+// circuit breaker.
+func WithCircuitBreaker(failures int, window, cooldown time.Duration) Option {
+	return func(c *Config) {
+		c.CircuitFailures = failures
+		c.CircuitWindow = window
+		c.CircuitCooldown = cooldown
+	}
+}
+
+// WithURLLimits sets the longest URL, in bytes, and the most query parameters
+// accepted for fetching
+func WithURLLimits(maxLength, maxQueryParams int) Option {
+	return func(c *Config) {
+		c.MaxURLLength = maxLength
+		c.MaxQueryParams = maxQueryParams
+	}
+}
+
+// WithResponseHeaderLimits sets the most bytes of headers read from a
+// response and the most header lines it may carry
+func WithResponseHeaderLimits(maxBytes int64, maxCount int) Option {
+	return func(c *Config) {
+		c.MaxResponseHeaderBytes = maxBytes
+		c.MaxResponseHeaders = maxCount
+	}
+}
+
+// WithBatchLimits sets the most URLs one fetch_batch call may list and the
+// response body bytes it may download across all of them
+func WithBatchLimits(maxURLs int, maxBytes int64) Option {
+	return func(c *Config) {
+		c.MaxBatchURLs = maxURLs
+		c.MaxBatchBytes = maxBytes
+	}
+}
+
+// WithDecompressionLimits sets how far a gzip-encoded response body may
+// expand: at most maxRatio bytes per compressed byte and maxBytes in total
+func WithDecompressionLimits(maxRatio int, maxBytes int64) Option {
+	return func(c *Config) {
+		c.MaxDecompressionRatio = maxRatio
+		c.MaxDecompressedBytes = maxBytes
+	}
+}
+
+// WithRateLimit caps the requests per minute each client IP may make to the
+// MCP endpoints, trusting X-Forwarded-For only from trustedProxies. Zero
+// means unlimited.
+func WithRateLimit(perMinute int, trustedProxies ...string) Option {
+	return func(c *Config) {
+		c.RateLimit = perMinute
+		c.TrustedProxies = trustedProxies
+	}
+}
+
+// WithAllowedContentTypes restricts fetched responses to media types matching
+// one of patterns, such as text/* or application/json. No patterns allows
+// every type.
+func WithAllowedContentTypes(patterns ...string) Option {
+	return func(c *Config) {
+		c.AllowedContentTypes = patterns
+	}
+}
+
+// WithContentProcessors sets pattern=processor rules, such as
+// text/csv=table, choosing how content types are processed
+func WithContentProcessors(rules ...string) Option {
+	return func(c *Config) {
+		c.ContentProcessors = rules
+	}
+}
+
+// WithDebug logs the whole redacted configuration at startup instead of a
+// summary of its main settings
+func WithDebug(enabled bool) Option {
+	return func(c *Config) {
+		c.Debug = enabled
+	}
+}
+
+// WithDebugHeaders logs selected request and response headers of every fetch,
+// along with the extra headers named
+func WithDebugHeaders(enabled bool, extra ...string) Option {
+	return func(c *Config) {
+		c.DebugHeaders = enabled
+		c.DebugHeaderNames = extra
+	}
+}
+
+// WithRedactQueryParams sets the query parameter name fragments redacted from logged URLs
+func WithRedactQueryParams(params ...string) Option {
+	return func(c *Config) {
+		c.RedactQueryParams = params
+	}
+}
+
+// WithDefaultMaxLength sets the max_length applied when clients omit it. Zero means unlimited.
+func WithDefaultMaxLength(maxLength int) Option {
+	return func(c *Config) {
+		c.DefaultMaxLength = maxLength
+	}
+}
+
+// WithMaxMaxLength caps every max_length, requested or defaulted. Zero means no cap.
+func WithMaxMaxLength(maxLength int) Option {
+	return func(c *Config) {
+		c.MaxMaxLength = maxLength
+	}
+}
+
+// WithMaxBytes caps the response body bytes downloaded per fetch. Zero means no cap.
+func WithMaxBytes(maxBytes int) Option {
+	return func(c *Config) {
+		c.MaxBytes = maxBytes
+	}
+}
+
+// WithMaxResultSize sets the most characters of a fetch result sent in one
+// message, beyond which the rest is served as resources. Zero means no limit.
+func WithMaxResultSize(size int) Option {
+	return func(c *Config) {
+		c.MaxResultSize = size
+	}
+}
+
+// WithSessionByteQuota caps the response body bytes the fetches of one MCP
+// session may download. Zero means no quota.
+func WithSessionByteQuota(quota int64) Option {
+	return func(c *Config) {
+		c.SessionByteQuota = quota
+	}
+}
+
+// WithBasePath sets the path prefix for all HTTP endpoints. Leading and
+// trailing slashes are normalized.
+func WithBasePath(basePath string) Option {
+	return func(c *Config) {
+		c.BasePath = basePath
+	}
+}
+
+// WithEventRetention sets how long and how many bytes of streamable HTTP
+// events are kept per session so clients can resume dropped streams
+func WithEventRetention(retention time.Duration, maxBytes int) Option {
+	return func(c *Config) {
+		c.EventRetention = retention
+		c.EventRetentionBytes = maxBytes
+	}
+}
+
+// WithSessionTimeouts sets how long a session may stay silent before it is
+// pinged, and how long it then has to answer before it is closed
+func WithSessionTimeouts(idle, ping time.Duration) Option {
+	return func(c *Config) {
+		c.SessionIdleTimeout = idle
+		c.SessionPingTimeout = ping
+	}
+}
+
+// WithSelfTest makes the server check that it can run, fetching canaryURL
+// when it is not empty, and exit with a report instead of serving
+func WithSelfTest(enabled bool, canaryURL string) Option {
+	return func(c *Config) {
+		c.SelfTest = enabled
+		c.SelfTestURL = canaryURL
+	}
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDefaults(t *testing.T) {
+	config, err := New()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parsed, err := ParseFlagsFromArgs(flag.NewFlagSet("test", flag.ContinueOnError), nil, noEnv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(config, parsed) {
+		t.Errorf("expected New() and ParseFlags defaults to match:\nNew:        %+v\nParseFlags: %+v", config, parsed)
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	config, err := New(
+		WithPort(9090),
+		WithTransport(TransportSSE),
+		WithUserAgent("EmbeddedBot/1.0"),
+		WithRobotsUserAgent("EmbeddedRobotsBot"),
+		WithIgnoreRobots(true),
+		WithRespectRobotsMeta(true),
+		WithStripTrackingParams(true),
+		WithRewriteKnownHosts(true),
+		WithDisableTitleHeader(true),
+		WithDisableReadability(true),
+		WithAllowInlineHTML(true),
+		WithAllowMetadataEndpoints(true),
+		WithProxyURL("http://proxy:3128"),
+		WithRequireProxy(true),
+		WithSourceAddress("192.0.2.10"),
+		WithHostProfilesFile("/etc/gofetch/profiles.json"),
+		WithDNSOverHTTPS("https://dns.example.com/dns-query"),
+		WithFetchTimeout(time.Minute),
+		WithRobotsTimeout(5*time.Second),
+		WithStallTimeout(3*time.Second),
+		WithNegativeCacheTTL(0),
+		WithProcessingBudget(time.Second),
+		WithMaxConnsPerHost(4),
+		WithURLLimits(2048, 20),
+		WithDecompressionLimits(50, 1<<20),
+		WithOverloadThresholds(64, 10*time.Second),
+		WithCircuitBreaker(0, 20*time.Second, 45*time.Second),
+		WithEventRetention(time.Minute, 4096),
+		WithSessionTimeouts(2*time.Minute, 3*time.Second),
+		WithRedactQueryParams("sid"),
+		WithAllowedContentTypes("text/html", "application/*+json"),
+		WithContentProcessors("text/csv=table"),
+		WithRateLimit(60, "10.0.0.1"),
+		WithDefaultMaxLength(5000),
+		WithMaxMaxLength(100000),
+		WithMaxBytes(1<<20),
+		WithMaxResultSize(500000),
+		WithSessionByteQuota(10<<20),
+		WithBatchLimits(5, 2<<20),
+		WithResponseHeaderLimits(64<<10, 64),
+		WithDebugHeaders(true, "Via"),
+		WithSelfTest(true, "https://example.com/canary"),
+		WithDebug(true),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Config{
+		Port:                   9090,
+		UserAgent:              "EmbeddedBot/1.0",
+		RobotsUserAgent:        "EmbeddedRobotsBot",
+		IgnoreRobots:           true,
+		RespectRobotsMeta:      true,
+		StripTrackingParams:    true,
+		RewriteKnownHosts:      true,
+		DisableTitleHeader:     true,
+		DisableReadability:     true,
+		AllowInlineHTML:        true,
+		AllowMetadataEndpoints: true,
+		ProxyURL:               "http://proxy:3128",
+		RequireProxy:           true,
+		SourceAddress:          "192.0.2.10",
+		HostProfilesFile:       "/etc/gofetch/profiles.json",
+		DNSOverHTTPS:           "https://dns.example.com/dns-query",
+		Transport:              TransportSSE,
+		FetchTimeout:           time.Minute,
+		RobotsTimeout:          5 * time.Second,
+		StallTimeout:           3 * time.Second,
+		ProcessingBudget:       time.Second,
+		MaxConnsPerHost:        4,
+		MaxURLLength:           2048,
+		MaxQueryParams:         20,
+		MaxDecompressionRatio:  50,
+		MaxDecompressedBytes:   1 << 20,
+		OverloadMaxInFlight:    64,
+		OverloadQueueWait:      10 * time.Second,
+		CircuitWindow:          20 * time.Second,
+		CircuitCooldown:        45 * time.Second,
+		EventRetention:         time.Minute,
+		EventRetentionBytes:    4096,
+		SessionIdleTimeout:     2 * time.Minute,
+		SessionPingTimeout:     3 * time.Second,
+		RedactQueryParams:      []string{"sid"},
+		AllowedContentTypes:    []string{"text/html", "application/*+json"},
+		ContentProcessors:      []string{"text/csv=table"},
+		RateLimit:              60,
+		TrustedProxies:         []string{"10.0.0.1"},
+		DefaultMaxLength:       5000,
+		MaxMaxLength:           100000,
+		MaxBytes:               1 << 20,
+		MaxResultSize:          500000,
+		SessionByteQuota:       10 << 20,
+		MaxBatchURLs:           5,
+		MaxBatchBytes:          2 << 20,
+		MaxResponseHeaderBytes: 64 << 10,
+		MaxResponseHeaders:     64,
+		DebugHeaders:           true,
+		DebugHeaderNames:       []string{"Via"},
+		SelfTest:               true,
+		SelfTestURL:            "https://example.com/canary",
+		Debug:                  true,
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config)
+	}
+}
+
+func TestNewEmptyUserAgentUsesDefault(t *testing.T) {
+	config, err := New(WithUserAgent(""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.UserAgent != DefaultUA {
+		t.Errorf("expected default user agent, got %q", config.UserAgent)
+	}
+}
+
+func TestNewValidates(t *testing.T) {
+	config, err := New(WithPort(-1))
+	if err == nil || !strings.Contains(err.Error(), "-port") {
+		t.Errorf("expected port validation error, got %v", err)
+	}
+	if config.Port != -1 {
+		t.Errorf("expected the invalid configuration returned with the error, got port %d", config.Port)
+	}
+}
+
+func ExampleNew() {
+	cfg, err := New(
+		WithTransport(TransportSSE),
+		WithPort(9090),
+		WithUserAgent("EmbeddedBot/1.0"),
+	)
+	if err != nil {
+		fmt.Println("invalid configuration:", err)
+		return
+	}
+
+	fmt.Println(cfg.Transport, cfg.Port, cfg.UserAgent, cfg.FetchTimeout)
+	// Output: sse 9090 EmbeddedBot/1.0 30s
+}
@@ -0,0 +1,260 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+)
+
+// Defaults for CircuitBreaker
+const (
+	DefaultCircuitWindow   = time.Minute
+	DefaultCircuitCooldown = 30 * time.Second
+)
+
+// maxCircuitHosts bounds the hosts whose failures are tracked. Past it, hosts
+// with a closed circuit are forgotten.
+const maxCircuitHosts = 10000
+
+// CircuitBreaker configures the per-host circuit breaker. After Failures
+// consecutive failures of a host within Window, fetches to it fail at once
+// for Cooldown. A single probe fetch is then let through: its success closes
+// the circuit and its failure opens it again.
+type CircuitBreaker struct {
+	// Failures is the number of consecutive failures that opens a host's
+	// circuit. Zero disables the breaker.
+	Failures int
+	// Window is the time the failures must fall within. Zero selects
+	// DefaultCircuitWindow.
+	Window time.Duration
+	// Cooldown is how long an open circuit fails fetches before a probe is
+	// allowed. Zero selects DefaultCircuitCooldown.
+	Cooldown time.Duration
+}
+
+// Circuit states reported by DomainStats
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// CircuitOpenError is the cause of a KindCircuitOpen failure
+type CircuitOpenError struct {
+	Host string
+	// Failures is the number of consecutive failures that opened the circuit
+	Failures int
+	// RetryAfter is how long until a probe fetch is allowed, zero while a
+	// probe is in progress
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.RetryAfter <= 0 {
+		return fmt.Sprintf("%s failed %d times in a row and is being probed; not fetching until the probe succeeds",
+			e.Host, e.Failures)
+	}
+	return fmt.Sprintf("%s failed %d times in a row; not fetching from it for another %s",
+		e.Host, e.Failures, e.RetryAfter.Round(time.Second))
+}
+
+// circuitBreaker tracks the health of each host fetched from. It is safe for
+// concurrent use.
+type circuitBreaker struct {
+	settings CircuitBreaker
+	now      func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*hostCircuit
+}
+
+// hostCircuit is the breaker state of one host
+type hostCircuit struct {
+	state        string
+	failures     int
+	firstFailure time.Time
+	// openUntil is when an open circuit lets a probe through
+	openUntil time.Time
+	probing   bool
+}
+
+// newCircuitBreaker returns a breaker with settings, or nil when
+// settings.Failures is not positive. A nil breaker allows every fetch.
+func newCircuitBreaker(settings CircuitBreaker) *circuitBreaker {
+	if settings.Failures <= 0 {
+		return nil
+	}
+	if settings.Window == 0 {
+		settings.Window = DefaultCircuitWindow
+	}
+	if settings.Cooldown == 0 {
+		settings.Cooldown = DefaultCircuitCooldown
+	}
+	return &circuitBreaker{settings: settings, now: time.Now, hosts: make(map[string]*hostCircuit)}
+}
+
+// circuitHost returns the host:port a URL's circuit is kept for, or an empty
+// string when it has none
+func circuitHost(rawURL string) string {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return hostKey(parsed)
+}
+
+// circuitOutcome classifies a fetch result for the breaker: a failure counts
+// towards opening the circuit, and a success, which includes any answer from
+// the host other than a server error, closes it. Failures that happen before
+// the host is contacted are neither.
+func circuitOutcome(err error) (failure, success bool) {
+	var fetchErr *FetchError
+	if err == nil {
+		return false, true
+	}
+	if !errors.As(err, &fetchErr) {
+		return false, false
+	}
+	switch fetchErr.Kind {
+	case KindNetwork, KindDNSFailure:
+		return true, false
+	case KindHTTPStatus:
+		return fetchErr.StatusCode >= http.StatusInternalServerError, fetchErr.StatusCode < http.StatusInternalServerError
+	case KindRobotsBlocked, KindPolicy, KindProcessing, KindBotProtection:
+		return false, true
+	case KindTooLarge, KindInvalidURL, KindInvalidRequest, KindCircuitOpen, KindCanceled:
+		return false, false
+	}
+	return false, false
+}
+
+// allow returns a *CircuitOpenError when fetches to host should fail at
+// once. When an open circuit's cooldown has passed, the first caller is let
+// through as the probe and the circuit becomes half-open.
+func (b *circuitBreaker) allow(host string) error {
+	if b == nil || host == "" {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	circuit, ok := b.hosts[host]
+	if !ok {
+		return nil
+	}
+	now := b.now()
+	switch circuit.state {
+	case CircuitOpen:
+		if now.Before(circuit.openUntil) {
+			return &CircuitOpenError{Host: host, Failures: circuit.failures, RetryAfter: circuit.openUntil.Sub(now)}
+		}
+		circuit.state = CircuitHalfOpen
+		circuit.probing = true
+		log.Printf("Circuit for %s is half-open, probing with the next fetch", host)
+	case CircuitHalfOpen:
+		if circuit.probing {
+			return &CircuitOpenError{Host: host, Failures: circuit.failures}
+		}
+		circuit.probing = true
+	}
+	return nil
+}
+
+// record updates host's circuit with the outcome of a fetch that allow let
+// through. It reports whether the circuit opened.
+func (b *circuitBreaker) record(host string, err error) (opened bool) {
+	if b == nil || host == "" {
+		return false
+	}
+	failure, success := circuitOutcome(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	circuit, ok := b.hosts[host]
+	switch {
+	case !ok && !failure:
+		return false
+	case !ok:
+		b.makeRoom()
+		circuit = &hostCircuit{state: CircuitClosed}
+		b.hosts[host] = circuit
+	}
+
+	now := b.now()
+	switch {
+	case circuit.state == CircuitHalfOpen && failure:
+		circuit.probing = false
+		b.open(host, circuit, now)
+		return true
+	case success:
+		if circuit.state != CircuitClosed {
+			log.Printf("Circuit for %s closed after a successful probe", host)
+		}
+		delete(b.hosts, host)
+	case failure && circuit.state == CircuitClosed:
+		if circuit.failures == 0 || now.Sub(circuit.firstFailure) > b.settings.Window {
+			circuit.failures = 0
+			circuit.firstFailure = now
+		}
+		circuit.failures++
+		if circuit.failures >= b.settings.Failures {
+			b.open(host, circuit, now)
+			return true
+		}
+	default:
+		// Neither outcome: a probe that never reached the host makes way for
+		// the next one
+		circuit.probing = false
+	}
+	return false
+}
+
+// open opens host's circuit for the cooldown. The caller holds mu.
+func (b *circuitBreaker) open(host string, circuit *hostCircuit, now time.Time) {
+	circuit.state = CircuitOpen
+	circuit.openUntil = now.Add(b.settings.Cooldown)
+	log.Printf("Circuit for %s opened after %d consecutive failures, failing fetches for %s",
+		host, circuit.failures, b.settings.Cooldown)
+}
+
+// makeRoom forgets closed circuits once maxCircuitHosts hosts are tracked.
+// The caller holds mu.
+func (b *circuitBreaker) makeRoom() {
+	if len(b.hosts) < maxCircuitHosts {
+		return
+	}
+	for host, circuit := range b.hosts {
+		if circuit.state == CircuitClosed {
+			delete(b.hosts, host)
+		}
+	}
+}
+
+// state returns the state of the least healthy circuit among the hosts with
+// the given hostname, on any port
+func (b *circuitBreaker) state(hostname string) string {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := CircuitClosed
+	for host, circuit := range b.hosts {
+		if (&neturl.URL{Host: host}).Hostname() != hostname {
+			continue
+		}
+		switch {
+		case circuit.state == CircuitOpen:
+			return CircuitOpen
+		case circuit.state == CircuitHalfOpen:
+			state = CircuitHalfOpen
+		}
+	}
+	return state
+}
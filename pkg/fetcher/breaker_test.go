@@ -0,0 +1,195 @@
+package fetcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+// newTestBreaker returns a breaker whose clock is advanced through the
+// returned pointer
+func newTestBreaker(settings CircuitBreaker) (*circuitBreaker, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := newCircuitBreaker(settings)
+	breaker.now = func() time.Time { return now }
+	return breaker, &now
+}
+
+func TestCircuitBreakerLifecycle(t *testing.T) {
+	breaker, now := newTestBreaker(CircuitBreaker{Failures: 3, Window: time.Minute, Cooldown: 30 * time.Second})
+	const host = "example.com"
+	failure := newFetchError(KindNetwork, "https://example.com/", errors.New("connection refused"))
+
+	for i := range 3 {
+		if err := breaker.allow(host); err != nil {
+			t.Fatalf("fetch %d: expected the closed circuit to allow it, got %v", i, err)
+		}
+		opened := breaker.record(host, failure)
+		if opened != (i == 2) {
+			t.Fatalf("fetch %d: expected opened %v, got %v", i, i == 2, opened)
+		}
+	}
+	if state := breaker.state(host); state != CircuitOpen {
+		t.Fatalf("expected an open circuit, got %s", state)
+	}
+
+	*now = now.Add(10 * time.Second)
+	var openErr *CircuitOpenError
+	err := breaker.allow(host)
+	if !errors.As(err, &openErr) || openErr.RetryAfter != 20*time.Second || !strings.Contains(err.Error(), "another 20s") {
+		t.Fatalf("expected an open circuit error with 20s left, got %v", err)
+	}
+
+	// After the cooldown a single probe is let through
+	*now = now.Add(20 * time.Second)
+	if err := breaker.allow(host); err != nil {
+		t.Fatalf("expected the probe to be allowed, got %v", err)
+	}
+	if state := breaker.state(host); state != CircuitHalfOpen {
+		t.Fatalf("expected a half-open circuit, got %s", state)
+	}
+	if err := breaker.allow(host); !errors.As(err, &openErr) || !strings.Contains(err.Error(), "is being probed") {
+		t.Fatalf("expected fetches during the probe to fail, got %v", err)
+	}
+
+	// A failed probe opens the circuit again
+	if !breaker.record(host, failure) {
+		t.Fatal("expected the failed probe to reopen the circuit")
+	}
+	if err := breaker.allow(host); err == nil {
+		t.Fatal("expected the reopened circuit to refuse fetches")
+	}
+
+	// A successful probe closes it
+	*now = now.Add(30 * time.Second)
+	if err := breaker.allow(host); err != nil {
+		t.Fatalf("expected the second probe to be allowed, got %v", err)
+	}
+	if breaker.record(host, nil) {
+		t.Error("expected a success not to open the circuit")
+	}
+	if state := breaker.state(host); state != CircuitClosed {
+		t.Fatalf("expected a closed circuit, got %s", state)
+	}
+	if err := breaker.allow(host); err != nil {
+		t.Errorf("expected the closed circuit to allow fetches, got %v", err)
+	}
+}
+
+func TestCircuitBreakerCountsConsecutiveFailuresInWindow(t *testing.T) {
+	failure := &FetchError{Kind: KindHTTPStatus, StatusCode: http.StatusBadGateway}
+	tests := []struct {
+		name     string
+		outcomes func(breaker *circuitBreaker, now *time.Time)
+	}{
+		{
+			name: "success in between",
+			outcomes: func(breaker *circuitBreaker, _ *time.Time) {
+				breaker.record("example.com", failure)
+				breaker.record("example.com", nil)
+				breaker.record("example.com", failure)
+			},
+		},
+		{
+			name: "client error in between",
+			outcomes: func(breaker *circuitBreaker, _ *time.Time) {
+				breaker.record("example.com", failure)
+				breaker.record("example.com", &FetchError{Kind: KindHTTPStatus, StatusCode: http.StatusNotFound})
+				breaker.record("example.com", failure)
+			},
+		},
+		{
+			name: "outside the window",
+			outcomes: func(breaker *circuitBreaker, now *time.Time) {
+				breaker.record("example.com", failure)
+				*now = now.Add(2 * time.Minute)
+				breaker.record("example.com", failure)
+			},
+		},
+		{
+			name: "other host",
+			outcomes: func(breaker *circuitBreaker, _ *time.Time) {
+				breaker.record("example.com", failure)
+				breaker.record("example.com:8080", failure)
+			},
+		},
+		{
+			name: "failures before contacting the host",
+			outcomes: func(breaker *circuitBreaker, _ *time.Time) {
+				breaker.record("example.com", failure)
+				breaker.record("example.com", &FetchError{Kind: KindInvalidRequest})
+				breaker.record("example.com", &FetchError{Kind: KindTooLarge})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker, now := newTestBreaker(CircuitBreaker{Failures: 2, Window: time.Minute})
+			tt.outcomes(breaker, now)
+			if state := breaker.state("example.com"); state != CircuitClosed {
+				t.Errorf("expected a closed circuit, got %s", state)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	breaker := newCircuitBreaker(CircuitBreaker{})
+	if breaker != nil {
+		t.Fatal("expected no breaker for zero failures")
+	}
+	for range 10 {
+		breaker.record("example.com", &FetchError{Kind: KindNetwork})
+	}
+	if err := breaker.allow("example.com"); err != nil {
+		t.Errorf("expected a disabled breaker to allow fetches, got %v", err)
+	}
+}
+
+func TestFetchURLCircuitBreaker(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+			return
+		}
+		requests++
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	fetcher := New(
+		WithHTTPClient(client),
+		WithRobots(robots.NewChecker("TestBot/1.0", "", false, false, client)),
+		WithProcessor(processor.NewContentProcessor(processor.Options{DisableTitleHeader: true})),
+		WithCircuitBreaker(CircuitBreaker{Failures: 2, Cooldown: time.Hour}),
+	)
+
+	for i := range 2 {
+		if _, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page"}); !errors.Is(err, KindHTTPStatus) {
+			t.Fatalf("fetch %d: expected an HTTP status error, got %v", i, err)
+		}
+	}
+	_, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/other"})
+	var openErr *CircuitOpenError
+	if !errors.Is(err, KindCircuitOpen) || !errors.As(err, &openErr) || openErr.Failures != 2 {
+		t.Fatalf("expected a circuit open error, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected the open circuit to spare the origin, got %d requests", requests)
+	}
+
+	stats, _ := fetcher.DomainStats(1)
+	if len(stats) != 1 || stats[0].CircuitOpens != 1 || stats[0].CircuitRejections != 1 ||
+		stats[0].Errors != 3 || stats[0].Circuit != CircuitOpen {
+		t.Errorf("expected one open and one rejection on an open circuit, got %+v", stats)
+	}
+}
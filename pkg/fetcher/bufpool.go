@@ -0,0 +1,41 @@
+package fetcher
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize is the largest buffer returned to the pool. Bodies
+// bigger than this are read into a buffer that is left to the GC, so one
+// huge page does not pin its memory for the life of the process.
+const maxPooledBufferSize = 8 << 20
+
+// bodyBufferPool holds *bytes.Buffer values reused across response reads
+var bodyBufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// readBody reads r into a pooled buffer, sized up front from contentLength
+// when the server declared one. The caller must pass the buffer to
+// releaseBody once it no longer references its bytes.
+func readBody(r io.Reader, contentLength int64) (*bytes.Buffer, error) {
+	buf := bodyBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if contentLength > 0 {
+		// bytes.Buffer.ReadFrom grows the buffer whenever less than 512
+		// bytes are free, so leave room for it to detect EOF without growing
+		buf.Grow(int(min(contentLength, maxPooledBufferSize)) + bytes.MinRead)
+	}
+	_, err := buf.ReadFrom(r)
+	return buf, err
+}
+
+// releaseBody returns a buffer obtained from readBody to the pool
+func releaseBody(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bodyBufferPool.Put(buf)
+}
@@ -0,0 +1,48 @@
+package fetcher
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadBody(t *testing.T) {
+	content := strings.Repeat("pooled body ", 10000)
+
+	for _, contentLength := range []int64{-1, 0, int64(len(content)), 10} {
+		buf, err := readBody(strings.NewReader(content), contentLength)
+		if err != nil {
+			t.Fatalf("content length %d: unexpected error: %v", contentLength, err)
+		}
+		if buf.String() != content {
+			t.Errorf("content length %d: body was not read completely", contentLength)
+		}
+		releaseBody(buf)
+	}
+}
+
+func TestReadBodyPresizesFromContentLength(t *testing.T) {
+	content := strings.Repeat("x", 100000)
+
+	buf, err := readBody(strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer releaseBody(buf)
+
+	// A single allocation sized from Content-Length leaves no room for doubling
+	if buf.Cap() >= 2*len(content) {
+		t.Errorf("expected capacity close to %d, got %d", len(content), buf.Cap())
+	}
+}
+
+func TestReleaseBodySkipsOversizedBuffers(t *testing.T) {
+	large := bytes.NewBuffer(make([]byte, 0, maxPooledBufferSize+1))
+	releaseBody(large)
+
+	for range 10 {
+		if buf := bodyBufferPool.Get().(*bytes.Buffer); buf == large {
+			t.Fatal("expected oversized buffer not to be pooled")
+		}
+	}
+}
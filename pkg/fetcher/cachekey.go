@@ -0,0 +1,74 @@
+package fetcher
+
+import (
+	neturl "net/url"
+	"slices"
+	"strings"
+)
+
+// trackingParams are query parameters added by analytics and ad platforms that
+// do not change the content of a page
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"igshid":  true,
+}
+
+// defaultPorts maps schemes to the port their URLs imply
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// IsTrackingParam reports whether the query parameter name, which is matched
+// case-insensitively, is a utm_* or other tracking parameter
+func IsTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+// cacheKey returns the key under which the outcome of fetching rawURL is
+// cached, so that URLs differing only in ways that cannot change the response
+// share an entry. The scheme and host are lowercased, default ports dropped,
+// an empty path becomes "/", tracking parameters are removed, the remaining
+// query parameters are sorted and the fragment, which is never sent, is
+// dropped. The path is left as is, since servers may treat its case and
+// encoding as significant, and so are the encodings of query parameters.
+// URLs that cannot be parsed are their own key. The original URL is still
+// the one requested.
+func cacheKey(rawURL string) string {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return rawURL
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = hostKey(parsed)
+
+	if parsed.Path == "" && parsed.RawPath == "" {
+		parsed.Path = "/"
+	}
+	parsed.Fragment, parsed.RawFragment = "", ""
+
+	var kept []string
+	for pair := range strings.SplitSeq(parsed.RawQuery, "&") {
+		rawName, _, _ := strings.Cut(pair, "=")
+		name := rawName
+		if unescaped, err := neturl.QueryUnescape(rawName); err == nil {
+			name = unescaped
+		}
+		if pair == "" || IsTrackingParam(name) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	slices.Sort(kept)
+	parsed.RawQuery = strings.Join(kept, "&")
+	parsed.ForceQuery = false
+
+	return parsed.String()
+}
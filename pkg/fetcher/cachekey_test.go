@@ -0,0 +1,144 @@
+package fetcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+func TestCacheKeyEquivalenceClasses(t *testing.T) {
+	// Every URL in a class shares the class's key; different classes do not
+	classes := []struct {
+		key  string
+		urls []string
+	}{
+		{
+			key: "http://example.com/",
+			urls: []string{
+				"http://example.com",
+				"http://example.com/",
+				"HTTP://EXAMPLE.com:80/",
+				"http://example.com:80/?utm_source=x",
+				"http://example.com/?",
+				"http://example.com/#top",
+				"http://Example.COM?fbclid=abc&UTM_Medium=y",
+			},
+		},
+		{
+			key:  "https://example.com/",
+			urls: []string{"https://example.com", "https://example.com:443/", "HTTPS://example.com?gclid=z"},
+		},
+		{
+			key:  "http://example.com:8080/",
+			urls: []string{"http://example.com:8080", "http://EXAMPLE.COM:8080/"},
+		},
+		{
+			key: "https://example.com/search?a=1&b=2",
+			urls: []string{
+				"https://example.com/search?a=1&b=2",
+				"https://example.com/search?b=2&a=1",
+				"https://example.com/search?b=2&utm_campaign=spring&a=1",
+				"https://example.com/search?a=1&&b=2",
+			},
+		},
+		{
+			// Path case and encoding are significant to many servers
+			key:  "https://example.com/Docs/Read%20Me",
+			urls: []string{"https://example.com/Docs/Read%20Me", "https://EXAMPLE.com:443/Docs/Read%20Me"},
+		},
+		{key: "https://example.com/docs/read%20me", urls: []string{"https://example.com/docs/read%20me", "https://example.com/docs/read me"}},
+		{
+			// So are the encodings of query parameters
+			key:  "https://example.com/search?q=go+lang",
+			urls: []string{"https://example.com/search?q=go+lang"},
+		},
+		{key: "https://example.com/search?q=go%20lang", urls: []string{"https://example.com/search?q=go%20lang"}},
+		{
+			key:  "http://[2001:db8::1]/",
+			urls: []string{"http://[2001:db8::1]", "http://[2001:DB8::1]:80/"},
+		},
+		{key: "http://[2001:db8::1]:8080/", urls: []string{"http://[2001:db8::1]:8080"}},
+		{key: "http://user@example.com/", urls: []string{"http://user@EXAMPLE.com"}},
+		{
+			// Unparseable URLs are their own key
+			key:  "http://[::1",
+			urls: []string{"http://[::1"},
+		},
+	}
+
+	seen := make(map[string]string)
+	for _, class := range classes {
+		for _, rawURL := range class.urls {
+			if got := cacheKey(rawURL); got != class.key {
+				t.Errorf("cacheKey(%q) = %q, expected %q", rawURL, got, class.key)
+			}
+		}
+		if other, ok := seen[class.key]; ok {
+			t.Errorf("classes %q and %q share a key", other, class.key)
+		}
+		seen[class.key] = class.key
+	}
+}
+
+func TestIsTrackingParam(t *testing.T) {
+	tests := map[string]bool{
+		"utm_source": true,
+		"UTM_Medium": true,
+		"fbclid":     true,
+		"GCLID":      true,
+		"utm":        false,
+		"id":         false,
+		"q":          false,
+	}
+	for name, expected := range tests {
+		if got := IsTrackingParam(name); got != expected {
+			t.Errorf("IsTrackingParam(%q) = %v, expected %v", name, got, expected)
+		}
+	}
+}
+
+func TestNegativeCacheUsesCanonicalKeys(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+			return
+		}
+		requests.Add(1)
+		if r.URL.RawQuery != "b=2&utm_source=x&a=1" {
+			t.Errorf("expected the original query to be requested, got %q", r.URL.RawQuery)
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	fetcher := New(
+		WithHTTPClient(client),
+		WithRobots(robots.NewChecker("TestBot/1.0", "", false, false, client)),
+		WithProcessor(processor.NewContentProcessor(processor.Options{DisableTitleHeader: true})),
+		WithNegativeCacheTTL(time.Minute),
+	)
+
+	_, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page?b=2&utm_source=x&a=1"})
+	if !errors.Is(err, KindHTTPStatus) {
+		t.Fatalf("expected the 404, got %v", err)
+	}
+
+	variant := strings.Replace(server.URL, "http://", "HTTP://", 1) + "/page?a=1&b=2#section"
+	_, err = fetcher.FetchURL(t.Context(), &FetchRequest{URL: variant})
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || !fetchErr.Cached {
+		t.Errorf("expected the equivalent URL to get the cached failure, got %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected one request, got %d", n)
+	}
+}
@@ -0,0 +1,57 @@
+package fetcher
+
+import (
+	"bytes"
+	neturl "net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// canonicalURL returns the absolute target of the first <link rel="canonical">
+// in the document head, resolved against base. It returns an empty string when
+// there is none or its href is not a usable http(s) URL.
+func canonicalURL(body []byte, base *neturl.URL) string {
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.DataAtom {
+			case atom.Body:
+				return ""
+			case atom.Link:
+				var rel, href string
+				for _, attr := range token.Attr {
+					switch strings.ToLower(attr.Key) {
+					case "rel":
+						rel = attr.Val
+					case "href":
+						href = attr.Val
+					}
+				}
+				if !hasToken(rel, "canonical") || strings.TrimSpace(href) == "" {
+					continue
+				}
+				resolved, err := base.Parse(strings.TrimSpace(href))
+				if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+					return ""
+				}
+				return resolved.String()
+			}
+		}
+	}
+}
+
+// hasToken reports whether the space-separated list contains token, ignoring case
+func hasToken(list, token string) bool {
+	for _, field := range strings.Fields(list) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package fetcher
+
+import (
+	neturl "net/url"
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	base, _ := neturl.Parse("https://example.com/news/story?ref=home")
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "absolute",
+			body:     `<head><link rel="canonical" href="https://example.org/story"></head>`,
+			expected: "https://example.org/story",
+		},
+		{
+			name:     "relative",
+			body:     `<head><link rel="alternate" href="/amp"><link rel="Canonical" href="/story/1"></head>`,
+			expected: "https://example.com/story/1",
+		},
+		{
+			name:     "rel with several tokens",
+			body:     `<link href="story" rel="nofollow canonical">`,
+			expected: "https://example.com/news/story",
+		},
+		{
+			name: "missing",
+			body: `<head><title>Story</title></head><body></body>`,
+		},
+		{
+			name: "only in body",
+			body: `<head></head><body><link rel="canonical" href="/story"></body>`,
+		},
+		{
+			name: "non-http scheme",
+			body: `<link rel="canonical" href="javascript:alert(1)">`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonicalURL([]byte(tt.body), base); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
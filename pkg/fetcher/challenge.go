@@ -0,0 +1,133 @@
+package fetcher
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxChallengeBytes bounds the pages checked for a bot protection challenge.
+// Challenge pages are small; a page larger than this is taken to be content.
+const maxChallengeBytes = 256 << 10
+
+// challengeStatuses are the statuses other than 200 that bot protection
+// services answer challenges with
+var challengeStatuses = map[int]bool{
+	http.StatusForbidden:          true,
+	http.StatusTooManyRequests:    true,
+	http.StatusServiceUnavailable: true,
+}
+
+// BotProtectionError is the cause of a KindBotProtection failure: the site
+// answered with a bot protection challenge or block page instead of the page
+type BotProtectionError struct {
+	// Vendor names the protection service, such as Cloudflare
+	Vendor string
+	// StatusCode is the status the challenge was served with
+	StatusCode int
+}
+
+// Error implements the error interface
+func (e *BotProtectionError) Error() string {
+	return fmt.Sprintf("the site answered with a %s bot protection challenge (HTTP %d) instead of the page",
+		e.Vendor, e.StatusCode)
+}
+
+// challengeSignature recognizes the challenge or block pages of one vendor.
+// A page matches when its title is one of titles, if any are listed, and
+// its body holds every one of markers, so a page that merely mentions the
+// vendor or loads its scripts is not mistaken for a challenge.
+type challengeSignature struct {
+	vendor  string
+	titles  []string
+	markers []string
+}
+
+// challengeSignatures are the challenge pages recognized, from the HTML the
+// vendors serve
+var challengeSignatures = []challengeSignature{
+	{vendor: "Cloudflare", titles: []string{"just a moment..."}, markers: []string{"/cdn-cgi/challenge-platform/"}},
+	{vendor: "Cloudflare", titles: []string{"attention required! | cloudflare"}, markers: []string{"cf-error-details"}},
+	{vendor: "Akamai", titles: []string{"access denied"}, markers: []string{"errors.edgesuite.net"}},
+	{vendor: "DataDome", markers: []string{"captcha-delivery.com", "var dd={"}},
+	{vendor: "PerimeterX", titles: []string{"access to this page has been denied"}, markers: []string{"px-captcha"}},
+}
+
+// challengeVendor returns the vendor whose challenge the response is, or an
+// empty string. Cloudflare marks its challenges with a cf-mitigated header;
+// other responses need an HTML body matching one of challengeSignatures.
+func challengeVendor(header http.Header, body []byte) string {
+	if strings.EqualFold(header.Get("Cf-Mitigated"), "challenge") || header.Get("Cf-Chl-Bypass") != "" {
+		return "Cloudflare"
+	}
+	if len(body) == 0 || len(body) > maxChallengeBytes || mediaTypeOf(header.Get("Content-Type")) != "text/html" {
+		return ""
+	}
+
+	content := strings.ToLower(html.UnescapeString(string(body)))
+	title := documentTitle(content)
+	for _, signature := range challengeSignatures {
+		if len(signature.titles) > 0 && !slices.Contains(signature.titles, title) {
+			continue
+		}
+		matched := true
+		for _, marker := range signature.markers {
+			matched = matched && strings.Contains(content, marker)
+		}
+		if matched {
+			return signature.vendor
+		}
+	}
+	return ""
+}
+
+// documentTitle returns the text of the first <title> in the document head,
+// with its whitespace collapsed
+func documentTitle(body string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken:
+			switch tokenizer.Token().DataAtom {
+			case atom.Body:
+				return ""
+			case atom.Title:
+				if tokenizer.Next() != html.TextToken {
+					return ""
+				}
+				return strings.Join(strings.Fields(tokenizer.Token().Data), " ")
+			}
+		}
+	}
+}
+
+// challengeBody reads the body of an error response to look for a challenge
+// in, decompressing it within the fetcher's limits. It reads one byte past
+// maxChallengeBytes so that larger bodies are not taken for challenges.
+func (f *HTTPFetcher) challengeBody(resp *http.Response) []byte {
+	var body io.Reader = io.LimitReader(resp.Body, maxChallengeBytes+1)
+	if gzipEncoded(resp.Header) {
+		decoded, err := decompressBody(body, f.decompression)
+		if err != nil {
+			return nil
+		}
+		body = io.LimitReader(decoded, maxChallengeBytes+1)
+	}
+	content, _ := io.ReadAll(body)
+	return content
+}
+
+// challengeError logs and returns the failure of a fetch of url answered
+// with vendor's challenge
+func (f *HTTPFetcher) challengeError(url, vendor string, statusCode int) *FetchError {
+	log.Printf("Bot protection challenge from %s for %s (status %d)", vendor, f.logURL(url), statusCode)
+	return newFetchError(KindBotProtection, url, &BotProtectionError{Vendor: vendor, StatusCode: statusCode})
+}
@@ -0,0 +1,110 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readChallenge(t *testing.T, name string) []byte {
+	t.Helper()
+	page, err := os.ReadFile(filepath.Join("testdata", "challenges", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return page
+}
+
+func TestChallengeVendor(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html; charset=UTF-8"}}
+	tests := map[string]string{
+		"cloudflare_challenge.html":     "Cloudflare",
+		"cloudflare_blocked.html":       "Cloudflare",
+		"akamai_denied.html":            "Akamai",
+		"datadome_captcha.html":         "DataDome",
+		"perimeterx_denied.html":        "PerimeterX",
+		"article_about_cloudflare.html": "",
+		"access_denied_help.html":       "",
+	}
+	for name, want := range tests {
+		if got := challengeVendor(html, readChallenge(t, name)); got != want {
+			t.Errorf("challengeVendor(%s) = %q, want %q", name, got, want)
+		}
+	}
+
+	page := readChallenge(t, "cloudflare_challenge.html")
+	if got := challengeVendor(http.Header{"Content-Type": {"text/plain"}}, page); got != "" {
+		t.Errorf("expected plain text never to be a challenge, got %q", got)
+	}
+	if got := challengeVendor(html, append(page, strings.Repeat(" ", maxChallengeBytes)...)); got != "" {
+		t.Errorf("expected a page over %d bytes never to be a challenge, got %q", maxChallengeBytes, got)
+	}
+	if got := challengeVendor(http.Header{"Cf-Mitigated": {"challenge"}}, nil); got != "Cloudflare" {
+		t.Errorf("expected the cf-mitigated header to name Cloudflare, got %q", got)
+	}
+}
+
+func TestFetchURLBotProtection(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(readChallenge(t, "akamai_denied.html"))
+	gz.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		switch r.URL.Path {
+		case "/cloudflare":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(readChallenge(t, "cloudflare_challenge.html"))
+		case "/mitigated":
+			w.Header().Set("Cf-Mitigated", "challenge")
+			w.WriteHeader(http.StatusForbidden)
+		case "/akamai":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(gzipped.Bytes())
+		case "/datadome":
+			w.Write(readChallenge(t, "datadome_captcha.html"))
+		case "/article":
+			w.Write(readChallenge(t, "article_about_cloudflare.html"))
+		case "/denied":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(readChallenge(t, "access_denied_help.html"))
+		}
+	}))
+	defer server.Close()
+
+	f := New(WithRobots(allowAll{}))
+	for path, want := range map[string]*BotProtectionError{
+		"/cloudflare": {Vendor: "Cloudflare", StatusCode: http.StatusForbidden},
+		"/mitigated":  {Vendor: "Cloudflare", StatusCode: http.StatusForbidden},
+		"/akamai":     {Vendor: "Akamai", StatusCode: http.StatusForbidden},
+		"/datadome":   {Vendor: "DataDome", StatusCode: http.StatusOK},
+	} {
+		for _, raw := range []bool{false, true} {
+			_, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + path, Raw: raw})
+			var challengeErr *BotProtectionError
+			if !errors.Is(err, KindBotProtection) || !errors.As(err, &challengeErr) || *challengeErr != *want {
+				t.Errorf("%s (raw %v): expected %+v, got %v", path, raw, want, err)
+			}
+		}
+	}
+
+	if _, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/article"}); err != nil {
+		t.Errorf("expected an article about challenges to be fetched, got %v", err)
+	}
+	if _, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/denied"}); !errors.Is(err, KindHTTPStatus) {
+		t.Errorf("expected an ordinary 403 page to be an HTTP status error, got %v", err)
+	}
+
+	stats, _ := f.DomainStats(0)
+	if len(stats) != 1 || stats[0].BotChallenges != 8 || stats[0].Errors != 9 {
+		t.Errorf("expected 8 challenges among 9 errors, got %+v", stats)
+	}
+}
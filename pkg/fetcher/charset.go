@@ -0,0 +1,58 @@
+package fetcher
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// fallbackCharset is reported by charset.DetermineEncoding when a document
+// declares no encoding at all
+const fallbackCharset = "windows-1252"
+
+// decodeBody converts a response body to UTF-8 and returns it together with the
+// name of the charset it was decoded from.
+//
+// A byte order mark or a charset parameter in the Content-Type header is always
+// honoured. HTML documents are additionally sniffed for a <meta charset> or
+// http-equiv declaration in their first 1024 bytes. Bodies that declare nothing
+// are treated as UTF-8, as they always have been. A body that needs no
+// decoding is returned as it is rather than copied.
+func decodeBody(body []byte, contentType string) ([]byte, string) {
+	enc, name, certain := charset.DetermineEncoding(body, contentType)
+
+	switch {
+	case name == "utf-8":
+		return trimBOM(body), name
+	case !certain && !isHTML(contentType):
+		// Only HTML can declare its charset in the document itself
+		return body, "utf-8"
+	case !certain && name == fallbackCharset && utf8.Valid(body):
+		// Nothing was declared in the sniffed prefix and the body is valid
+		// UTF-8, so keep it rather than reinterpreting it
+		return body, "utf-8"
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return body, "utf-8"
+	}
+	return trimBOM(decoded), name
+}
+
+// trimBOM drops a byte order mark that survived decoding
+func trimBOM(b []byte) []byte {
+	return bytes.TrimPrefix(b, []byte("\ufeff"))
+}
+
+// isHTML reports whether contentType names an HTML document
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.Contains(contentType, "text/html")
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
@@ -0,0 +1,131 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeBody(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            []byte
+		contentType     string
+		expected        string
+		expectedCharset string
+	}{
+		{
+			name:            "utf-8 without declaration",
+			body:            []byte("<p>Привет</p>"),
+			contentType:     "text/html",
+			expected:        "<p>Привет</p>",
+			expectedCharset: "utf-8",
+		},
+		{
+			name:            "header charset",
+			body:            []byte{0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2},
+			contentType:     "text/plain; charset=windows-1251",
+			expected:        "Привет",
+			expectedCharset: "windows-1251",
+		},
+		{
+			name:            "meta charset",
+			body:            append([]byte(`<meta charset="windows-1251"><p>`), 0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2),
+			contentType:     "text/html",
+			expected:        `<meta charset="windows-1251"><p>Привет`,
+			expectedCharset: "windows-1251",
+		},
+		{
+			name:            "header wins over meta",
+			body:            []byte(`<meta charset="windows-1251"><p>Привет`),
+			contentType:     "text/html; charset=utf-8",
+			expected:        `<meta charset="windows-1251"><p>Привет`,
+			expectedCharset: "utf-8",
+		},
+		{
+			name:            "byte order mark",
+			body:            []byte{0xfe, 0xff, 0x00, 'h', 0x00, 'i'},
+			contentType:     "text/html",
+			expected:        "hi",
+			expectedCharset: "utf-16be",
+		},
+		{
+			name:            "utf-8 byte order mark",
+			body:            []byte("\ufeff<p>hi</p>"),
+			contentType:     "text/html",
+			expected:        "<p>hi</p>",
+			expectedCharset: "utf-8",
+		},
+		{
+			name:            "meta ignored for non-HTML",
+			body:            []byte(`<meta charset="windows-1251">`),
+			contentType:     "text/plain",
+			expected:        `<meta charset="windows-1251">`,
+			expectedCharset: "utf-8",
+		},
+		{
+			name:            "utf-8 beyond the sniffed prefix",
+			body:            []byte(strings.Repeat("a", 2048) + "é"),
+			contentType:     "text/html",
+			expected:        strings.Repeat("a", 2048) + "é",
+			expectedCharset: "utf-8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, charsetName := decodeBody(tt.body, tt.contentType)
+			if string(got) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if charsetName != tt.expectedCharset {
+				t.Errorf("expected charset %q, got %q", tt.expectedCharset, charsetName)
+			}
+		})
+	}
+}
+
+func TestFetchURLDecodesMetaCharset(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		expected []string
+	}{
+		{
+			fixture:  "windows-1251.html",
+			expected: []string{"Привет, мир", "Это тестовая страница в кодировке windows-1251."},
+		},
+		{fixture: "shift_jis.html", expected: []string{"こんにちは世界", "のテストページです。"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			page, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatalf("failed to read fixture: %v", err)
+			}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				// No charset in the header, only in the document
+				w.Header().Set("Content-Type", "text/html")
+				w.Write(page)
+			}))
+			defer server.Close()
+
+			fetcher := createTestFetcher()
+			for _, raw := range []bool{false, true} {
+				result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL, Raw: raw})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				for _, want := range tt.expected {
+					if !strings.Contains(result.Content, want) {
+						t.Errorf("raw=%v: expected content to contain %q, got %q", raw, want, result.Content)
+					}
+				}
+			}
+		})
+	}
+}
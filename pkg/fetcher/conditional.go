@@ -0,0 +1,49 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/http"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// conditions are the validators of a conditional request. The zero value
+// makes an unconditional request.
+type conditions struct {
+	ifNoneMatch     string
+	ifModifiedSince string
+}
+
+// newConditions validates the validators a client supplied. The entity tag
+// is sent verbatim; the date is accepted in any HTTP date format and sent in
+// the preferred one.
+func newConditions(ifNoneMatch, ifModifiedSince string) (conditions, error) {
+	if ifNoneMatch != "" && !httpguts.ValidHeaderFieldValue(ifNoneMatch) {
+		return conditions{}, fmt.Errorf("invalid if_none_match %q: must be a valid header value", ifNoneMatch)
+	}
+	c := conditions{ifNoneMatch: ifNoneMatch}
+	if ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return conditions{}, fmt.Errorf("invalid if_modified_since %q: must be an HTTP date such as %s",
+				ifModifiedSince, "Mon, 02 Jan 2006 15:04:05 GMT")
+		}
+		c.ifModifiedSince = since.UTC().Format(http.TimeFormat)
+	}
+	return c, nil
+}
+
+// conditional reports whether any validator is set
+func (c conditions) conditional() bool {
+	return c.ifNoneMatch != "" || c.ifModifiedSince != ""
+}
+
+// apply sets the validators on a request's headers
+func (c conditions) apply(header http.Header) {
+	if c.ifNoneMatch != "" {
+		header.Set("If-None-Match", c.ifNoneMatch)
+	}
+	if c.ifModifiedSince != "" {
+		header.Set("If-Modified-Since", c.ifModifiedSince)
+	}
+}
@@ -0,0 +1,135 @@
+package fetcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// createConditionalServer serves a page with validators and answers 304 Not
+// Modified when the request's validators match them
+func createConditionalServer(t *testing.T, received *http.Header) *httptest.Server {
+	t.Helper()
+	const etag = `W/"v1"`
+	const lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		*received = r.Header.Clone()
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-None-Match") == etag || r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("page content"))
+	}))
+}
+
+func TestFetchURLConditional(t *testing.T) {
+	var received http.Header
+	server := createConditionalServer(t, &received)
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		ifNoneMatch     string
+		ifModifiedSince string
+		sentSince       string
+		notModified     bool
+	}{
+		{name: "unconditional"},
+		{name: "matching etag", ifNoneMatch: `W/"v1"`, notModified: true},
+		{name: "changed etag", ifNoneMatch: `"v0"`},
+		{
+			name: "matching date", ifModifiedSince: "Wed, 21 Oct 2015 07:28:00 GMT",
+			sentSince: "Wed, 21 Oct 2015 07:28:00 GMT", notModified: true,
+		},
+		{
+			// Older HTTP date formats are sent in the preferred one
+			name: "date normalized", ifModifiedSince: "Wednesday, 21-Oct-15 07:28:00 GMT",
+			sentSince: "Wed, 21 Oct 2015 07:28:00 GMT", notModified: true,
+		},
+	}
+
+	fetcher := createTestFetcher()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := fetcher.FetchURL(t.Context(), &FetchRequest{
+				URL:             server.URL,
+				IfNoneMatch:     tt.ifNoneMatch,
+				IfModifiedSince: tt.ifModifiedSince,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := received.Get("If-None-Match"); got != tt.ifNoneMatch {
+				t.Errorf("expected If-None-Match %q to be sent verbatim, got %q", tt.ifNoneMatch, got)
+			}
+			if got := received.Get("If-Modified-Since"); got != tt.sentSince {
+				t.Errorf("expected If-Modified-Since %q, got %q", tt.sentSince, got)
+			}
+			if result.NotModified != tt.notModified {
+				t.Errorf("expected NotModified %v, got %v", tt.notModified, result.NotModified)
+			}
+			if result.ETag != `W/"v1"` || result.LastModified != "Wed, 21 Oct 2015 07:28:00 GMT" {
+				t.Errorf("expected the response validators, got %q and %q", result.ETag, result.LastModified)
+			}
+
+			if tt.notModified {
+				if result.StatusCode != http.StatusNotModified || result.Content != "" || len(result.Warnings) != 0 {
+					t.Errorf("expected a 304 without content or warnings, got %+v", result)
+				}
+			} else if result.Content != "page content" {
+				t.Errorf("expected the page content, got %q", result.Content)
+			}
+		})
+	}
+
+	stats, _ := fetcher.DomainStats(1)
+	if len(stats) != 1 || stats[0].NotModified != 3 || stats[0].Fetches != int64(len(tests)) {
+		t.Errorf("expected 3 of %d fetches counted as not modified, got %+v", len(tests), stats)
+	}
+}
+
+func TestFetchURLInvalidConditions(t *testing.T) {
+	tests := []struct {
+		name            string
+		ifNoneMatch     string
+		ifModifiedSince string
+		expectedErr     string
+	}{
+		{name: "bad date", ifModifiedSince: "yesterday", expectedErr: `invalid if_modified_since "yesterday"`},
+		{name: "header injection", ifNoneMatch: "\"v1\"\r\nX-Evil: 1", expectedErr: "invalid if_none_match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := createTestFetcher().FetchURL(t.Context(), &FetchRequest{
+				URL:             "http://127.0.0.1:1",
+				IfNoneMatch:     tt.ifNoneMatch,
+				IfModifiedSince: tt.ifModifiedSince,
+			})
+			if !errors.Is(err, KindInvalidRequest) || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Errorf("expected %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestFetchURLUnsolicitedNotModified(t *testing.T) {
+	// A 304 the client did not ask for is still an error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+
+	if _, err := createTestFetcher().FetchURL(t.Context(), &FetchRequest{URL: server.URL}); !errors.Is(err, KindHTTPStatus) {
+		t.Errorf("expected an HTTP status error, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package fetcher
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ContentTypeError reports a response refused because its content type is not
+// in the configured allowlist
+type ContentTypeError struct {
+	// ContentType is the media type of the response, or the sniffed type
+	// when the response declared none
+	ContentType string
+}
+
+// Error implements the error interface
+func (e *ContentTypeError) Error() string {
+	return fmt.Sprintf("content type %s is not allowed by this server", e.ContentType)
+}
+
+// contentTypeAllowed reports whether mediaType matches one of patterns. Media
+// types are compared case-insensitively.
+func contentTypeAllowed(patterns []string, mediaType string) bool {
+	mediaType = strings.ToLower(mediaType)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContentType returns a *ContentTypeError unless the declared Content-Type
+// or the type sniffed from body is allowed. Accepting the sniffed type lets
+// mislabeled pages through when their real type is allowed. An empty
+// allowlist allows everything.
+func checkContentType(patterns []string, contentType string, body []byte) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	declared := mediaTypeOf(contentType)
+	if declared != "" && contentTypeAllowed(patterns, declared) {
+		return nil
+	}
+	sniffed := mediaTypeOf(http.DetectContentType(body))
+	if contentTypeAllowed(patterns, sniffed) {
+		return nil
+	}
+
+	if declared == "" {
+		return &ContentTypeError{ContentType: sniffed}
+	}
+	return &ContentTypeError{ContentType: declared}
+}
+
+// mediaTypeOf returns the lower-cased media type of a Content-Type value
+// without its parameters, or an empty string when it does not parse
+func mediaTypeOf(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
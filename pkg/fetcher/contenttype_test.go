@@ -0,0 +1,87 @@
+package fetcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+func TestCheckContentType(t *testing.T) {
+	html := []byte("<!DOCTYPE html><html><body><p>hello</p></body></html>")
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	patterns := []string{"text/*", "application/*+json", "application/json"}
+
+	tests := []struct {
+		name        string
+		patterns    []string
+		contentType string
+		body        []byte
+		refused     string
+	}{
+		{name: "permissive by default", contentType: "image/png", body: png},
+		{name: "wildcard subtype", patterns: patterns, contentType: "text/html; charset=utf-8", body: html},
+		{name: "case insensitive", patterns: patterns, contentType: "Application/JSON", body: []byte(`{}`)},
+		{name: "suffix pattern", patterns: patterns, contentType: "application/ld+json", body: []byte(`{}`)},
+		{name: "mislabeled html is sniffed", patterns: patterns, contentType: "application/octet-stream", body: html},
+		{name: "missing type is sniffed", patterns: patterns, body: html},
+		{name: "binary", patterns: patterns, contentType: "image/png", body: png, refused: "image/png"},
+		{name: "unlabeled binary", patterns: patterns, body: png, refused: "image/png"},
+		{name: "pdf", patterns: patterns, contentType: "application/pdf", body: []byte("%PDF-1.7"), refused: "application/pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkContentType(tt.patterns, tt.contentType, tt.body)
+			if tt.refused == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var typeErr *ContentTypeError
+			if !errors.As(err, &typeErr) || typeErr.ContentType != tt.refused {
+				t.Errorf("expected %s to be refused, got %v", tt.refused, err)
+			}
+		})
+	}
+}
+
+func TestFetchURLEnforcesAllowedContentTypes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("plain text"))
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	strict := NewHTTPFetcher(client, robots.NewChecker("TestBot/1.0", "", false, false, client),
+		processor.NewContentProcessor(processor.Options{DisableTitleHeader: true}), "TestBot/1.0", nil, 0, 0, URLLimits{}, []string{"text/*"})
+
+	// Raw fetches are checked too
+	_, err := strict.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/image", Raw: true})
+	var typeErr *ContentTypeError
+	if !errors.As(err, &typeErr) || !errors.Is(err, KindPolicy) || typeErr.ContentType != "image/png" {
+		t.Errorf("expected the image to be refused, got %v", err)
+	}
+	if _, err := strict.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/text", Raw: true}); err != nil {
+		t.Errorf("expected text to be allowed, got %v", err)
+	}
+
+	// Without an allowlist every type is returned as before
+	if _, err := createTestFetcher().FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/image", Raw: true}); err != nil {
+		t.Errorf("expected the default fetcher to allow images, got %v", err)
+	}
+}
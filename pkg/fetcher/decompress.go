@@ -0,0 +1,114 @@
+package fetcher
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Defaults for DecompressionLimits
+const (
+	DefaultMaxDecompressionRatio = 100
+	DefaultMaxDecompressedBytes  = 50 << 20
+)
+
+// minRatioCheckBytes is the decompressed size below which the ratio is not
+// checked, since short bodies of repetitive markup legitimately compress well
+const minRatioCheckBytes = 1 << 20
+
+// DecompressionLimits bounds how far a compressed response body may expand,
+// so a small response cannot decompress to gigabytes
+type DecompressionLimits struct {
+	// MaxRatio is the most decompressed bytes allowed per compressed byte.
+	// Zero selects DefaultMaxDecompressionRatio.
+	MaxRatio int
+	// MaxBytes is the most bytes a body may decompress to. Zero selects
+	// DefaultMaxDecompressedBytes.
+	MaxBytes int64
+}
+
+// withDefaults returns a copy of l with zero fields set to their defaults
+func (l DecompressionLimits) withDefaults() DecompressionLimits {
+	if l.MaxRatio == 0 {
+		l.MaxRatio = DefaultMaxDecompressionRatio
+	}
+	if l.MaxBytes == 0 {
+		l.MaxBytes = DefaultMaxDecompressedBytes
+	}
+	return l
+}
+
+// DecompressionLimitError reports a compressed response body that expanded
+// past one of the DecompressionLimits
+type DecompressionLimitError struct {
+	// Compressed and Decompressed are the bytes read and produced when
+	// decompression was aborted
+	Compressed   int64
+	Decompressed int64
+	// MaxRatio is set when the ratio limit was exceeded, and MaxBytes when
+	// the size limit was
+	MaxRatio int
+	MaxBytes int64
+}
+
+func (e *DecompressionLimitError) Error() string {
+	if e.MaxBytes > 0 {
+		return fmt.Sprintf("compressed response body expanded past the %d byte decompression limit", e.MaxBytes)
+	}
+	return fmt.Sprintf("compressed response body expanded from %d to %d bytes, past the %d:1 decompression ratio limit",
+		e.Compressed, e.Decompressed, e.MaxRatio)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// limitedDecompressor decompresses a body and fails with a
+// *DecompressionLimitError once the output exceeds its limits
+type limitedDecompressor struct {
+	compressed *countingReader
+	decoder    io.Reader
+	limits     DecompressionLimits
+	n          int64
+}
+
+func (d *limitedDecompressor) Read(p []byte) (int, error) {
+	n, err := d.decoder.Read(p)
+	d.n += int64(n)
+	if d.n > d.limits.MaxBytes {
+		return 0, &DecompressionLimitError{Compressed: d.compressed.n, Decompressed: d.n, MaxBytes: d.limits.MaxBytes}
+	}
+	if d.n > minRatioCheckBytes && d.n > d.compressed.n*int64(d.limits.MaxRatio) {
+		return 0, &DecompressionLimitError{Compressed: d.compressed.n, Decompressed: d.n, MaxRatio: d.limits.MaxRatio}
+	}
+	return n, err
+}
+
+// gzipEncoded reports whether header declares a gzip Content-Encoding
+func gzipEncoded(header http.Header) bool {
+	encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding")))
+	return encoding == "gzip" || encoding == "x-gzip"
+}
+
+// decompressBody returns a reader of the decompressed body, bounded by
+// limits. The transport only decodes gzip transparently when it chose the
+// Accept-Encoding header itself, so fetches ask for gzip explicitly and
+// decode here, where the compressed size is known.
+func decompressBody(body io.Reader, limits DecompressionLimits) (io.Reader, error) {
+	compressed := &countingReader{r: body}
+	decoder, err := gzip.NewReader(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode gzip response body: %w", err)
+	}
+	return &limitedDecompressor{compressed: compressed, decoder: decoder, limits: limits}, nil
+}
@@ -0,0 +1,126 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+)
+
+// newGzipServer serves body with a gzip Content-Encoding, whether or not it
+// is actually compressed
+func newGzipServer(t *testing.T, body []byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newDecompressionFetcher(limits DecompressionLimits) *HTTPFetcher {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return New(WithHTTPClient(client), WithUserAgent("TestBot/1.0"),
+		WithProcessor(processor.NewContentProcessor(processor.Options{DisableTitleHeader: true})),
+		WithDecompressionLimits(limits))
+}
+
+func TestFetchURLRefusesDecompressionBomb(t *testing.T) {
+	// 16 KiB of gzip expanding to 16 MiB of whitespace
+	bomb, err := os.ReadFile(filepath.Join("testdata", "bomb.html.gz"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	server := newGzipServer(t, bomb)
+
+	tests := []struct {
+		name        string
+		limits      DecompressionLimits
+		expectedErr string
+	}{
+		{
+			name:        "ratio",
+			limits:      DecompressionLimits{},
+			expectedErr: "past the 100:1 decompression ratio limit",
+		},
+		{
+			name:        "size",
+			limits:      DecompressionLimits{MaxRatio: 1 << 20, MaxBytes: 2 << 20},
+			expectedErr: "past the 2097152 byte decompression limit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := newDecompressionFetcher(tt.limits)
+			_, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL})
+			var limitErr *DecompressionLimitError
+			if !errors.Is(err, KindPolicy) || !errors.As(err, &limitErr) || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Fatalf("expected a decompression limit policy error, got %v", err)
+			}
+			if limitErr.Compressed > int64(len(bomb)) {
+				t.Errorf("expected at most %d compressed bytes read, got %d", len(bomb), limitErr.Compressed)
+			}
+
+			stats, _ := fetcher.DomainStats(1)
+			if len(stats) != 1 || stats[0].DecompressionAborts != 1 || stats[0].Errors != 1 {
+				t.Errorf("expected one decompression abort, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestFetchURLDecodesGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte("<html><body><p>Compressed page</p></body></html>"))
+	writer.Close()
+
+	var acceptEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+
+	result, err := newDecompressionFetcher(DecompressionLimits{}).FetchURL(t.Context(), &FetchRequest{URL: server.URL, Raw: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if acceptEncoding != "gzip" {
+		t.Errorf("expected Accept-Encoding gzip, got %q", acceptEncoding)
+	}
+	if !strings.Contains(result.Content, "Compressed page") {
+		t.Errorf("expected the decompressed page, got %q", result.Content)
+	}
+}
+
+func TestFetchURLInvalidGzip(t *testing.T) {
+	// The origin claims gzip but sends plain HTML
+	server := newGzipServer(t, []byte("<html><body>not compressed</body></html>"))
+
+	_, err := newDecompressionFetcher(DecompressionLimits{}).FetchURL(t.Context(), &FetchRequest{URL: server.URL})
+	if !errors.Is(err, KindNetwork) || !strings.Contains(err.Error(), "failed to decode gzip response body") {
+		t.Errorf("expected a gzip decoding error, got %v", err)
+	}
+}
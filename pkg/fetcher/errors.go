@@ -0,0 +1,158 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+// ErrorKind classifies why a fetch failed. It implements error so that
+// errors.Is(err, KindRobotsBlocked) matches any *FetchError of that kind.
+type ErrorKind string
+
+// Kinds of fetch failure
+const (
+	// KindRobotsBlocked means robots.txt or a page's robots directives
+	// disallow the fetch
+	KindRobotsBlocked ErrorKind = "robots_blocked"
+	// KindHTTPStatus means the server answered with a status other than 200
+	KindHTTPStatus ErrorKind = "http_status"
+	// KindNetwork means the server could not be reached or the response could
+	// not be read, including timeouts and stalled downloads
+	KindNetwork ErrorKind = "network"
+	// KindDNSFailure means the host name could not be resolved
+	KindDNSFailure ErrorKind = "dns_failure"
+	// KindPolicy means a server policy refused the fetch, such as the cloud
+	// metadata blocklist, the required proxy or the content type allowlist
+	KindPolicy ErrorKind = "policy"
+	// KindTooLarge means the request exceeded a size limit, such as the
+	// maximum URL length
+	KindTooLarge ErrorKind = "too_large"
+	// KindProcessing means the response was downloaded but could not be
+	// processed, reported only for strict requests
+	KindProcessing ErrorKind = "processing"
+	// KindInvalidURL means the URL could not be turned into a request
+	KindInvalidURL ErrorKind = "invalid_url"
+	// KindInvalidRequest means a fetch parameter other than the URL is invalid
+	KindInvalidRequest ErrorKind = "invalid_request"
+	// KindCircuitOpen means the host failed repeatedly and is not being
+	// fetched from until its circuit breaker cools down
+	KindCircuitOpen ErrorKind = "circuit_open"
+	// KindBotProtection means the site answered with a bot protection
+	// challenge, such as Cloudflare's, instead of the page
+	KindBotProtection ErrorKind = "blocked_by_bot_protection"
+	// KindCanceled means the caller cancelled the fetch before it completed,
+	// such as a client cancelling its tool call. It says nothing about the
+	// host, so it is not remembered, counted or held against the host.
+	KindCanceled ErrorKind = "canceled"
+)
+
+// Error implements the error interface
+func (k ErrorKind) Error() string {
+	return string(k)
+}
+
+// FetchError is the error returned by FetchURL for every failure. Its message
+// is that of the wrapped cause.
+type FetchError struct {
+	// Kind classifies the failure
+	Kind ErrorKind
+	// StatusCode is the HTTP status for KindHTTPStatus and zero otherwise
+	StatusCode int
+	// URL is the URL that was requested. It may carry credentials, so it must
+	// be redacted before it is logged.
+	URL string
+	// Cached reports a failure remembered from a recent fetch of the same request
+	// and returned without trying again
+	Cached bool
+	// Err is the underlying cause
+	Err error
+}
+
+// Error implements the error interface
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying cause
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the ErrorKind of e
+func (e *FetchError) Is(target error) bool {
+	kind, ok := target.(ErrorKind)
+	return ok && kind == e.Kind
+}
+
+// newFetchError wraps err as a *FetchError of the given kind
+func newFetchError(kind ErrorKind, url string, err error) *FetchError {
+	return &FetchError{Kind: kind, URL: url, Err: err}
+}
+
+// RobotsBlockedError reports a URL refused by robots.txt, with the rule that
+// refused it so clients can tell whether other pages on the host are allowed
+type RobotsBlockedError struct {
+	// URL is the URL that was refused
+	URL string
+	// Decision is the robots.txt decision, including the matched rule
+	Decision robots.Decision
+}
+
+// Error implements the error interface
+func (e *RobotsBlockedError) Error() string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "access to %s is disallowed by robots.txt", e.URL)
+	if rule := e.Decision.Rule; rule != nil {
+		fmt.Fprintf(&msg, " (rule %q on line %d of %s)", rule.Text, rule.Line, e.Decision.RobotsURL)
+		if e.Decision.HostWide {
+			msg.WriteString("; the whole host is disallowed")
+		} else {
+			msg.WriteString("; other paths on this host may be allowed")
+		}
+	}
+	if e.Decision.CrawlDelay != "" {
+		fmt.Fprintf(&msg, "; Crawl-delay: %s", e.Decision.CrawlDelay)
+	}
+	return msg.String()
+}
+
+// requestErrorKind classifies an error from sending a request. Dial and
+// header policies fail inside the HTTP client, so they are told apart from
+// network failures by the error they wrap.
+func requestErrorKind(err error) ErrorKind {
+	var metadataErr *MetadataEndpointError
+	var directErr *DirectDialError
+	var headerErr *ResponseHeaderError
+	var dnsErr *net.DNSError
+	if errors.As(err, &metadataErr) || errors.As(err, &directErr) || errors.As(err, &headerErr) {
+		return KindPolicy
+	}
+	if errors.As(err, &dnsErr) {
+		return KindDNSFailure
+	}
+	return KindNetwork
+}
+
+// canceledError returns a KindCanceled error in place of err when ctx, the
+// caller's context, was cancelled, and err otherwise
+func canceledError(ctx context.Context, url string, err error) error {
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+	return newFetchError(KindCanceled, url, fmt.Errorf("fetch cancelled: %w", ctx.Err()))
+}
+
+// httpStatusError returns the *FetchError for a response with a non-200 status
+func httpStatusError(url string, statusCode int, status string) *FetchError {
+	return &FetchError{
+		Kind:       KindHTTPStatus,
+		StatusCode: statusCode,
+		URL:        url,
+		Err:        fmt.Errorf("HTTP %d: %s", statusCode, status),
+	}
+}
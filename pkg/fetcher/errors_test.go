@@ -0,0 +1,140 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+func TestFetchErrorMatching(t *testing.T) {
+	cause := &MetadataEndpointError{Host: "169.254.169.254"}
+	var err error = fmt.Errorf("wrapped: %w", newFetchError(KindPolicy, "http://169.254.169.254/", cause))
+
+	if !errors.Is(err, KindPolicy) || errors.Is(err, KindNetwork) {
+		t.Errorf("expected err to match only its own kind")
+	}
+
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || fetchErr.URL != "http://169.254.169.254/" {
+		t.Errorf("expected a FetchError carrying the URL, got %+v", fetchErr)
+	}
+
+	var metadataErr *MetadataEndpointError
+	if !errors.As(err, &metadataErr) || err.Error() != "wrapped: "+cause.Error() {
+		t.Errorf("expected the cause to be reachable and to supply the message, got %v", err)
+	}
+}
+
+func TestRequestErrorKind(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected ErrorKind
+	}{
+		"metadata":    {err: &url.Error{Op: "Get", Err: &MetadataEndpointError{Host: "metadata.goog"}}, expected: KindPolicy},
+		"direct dial": {err: &url.Error{Op: "Get", Err: &DirectDialError{Address: "example.com:443"}}, expected: KindPolicy},
+		"refused":     {err: &url.Error{Op: "Get", Err: errors.New("connection refused")}, expected: KindNetwork},
+		"dns": {
+			err:      &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Name: "missing.test", IsNotFound: true}}},
+			expected: KindDNSFailure,
+		},
+	}
+
+	for name, tt := range tests {
+		if got := requestErrorKind(tt.err); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", name, tt.expected, got)
+		}
+	}
+}
+
+func TestFetchURLErrorKinds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: GuardMetadataEndpoints(http.DefaultTransport.(*http.Transport).Clone()),
+		Timeout:   5 * time.Second,
+	}
+	fetcher := NewHTTPFetcher(client, robots.NewChecker("TestBot/1.0", "", true, false, client),
+		processor.NewContentProcessor(processor.Options{DisableTitleHeader: true}), "TestBot/1.0", nil, 0, 0, URLLimits{}, nil)
+
+	tests := []struct {
+		name       string
+		url        string
+		kind       ErrorKind
+		statusCode int
+	}{
+		{name: "http status", url: server.URL + "/page", kind: KindHTTPStatus, statusCode: http.StatusGone},
+		{name: "metadata endpoint", url: "http://169.254.169.254/latest/meta-data/", kind: KindPolicy},
+		{name: "unreachable", url: "http://127.0.0.1:1/", kind: KindNetwork},
+		{name: "invalid url", url: "http://exa mple.com/", kind: KindInvalidURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: tt.url, Raw: true})
+			var fetchErr *FetchError
+			if !errors.As(err, &fetchErr) {
+				t.Fatalf("expected a FetchError, got %v", err)
+			}
+			if fetchErr.Kind != tt.kind || fetchErr.StatusCode != tt.statusCode || fetchErr.URL != tt.url {
+				t.Errorf("expected kind=%s status=%d url=%s, got %+v", tt.kind, tt.statusCode, tt.url, fetchErr)
+			}
+		})
+	}
+}
+
+func TestFetchURLCanceledMidDownload(t *testing.T) {
+	var requests atomic.Int32
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if requests.Add(1) > 1 {
+			w.Write([]byte("complete"))
+			return
+		}
+		// Only part of the first body arrives before the caller gives up
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	fetcher := New(WithRobots(allowAll{}), WithNegativeCacheTTL(time.Minute),
+		WithCircuitBreaker(CircuitBreaker{Failures: 1}))
+	ctx, cancel := context.WithCancel(t.Context())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err := fetcher.FetchURL(ctx, &FetchRequest{URL: server.URL + "/page", Raw: true})
+	if !errors.Is(err, KindCanceled) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled error, got %v", err)
+	}
+
+	// The cancellation is neither counted nor remembered, and with a breaker
+	// opening on the first failure the host is still fetched from
+	if stats, _ := fetcher.DomainStats(0); len(stats) != 0 {
+		t.Errorf("expected the cancelled fetch left out of the statistics, got %+v", stats)
+	}
+	result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page", Raw: true})
+	if err != nil || result.Content != "complete" {
+		t.Errorf("expected the page fetched again, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,69 @@
+package fetcher_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/stackloklabs/gofetch/pkg/fetcher"
+)
+
+// newExampleSite serves a small article and a robots.txt that disallows /private
+func newExampleSite() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+		case "/notes.txt":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, "Release 1.2 fixes the importer and speeds up exports.")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func ExampleNew() {
+	site := newExampleSite()
+	defer site.Close()
+
+	f := fetcher.New(fetcher.WithUserAgent("ExampleBot/1.0"))
+
+	maxLength := 11
+	result, err := f.FetchURL(context.Background(), &fetcher.FetchRequest{URL: site.URL + "/notes.txt", MaxLength: &maxLength})
+	if err != nil {
+		fmt.Println("fetch failed:", err)
+		return
+	}
+	fmt.Println(result.Content[:maxLength])
+	fmt.Println("truncated:", result.Page.Truncated, "next:", result.Page.NextIndex)
+
+	// Output:
+	// Release 1.2
+	// truncated: true next: 11
+}
+
+func ExampleFetchError() {
+	site := newExampleSite()
+	defer site.Close()
+
+	f := fetcher.New()
+
+	for _, path := range []string{"/private/report", "/missing"} {
+		_, err := f.FetchURL(context.Background(), &fetcher.FetchRequest{URL: site.URL + path})
+
+		var fetchErr *fetcher.FetchError
+		switch {
+		case errors.Is(err, fetcher.KindRobotsBlocked):
+			fmt.Println(path, "is disallowed by robots.txt")
+		case errors.As(err, &fetchErr) && fetchErr.Kind == fetcher.KindHTTPStatus:
+			fmt.Println(path, "returned status", fetchErr.StatusCode)
+		}
+	}
+
+	// Output:
+	// /private/report is disallowed by robots.txt
+	// /missing returned status 404
+}
@@ -2,68 +2,538 @@
 package fetcher
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	neturl "net/url"
 	"strings"
+	"time"
 
 	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/redact"
 	"github.com/stackloklabs/gofetch/pkg/robots"
 )
 
-// HTTPFetcher handles HTTP requests and content retrieval
+// RobotsPolicy decides whether pages may be fetched. *robots.Checker
+// implements it.
+type RobotsPolicy interface {
+	// DecideContext reports whether targetURL may be fetched and, when it
+	// may not, the rule that refuses it. It should give up once ctx is done
+	// and allow the URL, as when robots.txt cannot be fetched.
+	DecideContext(ctx context.Context, targetURL string) robots.Decision
+	// PageDirective reports whether a fetched page opts out of being used,
+	// returning the directive that says so
+	PageDirective(header http.Header, contentType string, body []byte) (string, bool)
+}
+
+// Reasons a fetch's content was truncated
+const (
+	// TruncationMaxLength: the returned content stopped at max_length
+	TruncationMaxLength = "max_length"
+	// TruncationMaxBytes: the download stopped at max_bytes
+	TruncationMaxBytes = "max_bytes"
+)
+
+// ContentProcessor converts fetched HTML and selects the page of content to
+// return. *processor.ContentProcessor implements it.
+type ContentProcessor interface {
+	// ProcessHTMLContext converts an HTML document served from sourceURL to
+	// markdown. When a step fails it returns the best content still available
+	// and a warning describing the failure. It should stop working soon after
+	// ctx is done, when its result is discarded. htmlContent may be a pooled
+	// response buffer, so it must not be kept once the call returns.
+	ProcessHTMLContext(ctx context.Context, htmlContent []byte, sourceURL string) (content, warning string)
+	// FormatContent returns the window of content selected by startIndex and
+	// maxLength, either of which may be nil
+	FormatContent(content string, startIndex, maxLength *int) (string, processor.PageInfo)
+}
+
+var (
+	_ RobotsPolicy     = (*robots.Checker)(nil)
+	_ ContentProcessor = (*processor.ContentProcessor)(nil)
+)
+
+// HTTPFetcher handles HTTP requests and content retrieval. It is safe for
+// concurrent use.
 type HTTPFetcher struct {
 	httpClient    *http.Client
-	robotsChecker *robots.Checker
-	processor     *processor.ContentProcessor
+	robotsChecker RobotsPolicy
+	processor     ContentProcessor
 	userAgent     string
+	redactor      *redact.Redactor
+	stallTimeout  time.Duration
+	hostLimiter   *hostLimiter
+	urlLimits     URLLimits
+	allowedTypes  []string
+	headerLog     *headerLogger
+	stats         *domainStats
+	failures      *negativeCache
+	// processingBudget bounds the time spent converting one page
+	processingBudget time.Duration
+	decompression    DecompressionLimits
+	breaker          *circuitBreaker
+	profiles         *HostProfiles
+	pacer            *hostPacer
+	// processingRules pick the processor of each content type, before
+	// DefaultProcessingRules
+	processingRules []ProcessingRule
+	// handler runs a request through the pipeline of stages
+	handler Handler
 }
 
-// NewHTTPFetcher creates a new HTTP fetcher instance
+// NewHTTPFetcher creates a new HTTP fetcher instance from explicit
+// components; New offers the same settings as options with defaults. A
+// download that receives no data for stallTimeout is aborted; zero selects
+// DefaultStallTimeout. At most maxConnsPerHost fetches run against one host
+// at a time and the rest wait their turn; zero selects
+// DefaultMaxConnsPerHost. URLs exceeding urlLimits are refused before any
+// request is made. When allowedTypes is not empty, responses whose content
+// type matches none of its patterns (such as text/* or application/json) are
+// refused, raw or not.
+//
+// Its signature is frozen: settings added since are only offered as options
+// of New, and take their zero values here.
 func NewHTTPFetcher(
 	httpClient *http.Client,
-	robotsChecker *robots.Checker,
-	contentProcessor *processor.ContentProcessor,
+	robotsChecker RobotsPolicy,
+	contentProcessor ContentProcessor,
 	userAgent string,
+	redactor *redact.Redactor,
+	stallTimeout time.Duration,
+	maxConnsPerHost int,
+	urlLimits URLLimits,
+	allowedTypes []string,
 ) *HTTPFetcher {
-	return &HTTPFetcher{
-		httpClient:    httpClient,
-		robotsChecker: robotsChecker,
-		processor:     contentProcessor,
-		userAgent:     userAgent,
+	return newHTTPFetcher(options{
+		httpClient:      httpClient,
+		robots:          robotsChecker,
+		processor:       contentProcessor,
+		userAgent:       userAgent,
+		redactor:        redactor,
+		stallTimeout:    stallTimeout,
+		maxConnsPerHost: maxConnsPerHost,
+		urlLimits:       urlLimits,
+		allowedTypes:    allowedTypes,
+	})
+}
+
+// newHTTPFetcher creates a fetcher from the components and settings in o,
+// as given
+func newHTTPFetcher(o options) *HTTPFetcher {
+	stallTimeout := o.stallTimeout
+	if stallTimeout == 0 {
+		stallTimeout = DefaultStallTimeout
+	}
+	maxConnsPerHost := o.maxConnsPerHost
+	if maxConnsPerHost == 0 {
+		maxConnsPerHost = DefaultMaxConnsPerHost
+	}
+	f := &HTTPFetcher{
+		httpClient:    o.httpClient,
+		robotsChecker: o.robots,
+		processor:     o.processor,
+		userAgent:     o.userAgent,
+		redactor:      o.redactor,
+		stallTimeout:  stallTimeout,
+		hostLimiter:   newHostLimiter(maxConnsPerHost),
+		urlLimits:     o.urlLimits.withDefaults(),
+		allowedTypes:  o.allowedTypes,
+		headerLog:     newHeaderLogger(o.debugHeaders),
+		stats:         newDomainStats(),
+		failures:      newNegativeCache(o.negativeTTL),
+
+		processingBudget: o.budget,
+		decompression:    o.decompression.withDefaults(),
+		breaker:          newCircuitBreaker(o.breaker),
+		profiles:         o.profiles,
+		pacer:            newHostPacer(),
+		processingRules:  o.processingRules,
 	}
+	f.handler = f.pipeline(o.prepended, o.appended)
+	return f
 }
 
-// FetchRequest holds the parameters for a fetch request
+// FetchRequest holds the parameters for a fetch request. New fields are only
+// ever added with a zero value that keeps the previous behavior.
 type FetchRequest struct {
-	URL        string
-	MaxLength  *int
+	// URL is the absolute http or https URL to fetch
+	URL string
+	// MaxLength caps the characters of content returned. Nil returns
+	// everything from StartIndex on.
+	MaxLength *int
+	// StartIndex is the character offset to return content from, used to
+	// page through truncated content. Nil starts at the beginning.
 	StartIndex *int
-	Raw        bool
+	// Raw returns the body as served instead of converting HTML to markdown
+	Raw bool
+	// ExpectedContent is one of ExpectHTML, ExpectJSON, ExpectText,
+	// ExpectMarkdown or ExpectAny.
+	// It selects the Accept header and how the body is processed. Empty
+	// selects ExpectHTML.
+	ExpectedContent string
+	// ConvertRST converts reStructuredText documents to markdown. They are
+	// returned as served otherwise.
+	ConvertRST bool
+	// Strict fails the fetch with KindProcessing when processing fails,
+	// instead of returning degraded content with a Warning
+	Strict bool
+	// MaxBytes caps the bytes of the response body downloaded. The rest of
+	// the body is never read and BodyTruncated is set. Zero reads the whole
+	// body.
+	MaxBytes int64
+	// IfNoneMatch is sent verbatim as If-None-Match, and IfModifiedSince, an
+	// HTTP date, as If-Modified-Since. When the server answers 304 Not
+	// Modified the result has NotModified set and no content.
+	IfNoneMatch     string
+	IfModifiedSince string
+	// RewriteKnownHosts fetches the raw file behind well-known file viewer
+	// pages, such as GitHub and GitLab blob pages and gists, instead of the
+	// page. The result's RewrittenURL records the URL fetched instead.
+	RewriteKnownHosts bool
+}
+
+// FetchResult holds the outcome of a successful fetch. Like FetchRequest it
+// only grows new fields.
+type FetchResult struct {
+	// Content is the formatted content, including any truncation footer
+	Content string
+	// Page describes which part of the processed content was returned
+	Page processor.PageInfo
+	// FinalURL is the URL the content was served from after following redirects
+	FinalURL string
+	// CanonicalURL is the page's <link rel="canonical"> target, resolved against
+	// FinalURL, or empty when the page declares none
+	CanonicalURL string
+	// ContentType is the Content-Type header of the response
+	ContentType string
+	// StatusCode is the HTTP status of the response, 200 or 204
+	StatusCode int
+	// Empty reports that the response had no body, as with 204 No Content,
+	// so Content is empty because there was nothing to return
+	Empty bool
+	// BodySHA256 is the hex SHA-256 of the response body as received, before
+	// charset transcoding or any processing
+	BodySHA256 string
+	// ContentSHA256 is the hex SHA-256 of the processed content before it was
+	// paginated, so it is the same for every page of a document
+	ContentSHA256 string
+	// SourceFormat is FormatMarkdown or FormatRST when the document was served
+	// as lightweight markup rather than HTML, and empty otherwise
+	SourceFormat string
+	// AlreadyMarkdown reports that Content is markdown the server did not
+	// derive from HTML: a Markdown document as served, or a converted
+	// reStructuredText one. Clients should not process it further.
+	AlreadyMarkdown bool
+	// Warning describes a processing step that failed, in which case Content
+	// is a lesser representation of the page such as its plain text. It is
+	// empty for a clean conversion, and otherwise repeated in Warnings.
+	Warning string
+	// BodyTruncated reports that the download stopped at the request's
+	// MaxBytes, so the content is only the beginning of the document
+	BodyTruncated bool
+	// TruncationReason is TruncationMaxBytes when the download was cut
+	// short, TruncationMaxLength when only the returned content was, and
+	// empty when nothing was cut
+	TruncationReason string
+	// NotModified reports a 304 Not Modified answer to a conditional
+	// request: the client's copy is current and Content is empty
+	NotModified bool
+	// ETag and LastModified are the response's validators, for use in a
+	// later conditional request
+	ETag         string
+	LastModified string
+	// CacheHeaders holds the response's caching headers (etag,
+	// last-modified, cache-control, expires, age and content-language) that
+	// were present, keyed by lowercase name with values capped in length.
+	// No other response header is ever included.
+	CacheHeaders map[string]string
+	// Warnings describe conditions worth reporting that did not fail the
+	// fetch, such as a response type that contradicts the expected content
+	Warnings Warnings
+	// BodyBytes is the number of response body bytes downloaded
+	BodyBytes int64
+	// RewrittenURL is the URL RewriteKnownHosts fetched in place of the
+	// requested one, and empty when it fetched the requested URL
+	RewrittenURL string
+	// BudgetExceeded reports that converting the page ran over the
+	// processing budget, so Content is its plain text and Warning says so
+	BudgetExceeded bool
+	// LengthMismatch reports that the body ended before the Content-Length
+	// the server declared. Content is what was actually received, which may
+	// be incomplete, and a warning gives both lengths.
+	LengthMismatch bool
+	// QueueWait is the time the fetch spent queued behind other fetches to
+	// the same host and waiting for the pace its profile sets, before the
+	// request was sent
+	QueueWait time.Duration
 }
 
-// FetchURL retrieves and processes content from the specified URL
-func (f *HTTPFetcher) FetchURL(req *FetchRequest) (string, error) {
-	log.Printf("Fetching URL: %s", sanitizeLogValue(req.URL))
+// fetchedPage is the processed body of a response together with where it
+// was actually served from
+type fetchedPage struct {
+	content      string
+	bodySHA256   string
+	contentType  string
+	finalURL     string
+	canonicalURL string
+	statusCode   int
+	// bodyTruncated is set when the download stopped at the byte cap
+	bodyTruncated bool
+	// empty is set when the response had no body
+	empty bool
+	// warning describes a processing step that failed
+	warning string
+	// sourceFormat is the lightweight markup the document was served as
+	sourceFormat string
+	// bodyBytes is the number of response body bytes downloaded
+	bodyBytes int64
+	// notModified is set for a 304 answer to a conditional request
+	notModified bool
+	// etag and lastModified are the response's validators
+	etag         string
+	lastModified string
+	// cacheHeaders are the response's allowlisted caching headers
+	cacheHeaders map[string]string
+	// budgetExceeded is set when conversion ran over the processing budget
+	budgetExceeded bool
+	// declaredLength is the Content-Length of a body that ended before it,
+	// and zero when the body matched
+	declaredLength int64
+	// queueWait is the time spent waiting for the host before the request
+	queueWait time.Duration
+}
+
+// FetchURL retrieves and processes content from the specified URL, running
+// the request through the fetcher's pipeline of stages. The fetch is
+// abandoned once ctx is done, releasing its place in the host's queue. When
+// ctx has a deadline, such as that of a tool call, the robots.txt check is
+// given at most a quarter of the time left.
+func (f *HTTPFetcher) FetchURL(ctx context.Context, req *FetchRequest) (*FetchResult, error) {
+	return f.handler(ctx, req)
+}
 
-	// Check robots.txt
-	if !f.robotsChecker.IsAllowed(req.URL) {
-		log.Printf("Access denied by robots.txt for URL: %s", sanitizeLogValue(req.URL))
-		return "", fmt.Errorf("access to %s is disallowed by robots.txt", req.URL)
+// fetch is the last step of the pipeline, downloading, processing and
+// formatting the page of a request the stages let through
+func (f *HTTPFetcher) fetch(ctx context.Context, req *FetchRequest) (*FetchResult, error) {
+	// Parsed again since appended stages may have changed the request
+	expected, cond, err := parseRequest(req)
+	if err != nil {
+		return nil, err
 	}
 
 	// Fetch the content
-	content, err := f.fetchURL(req.URL, req.Raw)
+	page, err := f.fetchURL(ctx, req.URL, req.Raw, expected, req.MaxBytes, cond)
 	if err != nil {
-		return "", err
+		return nil, canceledError(ctx, req.URL, err)
+	}
+	if page.notModified {
+		return &FetchResult{
+			FinalURL:     page.finalURL,
+			StatusCode:   page.statusCode,
+			NotModified:  true,
+			ETag:         page.etag,
+			LastModified: page.lastModified,
+			CacheHeaders: page.cacheHeaders,
+			QueueWait:    page.queueWait,
+		}, nil
+	}
+	// Markup documents skip the HTML pipeline and are returned as served,
+	// unless reStructuredText is to be converted
+	alreadyMarkdown := page.sourceFormat == FormatMarkdown
+	if page.sourceFormat == FormatRST && req.ConvertRST && !req.Raw {
+		log.Printf("Converting reStructuredText from %s to markdown", f.logURL(req.URL))
+		page.content = processor.RSTToMarkdown(page.content)
+		alreadyMarkdown = true
+	}
+	if page.warning != "" && req.Strict {
+		return nil, newFetchError(KindProcessing, req.URL, fmt.Errorf("failed to process %s: %s", req.URL, page.warning))
 	}
 
 	// Apply formatting
-	formattedContent := f.processor.FormatContent(content, req.StartIndex, req.MaxLength)
+	formattedContent, pageInfo := f.processor.FormatContent(page.content, req.StartIndex, req.MaxLength)
+	var truncationReason string
+	if pageInfo.Truncated {
+		truncationReason = TruncationMaxLength
+		logTruncation(req.URL, truncationReason, pageInfo, page.bodyBytes)
+	}
+	if page.bodyTruncated {
+		// Reported even when paging hides it, since later pages end early too
+		truncationReason = TruncationMaxBytes
+		logTruncation(req.URL, truncationReason, pageInfo, page.bodyBytes)
+	}
+	if pageInfo.OutOfRange {
+		log.Printf("start_index %d is past the end of %s (total length %d)",
+			*req.StartIndex, f.logURL(req.URL), pageInfo.TotalLength)
+	}
+
+	log.Printf("Fetch completed successfully for %s, returning %d characters", f.logURL(req.URL), len(formattedContent))
+	result := &FetchResult{
+		Content:          formattedContent,
+		Page:             pageInfo,
+		FinalURL:         page.finalURL,
+		CanonicalURL:     page.canonicalURL,
+		ContentType:      page.contentType,
+		BodySHA256:       page.bodySHA256,
+		ContentSHA256:    sha256HexString(page.content),
+		StatusCode:       page.statusCode,
+		Empty:            page.empty,
+		Warning:          page.warning,
+		SourceFormat:     page.sourceFormat,
+		AlreadyMarkdown:  alreadyMarkdown,
+		BodyTruncated:    page.bodyTruncated,
+		TruncationReason: truncationReason,
+		ETag:             page.etag,
+		LastModified:     page.lastModified,
+		CacheHeaders:     page.cacheHeaders,
+		BodyBytes:        page.bodyBytes,
+		BudgetExceeded:   page.budgetExceeded,
+		LengthMismatch:   page.declaredLength > 0,
+		QueueWait:        page.queueWait,
+	}
+	if page.declaredLength > 0 {
+		result.Warnings.Add(WarningLengthMismatch, fmt.Sprintf(
+			"the server declared a Content-Length of %d bytes but sent %d; the content is what was received",
+			page.declaredLength, page.bodyBytes), "")
+	}
+	if page.empty {
+		result.Warnings.Add(WarningEmptyResponse,
+			fmt.Sprintf("the server returned no content, status %d", page.statusCode), "")
+	}
+	// Only report a mismatch the client asked to be checked, and only for
+	// content that was actually returned. Markup served as plain text is
+	// what a client expecting markdown wants.
+	if req.ExpectedContent != "" && !page.empty && (expected != ExpectMarkdown || page.sourceFormat == "") {
+		if note := contentMismatch(expected, page.contentType); note != "" {
+			result.Warnings.Add(WarningContentTypeMismatch, note, page.contentType)
+		}
+	}
+	if page.bodyTruncated {
+		result.Warnings.Add(WarningBodyTruncated, fmt.Sprintf(
+			"the download stopped at %d bytes, so the content is only the beginning of the document", page.bodyBytes), "")
+	}
+	switch {
+	case page.budgetExceeded:
+		result.Warnings.Add(WarningProcessingBudget, page.warning, f.processingBudget.String())
+	case page.warning != "":
+		result.Warnings.Add(WarningDegradedProcessing, page.warning, "")
+	}
+	if pageInfo.Truncated {
+		result.Warnings.Add(WarningContentTruncated,
+			fmt.Sprintf("returned %d of %d characters", pageInfo.Returned, pageInfo.TotalLength),
+			fmt.Sprintf("next_start_index=%d", pageInfo.NextIndex))
+	}
+	if pageInfo.OutOfRange {
+		result.Warnings.Add(WarningOutOfRange, fmt.Sprintf(
+			"start_index %d is past the end of the content, which is %d characters long",
+			*req.StartIndex, pageInfo.TotalLength), "")
+	}
+	return result, nil
+}
+
+// processHTML converts an HTML page within the processing budget. When the
+// budget runs out the conversion is abandoned, and stops on its own soon
+// after, while the page's plain text is returned in its place. An abandoned
+// conversion may still be reading htmlContent when this returns.
+func (f *HTTPFetcher) processHTML(htmlContent []byte, sourceURL string) (content, warning string, exceeded bool) {
+	if f.processingBudget <= 0 {
+		content, warning = f.processor.ProcessHTMLContext(context.Background(), htmlContent, sourceURL)
+		return content, warning, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.processingBudget)
+	defer cancel()
+	type processed struct{ content, warning string }
+	done := make(chan processed, 1)
+	go func() {
+		content, warning := f.processor.ProcessHTMLContext(ctx, htmlContent, sourceURL)
+		done <- processed{content: content, warning: warning}
+	}()
+
+	select {
+	case result := <-done:
+		if ctx.Err() == nil {
+			return result.content, result.warning, false
+		}
+	case <-ctx.Done():
+	}
+	log.Printf("Processing budget of %s exceeded for %s", f.processingBudget, f.logURL(sourceURL))
+	content, warning = processor.PlainTextFallback(string(htmlContent),
+		fmt.Sprintf("converting it took longer than the %s processing budget", f.processingBudget))
+	return content, warning, true
+}
+
+// logTruncation records a content truncation event. A cut at max_length is
+// logged with the fraction of the remaining content that was omitted; a cut
+// at max_bytes with the bytes downloaded, as the size of the rest is unknown.
+func logTruncation(rawURL, reason string, info processor.PageInfo, bodyBytes int64) {
+	host := "unknown"
+	if parsed, err := neturl.Parse(rawURL); err == nil {
+		host = parsed.Hostname()
+	}
+
+	if reason == TruncationMaxBytes {
+		log.Printf("Content truncated for host %s: reason=%s downloaded=%d bytes",
+			sanitizeLogValue(host), reason, bodyBytes)
+		return
+	}
+	remaining := info.TotalLength - info.StartIndex
+	omitted := 0.0
+	if remaining > 0 {
+		omitted = float64(remaining-info.Returned) / float64(remaining)
+	}
+
+	log.Printf("Content truncated for host %s: reason=%s returned=%d of %d characters (%.1f%% omitted)",
+		sanitizeLogValue(host), reason, info.Returned, remaining, omitted*100)
+}
 
-	log.Printf("Fetch completed successfully for %s, returning %d characters", sanitizeLogValue(req.URL), len(formattedContent))
-	return formattedContent, nil
+// logURL prepares a URL for logging by redacting credentials and sensitive
+// query parameters and removing characters that could inject log lines
+func (f *HTTPFetcher) logURL(rawURL string) string {
+	return sanitizeLogValue(f.redactor.URL(rawURL))
+}
+
+// urlHost returns the host of rawURL for logging, or "unknown" when it does
+// not parse
+func urlHost(rawURL string) string {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return "unknown"
+	}
+	return sanitizeLogValue(parsed.Host)
+}
+
+// logError returns err in a form safe to log. Errors from the HTTP client embed
+// the full request URL, so only their underlying cause is kept.
+func logError(err error) error {
+	var urlErr *neturl.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// sha256Hex returns the hex-encoded SHA-256 digest of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sha256HexString returns the hex-encoded SHA-256 digest of s. It hashes s in
+// chunks rather than converting it, which would copy the whole content.
+func sha256HexString(s string) string {
+	h := sha256.New()
+	var chunk [32 << 10]byte
+	for len(s) > 0 {
+		n := copy(chunk[:], s)
+		h.Write(chunk[:n])
+		s = s[n:]
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // sanitizeLogValue removes newlines and carriage returns to prevent log injection.
@@ -73,54 +543,263 @@ func sanitizeLogValue(s string) string {
 	return s
 }
 
-// fetchURL retrieves content from the specified URL
-func (f *HTTPFetcher) fetchURL(url string, raw bool) (string, error) {
+// fetchURL retrieves content from the specified URL, reading at most maxBytes
+// of the body when maxBytes is positive and giving up once ctx is done. A
+// conditional request answered with 304 Not Modified returns a page with
+// notModified set and no content.
+func (f *HTTPFetcher) fetchURL(ctx context.Context, url string, raw bool, expected string, maxBytes int64, cond conditions) (*fetchedPage, error) {
+	timings := newFetchTimings()
+
+	// The request is cancelled with a *StalledError if the body stops arriving
+	traceCtx, sentHeaders := f.headerLog.traceRequest(timings.withClientTrace(ctx))
+	ctx, cancel := context.WithCancelCause(traceCtx)
+	defer cancel(nil)
+
 	// Create HTTP request
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		log.Printf("Failed to create HTTP request for %s: %v", sanitizeLogValue(url), err)
-		return "", fmt.Errorf("failed to create request: %v", err)
+		log.Printf("Failed to create HTTP request for %s: %v", f.logURL(url), logError(err))
+		return nil, newFetchError(KindInvalidURL, url, fmt.Errorf("failed to create request: %w", err))
 	}
 
 	// Set headers
-	req.Header.Set("User-Agent", f.userAgent)
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	profile, _ := f.profiles.Match(req.URL.Host)
+	userAgent := f.userAgent
+	if profile.UserAgent != "" {
+		userAgent = profile.UserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", acceptHeaders[expected])
+	// Set explicitly so the body is decoded by decompressBody, within limits
+	req.Header.Set("Accept-Encoding", "gzip")
+	cond.apply(req.Header)
+
+	// Wait for a slot so one host is not hit by too many fetches at once
+	host := hostKey(req.URL)
+	queued, err := f.hostLimiter.acquire(ctx, host, profile.MaxConcurrency)
+	if err != nil {
+		return nil, newFetchError(KindNetwork, url, &hostWaitError{fmt.Errorf("failed waiting for a connection to %s: %w", host, err)})
+	}
+	defer f.hostLimiter.release(host)
+	// Then for the host's profile to allow another fetch
+	paced, err := f.pacer.wait(ctx, host, profile.interval())
+	if err != nil {
+		return nil, newFetchError(KindNetwork, url, &hostWaitError{fmt.Errorf("failed waiting to fetch from %s at its set pace: %w", host, err)})
+	}
+	timings.hostWaitDone()
+	if queued {
+		log.Printf("Waited %s for a connection slot to %s", timings.HostWait, host)
+	}
+	if paced > 0 {
+		log.Printf("Waited %s to fetch from %s at the pace its profile sets", paced.Round(time.Millisecond), host)
+	}
 
 	// Make HTTP request
 	resp, err := f.httpClient.Do(req) //nolint:gosec // This is a fetch server; fetching user-provided URLs is its core purpose
+	if f.headerLog != nil {
+		log.Printf("Request headers for %s: %s", f.logURL(url), f.headerLog.formatRequest(sentHeaders()))
+		if resp != nil {
+			log.Printf("Response headers from %s: %s", f.logURL(url), f.headerLog.formatResponse(resp.Header))
+		}
+	}
 	if err != nil {
-		log.Printf("HTTP request failed for %s: %v", sanitizeLogValue(url), err)
-		return "", fmt.Errorf("failed to fetch URL: %v", err)
+		log.Printf("HTTP request failed for %s: %v", f.logURL(url), logError(err))
+		return nil, newFetchError(requestErrorKind(err), url, fmt.Errorf("failed to fetch URL: %w", err))
 	}
 	defer resp.Body.Close()
 
-	//nolint:gosec // URL sanitized by sanitizeLogValue; gosec can't track custom sanitizers
+	finalURL := resp.Request.URL.String()
+	if finalURL != url {
+		log.Printf("Redirected from %s to %s", f.logURL(url), f.logURL(finalURL))
+	}
+
+	//nolint:gosec // URL sanitized by logURL; gosec can't track custom sanitizers
 	log.Printf("HTTP %d response from %s (Content-Type: %s)",
-		resp.StatusCode, sanitizeLogValue(url), resp.Header.Get("Content-Type"))
+		resp.StatusCode, f.logURL(url), resp.Header.Get("Content-Type"))
 
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		//nolint:gosec // URL sanitized by sanitizeLogValue; gosec can't track custom sanitizers
+	if resp.StatusCode == http.StatusNotModified && cond.conditional() {
+		log.Printf("Content of %s not modified", f.logURL(url))
+		return &fetchedPage{
+			finalURL:     finalURL,
+			statusCode:   resp.StatusCode,
+			notModified:  true,
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+			cacheHeaders: cacheHeaders(resp.Header),
+			queueWait:    timings.HostWait,
+		}, nil
+	}
+
+	// Check status code; 204 No Content is a success with nothing to return.
+	// Challenges come with an error status as often as not, so those
+	// statuses have the start of their body read to look for one.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		if challengeStatuses[resp.StatusCode] {
+			if vendor := challengeVendor(resp.Header, f.challengeBody(resp)); vendor != "" {
+				return nil, f.challengeError(url, vendor, resp.StatusCode)
+			}
+		}
+		//nolint:gosec // URL sanitized by logURL; gosec can't track custom sanitizers
 		log.Printf("Non-200 status code %d for %s: %s",
-			resp.StatusCode, sanitizeLogValue(url), resp.Status)
-		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+			resp.StatusCode, f.logURL(url), resp.Status)
+		return nil, httpStatusError(url, resp.StatusCode, resp.Status)
 	}
 
 	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	readStart := time.Now()
+	wire := &wireReader{r: resp.Body}
+	bodyReader := newStallReader(wire, f.stallTimeout, cancel)
+	var decodedReader io.Reader = bodyReader
+	contentLength := resp.ContentLength
+	if gzipEncoded(resp.Header) {
+		decodedReader, err = decompressBody(bodyReader, f.decompression)
+		if err != nil {
+			bodyReader.stop()
+			log.Printf("Failed to read response body from %s: %v", f.logURL(url), err)
+			return nil, newFetchError(KindNetwork, url, err)
+		}
+		contentLength = -1
+	}
+	limitedReader := decodedReader
+	if maxBytes > 0 {
+		// One byte past the cap tells a body that fits from one that does not
+		limitedReader = io.LimitReader(decodedReader, maxBytes+1)
+		if contentLength < 0 || contentLength > maxBytes {
+			contentLength = maxBytes
+		}
+	}
+	bodyBuf, err := readBody(limitedReader, contentLength)
+	// A conversion abandoned over the processing budget may still be reading
+	// the body, whose buffer is then left to the garbage collector
+	keepBody := false
+	defer func() {
+		if !keepBody {
+			releaseBody(bodyBuf)
+		}
+	}()
+	bodyReader.stop()
+	body := bodyBuf.Bytes()
+	bodyTruncated := maxBytes > 0 && int64(len(body)) > maxBytes
+	if bodyTruncated {
+		body = body[:maxBytes]
+	}
+	timings.BodyRead = time.Since(readStart)
+	timings.BodyBytes = wire.n
+	if gzipEncoded(resp.Header) {
+		timings.Decompress = max(timings.BodyRead-wire.wait, 0)
+	}
+	var stallErr *StalledError
+	if err != nil && errors.As(context.Cause(ctx), &stallErr) {
+		log.Printf("Download stalled for %s: %v", f.logURL(url), stallErr)
+		return nil, newFetchError(KindNetwork, url, stallErr)
+	}
+	var limitErr *DecompressionLimitError
+	if errors.As(err, &limitErr) {
+		log.Printf("Aborted decompressing %s after %d compressed bytes: %v", f.logURL(url), limitErr.Compressed, limitErr)
+		return nil, newFetchError(KindPolicy, url, limitErr)
+	}
+	// A connection closed short of the declared Content-Length is a
+	// misconfigured origin more often than a network failure, so what
+	// arrived is kept. Compressed bodies are not checked: their length is
+	// not that of the decoded bytes, and a cut gzip stream fails to decode.
+	var declaredLength int64
+	if errors.Is(err, io.ErrUnexpectedEOF) && !gzipEncoded(resp.Header) && resp.ContentLength > int64(len(body)) {
+		log.Printf("Content-Length mismatch for %s: declared %d bytes, received %d",
+			f.logURL(url), resp.ContentLength, len(body))
+		declaredLength = resp.ContentLength
+		err = nil
+	}
 	if err != nil {
-		log.Printf("Failed to read response body from %s: %v", sanitizeLogValue(url), err)
-		return "", fmt.Errorf("failed to read response body: %v", err)
+		log.Printf("Failed to read response body from %s: %v", f.logURL(url), err)
+		return nil, newFetchError(KindNetwork, url, fmt.Errorf("failed to read response body: %w", err))
 	}
 
-	log.Printf("Successfully fetched %d bytes from %s", len(body), sanitizeLogValue(url))
+	bodySHA256 := sha256Hex(body)
+	log.Printf("Successfully fetched %d bytes from %s (sha256=%s)", len(body), f.logURL(url), bodySHA256)
+	if bodyTruncated {
+		log.Printf("Stopped reading %s at the %d byte limit", f.logURL(url), maxBytes)
+	}
 
-	content := string(body)
+	// An empty body has no content type to refuse
+	empty := len(body) == 0
+	if empty {
+		log.Printf("Empty response from %s (status %d)", f.logURL(url), resp.StatusCode)
+	} else if err := checkContentType(f.allowedTypes, resp.Header.Get("Content-Type"), body); err != nil {
+		log.Printf("Refused response from %s: %v", f.logURL(url), err)
+		return nil, newFetchError(KindPolicy, url, err)
+	}
+	mediaType := processingMediaType(resp.Header.Get("Content-Type"))
+	processorName := processorFor(f.processingRules, mediaType)
+	if processorName == ProcessorReject && !empty {
+		err := &ContentTypeError{ContentType: mediaType}
+		log.Printf("Refused response from %s by its processing rule: %v", f.logURL(url), err)
+		return nil, newFetchError(KindPolicy, url, err)
+	}
 
-	// Process HTML if not raw mode
-	if !raw && strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
-		content = f.processor.ProcessHTML(content)
+	decoded, charsetName := decodeBody(body, resp.Header.Get("Content-Type"))
+	if charsetName != "utf-8" {
+		log.Printf("Decoded content from %s as %s", f.logURL(url), charsetName)
 	}
+	if vendor := challengeVendor(resp.Header, decoded); vendor != "" {
+		return nil, f.challengeError(url, vendor, resp.StatusCode)
+	}
+
+	if directive, blocked := f.robotsChecker.PageDirective(resp.Header, resp.Header.Get("Content-Type"), decoded); blocked {
+		log.Printf("Access denied by robots meta directive %s for URL: %s", directive, f.logURL(url))
+		return nil, newFetchError(KindRobotsBlocked, url, fmt.Errorf("access to %s is disallowed by %s", url, directive))
+	}
+
+	page := &fetchedPage{
+		finalURL:      finalURL,
+		contentType:   resp.Header.Get("Content-Type"),
+		bodySHA256:    bodySHA256,
+		statusCode:    resp.StatusCode,
+		bodyTruncated: bodyTruncated,
+		empty:         empty,
+		bodyBytes:     int64(len(body)),
+		etag:          resp.Header.Get("ETag"),
+		lastModified:  resp.Header.Get("Last-Modified"),
+		cacheHeaders:  cacheHeaders(resp.Header),
+
+		declaredLength: declaredLength,
+	}
+	isHTML := strings.Contains(page.contentType, "text/html")
+	if isHTML && !empty {
+		page.canonicalURL = canonicalURL(decoded, resp.Request.URL)
+	} else if !isHTML {
+		page.sourceFormat = sourceFormat(page.contentType, resp.Request.URL)
+	}
+
+	// Process the content with its type's processor if not raw mode. An
+	// empty body is left empty rather than turned into a page holding only
+	// the title header. HTML is converted straight from the body's bytes.
+	var content string
+	processStart := time.Now()
+	switch {
+	case empty:
+	case raw:
+		content = string(decoded)
+	case processorName == ProcessorMarkdown:
+		content, page.warning, page.budgetExceeded = f.processHTML(decoded, finalURL)
+		keepBody = page.budgetExceeded
+	case processorName == ProcessorPretty:
+		content = indentJSON(string(decoded))
+	case processorName == ProcessorTable:
+		content, page.warning = csvTable(string(decoded))
+	case expected == ExpectJSON && contentKind(page.contentType) == ExpectJSON:
+		content = indentJSON(string(decoded))
+	default:
+		content = string(decoded)
+	}
+	timings.Processing = time.Since(processStart)
+	timings.done()
+	if page.warning != "" {
+		log.Printf("Processing degraded for %s: %s", f.logURL(url), page.warning)
+	}
+
+	log.Printf("Timing breakdown for %s: %s", f.logURL(url), timings)
 
-	return content, nil
+	page.content = content
+	page.queueWait = timings.HostWait
+	return page, nil
 }
@@ -1,8 +1,20 @@
 package fetcher
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -48,19 +60,19 @@ Disallow: /blocked/`
 
 func createTestFetcher() *HTTPFetcher {
 	client := &http.Client{Timeout: 5 * time.Second}
-	robotsChecker := robots.NewChecker("TestBot/1.0", false, client)
-	contentProcessor := processor.NewContentProcessor()
+	robotsChecker := robots.NewChecker("TestBot/1.0", "", false, false, client)
+	contentProcessor := processor.NewContentProcessor(processor.Options{DisableTitleHeader: true})
 
-	return NewHTTPFetcher(client, robotsChecker, contentProcessor, "TestBot/1.0")
+	return NewHTTPFetcher(client, robotsChecker, contentProcessor, "TestBot/1.0", nil, 0, 0, URLLimits{}, nil)
 }
 
 func TestNewHTTPFetcher(t *testing.T) {
 	client := &http.Client{Timeout: 5 * time.Second}
-	robotsChecker := robots.NewChecker("TestBot/1.0", false, client)
-	contentProcessor := processor.NewContentProcessor()
+	robotsChecker := robots.NewChecker("TestBot/1.0", "", false, false, client)
+	contentProcessor := processor.NewContentProcessor(processor.Options{DisableTitleHeader: true})
 	userAgent := "TestBot/1.0"
 
-	fetcher := NewHTTPFetcher(client, robotsChecker, contentProcessor, userAgent)
+	fetcher := NewHTTPFetcher(client, robotsChecker, contentProcessor, userAgent, nil, 0, 0, URLLimits{}, nil)
 
 	if fetcher.httpClient != client {
 		t.Error("expected httpClient to be set correctly")
@@ -86,10 +98,11 @@ func TestFetchURL(t *testing.T) {
 	fetcher := createTestFetcher()
 
 	tests := []struct {
-		name        string
-		request     *FetchRequest
-		expectError bool
-		expectedLen int // approximate length check
+		name         string
+		request      *FetchRequest
+		expectError  bool
+		expectedKind ErrorKind
+		expectedLen  int // approximate length check
 	}{
 		{
 			name: "successful HTML fetch",
@@ -115,8 +128,9 @@ func TestFetchURL(t *testing.T) {
 				URL: server.URL + "/error",
 				Raw: false,
 			},
-			expectError: true,
-			expectedLen: 0,
+			expectError:  true,
+			expectedKind: KindHTTPStatus,
+			expectedLen:  0,
 		},
 		{
 			name: "blocked by robots.txt",
@@ -124,8 +138,9 @@ func TestFetchURL(t *testing.T) {
 				URL: server.URL + "/blocked/page",
 				Raw: false,
 			},
-			expectError: true,
-			expectedLen: 0,
+			expectError:  true,
+			expectedKind: KindRobotsBlocked,
+			expectedLen:  0,
 		},
 		{
 			name: "fetch with formatting",
@@ -141,10 +156,10 @@ func TestFetchURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := fetcher.FetchURL(tt.request)
+			result, err := fetcher.FetchURL(t.Context(), tt.request)
 
-			if tt.expectError && err == nil {
-				t.Error("expected error but got none")
+			if tt.expectError && !errors.Is(err, tt.expectedKind) {
+				t.Errorf("expected a %s error, got %v", tt.expectedKind, err)
 			}
 
 			if !tt.expectError && err != nil {
@@ -152,8 +167,8 @@ func TestFetchURL(t *testing.T) {
 			}
 
 			if !tt.expectError {
-				if len(result) < tt.expectedLen {
-					t.Errorf("expected result length >= %d, got %d", tt.expectedLen, len(result))
+				if len(result.Content) < tt.expectedLen {
+					t.Errorf("expected result length >= %d, got %d", tt.expectedLen, len(result.Content))
 				}
 			}
 		})
@@ -161,6 +176,449 @@ func TestFetchURL(t *testing.T) {
 }
 
 // intPtr returns a pointer to an int
+func TestFetchURLRejectsNegativePaging(t *testing.T) {
+	_, err := createTestFetcher().FetchURL(t.Context(), &FetchRequest{URL: "http://127.0.0.1:1", StartIndex: intPtr(-3)})
+	if !errors.Is(err, KindInvalidRequest) || !strings.Contains(err.Error(), "invalid start_index -3") {
+		t.Errorf("expected invalid start_index error, got %v", err)
+	}
+}
+
 func intPtr(i int) *int {
 	return &i
 }
+
+func TestFetchURLRedactsLoggedURLs(t *testing.T) {
+	server := createMockServer()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	fetcher := createTestFetcher()
+	target := strings.Replace(server.URL, "http://", "http://admin:hunter2@", 1) + "/error?api_key=sk-live-123&page=1"
+
+	if _, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: target}); err == nil {
+		t.Fatal("expected error from error endpoint")
+	}
+
+	logs := buf.String()
+	for _, secret := range []string{"hunter2", "sk-live-123"} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("logs contain secret %q:\n%s", secret, logs)
+		}
+	}
+	if !strings.Contains(logs, "page=1") {
+		t.Errorf("expected non-sensitive parameters to be logged:\n%s", logs)
+	}
+}
+
+func TestFetchURLExplainsRobotsBlock(t *testing.T) {
+	server := createMockServer()
+	defer server.Close()
+
+	fetcher := createTestFetcher()
+	_, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/private/page"})
+
+	var blockedErr *RobotsBlockedError
+	if !errors.As(err, &blockedErr) || !errors.Is(err, KindRobotsBlocked) {
+		t.Fatalf("expected a robots_blocked error, got %v", err)
+	}
+	decision := blockedErr.Decision
+	if decision.Rule == nil || decision.Rule.Text != "Disallow: /private/" || decision.HostWide {
+		t.Errorf("unexpected decision: %+v", decision)
+	}
+	for _, want := range []string{`"Disallow: /private/"`, server.URL + "/robots.txt", "other paths on this host may be allowed"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %q, got %q", want, err)
+		}
+	}
+}
+
+func TestFetchURLRespectsRobotsMeta(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/header", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Robots-Tag", "noindex")
+		w.Write([]byte("private"))
+	})
+	mux.HandleFunc("/meta", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><meta name="robots" content="noai"></head><body><p>private</p></body></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	strict := NewHTTPFetcher(client, robots.NewChecker("TestBot/1.0", "", true, true, client),
+		processor.NewContentProcessor(processor.Options{DisableTitleHeader: true}), "TestBot/1.0", nil, 0, 0, URLLimits{}, nil)
+	lenient := createTestFetcher()
+
+	for path, directive := range map[string]string{"/header": `X-Robots-Tag "noindex"`, "/meta": `meta robots "noai"`} {
+		_, err := strict.FetchURL(t.Context(), &FetchRequest{URL: server.URL + path})
+		if !errors.Is(err, KindRobotsBlocked) || !strings.Contains(err.Error(), directive) {
+			t.Errorf("%s: expected a robots_blocked error naming %s, got %v", path, directive, err)
+		}
+
+		if _, err := lenient.FetchURL(t.Context(), &FetchRequest{URL: server.URL + path}); err != nil {
+			t.Errorf("%s: expected directives to be ignored by default, got %v", path, err)
+		}
+	}
+}
+
+func TestFetchURLContentHashes(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("testdata", "windows-1251.html"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(page)
+	}))
+	defer server.Close()
+
+	fetcher := createTestFetcher()
+	maxLength, startIndex := 10, 10
+	first, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL, MaxLength: &maxLength})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL, MaxLength: &maxLength, StartIndex: &startIndex})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The body hash covers the bytes as received, before transcoding
+	bodySum := sha256.Sum256(page)
+	if want := hex.EncodeToString(bodySum[:]); first.BodySHA256 != want {
+		t.Errorf("expected body hash %s, got %s", want, first.BodySHA256)
+	}
+	if first.ContentSHA256 == "" || first.ContentSHA256 == first.BodySHA256 {
+		t.Errorf("expected a distinct processed-content hash, got %q", first.ContentSHA256)
+	}
+	if first.BodySHA256 != second.BodySHA256 || first.ContentSHA256 != second.ContentSHA256 {
+		t.Errorf("expected hashes to be the same for every page: %+v %+v", first, second)
+	}
+}
+
+func TestFetchURLMaxBytes(t *testing.T) {
+	page := []byte(strings.Repeat("0123456789", 100))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(page)
+	}))
+	defer server.Close()
+
+	fetcher := createTestFetcher()
+
+	tests := []struct {
+		name      string
+		maxBytes  int64
+		expected  string
+		truncated bool
+	}{
+		{name: "unlimited", expected: string(page)},
+		{name: "cap cuts the body", maxBytes: 15, expected: "012345678901234", truncated: true},
+		{name: "body exactly at the cap", maxBytes: int64(len(page)), expected: string(page)},
+		{name: "cap above the body", maxBytes: 5000, expected: string(page)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL, MaxBytes: tt.maxBytes})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Content != tt.expected || result.BodyTruncated != tt.truncated {
+				t.Errorf("expected %d bytes (truncated=%v), got %d (truncated=%v)",
+					len(tt.expected), tt.truncated, len(result.Content), result.BodyTruncated)
+			}
+			// The hash covers the bytes actually downloaded
+			if want := sha256Hex([]byte(tt.expected)); result.BodySHA256 != want {
+				t.Errorf("expected body hash %s, got %s", want, result.BodySHA256)
+			}
+		})
+	}
+}
+
+func TestFetchURLTruncationReason(t *testing.T) {
+	page := []byte(strings.Repeat("0123456789", 100))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(page)
+	}))
+	defer server.Close()
+
+	fetcher := createTestFetcher()
+	maxLength := 100
+
+	tests := []struct {
+		name     string
+		req      FetchRequest
+		expected string
+		logged   string
+	}{
+		{name: "whole page", req: FetchRequest{URL: server.URL}},
+		{name: "max length", req: FetchRequest{URL: server.URL, MaxLength: &maxLength},
+			expected: TruncationMaxLength, logged: "reason=max_length returned=100 of 1000 characters"},
+		{name: "max bytes", req: FetchRequest{URL: server.URL, MaxBytes: 50},
+			expected: TruncationMaxBytes, logged: "reason=max_bytes downloaded=50 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			result, err := fetcher.FetchURL(t.Context(), &tt.req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.TruncationReason != tt.expected {
+				t.Errorf("expected truncation reason %q, got %q", tt.expected, result.TruncationReason)
+			}
+			truncations := strings.Count(buf.String(), "Content truncated")
+			if tt.logged == "" && truncations != 0 {
+				t.Errorf("expected no truncation logged, got:\n%s", buf.String())
+			}
+			if tt.logged != "" && (truncations != 1 || !strings.Contains(buf.String(), tt.logged)) {
+				t.Errorf("expected one truncation logged with %q, got:\n%s", tt.logged, buf.String())
+			}
+		})
+	}
+}
+
+func TestFetchURLEmptyResponses(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/no-content", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+	})
+	// Headers describing a page, as a HEAD response would, but no body
+	mux.HandleFunc("/headers-only", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	// An allowlist must not refuse a body that has no type to check
+	fetcher := NewHTTPFetcher(client, robots.NewChecker("TestBot/1.0", "", true, false, client),
+		processor.NewContentProcessor(processor.Options{}), "TestBot/1.0", nil, 0, 0, URLLimits{}, []string{"text/plain"})
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{path: "/no-content", status: http.StatusNoContent},
+		{path: "/empty", status: http.StatusOK},
+		{path: "/headers-only", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// Expecting a type the response does not have must not add a second warning
+			result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + tt.path, ExpectedContent: ExpectText})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !result.Empty || result.StatusCode != tt.status || result.Content != "" {
+				t.Errorf("expected an empty status %d result, got %+v", tt.status, result)
+			}
+			expected := Warnings{{Code: WarningEmptyResponse, Message: fmt.Sprintf("the server returned no content, status %d", tt.status)}}
+			if !reflect.DeepEqual(result.Warnings, expected) {
+				t.Errorf("expected %v, got %v", expected, result.Warnings)
+			}
+		})
+	}
+}
+
+// misstatedLength serves body with a Content-Length of declared, writing the
+// response on the raw connection since net/http refuses to send a wrong length
+func misstatedLength(declared int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n\r\n%s", declared, body)
+		buf.Flush()
+	}
+}
+
+func TestFetchURLContentLengthMismatch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/overstated", misstatedLength(100, "only part of the page"))
+	mux.HandleFunc("/understated", misstatedLength(9, "only part of the page"))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	fetcher := NewHTTPFetcher(client, robots.NewChecker("TestBot/1.0", "", true, false, client),
+		processor.NewContentProcessor(processor.Options{DisableTitleHeader: true}), "TestBot/1.0", nil, 0, 0, URLLimits{}, nil)
+
+	// A body shorter than declared is kept, with a warning, instead of failing
+	result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/overstated"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	message := "the server declared a Content-Length of 100 bytes but sent 21; the content is what was received"
+	if result.Content != "only part of the page" || !result.LengthMismatch ||
+		!reflect.DeepEqual(result.Warnings, Warnings{{Code: WarningLengthMismatch, Message: message}}) {
+		t.Errorf("expected the received body with a length mismatch warning, got %+v", result)
+	}
+
+	// The HTTP client stops reading at a length shorter than the body, so
+	// only the declared bytes are seen and nothing can be reported
+	result, err = fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/understated"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Content != "only part" || result.LengthMismatch {
+		t.Errorf("expected the declared bytes only, got %+v", result)
+	}
+
+	stats, _ := fetcher.DomainStats(1)
+	if len(stats) != 1 || stats[0].LengthMismatches != 1 || stats[0].Errors != 0 {
+		t.Errorf("expected one length mismatch and no errors, got %+v", stats)
+	}
+}
+
+func TestFetchURLDegradedProcessing(t *testing.T) {
+	server := createMockServer()
+	defer server.Close()
+
+	fetcher := New(WithRobots(allowAll{}), WithProcessor(&failingProcessor{}))
+
+	result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/html"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Content != "plain text" || result.Warning != "markdown conversion failed" {
+		t.Errorf("expected degraded content with a warning, got %q (warning %q)", result.Content, result.Warning)
+	}
+	if expected := (Warnings{{Code: WarningDegradedProcessing, Message: "markdown conversion failed"}}); !reflect.DeepEqual(result.Warnings, expected) {
+		t.Errorf("expected %v, got %v", expected, result.Warnings)
+	}
+
+	_, err = fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/html", Strict: true})
+	if !errors.Is(err, KindProcessing) || !strings.Contains(err.Error(), "markdown conversion failed") {
+		t.Errorf("expected a processing error for a strict request, got %v", err)
+	}
+}
+
+func TestSHA256HexString(t *testing.T) {
+	for _, s := range []string{"", "short", strings.Repeat("chunked content ", 10000)} {
+		if got, want := sha256HexString(s), sha256Hex([]byte(s)); got != want {
+			t.Errorf("length %d: expected %s, got %s", len(s), want, got)
+		}
+	}
+}
+
+// BenchmarkFetchURLLargeHTML measures a converted page, whose body is handed
+// to the processor without being copied into a string first
+func BenchmarkFetchURLLargeHTML(b *testing.B) {
+	page := []byte("<html><head><title>Large</title></head><body><pre>" +
+		strings.Repeat("Large documents are converted straight from the response body.\n", (1<<20)/64) +
+		"</pre></body></html>")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	}))
+	defer server.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	fetcher := NewHTTPFetcher(client, robots.NewChecker("TestBot/1.0", "", true, false, client),
+		processor.NewContentProcessor(processor.Options{DisableTitleHeader: true, DisableReadability: true}), "TestBot/1.0", nil, 0, 0, URLLimits{}, nil)
+	request := &FetchRequest{URL: server.URL}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(page)))
+	for b.Loop() {
+		if _, err := fetcher.FetchURL(b.Context(), request); err != nil {
+			b.Fatalf("fetch failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkFetchURLLargeBody(b *testing.B) {
+	page := bytes.Repeat([]byte(`{"message": "Hello, World!", "status": "ok"}`+"\n"), (1<<20)/45)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(page)
+	}))
+	defer server.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	fetcher := NewHTTPFetcher(client, robots.NewChecker("TestBot/1.0", "", true, false, client),
+		processor.NewContentProcessor(processor.Options{DisableTitleHeader: true}), "TestBot/1.0", nil, 0, 0, URLLimits{}, nil)
+	request := &FetchRequest{URL: server.URL, Raw: true}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(page)))
+	for b.Loop() {
+		if _, err := fetcher.FetchURL(b.Context(), request); err != nil {
+			b.Fatalf("fetch failed: %v", err)
+		}
+	}
+}
+
+// slowProcessor is a ContentProcessor whose conversion runs until its context
+// is done, reporting when it gave up
+type slowProcessor struct {
+	recordingProcessor
+	stopped chan struct{}
+}
+
+func (p *slowProcessor) ProcessHTMLContext(ctx context.Context, _ []byte, _ string) (string, string) {
+	<-ctx.Done()
+	close(p.stopped)
+	return "", ctx.Err().Error()
+}
+
+func TestFetchURLProcessingBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body><p>Slow to convert</p></body></html>"))
+	}))
+	defer server.Close()
+
+	slow := &slowProcessor{stopped: make(chan struct{})}
+	fetcher := New(WithRobots(allowAll{}), WithProcessor(slow), WithProcessingBudget(50*time.Millisecond))
+
+	result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.BudgetExceeded || !strings.Contains(result.Warning, "50ms processing budget") {
+		t.Errorf("expected the budget to be reported as exceeded, got %v %q", result.BudgetExceeded, result.Warning)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Code != WarningProcessingBudget || result.Warnings[0].Detail != "50ms" {
+		t.Errorf("expected a processing budget warning, got %v", result.Warnings)
+	}
+	if !strings.Contains(result.Content, "Slow to convert") {
+		t.Errorf("expected the plain text of the page, got %q", result.Content)
+	}
+	select {
+	case <-slow.stopped:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the abandoned conversion to be canceled")
+	}
+
+	stats, _ := fetcher.DomainStats(1)
+	if len(stats) != 1 || stats[0].BudgetBreaches != 1 {
+		t.Errorf("expected one budget breach, got %+v", stats)
+	}
+}
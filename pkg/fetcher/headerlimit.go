@@ -0,0 +1,91 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Defaults for HeaderLimits
+const (
+	DefaultMaxResponseHeaderBytes = 256 << 10
+	DefaultMaxResponseHeaders     = 256
+)
+
+// HeaderLimits bounds the response headers accepted, so an origin cannot
+// make the fetcher buffer megabytes of them
+type HeaderLimits struct {
+	// MaxBytes is the most bytes of response headers read, status line
+	// included. Zero selects DefaultMaxResponseHeaderBytes.
+	MaxBytes int64
+	// MaxCount is the most header lines a response may carry, counting each
+	// value of a repeated header. Zero selects DefaultMaxResponseHeaders.
+	MaxCount int
+}
+
+// withDefaults returns a copy of l with zero fields set to their defaults
+func (l HeaderLimits) withDefaults() HeaderLimits {
+	if l.MaxBytes == 0 {
+		l.MaxBytes = DefaultMaxResponseHeaderBytes
+	}
+	if l.MaxCount == 0 {
+		l.MaxCount = DefaultMaxResponseHeaders
+	}
+	return l
+}
+
+// ResponseHeaderError reports a response, redirects included, whose headers
+// exceeded one of the HeaderLimits
+type ResponseHeaderError struct {
+	// MaxBytes is set when the size limit was exceeded
+	MaxBytes int64
+	// Count and MaxCount are set when the count limit was exceeded
+	Count    int
+	MaxCount int
+}
+
+func (e *ResponseHeaderError) Error() string {
+	if e.MaxBytes > 0 {
+		return fmt.Sprintf("response headers exceeded the %d byte limit", e.MaxBytes)
+	}
+	return fmt.Sprintf("response carried %d headers, over the limit of %d", e.Count, e.MaxCount)
+}
+
+// LimitResponseHeaders makes transport read at most limits.MaxBytes of
+// response headers and returns next wrapped to refuse responses with more
+// than limits.MaxCount header lines. next is the round tripper in front of
+// transport, such as one from GuardMetadataEndpoints. Every hop of a
+// redirect is checked, and both limits fail with a *ResponseHeaderError.
+func LimitResponseHeaders(transport *http.Transport, next http.RoundTripper, limits HeaderLimits) http.RoundTripper {
+	limits = limits.withDefaults()
+	transport.MaxResponseHeaderBytes = limits.MaxBytes
+	return &headerLimiter{next: next, limits: limits}
+}
+
+// headerLimiter enforces HeaderLimits on the responses of next
+type headerLimiter struct {
+	next   http.RoundTripper
+	limits HeaderLimits
+}
+
+// RoundTrip implements http.RoundTripper
+func (l *headerLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := l.next.RoundTrip(req)
+	if err != nil {
+		// net/http reports the size limit only in its message
+		if strings.Contains(err.Error(), "server response headers exceeded") {
+			return nil, &ResponseHeaderError{MaxBytes: l.limits.MaxBytes}
+		}
+		return nil, err
+	}
+
+	count := 0
+	for _, values := range resp.Header {
+		count += len(values)
+	}
+	if count > l.limits.MaxCount {
+		resp.Body.Close()
+		return nil, &ResponseHeaderError{Count: count, MaxCount: l.limits.MaxCount}
+	}
+	return resp, nil
+}
@@ -0,0 +1,84 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newHeaderLimitedFetcher(limits HeaderLimits) *HTTPFetcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	client := &http.Client{Transport: LimitResponseHeaders(transport, transport, limits)}
+	return New(WithRobots(allowAll{}), WithHTTPClient(client))
+}
+
+func TestFetchURLResponseHeaderLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/many", "/redirect":
+			for i := range 5000 {
+				w.Header().Add(fmt.Sprintf("X-Filler-%d", i), "v")
+			}
+			if r.URL.Path == "/redirect" {
+				http.Redirect(w, r, "/ok", http.StatusFound)
+				return
+			}
+		case "/large":
+			w.Header().Set("X-Filler", strings.Repeat("v", 8<<10))
+		case "/repeated":
+			for range 300 {
+				w.Header().Add("Set-Cookie", "a=b")
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// The count limit is checked with the default size limit, which thousands
+	// of short headers stay within
+	f := newHeaderLimitedFetcher(HeaderLimits{})
+	small := newHeaderLimitedFetcher(HeaderLimits{MaxBytes: 4 << 10})
+
+	tests := map[string]*ResponseHeaderError{
+		"/many":     {Count: 5002, MaxCount: DefaultMaxResponseHeaders},
+		"/redirect": {Count: 5003, MaxCount: DefaultMaxResponseHeaders},
+		"/repeated": {Count: 303, MaxCount: DefaultMaxResponseHeaders},
+	}
+	for path, want := range tests {
+		_, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + path})
+		var headerErr *ResponseHeaderError
+		if !errors.Is(err, KindPolicy) || !errors.As(err, &headerErr) {
+			t.Errorf("%s: expected a header limit policy error, got %v", path, err)
+			continue
+		}
+		// The count includes the headers net/http adds, so only bound it
+		if headerErr.MaxBytes != want.MaxBytes || headerErr.MaxCount != want.MaxCount || headerErr.Count < want.Count-3 {
+			t.Errorf("%s: expected %+v, got %+v", path, want, headerErr)
+		}
+	}
+
+	_, err := small.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/large"})
+	var headerErr *ResponseHeaderError
+	if !errors.Is(err, KindPolicy) || !errors.As(err, &headerErr) || headerErr.MaxBytes != 4<<10 {
+		t.Errorf("expected the size limit to refuse large headers, got %v", err)
+	}
+	if content, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/large"}); err != nil || content.Content != "ok" {
+		t.Errorf("expected the default size limit to allow 8KB of headers, got %+v, %v", content, err)
+	}
+
+	if content, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/ok"}); err != nil || content.Content != "ok" {
+		t.Errorf("expected a response within the limits to be fetched, got %+v, %v", content, err)
+	}
+
+	stats, _ := f.DomainStats(0)
+	if len(stats) != 1 || stats[0].HeaderLimitAborts != int64(len(tests)) {
+		t.Errorf("expected %d header limit aborts, got %+v", len(tests), stats)
+	}
+	if stats, _ := small.DomainStats(0); len(stats) != 1 || stats[0].HeaderLimitAborts != 1 {
+		t.Errorf("expected the size limit abort counted, got %+v", stats)
+	}
+}
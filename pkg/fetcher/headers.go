@@ -0,0 +1,145 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Headers logged when DebugHeaders is enabled. They are the ones sites tend
+// to block on, so a blocked fetch can be reproduced from the logs.
+var (
+	debugRequestHeaders  = []string{"User-Agent", "Accept", "Accept-Language", "Accept-Encoding"}
+	debugResponseHeaders = []string{"Server", "Cf-Ray", "Retry-After", "X-Robots-Tag"}
+)
+
+// sensitiveHeaders are never logged, even when configured as extra headers
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// DebugHeaders configures logging of selected request and response headers
+// for every fetch, to help work out why a site blocks the fetcher
+type DebugHeaders struct {
+	// Enabled turns the logging on
+	Enabled bool
+	// Extra names headers to log in addition to the defaults, on both
+	// requests and responses. Credentials and cookies are never logged.
+	Extra []string
+}
+
+// headerLogger logs the allowlisted headers of a fetch. A nil *headerLogger
+// logs nothing.
+type headerLogger struct {
+	request  []string
+	response []string
+}
+
+// newHeaderLogger returns the logger for cfg, or nil when it is disabled
+func newHeaderLogger(cfg DebugHeaders) *headerLogger {
+	if !cfg.Enabled {
+		return nil
+	}
+	l := &headerLogger{
+		request:  slices.Clone(debugRequestHeaders),
+		response: slices.Clone(debugResponseHeaders),
+	}
+	for _, name := range cfg.Extra {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name == "" || slices.Contains(sensitiveHeaders, name) {
+			continue
+		}
+		if !slices.Contains(l.request, name) {
+			l.request = append(l.request, name)
+		}
+		if !slices.Contains(l.response, name) {
+			l.response = append(l.response, name)
+		}
+	}
+	return l
+}
+
+// traceRequest returns a context that records the headers actually written
+// to the wire, including those the transport adds such as Accept-Encoding,
+// and a function returning them once the request has been sent
+func (l *headerLogger) traceRequest(ctx context.Context) (context.Context, func() http.Header) {
+	if l == nil {
+		return ctx, func() http.Header { return nil }
+	}
+
+	var mu sync.Mutex
+	written := make(http.Header)
+	trace := &httptrace.ClientTrace{
+		WroteHeaderField: func(key string, value []string) {
+			mu.Lock()
+			defer mu.Unlock()
+			written[http.CanonicalHeaderKey(key)] = append(written[http.CanonicalHeaderKey(key)], value...)
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), func() http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return written.Clone()
+	}
+}
+
+// formatRequest formats the allowlisted request headers for logging
+func (l *headerLogger) formatRequest(header http.Header) string {
+	return formatHeaders(header, l.request)
+}
+
+// formatResponse formats the allowlisted response headers for logging
+func (l *headerLogger) formatResponse(header http.Header) string {
+	return formatHeaders(header, l.response)
+}
+
+// formatHeaders formats the headers of header named in names, in that order,
+// as name="value" pairs
+func formatHeaders(header http.Header, names []string) string {
+	var fields []string
+	for _, name := range names {
+		if values := header.Values(name); len(values) > 0 {
+			fields = append(fields, fmt.Sprintf("%s=%q", name, strings.Join(values, ", ")))
+		}
+	}
+	if len(fields) == 0 {
+		return "none"
+	}
+	return strings.Join(fields, " ")
+}
+
+// cacheHeaderNames are the response headers reported in
+// FetchResult.CacheHeaders, for clients that manage their own cache. Nothing
+// outside this list is ever reported.
+var cacheHeaderNames = []string{"ETag", "Last-Modified", "Cache-Control", "Expires", "Age", "Content-Language"}
+
+// maxCacheHeaderLength caps each reported header value, in bytes
+const maxCacheHeaderLength = 256
+
+// cacheHeaders returns the allowlisted caching headers of a response keyed by
+// lowercase name, with repeated headers joined by commas, surrounding and
+// control whitespace collapsed, and values cut to maxCacheHeaderLength. It
+// returns nil when the response has none of them.
+func cacheHeaders(header http.Header) map[string]string {
+	var headers map[string]string
+	for _, name := range cacheHeaderNames {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		value := strings.Join(strings.Fields(strings.Join(values, ", ")), " ")
+		if len(value) > maxCacheHeaderLength {
+			value = strings.ToValidUTF8(value[:maxCacheHeaderLength], "")
+		}
+		if value == "" {
+			continue
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[strings.ToLower(name)] = value
+	}
+	return headers
+}
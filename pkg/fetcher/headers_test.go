@@ -0,0 +1,97 @@
+package fetcher
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewHeaderLoggerNeverLogsSensitiveHeaders(t *testing.T) {
+	if newHeaderLogger(DebugHeaders{Extra: []string{"Via"}}) != nil {
+		t.Fatal("expected no logger when disabled")
+	}
+
+	l := newHeaderLogger(DebugHeaders{
+		Enabled: true,
+		Extra:   []string{"authorization", " Cookie ", "SET-COOKIE", "Proxy-Authorization", "via", "User-Agent"},
+	})
+	for _, names := range [][]string{l.request, l.response} {
+		for _, sensitive := range sensitiveHeaders {
+			if slices.Contains(names, sensitive) {
+				t.Errorf("expected %s never to be logged, got %v", sensitive, names)
+			}
+		}
+		if !slices.Contains(names, "Via") {
+			t.Errorf("expected the extra header Via to be logged, got %v", names)
+		}
+	}
+	if n := len(l.request); n != len(debugRequestHeaders)+1 {
+		t.Errorf("expected a configured default not to be repeated, got %v", l.request)
+	}
+}
+
+func TestFetchURLLogsDebugHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Server", "edge")
+		w.Header().Set("Cf-Ray", "8a1b2c3d")
+		w.Header().Set("Set-Cookie", "session=s3cr3t")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	fetcher := New(WithDebugHeaders("Authorization", "Set-Cookie"), WithRobots(allowAll{}))
+	// Credentials in the URL are sent as an Authorization header
+	target := strings.Replace(server.URL, "http://", "http://admin:hunter2@", 1)
+	if _, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: target}); err == nil {
+		t.Fatal("expected the 403 to fail the fetch")
+	}
+
+	logs := buf.String()
+	for _, want := range []string{`User-Agent="` + DefaultUserAgent + `"`, `Accept-Encoding="gzip"`, `Server="edge"`, `Cf-Ray="8a1b2c3d"`} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("expected the logs to contain %s:\n%s", want, logs)
+		}
+	}
+	for _, secret := range []string{"Authorization", "Basic ", "s3cr3t"} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("logs contain %q:\n%s", secret, logs)
+		}
+	}
+}
+
+func TestCacheHeaders(t *testing.T) {
+	header := http.Header{
+		"Etag":             {`W/"abc"`},
+		"Cache-Control":    {"public", "max-age=60"},
+		"Content-Language": {"en,\r\n de"},
+		"Expires":          {strings.Repeat("x", 1000)},
+		"Set-Cookie":       {"session=secret"},
+		"Authorization":    {"Bearer secret"},
+		"Server":           {"origin"},
+	}
+
+	headers := cacheHeaders(header)
+	expected := map[string]string{
+		"etag":             `W/"abc"`,
+		"cache-control":    "public, max-age=60",
+		"content-language": "en, de",
+		"expires":          strings.Repeat("x", maxCacheHeaderLength),
+	}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("expected %v, got %v", expected, headers)
+	}
+
+	if headers := cacheHeaders(http.Header{"Set-Cookie": {"a=b"}}); headers != nil {
+		t.Errorf("expected no cache headers, got %v", headers)
+	}
+}
@@ -0,0 +1,60 @@
+package fetcher
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	neturl "net/url"
+	"strings"
+)
+
+// errHostZone refuses IPv6 literals with a zone identifier, such as
+// [fe80::1%25eth0]. A zone names a network interface of the machine the
+// server runs on, which a client has no business choosing.
+var errHostZone = errors.New("IPv6 zone identifiers are not allowed in URLs")
+
+// normalizeHostname returns a host name or IP literal as policies compare
+// it: lowercased, without the trailing dot of a fully qualified name, so
+// example.com. and EXAMPLE.com are both example.com, and with IPv6 literals
+// unbracketed in their shortest form
+func normalizeHostname(hostname string) string {
+	hostname = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(hostname, "["), "]"))
+	if addr, err := netip.ParseAddr(hostname); err == nil {
+		return addr.String()
+	}
+	if trimmed := strings.TrimSuffix(hostname, "."); trimmed != "" {
+		hostname = trimmed
+	}
+	return hostname
+}
+
+// hostKey returns the host of u as per-host policies such as the circuit
+// breaker key it: its normalized hostname, with the port unless it is the
+// scheme's default and with IPv6 literals in brackets
+func hostKey(u *neturl.URL) string {
+	host, port := normalizeHostname(u.Hostname()), u.Port()
+	if port == defaultPorts[strings.ToLower(u.Scheme)] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		return net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		return "[" + host + "]"
+	default:
+		return host
+	}
+}
+
+// checkHost refuses hosts the fetcher does not support. URLs that do not
+// parse are left to fail when their request is made.
+func checkHost(rawURL string) error {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	if strings.Contains(parsed.Hostname(), "%") {
+		return errHostZone
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package fetcher
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// equivalentURLs are groups of weird but legal URLs that every per-host
+// policy must treat as the same host
+var equivalentURLs = []struct {
+	name     string
+	urls     []string
+	hostname string
+	hostKey  string
+}{
+	{
+		name:     "trailing dot and case",
+		urls:     []string{"https://example.com/", "https://EXAMPLE.com./", "https://example.com.:443/", "HTTPS://Example.COM/"},
+		hostname: "example.com",
+		hostKey:  "example.com",
+	},
+	{
+		name:     "IPv6 literal",
+		urls:     []string{"http://[2606:4700::1111]/", "http://[2606:4700:0:0::1111]:80/", "http://[2606:4700::1111]"},
+		hostname: "2606:4700::1111",
+		hostKey:  "[2606:4700::1111]",
+	},
+	{
+		name:     "IPv6 literal with a port",
+		urls:     []string{"https://[2001:DB8::1]:8443/", "https://[2001:db8:0::1]:8443/"},
+		hostname: "2001:db8::1",
+		hostKey:  "[2001:db8::1]:8443",
+	},
+	{
+		name:     "IPv4 literal",
+		urls:     []string{"http://192.0.2.1:8080/", "http://192.0.2.1.:8080/"},
+		hostname: "192.0.2.1",
+		hostKey:  "192.0.2.1:8080",
+	},
+}
+
+func TestHostPoliciesAgreeOnWeirdURLs(t *testing.T) {
+	profiles, err := parseHostProfiles([]byte(`{"example.com.": {"user_agent": "name"},
+		"[2606:4700:0::1111]": {"user_agent": "ipv6"}, "2001:db8::1": {"user_agent": "ipv6 port"},
+		"192.0.2.1": {"user_agent": "ipv4"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hostProfiles := &HostProfiles{}
+	hostProfiles.profiles.Store(&profiles)
+
+	for _, group := range equivalentURLs {
+		t.Run(group.name, func(t *testing.T) {
+			stats := newDomainStats()
+			cacheKeys := map[string]bool{}
+			for _, rawURL := range group.urls {
+				if host := circuitHost(rawURL); host != group.hostKey {
+					t.Errorf("circuit host of %s = %q, want %q", rawURL, host, group.hostKey)
+				}
+				if entry := stats.entry(rawURL); entry == nil || entry.Domain != group.hostname {
+					t.Errorf("stats domain of %s = %+v, want %q", rawURL, entry, group.hostname)
+				}
+				if err := checkHost(rawURL); err != nil {
+					t.Errorf("checkHost(%s): %v", rawURL, err)
+				}
+				host := rawURL[strings.Index(rawURL, "//")+2:]
+				host, _, _ = strings.Cut(host, "/")
+				if _, ok := hostProfiles.Match(host); !ok {
+					t.Errorf("no profile matched %s", host)
+				}
+				cacheKeys[cacheKey(rawURL)] = true
+			}
+			if len(stats.domains) != 1 {
+				t.Errorf("expected one domain, got %d", len(stats.domains))
+			}
+			if len(cacheKeys) != 1 {
+				t.Errorf("expected one cache key, got %v", cacheKeys)
+			}
+		})
+	}
+}
+
+func TestCheckHostRefusesZones(t *testing.T) {
+	for _, rawURL := range []string{"http://[fe80::1%25eth0]/", "http://[fe80::1%25eth0]:8080/x"} {
+		if err := checkHost(rawURL); !errors.Is(err, errHostZone) {
+			t.Errorf("checkHost(%s) = %v, want the zone error", rawURL, err)
+		}
+	}
+	if _, err := parseHostProfiles([]byte(`{"fe80::1%eth0": {}}`)); !errors.Is(err, errHostZone) {
+		t.Errorf("expected a zoned profile pattern to be refused, got %v", err)
+	}
+
+	f := New(WithRobots(allowAll{}))
+	_, err := f.FetchURL(t.Context(), &FetchRequest{URL: "http://[fe80::1%25eth0]/"})
+	if !errors.Is(err, KindInvalidURL) || !errors.Is(err, errHostZone) {
+		t.Errorf("expected an invalid URL error, got %v", err)
+	}
+}
+
+func TestFetchURLIPv6Literal(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Host+r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	f := New()
+	if _, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page", Raw: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/private/page"}); !errors.Is(err, KindRobotsBlocked) {
+		t.Errorf("expected robots.txt to apply to the IPv6 host, got %v", err)
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	mu.Lock()
+	if len(paths) == 0 || paths[0] != host+"/robots.txt" {
+		t.Errorf("expected robots.txt to be fetched from %s first, got %v", host, paths)
+	}
+	mu.Unlock()
+	stats, _ := f.DomainStats(0)
+	if len(stats) != 1 || stats[0].Domain != "::1" || stats[0].Fetches != 2 {
+		t.Errorf("expected both fetches counted for ::1, got %+v", stats)
+	}
+}
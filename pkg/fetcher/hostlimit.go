@@ -0,0 +1,143 @@
+package fetcher
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultMaxConnsPerHost is the per-host concurrency used when none is configured
+const DefaultMaxConnsPerHost = 2
+
+// hostLimiter caps how many fetches may run against one host at a time.
+// Fetches beyond the limit wait in arrival order, and a finishing fetch hands
+// its slot directly to the longest waiting one.
+type hostLimiter struct {
+	limit int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+// hostSlots tracks the fetches running and waiting for one host
+type hostSlots struct {
+	active  int
+	waiters []*hostWaiter
+}
+
+// hostWaiter is a fetch queued for a slot, signalled by closing ready
+type hostWaiter struct {
+	ready chan struct{}
+	since time.Time
+}
+
+// hostWaitError is the failure of a fetch that gave up waiting for its turn
+// at a host, for a connection slot or for the host's pace. It comes from
+// this fetcher's own queueing rather than from the host.
+type hostWaitError struct {
+	err error
+}
+
+// Error implements the error interface
+func (e *hostWaitError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying cause
+func (e *hostWaitError) Unwrap() error {
+	return e.err
+}
+
+// newHostLimiter creates a limiter allowing limit concurrent fetches per host
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{
+		limit: limit,
+		hosts: make(map[string]*hostSlots),
+	}
+}
+
+// acquire blocks until a slot for host is free or ctx is done. At most limit
+// fetches run against host at a time, or the limiter's own limit when limit
+// is zero. It reports whether the caller had to wait. Every successful
+// acquire must be paired with a release.
+func (l *hostLimiter) acquire(ctx context.Context, host string, limit int) (queued bool, err error) {
+	if limit <= 0 {
+		limit = l.limit
+	}
+	l.mu.Lock()
+	slots, ok := l.hosts[host]
+	if !ok {
+		slots = &hostSlots{}
+		l.hosts[host] = slots
+	}
+	if slots.active < limit && len(slots.waiters) == 0 {
+		slots.active++
+		l.mu.Unlock()
+		return false, nil
+	}
+	waiter := &hostWaiter{ready: make(chan struct{}), since: time.Now()}
+	slots.waiters = append(slots.waiters, waiter)
+	l.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return true, nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	if i := slices.Index(slots.waiters, waiter); i >= 0 {
+		slots.waiters = slices.Delete(slots.waiters, i, i+1)
+		l.mu.Unlock()
+		return true, ctx.Err()
+	}
+	l.mu.Unlock()
+
+	// The slot was handed over while ctx was being cancelled; pass it on
+	l.release(host)
+	return true, ctx.Err()
+}
+
+// release frees a slot for host, handing it to the next waiting fetch if any
+func (l *hostLimiter) release(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slots := l.hosts[host]
+	if len(slots.waiters) > 0 {
+		next := slots.waiters[0]
+		slots.waiters = slots.waiters[1:]
+		close(next.ready)
+		return
+	}
+	slots.active--
+	if slots.active == 0 {
+		delete(l.hosts, host)
+	}
+}
+
+// longestWait returns how long the fetch queued longest, across all hosts,
+// has been waiting for a slot, or zero when none is waiting
+func (l *hostLimiter) longestWait() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var oldest time.Time
+	for _, slots := range l.hosts {
+		// Waiters are queued in arrival order, so the first is the oldest
+		if len(slots.waiters) > 0 && (oldest.IsZero() || slots.waiters[0].since.Before(oldest)) {
+			oldest = slots.waiters[0].since
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
+
+// QueueWait returns how long the longest waiting fetch has been queued behind
+// the per-host connection limit, or zero when no fetch is waiting
+func (f *HTTPFetcher) QueueWait() time.Duration {
+	return f.hostLimiter.longestWait()
+}
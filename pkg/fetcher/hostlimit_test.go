@@ -0,0 +1,257 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterQueuesInArrivalOrder(t *testing.T) {
+	limiter := newHostLimiter(1)
+	if queued, err := limiter.acquire(t.Context(), "example.com", 0); queued || err != nil {
+		t.Fatalf("expected a free slot, got queued=%v err=%v", queued, err)
+	}
+
+	// Other hosts are not affected
+	if queued, err := limiter.acquire(t.Context(), "other.example", 0); queued || err != nil {
+		t.Fatalf("expected a free slot for another host, got queued=%v err=%v", queued, err)
+	}
+	limiter.release("other.example")
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if queued, err := limiter.acquire(context.Background(), "example.com", 0); !queued || err != nil {
+				t.Errorf("waiter %d: expected to be queued, got queued=%v err=%v", i, queued, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			limiter.release("example.com")
+		}()
+		waitForWaiters(t, limiter, "example.com", i+1)
+	}
+
+	limiter.release("example.com")
+	wg.Wait()
+
+	if fmt.Sprint(order) != "[0 1 2]" {
+		t.Errorf("expected waiters to run in arrival order, got %v", order)
+	}
+	if len(limiter.hosts) != 0 {
+		t.Errorf("expected idle hosts to be forgotten, got %d", len(limiter.hosts))
+	}
+}
+
+func TestHostLimiterCancelledWait(t *testing.T) {
+	limiter := newHostLimiter(1)
+	if _, err := limiter.acquire(t.Context(), "example.com", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx, "example.com", 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// The abandoned wait must not hold on to the slot
+	limiter.release("example.com")
+	if queued, err := limiter.acquire(t.Context(), "example.com", 0); queued || err != nil {
+		t.Errorf("expected the slot to be free, got queued=%v err=%v", queued, err)
+	}
+}
+
+func TestHostLimiterLongestWait(t *testing.T) {
+	limiter := newHostLimiter(1)
+	if wait := limiter.longestWait(); wait != 0 {
+		t.Errorf("expected no wait when idle, got %s", wait)
+	}
+	if _, err := limiter.acquire(t.Context(), "example.com", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wait := limiter.longestWait(); wait != 0 {
+		t.Errorf("expected no wait with a free host, got %s", wait)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := limiter.acquire(t.Context(), "example.com", 0); err == nil {
+			limiter.release("example.com")
+		}
+	}()
+	waitForWaiters(t, limiter, "example.com", 1)
+	time.Sleep(20 * time.Millisecond)
+	if wait := limiter.longestWait(); wait < 20*time.Millisecond {
+		t.Errorf("expected the queued fetch to have waited at least 20ms, got %s", wait)
+	}
+
+	limiter.release("example.com")
+	<-done
+	if wait := limiter.longestWait(); wait != 0 {
+		t.Errorf("expected no wait once the queue drained, got %s", wait)
+	}
+}
+
+func TestFetchURLLimitsConcurrencyPerHost(t *testing.T) {
+	var active, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("slow"))
+	}))
+	defer server.Close()
+
+	fetcher := createTestFetcher()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: fmt.Sprintf("%s/page/%d", server.URL, i), Raw: true}); err != nil {
+				t.Errorf("fetch %d failed: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got != DefaultMaxConnsPerHost {
+		t.Errorf("expected at most %d concurrent fetches, got %d", DefaultMaxConnsPerHost, got)
+	}
+}
+
+// waitForWaiters blocks until n fetches are queued for host
+func waitForWaiters(t *testing.T, limiter *hostLimiter, host string, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		limiter.mu.Lock()
+		waiting := 0
+		if slots, ok := limiter.hosts[host]; ok {
+			waiting = len(slots.waiters)
+		}
+		limiter.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued fetches", n)
+}
+
+func TestFetchURLReportsQueueWait(t *testing.T) {
+	hold := 200 * time.Millisecond
+	arrived := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(arrived)
+			time.Sleep(hold)
+		}
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	fetcher := New(WithRobots(allowAll{}), WithMaxConnsPerHost(1))
+	var slow *FetchResult
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var err error
+		if slow, err = fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/slow", Raw: true}); err != nil {
+			t.Errorf("slow fetch failed: %v", err)
+		}
+	}()
+	<-arrived
+
+	queued, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/fast", Raw: true})
+	if err != nil {
+		t.Fatalf("queued fetch failed: %v", err)
+	}
+	<-done
+
+	// The queued fetch waited for the slow one's slot, which did not wait
+	if queued.QueueWait < hold/2 {
+		t.Errorf("expected the queued fetch to wait about %s, got %s", hold, queued.QueueWait)
+	}
+	if slow == nil || slow.QueueWait >= hold/2 {
+		t.Errorf("expected the first fetch not to wait, got %+v", slow)
+	}
+}
+
+func TestFetchURLCancelReleasesHostSlot(t *testing.T) {
+	arrived := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hang" {
+			close(arrived)
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	fetcher := New(WithRobots(allowAll{}), WithMaxConnsPerHost(1))
+	ctx, cancel := context.WithCancel(t.Context())
+	hung := make(chan error, 1)
+	go func() {
+		_, err := fetcher.FetchURL(ctx, &FetchRequest{URL: server.URL + "/hang", Raw: true})
+		hung <- err
+	}()
+	<-arrived
+
+	// A fetch queued behind it gives up its place when cancelled
+	queuedCtx, cancelQueued := context.WithCancel(t.Context())
+	queued := make(chan error, 1)
+	go func() {
+		_, err := fetcher.FetchURL(queuedCtx, &FetchRequest{URL: server.URL + "/queued", Raw: true})
+		queued <- err
+	}()
+	u, _ := neturl.Parse(server.URL)
+	waitForWaiters(t, fetcher.hostLimiter, hostKey(u), 1)
+	cancelQueued()
+	if err := <-queued; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the queued fetch to be cancelled, got %v", err)
+	}
+
+	// Cancelling the download in progress frees the host's only slot
+	cancel()
+	select {
+	case err := <-hung:
+		if err == nil {
+			t.Error("expected the cancelled download to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelling did not abort the download")
+	}
+	result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/next", Raw: true})
+	if err != nil || result.Content != "done" || result.QueueWait >= 100*time.Millisecond {
+		t.Errorf("expected the slot to be free for the next fetch, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,201 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// MetadataEndpointError reports a request refused because it targets a cloud
+// instance metadata service. A single successful fetch of such an endpoint
+// can leak the credentials of the machine the server runs on.
+type MetadataEndpointError struct {
+	// Host is the hostname or IP address that was refused
+	Host string
+}
+
+// Error implements the error interface
+func (e *MetadataEndpointError) Error() string {
+	return fmt.Sprintf("access to cloud metadata endpoint %s is blocked", e.Host)
+}
+
+// metadataAddrs are the addresses of cloud instance metadata services
+var metadataAddrs = []netip.Addr{
+	netip.MustParseAddr("169.254.169.254"), // AWS, GCP, Azure, OpenStack and others
+	netip.MustParseAddr("169.254.170.2"),   // AWS ECS task metadata
+	netip.MustParseAddr("fd00:ec2::254"),   // AWS over IPv6
+	netip.MustParseAddr("100.100.100.200"), // Alibaba Cloud
+}
+
+// metadataHostnames are names that resolve to a metadata service from inside
+// the cloud they belong to
+var metadataHostnames = []string{
+	"metadata.google.internal",
+	"metadata.goog",
+}
+
+// GuardMetadataEndpoints makes transport refuse connections to cloud metadata
+// services and returns a round tripper that also refuses requests naming
+// them. The request check covers proxied requests, whose connections go to
+// the proxy; the dial check covers hostnames that resolve to a metadata
+// address, and dials the addresses it checked through the dialer already set
+// on transport, such as one bound by BindSourceAddress. Both fail with a
+// *MetadataEndpointError.
+func GuardMetadataEndpoints(transport *http.Transport) http.RoundTripper {
+	return guardMetadataEndpoints(transport, net.DefaultResolver)
+}
+
+// GuardMetadataEndpointsWithResolver is GuardMetadataEndpoints looking hosts
+// up with resolver, such as one from NewResolver, rather than the system's
+func GuardMetadataEndpointsWithResolver(transport *http.Transport, resolver *net.Resolver) http.RoundTripper {
+	return guardMetadataEndpoints(transport, resolver)
+}
+
+// guardMetadataEndpoints is GuardMetadataEndpoints with the resolver used for
+// dialing made explicit
+func guardMetadataEndpoints(transport *http.Transport, resolver hostResolver) http.RoundTripper {
+	dial := transport.DialContext
+	if dial == nil {
+		dial = newDialer(nil).DialContext
+	}
+	dialer := &pinnedDialer{
+		resolver: resolver,
+		dial:     refuseMetadataConn(dial),
+	}
+	transport.DialContext = dialer.DialContext
+	return &metadataGuard{next: transport}
+}
+
+// hostResolver looks up the addresses of a host; *net.Resolver implements it
+type hostResolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// pinnedDialer resolves a host once, checks every address it resolves to and
+// connects to those same addresses. Letting the dialer resolve again after
+// the check would allow a DNS rebinding attack to pass it with one answer and
+// connect with another. TLS server names and Host headers come from the
+// request URL, so they still carry the original hostname.
+type pinnedDialer struct {
+	resolver hostResolver
+	dial     dialFunc
+	// allowMetadata skips the checks, leaving only the pinned lookup
+	allowMetadata bool
+}
+
+// dialFunc is the signature of http.Transport.DialContext
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// DialContext connects to address, refusing it when any of the addresses its
+// host resolves to is a metadata service
+func (d *pinnedDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if !d.allowMetadata && isMetadataHost(host) {
+		return nil, &MetadataEndpointError{Host: host}
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return d.dial(ctx, network, address)
+	}
+
+	addrs, err := d.resolver.LookupNetIP(ctx, lookupNetwork(network), host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	// A host answering with both public and metadata addresses is refused
+	// outright rather than dialed on the public ones
+	for _, addr := range addrs {
+		if !d.allowMetadata && isMetadataHost(addr.String()) {
+			return nil, &MetadataEndpointError{Host: host}
+		}
+	}
+
+	var errs []error
+	for _, addr := range addrs {
+		conn, err := d.dial(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// lookupNetwork maps a dial network to the matching resolver network
+func lookupNetwork(network string) string {
+	switch network {
+	case "tcp4", "udp4":
+		return "ip4"
+	case "tcp6", "udp6":
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// metadataGuard refuses requests whose host is a metadata service
+type metadataGuard struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (g *metadataGuard) RoundTrip(req *http.Request) (*http.Response, error) {
+	if host := req.URL.Hostname(); isMetadataHost(host) {
+		return nil, &MetadataEndpointError{Host: host}
+	}
+	return g.next.RoundTrip(req)
+}
+
+// refuseMetadataConn wraps dial to close connections that reached a metadata
+// address anyway, before anything is sent on them
+func refuseMetadataConn(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if err := refuseMetadataAddr(network, conn.RemoteAddr().String(), nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// refuseMetadataAddr rejects connections to metadata addresses. It has the
+// signature of a net.Dialer Control function; address is an IP and port.
+func refuseMetadataAddr(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if isMetadataHost(host) {
+		return &MetadataEndpointError{Host: host}
+	}
+	return nil
+}
+
+// isMetadataHost reports whether host, an IP address or hostname, names a
+// cloud metadata service
+func isMetadataHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return slices.Contains(metadataAddrs, addr.Unmap().WithZone(""))
+	}
+	return slices.Contains(metadataHostnames, host)
+}
@@ -0,0 +1,169 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIsMetadataHost(t *testing.T) {
+	tests := map[string]bool{
+		"169.254.169.254":           true,
+		"[fd00:ec2::254]":           true,
+		"fd00:ec2:0::254":           true,
+		"::ffff:169.254.169.254":    true,
+		"100.100.100.200":           true,
+		"metadata.google.internal":  true,
+		"METADATA.Google.Internal.": true,
+		"169.254.169.253":           false,
+		"example.com":               false,
+		"metadata.example.com":      false,
+	}
+
+	for host, expected := range tests {
+		if got := isMetadataHost(host); got != expected {
+			t.Errorf("isMetadataHost(%q) = %v, expected %v", host, got, expected)
+		}
+	}
+}
+
+func TestGuardMetadataEndpointsRefusesRequests(t *testing.T) {
+	client := &http.Client{
+		Transport: GuardMetadataEndpoints(http.DefaultTransport.(*http.Transport).Clone()),
+		Timeout:   5 * time.Second,
+	}
+
+	for _, target := range []string{
+		"http://169.254.169.254/latest/meta-data/iam/security-credentials/",
+		"http://[fd00:ec2::254]/latest/meta-data/",
+		"http://metadata.google.internal/computeMetadata/v1/",
+	} {
+		_, err := client.Get(target)
+		var metadataErr *MetadataEndpointError
+		if !errors.As(err, &metadataErr) {
+			t.Errorf("%s: expected MetadataEndpointError, got %v", target, err)
+		}
+	}
+
+	// Other hosts are unaffected
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestRefuseMetadataAddr(t *testing.T) {
+	// The dialer sees resolved addresses, so a hostname pointing at the
+	// metadata service is caught here
+	for _, address := range []string{"169.254.169.254:80", "[fd00:ec2::254]:80"} {
+		var metadataErr *MetadataEndpointError
+		if err := refuseMetadataAddr("tcp", address, nil); !errors.As(err, &metadataErr) {
+			t.Errorf("%s: expected MetadataEndpointError, got %v", address, err)
+		}
+	}
+	if err := refuseMetadataAddr("tcp", "127.0.0.1:80", nil); err != nil {
+		t.Errorf("expected loopback to be allowed, got %v", err)
+	}
+}
+
+// fakeResolver answers lookups from a fixed table and counts them
+type fakeResolver struct {
+	mu      sync.Mutex
+	answers map[string][]netip.Addr
+	lookups map[string]int
+}
+
+func (r *fakeResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups[host]++
+	addrs, ok := r.answers[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func TestPinnedDialerChecksEveryAnswer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			_, port, _ := net.SplitHostPort(r.Host)
+			http.Redirect(w, r, "http://internal.test:"+port+"/", http.StatusFound)
+			return
+		}
+		w.Write([]byte("host=" + r.Host))
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	loopback := netip.MustParseAddr("127.0.0.1")
+	resolver := &fakeResolver{
+		answers: map[string][]netip.Addr{
+			"public.test":   {loopback},
+			"rebind.test":   {loopback, netip.MustParseAddr("169.254.169.254")},
+			"rebind6.test":  {netip.MustParseAddr("fd00:ec2::254"), loopback},
+			"internal.test": {netip.MustParseAddr("169.254.169.254")},
+		},
+		lookups: make(map[string]int),
+	}
+	client := &http.Client{
+		Transport: guardMetadataEndpoints(http.DefaultTransport.(*http.Transport).Clone(), resolver),
+		Timeout:   5 * time.Second,
+	}
+
+	// The connection goes to the resolved address but the request keeps
+	// the original hostname
+	resp, err := client.Get(fmt.Sprintf("http://public.test:%d/", port))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := fmt.Sprintf("host=public.test:%d", port); string(body) != want {
+		t.Errorf("expected %q, got %q", want, body)
+	}
+	if resolver.lookups["public.test"] != 1 {
+		t.Errorf("expected public.test to be resolved once, got %d lookups", resolver.lookups["public.test"])
+	}
+
+	// A single metadata answer among public ones refuses the host
+	for _, host := range []string{"rebind.test", "rebind6.test"} {
+		_, err := client.Get(fmt.Sprintf("http://%s:%d/", host, port))
+		var metadataErr *MetadataEndpointError
+		if !errors.As(err, &metadataErr) || metadataErr.Host != host {
+			t.Errorf("%s: expected MetadataEndpointError naming the host, got %v", host, err)
+		}
+	}
+
+	// Redirect targets are dialed through the same checks
+	_, err = client.Get(fmt.Sprintf("http://public.test:%d/redirect", port))
+	var metadataErr *MetadataEndpointError
+	if !errors.As(err, &metadataErr) || metadataErr.Host != "internal.test" {
+		t.Errorf("expected the redirect to internal.test to be refused, got %v", err)
+	}
+}
+
+func TestPinnedDialerUnknownHost(t *testing.T) {
+	dialer := &pinnedDialer{
+		resolver: &fakeResolver{lookups: make(map[string]int)},
+		dial:     (&net.Dialer{}).DialContext,
+	}
+	_, err := dialer.DialContext(t.Context(), "tcp", "missing.test:80")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("expected a not found DNS error, got %v", err)
+	}
+}
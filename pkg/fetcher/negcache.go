@@ -0,0 +1,133 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxNegativeEntries bounds the failed URLs remembered. Expired entries are
+// dropped first; past that the cache forgets everything rather than grow.
+const maxNegativeEntries = 10000
+
+// negativeCache remembers recent fetch failures by failureKey, so that a client
+// retrying a failing URL right away gets the failure back without paying its
+// latency again. It is safe for concurrent use.
+type negativeCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]negativeEntry
+}
+
+// negativeEntry is a remembered failure
+type negativeEntry struct {
+	err     *FetchError
+	expires time.Time
+}
+
+// newNegativeCache returns a cache keeping failures for ttl, or nil when ttl
+// is not positive. A nil cache remembers nothing.
+func newNegativeCache(ttl time.Duration) *negativeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &negativeCache{ttl: ttl, now: time.Now, entries: make(map[string]negativeEntry)}
+}
+
+// cacheableFailure reports whether a failure of this kind is likely to recur
+// on an immediate retry. Invalid requests and oversized URLs fail before any
+// request is made, and processing failures depend on the request's options.
+func cacheableFailure(kind ErrorKind) bool {
+	switch kind {
+	case KindHTTPStatus, KindNetwork, KindDNSFailure, KindRobotsBlocked, KindPolicy, KindBotProtection:
+		return true
+	default:
+		return false
+	}
+}
+
+// localFailure reports whether err came from this side of a fetch made with
+// ctx rather than from the host: the caller cancelling the fetch or running
+// out of time for it, or the fetch giving up its wait for a turn at the
+// host. A retry of such a failure may well succeed, so it is not remembered.
+func localFailure(ctx context.Context, err error) bool {
+	var waitErr *hostWaitError
+	return err != nil && (ctx.Err() != nil || errors.Is(err, KindCanceled) || errors.As(err, &waitErr))
+}
+
+// failureKey is the key the failures of req are remembered under: the
+// cacheKey of its URL along with the rest of what the response depends on,
+// the expected content sent as Accept, the conditional headers and the body
+// size cap
+func failureKey(req *FetchRequest) string {
+	expected, err := normalizeExpectedContent(req.ExpectedContent)
+	if err != nil {
+		expected = req.ExpectedContent
+	}
+	return fmt.Sprintf("%s accept=%s if-none-match=%q if-modified-since=%q max-bytes=%d",
+		cacheKey(req.URL), expected, req.IfNoneMatch, req.IfModifiedSince, req.MaxBytes)
+}
+
+// get returns the failure remembered under url, a failureKey, marked as
+// cached, or nil
+func (c *negativeCache) get(url string) *FetchError {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[url]
+	if !ok {
+		return nil
+	}
+	now := c.now()
+	if !now.Before(entry.expires) {
+		delete(c.entries, url)
+		return nil
+	}
+
+	cached := *entry.err
+	cached.Cached = true
+	cached.Err = fmt.Errorf("%w (cached failure, retry after %s)", entry.err.Err,
+		entry.expires.Sub(now).Round(time.Second))
+	return &cached
+}
+
+// record remembers err as the outcome of fetching url, or forgets url when
+// the fetch succeeded
+func (c *negativeCache) record(url string, err error) {
+	if c == nil {
+		return
+	}
+	var fetchErr *FetchError
+	ok := errors.As(err, &fetchErr)
+	if ok && (fetchErr.Cached || !cacheableFailure(fetchErr.Kind)) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		delete(c.entries, url)
+		return
+	}
+	if !ok {
+		return
+	}
+	now := c.now()
+	if len(c.entries) >= maxNegativeEntries {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxNegativeEntries {
+			clear(c.entries)
+		}
+	}
+	c.entries[url] = negativeEntry{err: fetchErr, expires: now.Add(c.ttl)}
+}
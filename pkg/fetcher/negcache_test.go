@@ -0,0 +1,199 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+func TestNegativeCache(t *testing.T) {
+	var requests atomic.Int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		case "/flaky":
+			requests.Add(1)
+			if healthy.Load() {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte("recovered"))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	fetcher := New(
+		WithHTTPClient(client),
+		WithRobots(robots.NewChecker("TestBot/1.0", "", false, false, client)),
+		WithProcessor(processor.NewContentProcessor(processor.Options{DisableTitleHeader: true})),
+		WithNegativeCacheTTL(time.Minute),
+	)
+	now := time.Now()
+	fetcher.failures.now = func() time.Time { return now }
+
+	// A retry within the TTL returns the same failure without a request
+	for i := range 3 {
+		_, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/flaky"})
+		var fetchErr *FetchError
+		if !errors.As(err, &fetchErr) || fetchErr.Kind != KindHTTPStatus || fetchErr.StatusCode != http.StatusNotFound {
+			t.Fatalf("fetch %d: expected the 404, got %v", i+1, err)
+		}
+		if cached := i > 0; fetchErr.Cached != cached || strings.Contains(err.Error(), "cached failure") != cached {
+			t.Errorf("fetch %d: expected cached=%t, got %v (%+v)", i+1, cached, err, fetchErr)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected one request while the failure is cached, got %d", n)
+	}
+
+	// Once the TTL passes the URL is tried again, and success clears it
+	healthy.Store(true)
+	now = now.Add(time.Minute)
+	if result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/flaky"}); err != nil || result.Content != "recovered" {
+		t.Fatalf("expected the recovered page after the TTL, got %v", err)
+	}
+	if _, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/flaky"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("expected successes never to be cached, got %d requests", n)
+	}
+
+	// Robots refusals are cached and keep their details
+	for range 2 {
+		_, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/private"})
+		var blocked *RobotsBlockedError
+		if !errors.Is(err, KindRobotsBlocked) || !errors.As(err, &blocked) {
+			t.Fatalf("expected a robots refusal, got %v", err)
+		}
+	}
+
+	stats, _ := fetcher.DomainStats(1)
+	if len(stats) != 1 || stats[0].CachedFailures != 3 || stats[0].Fetches != 7 {
+		t.Errorf("expected 3 of 7 fetches answered from the cache, got %+v", stats)
+	}
+}
+
+func TestNegativeCacheSkipsInvalidRequests(t *testing.T) {
+	cache := newNegativeCache(time.Minute)
+	cache.record("http://example.com/", newFetchError(KindInvalidRequest, "http://example.com/", errors.New("bad")))
+	cache.record("http://example.com/big", newFetchError(KindTooLarge, "http://example.com/big", errors.New("big")))
+	if cache.get("http://example.com/") != nil || cache.get("http://example.com/big") != nil {
+		t.Error("expected failures that depend on the request not to be cached")
+	}
+
+	// A failure a stage wrapped is still remembered
+	cache.record("http://example.com/down", fmt.Errorf("stage: %w",
+		newFetchError(KindNetwork, "http://example.com/down", errors.New("refused"))))
+	if cached := cache.get("http://example.com/down"); cached == nil || cached.Kind != KindNetwork {
+		t.Errorf("expected a wrapped failure to be cached, got %v", cached)
+	}
+
+	if newNegativeCache(0) != nil {
+		t.Error("expected a zero TTL to disable the cache")
+	}
+}
+
+func TestNegativeCacheKeysByRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("Accept"), "application/json") {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("text"))
+	}))
+	defer server.Close()
+
+	fetcher := New(WithRobots(allowAll{}), WithNegativeCacheTTL(time.Minute))
+
+	// A 406 for JSON is remembered for JSON fetches only
+	for i := range 2 {
+		_, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page", ExpectedContent: ExpectJSON})
+		var fetchErr *FetchError
+		if !errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusNotAcceptable || fetchErr.Cached != (i > 0) {
+			t.Fatalf("fetch %d: expected the 406, cached=%t, got %v", i+1, i > 0, err)
+		}
+	}
+	if result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page"}); err != nil || result.Content != "text" {
+		t.Fatalf("expected the default fetch not to get the JSON fetch's failure, got %v", err)
+	}
+
+	if failureKey(&FetchRequest{URL: server.URL, MaxBytes: 10}) == failureKey(&FetchRequest{URL: server.URL, MaxBytes: 20}) ||
+		failureKey(&FetchRequest{URL: server.URL, IfNoneMatch: `"a"`}) == failureKey(&FetchRequest{URL: server.URL}) {
+		t.Error("expected the byte limit and conditional headers to be part of the key")
+	}
+	if failureKey(&FetchRequest{URL: server.URL, ExpectedContent: "JSON"}) != failureKey(&FetchRequest{URL: server.URL, ExpectedContent: ExpectJSON}) {
+		t.Error("expected the expected content to be normalized in the key")
+	}
+}
+
+func TestNegativeCacheSkipsLocalFailures(t *testing.T) {
+	var slow atomic.Bool
+	slow.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first request for /slow hangs until its client gives up
+		if r.URL.Path == "/slow" && slow.Swap(false) {
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	fetcher := New(WithRobots(allowAll{}), WithNegativeCacheTTL(time.Minute), WithMaxConnsPerHost(1))
+
+	// A fetch that runs out of its caller's time is not remembered
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	_, err := fetcher.FetchURL(ctx, &FetchRequest{URL: server.URL + "/slow"})
+	cancel()
+	if err == nil {
+		t.Fatal("expected the short deadline to fail the fetch")
+	}
+	if result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/slow"}); err != nil || result.Content != "ok" {
+		t.Fatalf("expected the retry to be fetched, got %v", err)
+	}
+
+	// Nor is a fetch that gives up waiting for a connection slot
+	u, _ := url.Parse(server.URL)
+	host := hostKey(u)
+	if _, err := fetcher.hostLimiter.acquire(t.Context(), host, 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(t.Context(), 20*time.Millisecond)
+	_, err = fetcher.FetchURL(ctx, &FetchRequest{URL: server.URL + "/page"})
+	cancel()
+	if err == nil || !strings.Contains(err.Error(), "failed waiting for a connection") {
+		t.Fatalf("expected the fetch to give up waiting for a slot, got %v", err)
+	}
+	fetcher.hostLimiter.release(host)
+	if result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page"}); err != nil || result.Content != "ok" {
+		t.Fatalf("expected the retry to be fetched, got %v", err)
+	}
+
+	// Waits for a turn at the host count as local whatever the context
+	waitErr := newFetchError(KindNetwork, server.URL, &hostWaitError{errors.New("gave up")})
+	if !localFailure(t.Context(), waitErr) || localFailure(t.Context(), newFetchError(KindNetwork, server.URL, errors.New("refused"))) {
+		t.Error("expected only the host wait to count as a local failure")
+	}
+}
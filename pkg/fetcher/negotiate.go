@@ -0,0 +1,120 @@
+package fetcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	neturl "net/url"
+	"path"
+	"strings"
+)
+
+// Expected content kinds a client can ask for
+const (
+	ExpectHTML     = "html"
+	ExpectJSON     = "json"
+	ExpectText     = "text"
+	ExpectMarkdown = "markdown"
+	ExpectAny      = "any"
+)
+
+// Source formats of documents that are already lightweight markup
+const (
+	FormatMarkdown = "markdown"
+	FormatRST      = "rst"
+)
+
+// acceptHeaders maps each expected content kind to the Accept header sent
+var acceptHeaders = map[string]string{
+	ExpectHTML:     "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+	ExpectJSON:     "application/json,application/*+json;q=0.9,*/*;q=0.1",
+	ExpectText:     "text/plain,text/*;q=0.9,*/*;q=0.1",
+	ExpectMarkdown: "text/markdown,text/x-markdown;q=0.9,text/x-rst;q=0.8,text/plain;q=0.5,*/*;q=0.1",
+	ExpectAny:      "*/*",
+}
+
+// normalizeExpectedContent validates an expected content kind, mapping the
+// empty string to ExpectHTML
+func normalizeExpectedContent(expected string) (string, error) {
+	if expected == "" {
+		return ExpectHTML, nil
+	}
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if _, ok := acceptHeaders[expected]; !ok {
+		return "", fmt.Errorf("invalid expected_content %q: must be html, json, text, markdown or any", expected)
+	}
+	return expected, nil
+}
+
+// contentKind classifies a Content-Type header value as one of the expected
+// content kinds, or returns the bare media type for anything else
+func contentKind(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return ExpectHTML
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return ExpectJSON
+	case mediaType == "text/markdown" || mediaType == "text/x-markdown":
+		return ExpectMarkdown
+	case strings.HasPrefix(mediaType, "text/"):
+		return ExpectText
+	default:
+		return mediaType
+	}
+}
+
+// sourceFormat recognizes Markdown and reStructuredText documents by their
+// media type or, when they are served as generic text, by the extension of
+// their path. It returns an empty string for anything else.
+func sourceFormat(contentType string, pageURL *neturl.URL) string {
+	switch mediaType := mediaTypeOf(contentType); mediaType {
+	case "text/markdown", "text/x-markdown":
+		return FormatMarkdown
+	case "text/x-rst", "text/prs.fallenstein.rst":
+		return FormatRST
+	case "text/plain", "application/octet-stream", "":
+		switch strings.ToLower(path.Ext(pageURL.Path)) {
+		case ".md", ".markdown":
+			return FormatMarkdown
+		case ".rst":
+			return FormatRST
+		}
+	}
+	return ""
+}
+
+// contentMismatch returns a note when a response's Content-Type contradicts the
+// content the client expected, or an empty string when it does not
+func contentMismatch(expected, contentType string) string {
+	if expected == ExpectAny {
+		return ""
+	}
+	kind := contentKind(contentType)
+	// Markdown is still text
+	if kind == ExpectMarkdown && expected == ExpectText {
+		return ""
+	}
+	if kind != expected {
+		if contentType == "" {
+			contentType = "none"
+		}
+		return fmt.Sprintf("expected %s content but the server returned Content-Type %s", expected, contentType)
+	}
+	return ""
+}
+
+// indentJSON pretty-prints a JSON document so that pagination splits it on
+// readable boundaries. Invalid JSON is returned unchanged.
+func indentJSON(content string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(content), "", "  "); err != nil {
+		return content
+	}
+	return buf.String()
+}
@@ -0,0 +1,245 @@
+package fetcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// createNegotiatingServer serves JSON to clients that prefer it and an HTML
+// documentation page to everyone else, like many API endpoints do
+func createNegotiatingServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept")
+		switch {
+		case strings.HasPrefix(accept, "application/json"):
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"ok","items":[1,2]}`))
+		case strings.HasPrefix(accept, "text/plain"):
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte("status: ok"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body><h1>API documentation</h1><p>Send Accept: application/json.</p></body></html>"))
+		}
+	}))
+}
+
+func TestFetchURLExpectedContent(t *testing.T) {
+	server := createNegotiatingServer()
+	defer server.Close()
+
+	tests := []struct {
+		expected     string
+		contains     string
+		contentType  string
+		expectedNote bool
+	}{
+		{expected: "", contains: "API documentation", contentType: "text/html"},
+		{expected: ExpectHTML, contains: "API documentation", contentType: "text/html"},
+		{expected: ExpectJSON, contains: "\"status\": \"ok\"", contentType: "application/json"},
+		{expected: ExpectText, contains: "status: ok", contentType: "text/plain; charset=utf-8"},
+		{expected: ExpectAny, contains: "API documentation", contentType: "text/html"},
+	}
+
+	fetcher := createTestFetcher()
+	for _, tt := range tests {
+		t.Run("expect "+tt.expected, func(t *testing.T) {
+			result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL, ExpectedContent: tt.expected})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(result.Content, tt.contains) {
+				t.Errorf("expected content to contain %q, got %q", tt.contains, result.Content)
+			}
+			if result.ContentType != tt.contentType {
+				t.Errorf("expected content type %q, got %q", tt.contentType, result.ContentType)
+			}
+			if result.Warnings.Has(WarningContentTypeMismatch) {
+				t.Errorf("expected no content type warning, got %v", result.Warnings)
+			}
+		})
+	}
+}
+
+func TestFetchURLExpectedContentMismatch(t *testing.T) {
+	// This endpoint ignores Accept and always answers with HTML
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body><p>Moved to the docs</p></body></html>"))
+	}))
+	defer server.Close()
+
+	result, err := createTestFetcher().FetchURL(t.Context(), &FetchRequest{URL: server.URL, ExpectedContent: ExpectJSON})
+	if err != nil {
+		t.Fatalf("expected a mismatch not to fail the fetch, got %v", err)
+	}
+	// The endpoint serves the same page as robots.txt, which is warned about too
+	if len(result.Warnings) == 0 || result.Warnings[0].Code != WarningContentTypeMismatch ||
+		!strings.Contains(result.Warnings[0].Message, "expected json content") || result.Warnings[0].Detail != "text/html" {
+		t.Errorf("expected a mismatch warning, got %v", result.Warnings)
+	}
+	if !strings.Contains(result.Content, "Moved to the docs") {
+		t.Errorf("expected the HTML to be processed as usual, got %q", result.Content)
+	}
+}
+
+func TestFetchURLInvalidExpectedContent(t *testing.T) {
+	_, err := createTestFetcher().FetchURL(t.Context(), &FetchRequest{URL: "http://127.0.0.1:1", ExpectedContent: "xml"})
+	if !errors.Is(err, KindInvalidRequest) || !strings.Contains(err.Error(), `invalid expected_content "xml"`) {
+		t.Errorf("expected invalid expected_content error, got %v", err)
+	}
+}
+
+func TestContentMismatch(t *testing.T) {
+	tests := []struct {
+		expected    string
+		contentType string
+		mismatch    bool
+	}{
+		{ExpectHTML, "text/html; charset=utf-8", false},
+		{ExpectHTML, "application/xhtml+xml", false},
+		{ExpectHTML, "application/json", true},
+		{ExpectJSON, "application/problem+json", false},
+		{ExpectJSON, "text/html", true},
+		{ExpectText, "text/markdown", false},
+		{ExpectMarkdown, "text/markdown; charset=utf-8", false},
+		{ExpectMarkdown, "text/html", true},
+		{ExpectText, "text/html", true},
+		{ExpectText, "", true},
+		{ExpectAny, "application/octet-stream", false},
+	}
+
+	for _, tt := range tests {
+		note := contentMismatch(tt.expected, tt.contentType)
+		if (note != "") != tt.mismatch {
+			t.Errorf("contentMismatch(%q, %q) = %q, expected mismatch=%v", tt.expected, tt.contentType, note, tt.mismatch)
+		}
+	}
+}
+
+// createMarkupServer serves the README fixtures, with the Content-Type given
+// by the type query parameter
+func createMarkupServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := "README.md"
+		if strings.HasSuffix(r.URL.Path, ".rst") {
+			name = "readme.rst"
+		}
+		body, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Errorf("failed to read fixture: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		w.Write(body)
+	}))
+}
+
+func TestFetchURLMarkupSources(t *testing.T) {
+	server := createMarkupServer(t)
+	defer server.Close()
+
+	markdown, err := os.ReadFile(filepath.Join("testdata", "README.md"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	rst, err := os.ReadFile(filepath.Join("testdata", "readme.rst"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		path            string
+		convertRST      bool
+		content         string
+		sourceFormat    string
+		alreadyMarkdown bool
+	}{
+		{"markdown type", "/doc?type=text/markdown", false, string(markdown), FormatMarkdown, true},
+		{"markdown served as text", "/README.md?type=text/plain", false, string(markdown), FormatMarkdown, true},
+		{"rst type", "/doc.rst?type=text/x-rst", false, string(rst), FormatRST, false},
+		{"rst served as text", "/readme.rst?type=text/plain", false, string(rst), FormatRST, false},
+		{"plain text", "/notes.txt?type=text/plain", false, string(markdown), "", false},
+		{
+			"rst converted", "/readme.rst?type=text/x-rst", true,
+			"# gofetch\n\nAn MCP server that fetches web content.\n\n## Usage\n\nStart it with `-transport`:\n\n" +
+				"```\n./gofetch -transport streamable-http\n```\n",
+			FormatRST, true,
+		},
+	}
+
+	fetcher := createTestFetcher()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := fetcher.FetchURL(t.Context(), &FetchRequest{
+				URL:             server.URL + tt.path,
+				ExpectedContent: ExpectMarkdown,
+				ConvertRST:      tt.convertRST,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Content != tt.content {
+				t.Errorf("expected content %q, got %q", tt.content, result.Content)
+			}
+			if result.SourceFormat != tt.sourceFormat {
+				t.Errorf("expected source format %q, got %q", tt.sourceFormat, result.SourceFormat)
+			}
+			if result.AlreadyMarkdown != tt.alreadyMarkdown {
+				t.Errorf("expected already markdown %v, got %v", tt.alreadyMarkdown, result.AlreadyMarkdown)
+			}
+			if tt.sourceFormat != "" && result.Warnings.Has(WarningContentTypeMismatch) {
+				t.Errorf("expected no content type warning, got %v", result.Warnings)
+			}
+		})
+	}
+}
+
+func TestFetchURLExpectMarkdownAcceptHeader(t *testing.T) {
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		w.Header().Set("Content-Type", "text/markdown")
+		w.Write([]byte("# Title"))
+	}))
+	defer server.Close()
+
+	if _, err := createTestFetcher().FetchURL(t.Context(), &FetchRequest{URL: server.URL, ExpectedContent: ExpectMarkdown}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(accept, "text/markdown") {
+		t.Errorf("expected markdown to be preferred, got Accept %q", accept)
+	}
+}
+
+func TestSourceFormat(t *testing.T) {
+	tests := []struct {
+		contentType string
+		path        string
+		format      string
+	}{
+		{"text/markdown; charset=utf-8", "/doc", FormatMarkdown},
+		{"text/x-markdown", "/doc", FormatMarkdown},
+		{"text/x-rst", "/doc", FormatRST},
+		{"text/plain", "/README.md", FormatMarkdown},
+		{"text/plain", "/docs/INDEX.RST", FormatRST},
+		{"application/octet-stream", "/guide.markdown", FormatMarkdown},
+		{"text/plain", "/notes.txt", ""},
+		{"text/html", "/README.md", ""},
+	}
+
+	for _, tt := range tests {
+		pageURL := &neturl.URL{Scheme: "https", Host: "example.com", Path: tt.path}
+		if format := sourceFormat(tt.contentType, pageURL); format != tt.format {
+			t.Errorf("sourceFormat(%q, %q) = %q, expected %q", tt.contentType, tt.path, format, tt.format)
+		}
+	}
+}
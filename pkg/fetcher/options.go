@@ -0,0 +1,211 @@
+package fetcher
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/redact"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+// Defaults used by New
+const (
+	DefaultUserAgent = config.DefaultUA
+	DefaultTimeout   = 30 * time.Second
+)
+
+// Option configures a fetcher built by New
+type Option func(*options)
+
+// options collects the settings of New before the fetcher is built
+type options struct {
+	httpClient      *http.Client
+	robots          RobotsPolicy
+	processor       ContentProcessor
+	userAgent       string
+	redactor        *redact.Redactor
+	stallTimeout    time.Duration
+	maxConnsPerHost int
+	urlLimits       URLLimits
+	allowedTypes    []string
+	debugHeaders    DebugHeaders
+	negativeTTL     time.Duration
+	budget          time.Duration
+	decompression   DecompressionLimits
+	breaker         CircuitBreaker
+	profiles        *HostProfiles
+	processingRules []ProcessingRule
+	prepended       []Stage
+	appended        []Stage
+}
+
+// New creates a fetcher for use outside the MCP server. Without options it
+// uses an HTTP client with a DefaultTimeout that refuses cloud metadata
+// endpoints, sends DefaultUserAgent, obeys robots.txt and converts HTML to
+// markdown, with the same limits as NewHTTPFetcher's zero values.
+func New(opts ...Option) *HTTPFetcher {
+	o := options{userAgent: DefaultUserAgent}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.httpClient == nil {
+		o.httpClient = &http.Client{
+			Transport: GuardMetadataEndpoints(http.DefaultTransport.(*http.Transport).Clone()),
+			Timeout:   DefaultTimeout,
+		}
+	}
+	if o.robots == nil {
+		o.robots = robots.NewChecker(o.userAgent, "", false, false, o.httpClient)
+	}
+	if o.processor == nil {
+		o.processor = processor.NewContentProcessor(processor.Options{})
+	}
+
+	return newHTTPFetcher(o)
+}
+
+// WithHTTPClient sets the client used for pages and, unless WithRobots is
+// given, for robots.txt
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithUserAgent sets the User-Agent sent with requests and matched against
+// robots.txt
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithRobots replaces the robots.txt policy, for example with a
+// *robots.Checker that ignores robots.txt
+func WithRobots(policy RobotsPolicy) Option {
+	return func(o *options) {
+		o.robots = policy
+	}
+}
+
+// WithProcessor replaces the HTML conversion and pagination
+func WithProcessor(contentProcessor ContentProcessor) Option {
+	return func(o *options) {
+		o.processor = contentProcessor
+	}
+}
+
+// WithRedactor sets how URLs are redacted before they are logged
+func WithRedactor(redactor *redact.Redactor) Option {
+	return func(o *options) {
+		o.redactor = redactor
+	}
+}
+
+// WithStallTimeout sets how long a download may go without receiving data
+func WithStallTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.stallTimeout = timeout
+	}
+}
+
+// WithMaxConnsPerHost sets how many fetches may run against one host at once
+func WithMaxConnsPerHost(limit int) Option {
+	return func(o *options) {
+		o.maxConnsPerHost = limit
+	}
+}
+
+// WithURLLimits sets the limits on the URLs accepted
+func WithURLLimits(limits URLLimits) Option {
+	return func(o *options) {
+		o.urlLimits = limits
+	}
+}
+
+// WithAllowedContentTypes restricts responses to media types matching one of
+// patterns, such as text/* or application/json
+func WithAllowedContentTypes(patterns ...string) Option {
+	return func(o *options) {
+		o.allowedTypes = patterns
+	}
+}
+
+// WithDebugHeaders logs selected request and response headers of every fetch,
+// along with the extra headers named. Credentials and cookies are never logged.
+func WithDebugHeaders(extra ...string) Option {
+	return func(o *options) {
+		o.debugHeaders = DebugHeaders{Enabled: true, Extra: extra}
+	}
+}
+
+// WithNegativeCacheTTL returns a failed fetch's error again, without a new
+// attempt, to the same request within ttl: the same URL with the same expected
+// content, conditional headers and byte limit. Failures of the caller's own
+// making, a cancellation, its deadline or a wait for its turn at the host, are
+// not remembered
+func WithNegativeCacheTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithProcessingBudget abandons converting a page to markdown after budget,
+// returning its plain text with a warning instead
+func WithProcessingBudget(budget time.Duration) Option {
+	return func(o *options) {
+		o.budget = budget
+	}
+}
+
+// WithDecompressionLimits bounds how far a gzip-encoded response body may
+// expand. Zero fields select the defaults.
+func WithDecompressionLimits(limits DecompressionLimits) Option {
+	return func(o *options) {
+		o.decompression = limits
+	}
+}
+
+// WithCircuitBreaker fails fetches to a host at once after it failed
+// repeatedly, as configured by breaker
+func WithCircuitBreaker(breaker CircuitBreaker) Option {
+	return func(o *options) {
+		o.breaker = breaker
+	}
+}
+
+// WithHostProfiles overrides the pace, concurrency and user agent of fetches
+// to the hosts profiles match
+func WithHostProfiles(profiles *HostProfiles) Option {
+	return func(o *options) {
+		o.profiles = profiles
+	}
+}
+
+// WithProcessingRules chooses how content types are processed, ahead of
+// DefaultProcessingRules. Rules naming an unknown processor are skipped;
+// ParseProcessingRules refuses them.
+func WithProcessingRules(rules ...ProcessingRule) Option {
+	return func(o *options) {
+		o.processingRules = append(o.processingRules, rules...)
+	}
+}
+
+// WithPrependStages runs stages, in order, ahead of the built-in stages of
+// the fetch pipeline. See Stage.
+func WithPrependStages(stages ...Stage) Option {
+	return func(o *options) {
+		o.prepended = append(o.prepended, stages...)
+	}
+}
+
+// WithAppendStages runs stages, in order, after the built-in stages of the
+// fetch pipeline and right before the download. See Stage.
+func WithAppendStages(stages ...Stage) Option {
+	return func(o *options) {
+		o.appended = append(o.appended, stages...)
+	}
+}
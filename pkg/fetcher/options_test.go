@@ -0,0 +1,90 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+// allowAll is a RobotsPolicy that allows every page
+type allowAll struct{}
+
+func (allowAll) DecideContext(context.Context, string) robots.Decision {
+	return robots.Decision{Allowed: true}
+}
+
+func (allowAll) PageDirective(http.Header, string, []byte) (string, bool) { return "", false }
+
+// recordingProcessor is a ContentProcessor that only records its input
+type recordingProcessor struct {
+	processed string
+}
+
+func (p *recordingProcessor) ProcessHTMLContext(_ context.Context, htmlContent []byte, _ string) (string, string) {
+	p.processed = string(htmlContent)
+	return "converted", ""
+}
+
+// failingProcessor is a ContentProcessor whose conversion always degrades
+type failingProcessor struct {
+	recordingProcessor
+}
+
+func (*failingProcessor) ProcessHTMLContext(context.Context, []byte, string) (string, string) {
+	return "plain text", "markdown conversion failed"
+}
+
+func (*recordingProcessor) FormatContent(content string, _, _ *int) (string, processor.PageInfo) {
+	return content, processor.PageInfo{TotalLength: len(content), Returned: len(content)}
+}
+
+func TestNewDefaults(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /\n"))
+			return
+		}
+		userAgent = r.UserAgent()
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	f := New()
+	if f.userAgent != DefaultUserAgent || f.httpClient.Timeout != DefaultTimeout {
+		t.Errorf("unexpected defaults: user agent %q, timeout %s", f.userAgent, f.httpClient.Timeout)
+	}
+	if _, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page"}); err == nil {
+		t.Error("expected robots.txt to be obeyed by default")
+	}
+
+	f = New(WithRobots(allowAll{}), WithUserAgent("LibraryBot/2.0"))
+	if _, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page", Raw: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if userAgent != "LibraryBot/2.0" {
+		t.Errorf("expected the configured user agent, got %q", userAgent)
+	}
+}
+
+func TestNewWithProcessor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>hello</p>"))
+	}))
+	defer server.Close()
+
+	contentProcessor := &recordingProcessor{}
+	f := New(WithRobots(allowAll{}), WithProcessor(contentProcessor), WithHTTPClient(server.Client()))
+	result, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if contentProcessor.processed != "<p>hello</p>" || result.Content != "converted" {
+		t.Errorf("expected the custom processor to be used, got %q", result.Content)
+	}
+}
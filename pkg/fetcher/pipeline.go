@@ -0,0 +1,232 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+)
+
+// Handler carries out a fetch request, giving up once ctx is done. To a
+// Stage it is the rest of the pipeline.
+type Handler func(ctx context.Context, req *FetchRequest) (*FetchResult, error)
+
+// Stage is one step of the pipeline FetchURL runs a request through. A stage
+// may fail the request without calling next, pass it on unchanged or as a
+// modified copy, and inspect or change the result next returns. Stages must
+// not modify the request they are given, which belongs to the caller, and
+// must be safe for concurrent use.
+//
+// The built-in stages, in order, rewrite known file viewer hosts, count
+// domain statistics, return cached failures, apply the circuit breaker,
+// validate the request and check robots.txt; the page is then downloaded,
+// processed and formatted. Stages added with WithPrependStages run before
+// all of them and see requests exactly as given to FetchURL, so they can
+// rewrite URLs that the rest of the pipeline then checks. Stages added with
+// WithAppendStages run last, right before the download, and only see
+// requests that passed every check.
+type Stage interface {
+	Handle(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error)
+}
+
+// StageFunc adapts a function to a Stage
+type StageFunc func(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error)
+
+// Handle calls fn
+func (fn StageFunc) Handle(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+	return fn(ctx, req, next)
+}
+
+// chain returns a handler running stages in order, ahead of last
+func chain(stages []Stage, last Handler) Handler {
+	handler := last
+	for _, stage := range slices.Backward(stages) {
+		next := handler
+		handler = func(ctx context.Context, req *FetchRequest) (*FetchResult, error) {
+			return stage.Handle(ctx, req, next)
+		}
+	}
+	return handler
+}
+
+// pipeline returns the handler FetchURL runs: the prepended stages, the
+// built-in ones, the appended ones and finally fetch
+func (f *HTTPFetcher) pipeline(prepended, appended []Stage) Handler {
+	builtin := []Stage{
+		StageFunc(f.rewriteStage),
+		StageFunc(f.statsStage),
+		StageFunc(f.failureCacheStage),
+		StageFunc(f.circuitStage),
+		StageFunc(f.validateStage),
+		StageFunc(f.robotsStage),
+	}
+	return chain(slices.Concat(prepended, builtin, appended), f.fetch)
+}
+
+// rewriteStage fetches the raw file behind known file viewer pages when the
+// request asks for it
+func (f *HTTPFetcher) rewriteStage(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+	if !req.RewriteKnownHosts {
+		return next(ctx, req)
+	}
+	target, name := rewriteKnownHost(req.URL)
+	if name == "" {
+		return next(ctx, req)
+	}
+
+	// URLs over the limits are not logged; validateStage refuses them
+	if f.urlLimits.check(req.URL) == nil && f.urlLimits.check(target) == nil {
+		log.Printf("Rewrote %s to %s (%s)", f.logURL(req.URL), f.logURL(target), name)
+	}
+	rewritten := *req
+	rewritten.URL = target
+	result, err := next(ctx, &rewritten)
+	if result != nil && target != req.URL {
+		result.RewrittenURL = target
+		result.Warnings.Add(WarningURLRewritten, fmt.Sprintf("fetched the raw file %s in place of %s", target, req.URL), name)
+	}
+	return result, err
+}
+
+// statsStage counts every fetch in the domain statistics, except those the
+// caller cancelled
+func (f *HTTPFetcher) statsStage(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+	result, err := next(ctx, req)
+	if !errors.Is(err, KindCanceled) {
+		f.stats.record(req.URL, result, err)
+	}
+	return result, err
+}
+
+// failureCacheStage returns a recent failure of the same request again
+// instead of retrying it, and remembers new failures that came from the host
+func (f *HTTPFetcher) failureCacheStage(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+	key := failureKey(req)
+	if cached := f.failures.get(key); cached != nil {
+		log.Printf("Returning cached %s failure for host %s", cached.Kind, urlHost(req.URL))
+		return nil, cached
+	}
+
+	result, err := next(ctx, req)
+	if !localFailure(ctx, err) {
+		f.failures.record(key, err)
+	}
+	return result, err
+}
+
+// circuitStage fails fetches to hosts whose circuit is open and tracks the
+// outcome of the others that were not cancelled
+func (f *HTTPFetcher) circuitStage(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+	host := circuitHost(req.URL)
+	if err := f.breaker.allow(host); err != nil {
+		log.Printf("Refused fetch for host %s: %v", urlHost(req.URL), err)
+		return nil, newFetchError(KindCircuitOpen, req.URL, err)
+	}
+
+	result, err := next(ctx, req)
+	if !errors.Is(err, KindCanceled) && f.breaker.record(host, err) {
+		f.stats.circuitOpened(req.URL)
+	}
+	return result, err
+}
+
+// validateStage refuses URLs over the limits and invalid request parameters
+func (f *HTTPFetcher) validateStage(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+	// Checked before anything logs the URL, which may be kilobytes long
+	if err := f.urlLimits.check(req.URL); err != nil {
+		log.Printf("Rejected URL for host %s: %v", urlHost(req.URL), err)
+		return nil, newFetchError(KindTooLarge, req.URL, err)
+	}
+
+	log.Printf("Fetching URL: %s", f.logURL(req.URL))
+
+	if err := checkHost(req.URL); err != nil {
+		return nil, newFetchError(KindInvalidURL, req.URL, err)
+	}
+	if _, _, err := parseRequest(req); err != nil {
+		return nil, err
+	}
+	return next(ctx, req)
+}
+
+// robotsBudgetShare is the fraction of the time left before the deadline of
+// a request's context that the robots.txt check may take
+const robotsBudgetShare = 4
+
+// robotsStage refuses pages robots.txt disallows, and reports robots.txt
+// files that are malformed or too slow to check before the deadline. With a
+// deadline on ctx the check gets a quarter of the time left, so a slow
+// robots.txt cannot use up the time for the page.
+func (f *HTTPFetcher) robotsStage(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+	robotsCtx := ctx
+	var budget time.Duration
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		budget = time.Until(deadline) / robotsBudgetShare
+		var cancel context.CancelFunc
+		robotsCtx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+
+	started := time.Now()
+	decision := f.robotsChecker.DecideContext(robotsCtx, req.URL)
+	if hasDeadline {
+		log.Printf("Robots check for host %s took %s of its %s budget, leaving %s for the fetch",
+			urlHost(req.URL), time.Since(started).Round(time.Millisecond), budget.Round(time.Millisecond),
+			time.Until(deadline).Round(time.Millisecond))
+	}
+	if decision.TimedOut {
+		log.Printf("Robots check for host %s timed out; fetching as if there were no robots.txt", urlHost(req.URL))
+	}
+	if len(decision.Anomalies) > 0 {
+		ignored := ""
+		if decision.Unrecognized {
+			ignored = "; ignoring it as if there were none"
+		}
+		log.Printf("Malformed robots.txt for host %s: %s%s",
+			urlHost(req.URL), strings.Join(decision.Anomalies, ", "), ignored)
+		f.stats.robotsAnomaly(req.URL)
+	}
+	if !decision.Allowed {
+		log.Printf("Access denied by robots.txt for URL: %s", f.logURL(req.URL))
+		return nil, newFetchError(KindRobotsBlocked, req.URL, &RobotsBlockedError{URL: req.URL, Decision: decision})
+	}
+
+	result, err := next(ctx, req)
+	if result != nil && decision.TimedOut {
+		result.Warnings.Add(WarningRobotsTimedOut,
+			"robots.txt could not be checked in time, so the page was fetched as if the site had none",
+			budget.Round(time.Millisecond).String())
+	}
+	if result != nil && len(decision.Anomalies) > 0 {
+		message := "the site's robots.txt is malformed"
+		if decision.Unrecognized {
+			message = "what the site serves as robots.txt is not one, so it was ignored"
+		}
+		result.Warnings.Add(WarningRobotsMalformed, message, strings.Join(decision.Anomalies, ", "))
+	}
+	return result, err
+}
+
+// parseRequest validates the paging, expected content and conditional
+// parameters of req, returning the normalized expected content and the
+// request conditions
+func parseRequest(req *FetchRequest) (expected string, cond conditions, err error) {
+	if err := processor.ValidatePage(req.StartIndex, req.MaxLength); err != nil {
+		return "", conditions{}, newFetchError(KindInvalidRequest, req.URL, err)
+	}
+	expected, err = normalizeExpectedContent(req.ExpectedContent)
+	if err != nil {
+		return "", conditions{}, newFetchError(KindInvalidRequest, req.URL, err)
+	}
+	cond, err = newConditions(req.IfNoneMatch, req.IfModifiedSince)
+	if err != nil {
+		return "", conditions{}, newFetchError(KindInvalidRequest, req.URL, err)
+	}
+	return expected, cond, nil
+}
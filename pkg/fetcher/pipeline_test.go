@@ -0,0 +1,183 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+// newPipelineServer serves the requested URI as plain text and refuses
+// /private in robots.txt
+func newPipelineServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("served " + r.URL.RequestURI()))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// addQueryStage is an example custom stage adding a query parameter to every
+// fetched URL
+func addQueryStage(param string) Stage {
+	return StageFunc(func(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+		rewritten := *req
+		if strings.Contains(req.URL, "?") {
+			rewritten.URL += "&" + param
+		} else {
+			rewritten.URL += "?" + param
+		}
+		return next(ctx, &rewritten)
+	})
+}
+
+// recordStage is a stage recording the URLs it sees in calls
+func recordStage(calls *[]string) Stage {
+	return StageFunc(func(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+		*calls = append(*calls, req.URL)
+		return next(ctx, req)
+	})
+}
+
+func TestFetchURLPrependStages(t *testing.T) {
+	server := newPipelineServer(t)
+	fetcher := New(WithPrependStages(addQueryStage("lang=en")))
+
+	req := &FetchRequest{URL: server.URL + "/docs"}
+	result, err := fetcher.FetchURL(t.Context(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Content != "served /docs?lang=en" {
+		t.Errorf("expected the rewritten URL to be fetched, got %q", result.Content)
+	}
+	if req.URL != server.URL+"/docs" {
+		t.Errorf("expected the caller's request to be left alone, got %s", req.URL)
+	}
+
+	// Prepended stages run before the built-in checks, which see their changes
+	_, err = New(WithPrependStages(StageFunc(func(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+		rewritten := *req
+		rewritten.URL = server.URL + "/private"
+		return next(ctx, &rewritten)
+	}))).FetchURL(t.Context(), req)
+	if !errors.Is(err, KindRobotsBlocked) {
+		t.Errorf("expected robots.txt to check the rewritten URL, got %v", err)
+	}
+}
+
+func TestFetchURLAppendStages(t *testing.T) {
+	server := newPipelineServer(t)
+	denied := errors.New("example.com only")
+	var calls []string
+	fetcher := New(WithAppendStages(
+		recordStage(&calls),
+		StageFunc(func(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+			if strings.Contains(req.URL, "/blocked") {
+				return nil, newFetchError(KindPolicy, req.URL, denied)
+			}
+			return next(ctx, req)
+		}),
+	))
+
+	if _, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/blocked"}); !errors.Is(err, KindPolicy) || !errors.Is(err, denied) {
+		t.Errorf("expected the custom policy to refuse the fetch, got %v", err)
+	}
+	if _, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/open"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// Appended stages only see requests that passed the built-in checks
+	if _, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/private"}); !errors.Is(err, KindRobotsBlocked) {
+		t.Errorf("expected robots.txt to refuse the fetch, got %v", err)
+	}
+	if _, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/x", ExpectedContent: "video"}); !errors.Is(err, KindInvalidRequest) {
+		t.Errorf("expected an invalid request error, got %v", err)
+	}
+
+	expected := []string{server.URL + "/blocked", server.URL + "/open"}
+	if !slices.Equal(calls, expected) {
+		t.Errorf("expected the appended stages to see %v, got %v", expected, calls)
+	}
+
+	// Fetches refused by custom stages are counted like any other
+	stats, _ := fetcher.DomainStats(1)
+	if len(stats) != 1 || stats[0].Fetches != 4 || stats[0].Errors != 2 || stats[0].RobotsBlocks != 1 {
+		t.Errorf("expected 4 fetches with 2 errors and a robots block, got %+v", stats)
+	}
+}
+
+func TestFetchURLStageOrder(t *testing.T) {
+	server := newPipelineServer(t)
+	var order []string
+	stage := func(name string) Stage {
+		return StageFunc(func(ctx context.Context, req *FetchRequest, next Handler) (*FetchResult, error) {
+			order = append(order, name)
+			result, err := next(ctx, req)
+			order = append(order, name+" done")
+			return result, err
+		})
+	}
+	fetcher := New(
+		WithPrependStages(stage("first"), stage("second")),
+		WithAppendStages(stage("third")),
+		WithPrependStages(stage("fourth")),
+	)
+
+	if _, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"first", "second", "fourth", "third", "third done", "fourth done", "second done", "first done"}
+	if !slices.Equal(order, expected) {
+		t.Errorf("expected %v, got %v", expected, order)
+	}
+}
+
+func TestFetchURLRobotsBudget(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			<-release
+			w.Write([]byte("User-agent: *\nDisallow: /\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	fetcher := New(
+		WithHTTPClient(client),
+		WithRobots(robots.NewChecker("TestBot/1.0", "", false, false, client)),
+		WithProcessor(processor.NewContentProcessor(processor.Options{DisableTitleHeader: true})),
+	)
+
+	// A quarter of the 400ms left goes to robots.txt, which never answers
+	started := time.Now()
+	ctx, cancel := context.WithDeadline(t.Context(), started.Add(400*time.Millisecond))
+	defer cancel()
+	result, err := fetcher.FetchURL(ctx, &FetchRequest{URL: server.URL + "/page"})
+	if err != nil {
+		t.Fatalf("expected the slow robots.txt to be treated as missing, got %v", err)
+	}
+	if result.Content != "page" || !result.Warnings.Has(WarningRobotsTimedOut) {
+		t.Errorf("expected the page with a robots timeout warning, got %+v", result)
+	}
+	if elapsed := time.Since(started); elapsed > 300*time.Millisecond {
+		t.Errorf("expected the robots check to give up after its budget, took %s", elapsed)
+	}
+}
@@ -0,0 +1,127 @@
+package fetcher
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Names of the content processors a ProcessingRule can select
+const (
+	// ProcessorMarkdown converts HTML to markdown with the ContentProcessor
+	ProcessorMarkdown = "markdown"
+	// ProcessorPretty indents JSON, leaving anything else as it is
+	ProcessorPretty = "pretty"
+	// ProcessorTable renders CSV as a markdown table
+	ProcessorTable = "table"
+	// ProcessorText returns the content as it is
+	ProcessorText = "text"
+	// ProcessorReject refuses the response, raw or not, as a policy error
+	ProcessorReject = "reject"
+)
+
+// ProcessorNames lists the names of every content processor
+var ProcessorNames = []string{ProcessorMarkdown, ProcessorPretty, ProcessorTable, ProcessorText, ProcessorReject}
+
+// ProcessingRule selects the processor for responses whose media type
+// matches Pattern, such as text/csv or application/*
+type ProcessingRule struct {
+	Pattern   string
+	Processor string
+}
+
+// DefaultProcessingRules are tried after any configured rules. They convert
+// HTML to markdown and return everything else as it is; JSON is still
+// indented for requests expecting JSON.
+var DefaultProcessingRules = []ProcessingRule{
+	{Pattern: "text/html", Processor: ProcessorMarkdown},
+	{Pattern: "*/*", Processor: ProcessorText},
+}
+
+// ParseProcessingRules parses rules written as pattern=processor, such as
+// application/json=pretty, refusing unknown processors and invalid patterns
+func ParseProcessingRules(specs []string) ([]ProcessingRule, error) {
+	rules := make([]ProcessingRule, 0, len(specs))
+	for _, spec := range specs {
+		pattern, name, ok := strings.Cut(spec, "=")
+		pattern, name = strings.ToLower(strings.TrimSpace(pattern)), strings.TrimSpace(name)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid processing rule %q: must be pattern=processor", spec)
+		}
+		if _, err := path.Match(pattern, ""); err != nil || strings.Count(pattern, "/") != 1 {
+			return nil, fmt.Errorf("invalid processing rule %q: %q is not a media type pattern such as text/*", spec, pattern)
+		}
+		if !slices.Contains(ProcessorNames, name) {
+			return nil, fmt.Errorf("invalid processing rule %q: unknown processor %q, must be one of %s",
+				spec, name, strings.Join(ProcessorNames, ", "))
+		}
+		rules = append(rules, ProcessingRule{Pattern: pattern, Processor: name})
+	}
+	return rules, nil
+}
+
+// processorFor returns the processor of the first rule matching mediaType,
+// trying rules before DefaultProcessingRules. Rules naming an unknown
+// processor are skipped.
+func processorFor(rules []ProcessingRule, mediaType string) string {
+	mediaType = strings.ToLower(mediaType)
+	for _, rule := range slices.Concat(rules, DefaultProcessingRules) {
+		if !slices.Contains(ProcessorNames, rule.Processor) {
+			continue
+		}
+		if ok, _ := path.Match(strings.ToLower(rule.Pattern), mediaType); ok {
+			return rule.Processor
+		}
+	}
+	return ProcessorText
+}
+
+// processingMediaType returns the media type rules are matched against. A
+// Content-Type whose parameters do not parse still has its media type used.
+func processingMediaType(contentType string) string {
+	if mediaType := mediaTypeOf(contentType); mediaType != "" {
+		return mediaType
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// csvTable renders CSV content as a markdown table whose first record is the
+// header. Content that does not parse as CSV is returned with a warning.
+func csvTable(content string) (table, warning string) {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return content, fmt.Sprintf("the CSV could not be parsed (%v), so it is returned as is", err)
+	}
+	if len(records) == 0 {
+		return content, ""
+	}
+
+	columns := 0
+	for _, record := range records {
+		columns = max(columns, len(record))
+	}
+	var out strings.Builder
+	writeRow := func(record []string) {
+		out.WriteString("|")
+		for i := range columns {
+			cell := ""
+			if i < len(record) {
+				cell = record[i]
+			}
+			cell = strings.ReplaceAll(strings.ReplaceAll(cell, "|", `\|`), "\n", " ")
+			out.WriteString(" " + strings.TrimSpace(strings.ReplaceAll(cell, "\r", "")) + " |")
+		}
+		out.WriteString("\n")
+	}
+	writeRow(records[0])
+	out.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+	for _, record := range records[1:] {
+		writeRow(record)
+	}
+	return out.String(), ""
+}
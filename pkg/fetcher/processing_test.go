@@ -0,0 +1,123 @@
+package fetcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseProcessingRules(t *testing.T) {
+	rules, err := ParseProcessingRules([]string{"Application/JSON = pretty", "text/*=table"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []ProcessingRule{{"application/json", ProcessorPretty}, {"text/*", ProcessorTable}}
+	if len(rules) != 2 || rules[0] != expected[0] || rules[1] != expected[1] {
+		t.Errorf("expected %+v, got %+v", expected, rules)
+	}
+
+	for spec, want := range map[string]string{
+		"text/csv":             "must be pattern=processor",
+		"=table":               "must be pattern=processor",
+		"csv=table":            "not a media type pattern",
+		"text/[csv=table":      "not a media type pattern",
+		"text/csv=spreadsheet": `unknown processor "spreadsheet"`,
+	} {
+		if _, err := ParseProcessingRules([]string{spec}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseProcessingRules(%q) = %v, want an error containing %q", spec, err, want)
+		}
+	}
+}
+
+func TestProcessorFor(t *testing.T) {
+	defaults := map[string]string{
+		"text/html":        ProcessorMarkdown,
+		"TEXT/HTML":        ProcessorMarkdown,
+		"application/json": ProcessorText,
+		"text/csv":         ProcessorText,
+		"":                 ProcessorText,
+	}
+	for mediaType, want := range defaults {
+		if got := processorFor(nil, mediaType); got != want {
+			t.Errorf("default processor for %q = %s, want %s", mediaType, got, want)
+		}
+	}
+
+	rules := []ProcessingRule{
+		{"text/csv", ProcessorTable},
+		{"text/html", "unknown"},
+		{"*/*", ProcessorReject},
+	}
+	overridden := map[string]string{
+		"text/csv":  ProcessorTable,
+		"text/html": ProcessorReject,
+		"image/png": ProcessorReject,
+	}
+	for mediaType, want := range overridden {
+		if got := processorFor(rules, mediaType); got != want {
+			t.Errorf("configured processor for %q = %s, want %s", mediaType, got, want)
+		}
+	}
+}
+
+func TestCSVTable(t *testing.T) {
+	table, warning := csvTable("name,notes\nalpha,\"a|b\"\nbeta\n")
+	expected := "| name | notes |\n| --- | --- |\n| alpha | a\\|b |\n| beta |  |\n"
+	if table != expected || warning != "" {
+		t.Errorf("expected %q, got %q (warning %q)", expected, table, warning)
+	}
+
+	if content, warning := csvTable("a,b\"c\n"); content != "a,b\"c\n" || warning == "" {
+		t.Errorf("expected unparsable CSV returned as is with a warning, got %q (warning %q)", content, warning)
+	}
+}
+
+func TestFetchURLProcessingRules(t *testing.T) {
+	bodies := map[string][2]string{
+		"/data.json":  {"application/json", `{"a":[1,2]}`},
+		"/data.csv":   {"text/csv", "x,y\n1,2\n"},
+		"/page.html":  {"text/html", "<html><body><p>Hello <b>there</b></p></body></html>"},
+		"/image.png":  {"image/png", "\x89PNG\r\n"},
+		"/notes.text": {"text/plain", "plain"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := bodies[r.URL.Path]
+		w.Header().Set("Content-Type", body[0])
+		w.Write([]byte(body[1]))
+	}))
+	defer server.Close()
+
+	rules, err := ParseProcessingRules([]string{"application/json=pretty", "text/csv=table", "text/html=markdown", "image/*=reject"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f := New(WithRobots(allowAll{}), WithProcessingRules(rules...))
+
+	for path, want := range map[string]string{
+		"/data.json":  "{\n  \"a\": [\n    1,\n    2\n  ]\n}",
+		"/data.csv":   "| x | y |\n| --- | --- |\n| 1 | 2 |\n",
+		"/page.html":  "Hello **there**",
+		"/notes.text": "plain",
+	} {
+		result, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + path})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+		if !strings.Contains(result.Content, want) {
+			t.Errorf("%s: expected %q in %q", path, want, result.Content)
+		}
+	}
+
+	// raw skips processing, but not refusal
+	result, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/data.csv", Raw: true})
+	if err != nil || result.Content != bodies["/data.csv"][1] {
+		t.Errorf("expected the raw CSV, got %+v: %v", result, err)
+	}
+	var typeErr *ContentTypeError
+	_, err = f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/image.png", Raw: true})
+	if !errors.Is(err, KindPolicy) || !errors.As(err, &typeErr) || typeErr.ContentType != "image/png" {
+		t.Errorf("expected the image to be refused, got %v", err)
+	}
+}
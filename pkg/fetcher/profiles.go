@@ -0,0 +1,234 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HostProfile overrides how politely one host is fetched from. Zero fields
+// keep the server-wide behavior.
+type HostProfile struct {
+	// RequestsPerSecond caps how often fetches to the host may start
+	RequestsPerSecond float64
+	// MaxConcurrency replaces the per-host connection limit
+	MaxConcurrency int
+	// CrawlDelay is the least time between the starts of two fetches to the
+	// host. It applies instead of RequestsPerSecond when it is longer.
+	CrawlDelay time.Duration
+	// UserAgent is sent to the host in place of the server's user agent
+	UserAgent string
+}
+
+// interval returns the least time between the starts of two fetches
+func (p HostProfile) interval() time.Duration {
+	interval := p.CrawlDelay
+	if p.RequestsPerSecond > 0 {
+		interval = max(interval, time.Duration(float64(time.Second)/p.RequestsPerSecond))
+	}
+	return interval
+}
+
+// profileEntry is a HostProfile as written in a profiles file
+type profileEntry struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	MaxConcurrency    int     `json:"max_concurrency"`
+	CrawlDelay        string  `json:"crawl_delay"`
+	UserAgent         string  `json:"user_agent"`
+}
+
+// HostProfiles holds the politeness profiles loaded from a file, keyed by
+// host pattern. A pattern is a host name such as api.example.com, an IP
+// address such as 192.0.2.1 or 2001:db8::1, a wildcard such as
+// *.example.com matching every subdomain of example.com but not
+// example.com itself, or * matching every host. Names match with or without
+// a trailing dot. A host uses the
+// profile of its own name if there is one, otherwise that of the longest
+// matching wildcard, otherwise that of *. Profiles are not combined.
+//
+// A nil *HostProfiles has no profiles.
+type HostProfiles struct {
+	path     string
+	profiles atomic.Pointer[map[string]HostProfile]
+}
+
+// LoadHostProfiles reads the profiles file at path, a JSON object mapping
+// host patterns to profiles:
+//
+//	{"partner.example": {"requests_per_second": 0.2, "max_concurrency": 1,
+//	  "crawl_delay": "5s", "user_agent": "ExampleBot/1.0"}}
+func LoadHostProfiles(path string) (*HostProfiles, error) {
+	p := &HostProfiles{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload reads the profiles file again. When it cannot be read or is
+// invalid, the profiles in use are kept and the error returned.
+func (p *HostProfiles) Reload() error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to read host profiles: %w", err)
+	}
+	profiles, err := parseHostProfiles(data)
+	if err != nil {
+		return fmt.Errorf("invalid host profiles in %s: %w", p.path, err)
+	}
+	p.profiles.Store(&profiles)
+	return nil
+}
+
+// Len returns the number of profiles in use
+func (p *HostProfiles) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(*p.profiles.Load())
+}
+
+// parseHostProfiles validates and converts the contents of a profiles file
+func parseHostProfiles(data []byte) (map[string]HostProfile, error) {
+	var entries map[string]profileEntry
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]HostProfile, len(entries))
+	for pattern, entry := range entries {
+		key := normalizeHostname(strings.TrimSpace(pattern))
+		if err := validateHostPattern(key); err != nil {
+			return nil, err
+		}
+		if _, ok := profiles[key]; ok {
+			return nil, fmt.Errorf("host pattern %q is given twice", pattern)
+		}
+		if entry.RequestsPerSecond < 0 || entry.MaxConcurrency < 0 {
+			return nil, fmt.Errorf("%s: requests_per_second and max_concurrency must not be negative", pattern)
+		}
+		if strings.ContainsAny(entry.UserAgent, "\r\n") {
+			return nil, fmt.Errorf("%s: user_agent must be a single line", pattern)
+		}
+		profile := HostProfile{
+			RequestsPerSecond: entry.RequestsPerSecond,
+			MaxConcurrency:    entry.MaxConcurrency,
+			UserAgent:         entry.UserAgent,
+		}
+		if entry.CrawlDelay != "" {
+			delay, err := time.ParseDuration(entry.CrawlDelay)
+			if err != nil || delay < 0 {
+				return nil, fmt.Errorf("%s: crawl_delay %q must be a duration such as 5s", pattern, entry.CrawlDelay)
+			}
+			profile.CrawlDelay = delay
+		}
+		profiles[key] = profile
+	}
+	return profiles, nil
+}
+
+// validateHostPattern checks that a normalized pattern is a host name, an
+// IP address without a zone, a *. wildcard or *
+func validateHostPattern(pattern string) error {
+	name := strings.TrimPrefix(pattern, "*.")
+	if addr, err := netip.ParseAddr(pattern); err == nil {
+		if addr.Zone() != "" {
+			return fmt.Errorf("invalid host pattern %q: %w", pattern, errHostZone)
+		}
+		return nil
+	}
+	switch {
+	case pattern == "*":
+		return nil
+	case name == "" || strings.ContainsAny(name, "*/:@% "):
+		return fmt.Errorf("invalid host pattern %q: must be a host name, an IP address, *.domain or *", pattern)
+	}
+	return nil
+}
+
+// Match returns the profile that applies to host, which may include a port,
+// and whether there is one
+func (p *HostProfiles) Match(host string) (HostProfile, bool) {
+	if p == nil {
+		return HostProfile{}, false
+	}
+	profiles := *p.profiles.Load()
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = normalizeHostname(host)
+
+	if profile, ok := profiles[host]; ok {
+		return profile, true
+	}
+	// Wildcards are tried from the longest, dropping one label at a time
+	for suffix := host; ; {
+		_, rest, ok := strings.Cut(suffix, ".")
+		if !ok {
+			break
+		}
+		if profile, ok := profiles["*."+rest]; ok {
+			return profile, true
+		}
+		suffix = rest
+	}
+	profile, ok := profiles["*"]
+	return profile, ok
+}
+
+// hostPacer spaces the starts of fetches to the same host
+type hostPacer struct {
+	mu sync.Mutex
+	// next holds, for each paced host, when the next fetch may start
+	next map[string]time.Time
+}
+
+// newHostPacer creates a pacer with no hosts
+func newHostPacer() *hostPacer {
+	return &hostPacer{next: make(map[string]time.Time)}
+}
+
+// wait blocks until a fetch to host may start, at least interval after the
+// previous one, or until ctx is done. It reports how long it waited.
+func (p *hostPacer) wait(ctx context.Context, host string, interval time.Duration) (time.Duration, error) {
+	if interval <= 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	for other, next := range p.next {
+		if next.Before(now) {
+			delete(p.next, other)
+		}
+	}
+	start := now
+	if next, ok := p.next[host]; ok && next.After(now) {
+		start = next
+	}
+	p.next[host] = start.Add(interval)
+	p.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return time.Since(now), ctx.Err()
+	}
+}
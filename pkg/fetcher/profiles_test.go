@@ -0,0 +1,174 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeProfiles writes a profiles file and returns its path
+func writeProfiles(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHostProfilesMatch(t *testing.T) {
+	profiles, err := LoadHostProfiles(writeProfiles(t, `{
+		"API.example.com": {"user_agent": "exact"},
+		"*.example.com": {"user_agent": "domain"},
+		"*.docs.example.com": {"user_agent": "docs"},
+		"*": {"user_agent": "default"}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if profiles.Len() != 4 {
+		t.Errorf("expected 4 profiles, got %d", profiles.Len())
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"api.example.com", "exact"},
+		{"API.Example.com:8443", "exact"},
+		{"www.example.com", "domain"},
+		{"v2.api.example.com", "domain"},
+		{"go.docs.example.com", "docs"},
+		{"docs.example.com", "domain"},
+		{"example.com", "default"},
+		{"other.org", "default"},
+	}
+	for _, tt := range tests {
+		profile, ok := profiles.Match(tt.host)
+		if !ok || profile.UserAgent != tt.want {
+			t.Errorf("Match(%q) = %q, %v; want %q", tt.host, profile.UserAgent, ok, tt.want)
+		}
+	}
+
+	var none *HostProfiles
+	if _, ok := none.Match("example.com"); ok || none.Len() != 0 {
+		t.Error("expected a nil HostProfiles to have no profiles")
+	}
+}
+
+func TestParseHostProfiles(t *testing.T) {
+	profiles, err := parseHostProfiles([]byte(`{"example.com": {"requests_per_second": 2, "max_concurrency": 1, "crawl_delay": "1s"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := HostProfile{RequestsPerSecond: 2, MaxConcurrency: 1, CrawlDelay: time.Second}
+	if profiles["example.com"] != want {
+		t.Errorf("got %+v, want %+v", profiles["example.com"], want)
+	}
+	// The longer of the crawl delay and the rate's interval applies
+	if interval := want.interval(); interval != time.Second {
+		t.Errorf("expected a 1s interval, got %s", interval)
+	}
+	if interval := (HostProfile{RequestsPerSecond: 0.5}).interval(); interval != 2*time.Second {
+		t.Errorf("expected a 2s interval, got %s", interval)
+	}
+
+	invalid := map[string]string{
+		"not an object":    `[]`,
+		"unknown field":    `{"example.com": {"delay": "1s"}}`,
+		"bad pattern":      `{"ex*ample.com": {}}`,
+		"path in pattern":  `{"example.com/docs": {}}`,
+		"duplicate":        `{"example.com": {}, "Example.com": {}}`,
+		"negative rate":    `{"example.com": {"requests_per_second": -1}}`,
+		"bad crawl delay":  `{"example.com": {"crawl_delay": "5"}}`,
+		"multi-line agent": `{"example.com": {"user_agent": "a\nb"}}`,
+	}
+	for name, contents := range invalid {
+		if _, err := parseHostProfiles([]byte(contents)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestHostProfilesReloadKeepsProfilesOnError(t *testing.T) {
+	path := writeProfiles(t, `{"example.com": {"user_agent": "first"}}`)
+	profiles, err := LoadHostProfiles(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"example.com": {"crawl_delay": "soon"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := profiles.Reload(); err == nil {
+		t.Error("expected the invalid file to be reported")
+	}
+	if profile, _ := profiles.Match("example.com"); profile.UserAgent != "first" {
+		t.Errorf("expected the previous profiles to be kept, got %q", profile.UserAgent)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"example.com": {"user_agent": "second"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := profiles.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if profile, _ := profiles.Match("example.com"); profile.UserAgent != "second" {
+		t.Errorf("expected the reloaded profile, got %q", profile.UserAgent)
+	}
+}
+
+func TestHostPacerWait(t *testing.T) {
+	pacer := newHostPacer()
+	ctx := context.Background()
+
+	if waited, err := pacer.wait(ctx, "example.com", 50*time.Millisecond); err != nil || waited != 0 {
+		t.Errorf("expected the first fetch to start at once, waited %s: %v", waited, err)
+	}
+	if waited, _ := pacer.wait(ctx, "other.org", 50*time.Millisecond); waited != 0 {
+		t.Errorf("expected hosts to be paced separately, waited %s", waited)
+	}
+	if waited, _ := pacer.wait(ctx, "example.com", 50*time.Millisecond); waited < 30*time.Millisecond {
+		t.Errorf("expected the second fetch to wait, waited %s", waited)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := pacer.wait(cancelled, "example.com", time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the wait to end with its context, got %v", err)
+	}
+}
+
+func TestFetchURLHostProfile(t *testing.T) {
+	var agents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	profiles, err := LoadHostProfiles(writeProfiles(t, `{"127.0.0.1": {"crawl_delay": "100ms", "user_agent": "PartnerBot/1.0"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f := New(WithRobots(allowAll{}), WithHostProfiles(profiles))
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page?n=" + string(rune('a'+i)), Raw: true}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("expected the second fetch to be delayed, took %s", elapsed)
+	}
+	if len(agents) != 2 || strings.Join(agents, ",") != "PartnerBot/1.0,PartnerBot/1.0" {
+		t.Errorf("expected the profile's user agent, got %q", agents)
+	}
+}
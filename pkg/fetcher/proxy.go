@@ -0,0 +1,54 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DirectDialError reports a connection refused because it would bypass the
+// required proxy
+type DirectDialError struct {
+	// Address is the host:port that was refused
+	Address string
+}
+
+// Error implements the error interface
+func (e *DirectDialError) Error() string {
+	return fmt.Sprintf("direct connection to %s refused: all traffic must go through the proxy", e.Address)
+}
+
+// defaultProxyPorts are the ports assumed for proxy URLs without one
+var defaultProxyPorts = map[string]string{
+	"http":    "80",
+	"https":   "443",
+	"socks5":  "1080",
+	"socks5h": "1080",
+}
+
+// RequireProxy routes every request made through transport via proxyURL and
+// refuses any connection to another address, so traffic fails rather than
+// going out directly when the proxy cannot be used. It wraps the dialer
+// already set on transport, so it must be applied after any other dial
+// policy such as GuardMetadataEndpoints.
+func RequireProxy(transport *http.Transport, proxyURL *url.URL) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), defaultProxyPorts[proxyURL.Scheme])
+	}
+
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if !strings.EqualFold(address, proxyAddr) {
+			return nil, &DirectDialError{Address: address}
+		}
+		return dial(ctx, network, address)
+	}
+}
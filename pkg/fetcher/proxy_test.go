@@ -0,0 +1,106 @@
+package fetcher
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequireProxyRefusesDirectConnections(t *testing.T) {
+	var direct atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		direct.Add(1)
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/final", http.StatusFound)
+			return
+		}
+		w.Write([]byte("direct"))
+	}))
+	defer target.Close()
+
+	// Reserve a port and close it so the proxy is unreachable
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	proxyAddr := listener.Addr().String()
+	listener.Close()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	RequireProxy(transport, &url.URL{Scheme: "http", Host: proxyAddr})
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	// The unreachable proxy fails the request instead of a direct fetch
+	if _, err := client.Get(target.URL); err == nil {
+		t.Fatal("expected the request to fail with the proxy down")
+	}
+
+	// Dialing anything but the proxy is refused outright
+	_, err = transport.DialContext(t.Context(), "tcp", target.Listener.Addr().String())
+	var directErr *DirectDialError
+	if !errors.As(err, &directErr) || directErr.Address != target.Listener.Addr().String() {
+		t.Errorf("expected DirectDialError, got %v", err)
+	}
+
+	// Proxy selection cannot be turned off per request
+	transport.Proxy = nil
+	if _, err := client.Get(target.URL + "/redirect"); !errors.As(err, &directErr) {
+		t.Errorf("expected DirectDialError without a proxy, got %v", err)
+	}
+
+	if n := direct.Load(); n != 0 {
+		t.Errorf("expected no direct requests, got %d", n)
+	}
+}
+
+func TestRequireProxySendsTrafficThroughProxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		// A forward proxy receives the absolute target URL
+		if r.URL.Host != "unreachable.test" {
+			t.Errorf("expected a proxied request for unreachable.test, got %s", r.URL.Host)
+		}
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://unreachable.test/final", http.StatusFound)
+			return
+		}
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	proxyURL, _ := url.Parse(proxy.URL)
+	RequireProxy(transport, proxyURL)
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	// Redirects follow the same route
+	resp, err := client.Get("http://unreachable.test/redirect")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if n := proxied.Load(); n != 2 {
+		t.Errorf("expected both requests to reach the proxy, got %d", n)
+	}
+}
+
+func TestRequireProxyDefaultPort(t *testing.T) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	RequireProxy(transport, &url.URL{Scheme: "socks5", Host: "proxy.invalid"})
+
+	_, err := transport.DialContext(t.Context(), "tcp", "proxy.invalid:80")
+	var directErr *DirectDialError
+	if !errors.As(err, &directErr) {
+		t.Errorf("expected the wrong port to be refused, got %v", err)
+	}
+	_, err = transport.DialContext(t.Context(), "tcp", "PROXY.invalid:1080")
+	if errors.As(err, &directErr) {
+		t.Errorf("expected the proxy address to be dialed, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// resolverTimeout bounds each connection to, or exchange with, a configured
+// DNS server
+const resolverTimeout = 5 * time.Second
+
+// maxDNSMessageSize is the largest DNS message, bounded by its two byte
+// length prefix over TCP
+const maxDNSMessageSize = 65535
+
+// NewResolver returns a resolver sending every lookup to the DNS server at
+// address instead of those the system is configured with. An address
+// without a port uses port 53.
+func NewResolver(address string) *net.Resolver {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "53")
+	}
+	dialer := &net.Dialer{Timeout: resolverTimeout}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
+
+// NewDoHResolver returns a resolver sending every lookup as a DNS over HTTPS
+// (RFC 8484) POST to endpoint through client. The client's own connections
+// are resolved as it is configured, so it must not use the returned
+// resolver. Errors name the endpoint by its host alone, as its path and
+// query often identify the account using it.
+func NewDoHResolver(endpoint string, client *http.Client) *net.Resolver {
+	host := "the endpoint"
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, endpoint: endpoint, host: host, client: client}, nil
+		},
+	}
+}
+
+// ResolveWith makes transport look hosts up with resolver, resolving each
+// once and dialing the addresses it answered through the dialer already set
+// on transport. GuardMetadataEndpointsWithResolver does the same while
+// checking the answers, so it is used instead when the guard is wanted.
+func ResolveWith(transport *http.Transport, resolver *net.Resolver) {
+	dial := transport.DialContext
+	if dial == nil {
+		dial = newDialer(nil).DialContext
+	}
+	dialer := &pinnedDialer{resolver: resolver, dial: dial, allowMetadata: true}
+	transport.DialContext = dialer.DialContext
+}
+
+// dohConn carries the DNS exchanges of one resolver connection over HTTPS.
+// It is a stream connection to the resolver, so each message written and
+// read is framed with its two byte length; every message written is sent as
+// its own request and its answer queued for reading.
+type dohConn struct {
+	ctx      context.Context
+	endpoint string
+	host     string
+	client   *http.Client
+
+	pending  bytes.Buffer
+	answers  bytes.Buffer
+	deadline time.Time
+}
+
+// Write sends each complete DNS message in b and queues its answer
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.pending.Write(b)
+	for c.pending.Len() >= 2 {
+		size := int(binary.BigEndian.Uint16(c.pending.Bytes()))
+		if c.pending.Len() < 2+size {
+			break
+		}
+		c.pending.Next(2)
+		answer, err := c.exchange(c.pending.Next(size))
+		if err != nil {
+			return 0, err
+		}
+		c.answers.Write(binary.BigEndian.AppendUint16(nil, uint16(len(answer))))
+		c.answers.Write(answer)
+	}
+	return len(b), nil
+}
+
+// exchange posts one DNS message to the endpoint and returns the answer
+func (c *dohConn) exchange(msg []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, resolverTimeout)
+	defer cancel()
+	if !c.deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// The *url.Error would repeat the whole endpoint
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("DNS over HTTPS query to %s failed: %w", c.host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS query to %s failed: HTTP %d", c.host, resp.StatusCode)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("DNS over HTTPS query to %s failed: %w", c.host, err)
+	}
+	if len(answer) > maxDNSMessageSize {
+		return nil, fmt.Errorf("DNS over HTTPS answer from %s is too large", c.host)
+	}
+	return answer, nil
+}
+
+// Read returns queued answers
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.answers.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.answers.Read(b)
+}
+
+// Close implements net.Conn; there is nothing to release
+func (c *dohConn) Close() error { return nil }
+
+// LocalAddr implements net.Conn
+func (c *dohConn) LocalAddr() net.Addr { return dohAddr{} }
+
+// RemoteAddr implements net.Conn
+func (c *dohConn) RemoteAddr() net.Addr { return dohAddr{} }
+
+// SetDeadline bounds the exchanges that follow
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+// SetReadDeadline implements net.Conn; answers are read from memory
+func (c *dohConn) SetReadDeadline(time.Time) error { return nil }
+
+// SetWriteDeadline bounds the exchanges that follow
+func (c *dohConn) SetWriteDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+// dohAddr is the placeholder address of a dohConn
+type dohAddr struct{}
+
+// Network implements net.Addr
+func (dohAddr) Network() string { return "doh" }
+
+// String implements net.Addr
+func (dohAddr) String() string { return "doh" }
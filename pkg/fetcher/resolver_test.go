@@ -0,0 +1,166 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub answers A queries for the names it knows with their address and
+// every other query with NXDOMAIN
+type dnsStub struct {
+	answers map[string]netip.Addr
+	queries atomic.Int32
+}
+
+// answer builds the reply to the DNS message query
+func (s *dnsStub) answer(t *testing.T, query []byte) []byte {
+	t.Helper()
+	s.queries.Add(1)
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		t.Errorf("invalid DNS query: %v", err)
+		return nil
+	}
+	question, err := parser.Question()
+	if err != nil {
+		t.Errorf("invalid DNS question: %v", err)
+		return nil
+	}
+
+	addr, known := s.answers[strings.TrimSuffix(question.Name.String(), ".")]
+	reply := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID: header.ID, Response: true, RecursionAvailable: true, RCode: dnsmessage.RCodeNameError,
+	})
+	if known {
+		reply = dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RecursionAvailable: true})
+	}
+	reply.EnableCompression()
+	reply.StartQuestions()
+	reply.Question(question)
+	reply.StartAnswers()
+	if known && question.Type == dnsmessage.TypeA {
+		reply.AResource(dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60},
+			dnsmessage.AResource{A: addr.As4()})
+	}
+	msg, err := reply.Finish()
+	if err != nil {
+		t.Errorf("failed to build DNS reply: %v", err)
+	}
+	return msg
+}
+
+// serveUDP answers queries on a local UDP port and returns its address
+func (s *dnsStub) serveUDP(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxDNSMessageSize)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(s.answer(t, buf[:n]), from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// serveDoH answers queries posted to a local HTTPS server and returns its URL
+func (s *dnsStub) serveDoH(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(s.answer(t, query))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolvers(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("host=" + r.Host))
+	}))
+	defer site.Close()
+	port := site.Listener.Addr().(*net.TCPAddr).Port
+
+	stub := &dnsStub{answers: map[string]netip.Addr{"internal.corp": netip.MustParseAddr("127.0.0.1")}}
+	doh := stub.serveDoH(t)
+	resolvers := map[string]*net.Resolver{
+		"dns server":     NewResolver(stub.serveUDP(t)),
+		"dns over https": NewDoHResolver(doh.URL+"/dns-query", doh.Client()),
+	}
+
+	for name, resolver := range resolvers {
+		t.Run(name, func(t *testing.T) {
+			guarded := http.DefaultTransport.(*http.Transport).Clone()
+			unguarded := http.DefaultTransport.(*http.Transport).Clone()
+			ResolveWith(unguarded, resolver)
+			transports := map[string]http.RoundTripper{
+				"guarded":   GuardMetadataEndpointsWithResolver(guarded, resolver),
+				"unguarded": unguarded,
+			}
+
+			for tname, transport := range transports {
+				client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+				before := stub.queries.Load()
+				resp, err := client.Get(fmt.Sprintf("http://internal.corp:%d/", port))
+				if err != nil {
+					t.Fatalf("%s: expected the stub to resolve the host, got %v", tname, err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if want := fmt.Sprintf("host=internal.corp:%d", port); string(body) != want {
+					t.Errorf("%s: expected %q, got %q", tname, want, body)
+				}
+				if stub.queries.Load() == before {
+					t.Errorf("%s: expected the lookup to reach the stub", tname)
+				}
+
+				// Names the stub does not know fail as DNS errors
+				_, err = client.Get(fmt.Sprintf("http://missing.corp:%d/", port))
+				if kind := requestErrorKind(err); kind != KindDNSFailure {
+					t.Errorf("%s: expected %s, got %s (%v)", tname, KindDNSFailure, kind, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDoHResolverFailure(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	resolver := NewDoHResolver(server.URL+"/dns-query?token=s3cr3t", server.Client())
+	_, err := resolver.LookupNetIP(t.Context(), "ip4", "example.test")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		t.Errorf("expected a DNS error, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "s3cr3t") {
+		t.Errorf("expected the endpoint's query left out of the error, got %v", err)
+	}
+}
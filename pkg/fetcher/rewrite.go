@@ -0,0 +1,66 @@
+package fetcher
+
+import (
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+// urlRewrite turns a URL of a page that wraps a file in a site's interface
+// into the URL of the file itself
+type urlRewrite struct {
+	// name identifies the rewrite in logs and notes
+	name string
+	// host is the lowercase host the rewrite applies to
+	host string
+	// path matches the URL path; query strings and fragments are dropped
+	path *regexp.Regexp
+	// target is the rewritten URL, expanded with path's submatches
+	target string
+}
+
+// knownHostRewrites are applied by FetchRequest.RewriteKnownHosts. Supporting
+// another host only takes a new entry here.
+var knownHostRewrites = []urlRewrite{
+	{
+		name:   "github_blob",
+		host:   "github.com",
+		path:   regexp.MustCompile(`^/([^/]+)/([^/]+)/blob/(.+)$`),
+		target: "https://raw.githubusercontent.com/$1/$2/$3",
+	},
+	{
+		name:   "gitlab_blob",
+		host:   "gitlab.com",
+		path:   regexp.MustCompile(`^/(.+?)/-/blob/(.+)$`),
+		target: "https://gitlab.com/$1/-/raw/$2",
+	},
+	{
+		name:   "gist",
+		host:   "gist.github.com",
+		path:   regexp.MustCompile(`^/([^/]+)/([0-9a-f]+)/?$`),
+		target: "https://gist.githubusercontent.com/$1/$2/raw",
+	},
+}
+
+// rewriteKnownHost returns the raw file URL for rawURL and the name of the
+// rewrite that produced it, or rawURL unchanged and an empty name when no
+// rewrite applies. Only https URLs without credentials are rewritten.
+func rewriteKnownHost(rawURL string) (string, string) {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil || parsed.Scheme != "https" || parsed.User != nil || parsed.Port() != "" {
+		return rawURL, ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	for _, rewrite := range knownHostRewrites {
+		if host != rewrite.host {
+			continue
+		}
+		match := rewrite.path.FindStringSubmatchIndex(parsed.EscapedPath())
+		if match == nil {
+			continue
+		}
+		target := rewrite.path.ExpandString(nil, rewrite.target, parsed.EscapedPath(), match)
+		return string(target), rewrite.name
+	}
+	return rawURL, ""
+}
@@ -0,0 +1,71 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// interfaceAddrs lists the addresses assigned to this host's interfaces
+var interfaceAddrs = net.InterfaceAddrs
+
+// newDialer returns the dialer used for fetches, connecting from localAddr
+// when it is not nil
+func newDialer(localAddr net.Addr) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		LocalAddr: localAddr,
+	}
+}
+
+// BindSourceAddress makes every connection through transport leave from
+// addr, so that firewall rules and allowlists keyed on it apply on hosts with
+// several addresses. It fails unless addr is assigned to one of this host's
+// interfaces. Only destinations of addr's family can be reached, so an IPv4
+// source never dials IPv6 addresses. Dial errors name the source address.
+// Apply it before GuardMetadataEndpoints and RequireProxy, which keep the
+// dialer it sets.
+func BindSourceAddress(transport *http.Transport, addr netip.Addr) error {
+	addr = addr.Unmap()
+	assigned, err := interfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("source address %s: failed to list interface addresses: %w", addr, err)
+	}
+	if !hasAddr(assigned, addr) {
+		return fmt.Errorf("source address %s is not assigned to any interface of this host", addr)
+	}
+
+	dialer := newDialer(&net.TCPAddr{IP: addr.AsSlice(), Zone: addr.Zone()})
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if network == "tcp" {
+			network = "tcp6"
+			if addr.Is4() {
+				network = "tcp4"
+			}
+		}
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s from source address %s: %w", address, addr, err)
+		}
+		return conn, nil
+	}
+	return nil
+}
+
+// hasAddr reports whether addr is among the interface addresses assigned
+func hasAddr(assigned []net.Addr, addr netip.Addr) bool {
+	for _, a := range assigned {
+		prefix, err := netip.ParsePrefix(a.String())
+		if err != nil {
+			continue
+		}
+		if prefix.Addr().Unmap().WithZone("") == addr.WithZone("") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package fetcher
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestBindSourceAddress(t *testing.T) {
+	var remote string
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		remote = r.RemoteAddr
+	}))
+	defer server.Close()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if err := BindSourceAddress(transport, netip.MustParseAddr("127.0.0.1")); err != nil {
+		t.Fatalf("expected the loopback address to be bindable: %v", err)
+	}
+	// The metadata guard keeps the bound dialer
+	client := &http.Client{Transport: GuardMetadataEndpoints(transport)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if host, _, _ := net.SplitHostPort(remote); host != "127.0.0.1" {
+		t.Errorf("expected the connection to come from 127.0.0.1, got %s", remote)
+	}
+}
+
+func TestBindSourceAddressDialer(t *testing.T) {
+	// Both addresses are reported as assigned, so nothing is really bound
+	defer func(orig func() ([]net.Addr, error)) { interfaceAddrs = orig }(interfaceAddrs)
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("192.0.2.10"), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("2001:db8::10"), Mask: net.CIDRMask(64, 128)},
+		}, nil
+	}
+
+	tests := []struct {
+		name        string
+		addr        string
+		expectedErr string
+	}{
+		{name: "assigned IPv4", addr: "192.0.2.10"},
+		{name: "assigned IPv6", addr: "2001:db8::10"},
+		{name: "unassigned", addr: "192.0.2.11", expectedErr: "source address 192.0.2.11 is not assigned to any interface"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &http.Transport{}
+			err := BindSourceAddress(transport, netip.MustParseAddr(tt.addr))
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected %q, got %v", tt.expectedErr, err)
+				}
+				if transport.DialContext != nil {
+					t.Error("expected the transport to be left alone")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// The address is not really assigned, so dialing fails naming it
+			ctx, cancel := context.WithCancel(t.Context())
+			cancel()
+			_, err = transport.DialContext(ctx, "tcp", "127.0.0.1:1")
+			if err == nil || !strings.Contains(err.Error(), "from source address "+tt.addr) {
+				t.Errorf("expected the error to name the source address, got %v", err)
+			}
+		})
+	}
+}
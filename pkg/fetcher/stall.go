@@ -0,0 +1,61 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultStallTimeout is the idle window used when none is configured
+const DefaultStallTimeout = 15 * time.Second
+
+// StalledError reports a download that was aborted because the origin stopped
+// sending data. It is distinct from the overall fetch timeout, which bounds the
+// whole request regardless of progress.
+type StalledError struct {
+	// Idle is the window during which no bytes arrived
+	Idle time.Duration
+	// Received is the number of body bytes read before the stall
+	Received int64
+}
+
+// Error implements the error interface
+func (e *StalledError) Error() string {
+	return fmt.Sprintf("stalled download: no data received for %s after %d bytes", e.Idle, e.Received)
+}
+
+// stallReader wraps a response body and cancels the request when no bytes
+// arrive within the idle window. Each successful read restarts the window.
+type stallReader struct {
+	body     io.Reader
+	idle     time.Duration
+	timer    *time.Timer
+	received atomic.Int64
+}
+
+// newStallReader watches body, cancelling the request through cancel once it
+// has been idle for longer than idle
+func newStallReader(body io.Reader, idle time.Duration, cancel context.CancelCauseFunc) *stallReader {
+	r := &stallReader{body: body, idle: idle}
+	r.timer = time.AfterFunc(idle, func() {
+		cancel(&StalledError{Idle: idle, Received: r.received.Load()})
+	})
+	return r
+}
+
+// Read implements io.Reader
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.received.Add(int64(n))
+		r.timer.Reset(r.idle)
+	}
+	return n, err
+}
+
+// stop releases the idle timer
+func (r *stallReader) stop() {
+	r.timer.Stop()
+}
@@ -0,0 +1,74 @@
+package fetcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+// createStallTestFetcher creates a fetcher with a short idle window and a
+// generous overall timeout, so only stall detection can end a slow download
+func createStallTestFetcher(stallTimeout time.Duration) *HTTPFetcher {
+	client := &http.Client{Timeout: 10 * time.Second}
+	robotsChecker := robots.NewChecker("TestBot/1.0", "", true, false, client)
+	return NewHTTPFetcher(client, robotsChecker, processor.NewContentProcessor(processor.Options{DisableTitleHeader: true}), "TestBot/1.0", nil, stallTimeout, 0, URLLimits{}, nil)
+}
+
+func TestFetchURLAbortsStalledDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		// Dribble a few bytes, then go silent without closing the response
+		for range 3 {
+			w.Write([]byte("x"))
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	fetcher := createStallTestFetcher(200 * time.Millisecond)
+
+	start := time.Now()
+	_, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL})
+	elapsed := time.Since(start)
+
+	var stallErr *StalledError
+	if !errors.As(err, &stallErr) || !errors.Is(err, KindNetwork) {
+		t.Fatalf("expected a stalled download network error, got %v", err)
+	}
+	if stallErr.Idle != 200*time.Millisecond || stallErr.Received != 3 {
+		t.Errorf("unexpected stall details: %+v", stallErr)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("stall was detected only after %s", elapsed)
+	}
+}
+
+func TestFetchURLSlowButSteadyDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		// Each gap is shorter than the idle window, but together they exceed it
+		for range 10 {
+			w.Write([]byte("x"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := createStallTestFetcher(200 * time.Millisecond)
+
+	result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Content != "xxxxxxxxxx" {
+		t.Errorf("expected full content, got %q", result.Content)
+	}
+}
@@ -0,0 +1,213 @@
+package fetcher
+
+import (
+	"cmp"
+	"errors"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxTrackedDomains bounds the domains DomainStats reports on. When a new
+// domain arrives at the limit, the one fetched least recently is forgotten.
+const MaxTrackedDomains = 1000
+
+// DomainStats counts the fetches made to one domain since the process started
+type DomainStats struct {
+	Domain string
+	// Fetches counts every fetch attempted, including failed and refused ones
+	Fetches int64
+	// Bytes counts the response body bytes downloaded
+	Bytes int64
+	// Errors counts failed fetches other than robots.txt refusals
+	Errors int64
+	// RobotsBlocks counts fetches refused by robots.txt or robots directives
+	RobotsBlocks int64
+	// NotModified counts conditional fetches answered with 304 Not Modified
+	NotModified int64
+	// CachedFailures counts failures returned from the negative cache; they
+	// are also counted as fetches and as errors or robots blocks
+	CachedFailures int64
+	// BudgetBreaches counts pages whose conversion ran over the processing
+	// budget
+	BudgetBreaches int64
+	// DecompressionAborts counts responses refused for expanding past the
+	// decompression limits; they are also counted as errors
+	DecompressionAborts int64
+	// HeaderLimitAborts counts responses, redirects included, refused for
+	// headers past the header limits; they are also counted as errors
+	HeaderLimitAborts int64
+	// CircuitOpens counts the times a host of this domain had its circuit
+	// opened, and CircuitRejections the fetches failed while it was open.
+	// Rejections are also counted as errors.
+	CircuitOpens      int64
+	CircuitRejections int64
+	// LengthMismatches counts responses whose body ended before their
+	// declared Content-Length; they are successes, not errors
+	LengthMismatches int64
+	// RobotsAnomalies counts fetches that found the domain's robots.txt
+	// malformed, or not a robots.txt at all
+	RobotsAnomalies int64
+	// BotChallenges counts fetches answered with a bot protection challenge;
+	// they are also counted as errors
+	BotChallenges int64
+	// Circuit is the state of the domain's least healthy circuit: closed,
+	// open or half_open
+	Circuit   string
+	LastFetch time.Time
+}
+
+// domainStats accumulates DomainStats for at most MaxTrackedDomains domains.
+// It is safe for concurrent use.
+type domainStats struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	domains map[string]*DomainStats
+}
+
+// newDomainStats returns empty statistics
+func newDomainStats() *domainStats {
+	return &domainStats{now: time.Now, domains: make(map[string]*DomainStats)}
+}
+
+// record counts a fetch of rawURL that returned result or err. URLs without
+// a host are not counted.
+func (s *domainStats) record(rawURL string, result *FetchResult, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.entry(rawURL)
+	if stats == nil {
+		return
+	}
+
+	stats.Fetches++
+	stats.LastFetch = s.now()
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) && fetchErr.Cached {
+		stats.CachedFailures++
+	}
+	if errors.Is(err, KindCircuitOpen) {
+		stats.CircuitRejections++
+	}
+	if errors.Is(err, KindBotProtection) {
+		stats.BotChallenges++
+	}
+	var limitErr *DecompressionLimitError
+	if errors.As(err, &limitErr) && (fetchErr == nil || !fetchErr.Cached) {
+		stats.DecompressionAborts++
+	}
+	var headerErr *ResponseHeaderError
+	if errors.As(err, &headerErr) && (fetchErr == nil || !fetchErr.Cached) {
+		stats.HeaderLimitAborts++
+	}
+	switch {
+	case errors.Is(err, KindRobotsBlocked):
+		stats.RobotsBlocks++
+	case err != nil:
+		stats.Errors++
+	case result != nil:
+		stats.Bytes += result.BodyBytes
+		if result.BudgetExceeded {
+			stats.BudgetBreaches++
+		}
+		if result.NotModified {
+			stats.NotModified++
+		}
+		if result.LengthMismatch {
+			stats.LengthMismatches++
+		}
+	}
+}
+
+// circuitOpened counts the opening of a circuit of rawURL's domain
+func (s *domainStats) circuitOpened(rawURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stats := s.entry(rawURL); stats != nil {
+		stats.CircuitOpens++
+	}
+}
+
+// robotsAnomaly counts a fetch of rawURL that found its robots.txt malformed
+func (s *domainStats) robotsAnomaly(rawURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stats := s.entry(rawURL); stats != nil {
+		stats.RobotsAnomalies++
+	}
+}
+
+// entry returns the statistics of rawURL's domain, adding them when it is
+// new, or nil when rawURL has no host. The caller holds mu.
+func (s *domainStats) entry(rawURL string) *DomainStats {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return nil
+	}
+	domain := normalizeHostname(parsed.Hostname())
+
+	stats, ok := s.domains[domain]
+	if !ok {
+		if len(s.domains) >= MaxTrackedDomains {
+			s.evictOldest()
+		}
+		stats = &DomainStats{Domain: domain}
+		s.domains[domain] = stats
+	}
+	return stats
+}
+
+// evictOldest forgets the domain fetched least recently. The caller holds mu.
+func (s *domainStats) evictOldest() {
+	var oldest *DomainStats
+	for _, stats := range s.domains {
+		if oldest == nil || stats.LastFetch.Before(oldest.LastFetch) {
+			oldest = stats
+		}
+	}
+	if oldest != nil {
+		delete(s.domains, oldest.Domain)
+	}
+}
+
+// top returns copies of the statistics of the limit domains fetched most,
+// by fetches and then bytes, along with the number of domains tracked. A
+// limit of zero or less returns every domain.
+func (s *domainStats) top(limit int) ([]DomainStats, int) {
+	s.mu.Lock()
+	all := make([]DomainStats, 0, len(s.domains))
+	for _, stats := range s.domains {
+		all = append(all, *stats)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(all, func(a, b DomainStats) int {
+		switch {
+		case a.Fetches != b.Fetches:
+			return cmp.Compare(b.Fetches, a.Fetches)
+		case a.Bytes != b.Bytes:
+			return cmp.Compare(b.Bytes, a.Bytes)
+		default:
+			return strings.Compare(a.Domain, b.Domain)
+		}
+	})
+	tracked := len(all)
+	if limit > 0 && len(all) > limit {
+		all = all[:limit]
+	}
+	return all, tracked
+}
+
+// DomainStats returns the statistics of the limit domains fetched most since
+// the process started, by fetches and then bytes, along with the number of
+// domains tracked. A limit of zero or less returns every domain.
+func (f *HTTPFetcher) DomainStats(limit int) ([]DomainStats, int) {
+	stats, tracked := f.stats.top(limit)
+	for i := range stats {
+		stats[i].Circuit = f.breaker.state(stats[i].Domain)
+	}
+	return stats, tracked
+}
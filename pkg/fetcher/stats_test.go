@@ -0,0 +1,151 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+func TestDomainStatsParallelFetches(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/error":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("0123456789"))
+		}
+	}))
+	defer server.Close()
+
+	// Every host resolves to the test server, so each counts as its own domain
+	dialer := &net.Dialer{}
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		},
+	}
+	fetcher := NewHTTPFetcher(client, robots.NewChecker("TestBot/1.0", "", false, false, client),
+		processor.NewContentProcessor(processor.Options{DisableTitleHeader: true}), "TestBot/1.0", nil, 0, 8, URLLimits{}, nil)
+
+	fetches := map[string]int{"a.test": 12, "b.test": 8, "c.test": 4}
+	var wg sync.WaitGroup
+	for host, count := range fetches {
+		for i := range count {
+			path := "/page"
+			switch i {
+			case 0:
+				path = "/private"
+			case 1:
+				path = "/error"
+			}
+			wg.Go(func() {
+				fetcher.FetchURL(t.Context(), &FetchRequest{URL: fmt.Sprintf("http://%s%s", host, path)})
+			})
+		}
+	}
+	wg.Wait()
+
+	stats, tracked := fetcher.DomainStats(2)
+	if tracked != 3 {
+		t.Errorf("expected 3 domains tracked, got %d", tracked)
+	}
+	if len(stats) != 2 || stats[0].Domain != "a.test" || stats[1].Domain != "b.test" {
+		t.Fatalf("expected the two busiest domains in order, got %+v", stats)
+	}
+	for _, domain := range stats {
+		count := int64(fetches[domain.Domain])
+		if domain.Fetches != count || domain.RobotsBlocks != 1 || domain.Errors != 1 {
+			t.Errorf("expected %d fetches with one robots block and one error, got %+v", count, domain)
+		}
+		// Error bodies are not downloaded, so only the pages count
+		if domain.Bytes != (count-2)*10 {
+			t.Errorf("expected %d bytes for %s, got %d", (count-2)*10, domain.Domain, domain.Bytes)
+		}
+		if domain.LastFetch.IsZero() {
+			t.Errorf("expected a last fetch time for %s", domain.Domain)
+		}
+	}
+}
+
+func TestDomainStatsEvictsLeastRecentlyFetched(t *testing.T) {
+	stats := newDomainStats()
+	now := time.Unix(0, 0)
+	stats.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for i := range MaxTrackedDomains {
+		stats.record(fmt.Sprintf("https://host%d.test/", i), nil, nil)
+	}
+	// Fetching host0 again makes host1 the least recently fetched
+	stats.record("https://HOST0.test/", nil, nil)
+	stats.record("https://new.test/", nil, errors.New("failed"))
+
+	all, tracked := stats.top(0)
+	if tracked != MaxTrackedDomains || len(all) != MaxTrackedDomains {
+		t.Fatalf("expected %d domains, got %d", MaxTrackedDomains, tracked)
+	}
+	if all[0].Domain != "host0.test" || all[0].Fetches != 2 {
+		t.Errorf("expected host0.test to lead with 2 fetches, got %+v", all[0])
+	}
+	for _, domain := range all {
+		if domain.Domain == "host1.test" {
+			t.Error("expected host1.test to be evicted")
+		}
+		if domain.Domain == "new.test" && domain.Errors != 1 {
+			t.Errorf("expected new.test to count its error, got %+v", domain)
+		}
+	}
+}
+
+func TestDomainStatsRobotsAnomalies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			// An error page served in place of robots.txt
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body><pre>User-agent: *\nDisallow: /\n</pre></body></html>"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	fetcher := New(
+		WithHTTPClient(client),
+		WithRobots(robots.NewChecker("TestBot/1.0", "", false, false, client)),
+		WithProcessor(processor.NewContentProcessor(processor.Options{DisableTitleHeader: true})),
+	)
+
+	for i := range 2 {
+		result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/page"})
+		if err != nil {
+			t.Fatalf("fetch %d: expected the unrecognized robots.txt to be ignored, got %v", i, err)
+		}
+		if !result.Warnings.Has(WarningRobotsMalformed) {
+			t.Errorf("fetch %d: expected a robots.txt warning, got %v", i, result.Warnings)
+		}
+	}
+
+	stats, _ := fetcher.DomainStats(1)
+	if len(stats) != 1 || stats[0].RobotsAnomalies != 2 || stats[0].RobotsBlocks != 0 {
+		t.Errorf("expected two robots anomalies and no blocks, got %+v", stats)
+	}
+}
@@ -0,0 +1,175 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// fetchTimings holds the duration breakdown of a single fetch, along with
+// how its connection was obtained
+type fetchTimings struct {
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+
+	// HostWait is the time spent queued behind other fetches to the same
+	// host and waiting for its pace. It is not part of TTFB, which starts
+	// once the wait is over, nor of Execution.
+	HostWait time.Duration
+	// Execution is the time from the end of HostWait until the page was
+	// processed, so the time spent waiting can be told from the time taken
+	// by the fetch itself
+	Execution  time.Duration
+	DNS        time.Duration
+	Connect    time.Duration
+	TLS        time.Duration
+	TTFB       time.Duration
+	BodyRead   time.Duration
+	Processing time.Duration
+
+	// BodyBytes is the number of bytes read off the wire while reading the
+	// body, compressed if it was. Decompress is the part of BodyRead spent
+	// decoding a compressed body rather than waiting on the network, so a
+	// slow transfer can be told from a costly one.
+	BodyBytes  int64
+	Decompress time.Duration
+
+	// ConnReused reports that the request went out on a connection kept from
+	// an earlier one, which had been idle for ConnIdle. Requests that were
+	// never sent, such as ones refused while dialing, leave it false.
+	ConnReused bool
+	ConnIdle   time.Duration
+	// DNSCoalesced reports that the lookup was shared with a concurrent one
+	// for the same host
+	DNSCoalesced bool
+}
+
+// newFetchTimings creates a timing recorder whose clock starts now
+func newFetchTimings() *fetchTimings {
+	return &fetchTimings{start: time.Now()}
+}
+
+// hostWaitDone records the time spent waiting for a per-host slot and
+// restarts the clock so the wait is not counted as time to first byte
+func (t *fetchTimings) hostWaitDone() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.HostWait = now.Sub(t.start)
+	t.start = now
+}
+
+// done records the execution time of a fetch whose page has been processed
+func (t *fetchTimings) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Execution = time.Since(t.start)
+}
+
+// withClientTrace returns a context that records connection phase timings into t
+func (t *fetchTimings) withClientTrace(ctx context.Context) context.Context {
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !t.dnsStart.IsZero() {
+				t.DNS = time.Since(t.dnsStart)
+			}
+			t.DNSCoalesced = info.Coalesced
+		},
+		ConnectStart: func(_, _ string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.connectStart = time.Now()
+		},
+		ConnectDone: func(_, _ string, _ error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !t.connectStart.IsZero() {
+				t.Connect = time.Since(t.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !t.tlsStart.IsZero() {
+				t.TLS = time.Since(t.tlsStart)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.ConnReused = info.Reused
+			t.ConnIdle = info.IdleTime
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.TTFB = time.Since(t.start)
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace)
+}
+
+// String formats the breakdown for logging. conn is reused, with how long
+// the connection had been idle, or new; dns_coalesced marks a shared lookup.
+func (t *fetchTimings) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn := "conn=new"
+	if t.ConnReused {
+		conn = fmt.Sprintf("conn=reused idle=%s", t.ConnIdle)
+	}
+	if t.DNSCoalesced {
+		conn += " dns_coalesced"
+	}
+	body := fmt.Sprintf("body=%s body_bytes=%d throughput=%s", t.BodyRead, t.BodyBytes, throughput(t.BodyBytes, t.BodyRead))
+	if t.Decompress > 0 {
+		body += fmt.Sprintf(" decompress=%s", t.Decompress)
+	}
+	return fmt.Sprintf("host_wait=%s execution=%s dns=%s connect=%s tls=%s ttfb=%s %s processing=%s %s",
+		t.HostWait, t.Execution, t.DNS, t.Connect, t.TLS, t.TTFB, body, t.Processing, conn)
+}
+
+// throughput formats the average rate of reading n bytes in d
+func throughput(n int64, d time.Duration) string {
+	if d <= 0 {
+		return "0B/s"
+	}
+	return fmt.Sprintf("%.0fB/s", float64(n)/d.Seconds())
+}
+
+// wireReader counts the bytes read from a response body and the time spent
+// waiting on them, which is what is left of the body read once decoding is
+// taken out
+type wireReader struct {
+	r    io.Reader
+	n    int64
+	wait time.Duration
+}
+
+func (w *wireReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.r.Read(p)
+	w.wait += time.Since(start)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,197 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchTimingsCapturesTTFB(t *testing.T) {
+	delay := 50 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte("delayed"))
+	}))
+	defer server.Close()
+
+	timings := newFetchTimings()
+	req, err := http.NewRequestWithContext(timings.withClientTrace(t.Context()), "GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if timings.TTFB < delay {
+		t.Errorf("expected TTFB >= %s, got %s", delay, timings.TTFB)
+	}
+	if timings.Connect <= 0 {
+		t.Errorf("expected connect duration to be recorded, got %s", timings.Connect)
+	}
+	if timings.TLS != 0 {
+		t.Errorf("expected no TLS duration for plain HTTP, got %s", timings.TLS)
+	}
+}
+
+func TestFetchTimingsString(t *testing.T) {
+	timings := &fetchTimings{
+		HostWait:   300 * time.Millisecond,
+		Execution:  4 * time.Second,
+		TTFB:       2 * time.Second,
+		BodyRead:   time.Second,
+		Processing: 500 * time.Millisecond,
+	}
+
+	s := timings.String()
+	for _, want := range []string{"host_wait=300ms execution=4s", "ttfb=2s", "body=1s", "processing=500ms", "conn=new"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected %q in %q", want, s)
+		}
+	}
+	if strings.Contains(s, "decompress=") {
+		t.Errorf("expected no decompression time for an uncompressed body, got %q", s)
+	}
+
+	timings.BodyBytes = 4096
+	timings.Decompress = 250 * time.Millisecond
+	if s = timings.String(); !strings.Contains(s, "body=1s body_bytes=4096 throughput=4096B/s decompress=250ms") {
+		t.Errorf("expected the body read detail in %q", s)
+	}
+}
+
+func TestFetchURLTimesThrottledBody(t *testing.T) {
+	const chunks, pause = 4, 25 * time.Millisecond
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(bytes.Repeat([]byte("throttled body "), 4096))
+	gz.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		body := compressed.Bytes()
+		if r.URL.Path == "/gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+		size := len(body)/chunks + 1
+		for len(body) > 0 {
+			n := min(size, len(body))
+			w.Write(body[:n])
+			w.(http.Flusher).Flush()
+			body = body[n:]
+			time.Sleep(pause)
+		}
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	f := New(WithRobots(allowAll{}))
+	breakdown := regexp.MustCompile(`body=(\S+) body_bytes=(\d+) throughput=\d+B/s( decompress=(\S+))?`)
+	for _, path := range []string{"/gzip", "/plain"} {
+		buf.Reset()
+		if _, err := f.FetchURL(t.Context(), &FetchRequest{URL: server.URL + path, Raw: true}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+		match := breakdown.FindStringSubmatch(buf.String())
+		if match == nil {
+			t.Fatalf("%s: no body timings logged:\n%s", path, buf.String())
+		}
+		body, _ := time.ParseDuration(match[1])
+		if body < (chunks-1)*pause {
+			t.Errorf("%s: expected the body read to span the throttled chunks, got %s", path, body)
+		}
+		if match[2] != strconv.Itoa(compressed.Len()) {
+			t.Errorf("%s: expected %d bytes off the wire, got %s", path, compressed.Len(), match[2])
+		}
+		decompress, _ := time.ParseDuration(match[4])
+		if path == "/gzip" && (match[3] == "" || decompress >= body) {
+			t.Errorf("%s: expected decompression timed apart from the transfer, got %q", path, match[0])
+		}
+		if path == "/plain" && match[3] != "" {
+			t.Errorf("%s: expected no decompression time, got %q", path, match[0])
+		}
+	}
+}
+
+func TestFetchTimingsHostWaitExcludedFromTTFB(t *testing.T) {
+	wait := 50 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer server.Close()
+
+	timings := newFetchTimings()
+	time.Sleep(wait)
+	timings.hostWaitDone()
+
+	req, err := http.NewRequestWithContext(timings.withClientTrace(t.Context()), "GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if timings.HostWait < wait {
+		t.Errorf("expected host wait >= %s, got %s", wait, timings.HostWait)
+	}
+	if timings.TTFB >= wait {
+		t.Errorf("expected TTFB to exclude the host wait, got %s", timings.TTFB)
+	}
+}
+
+func TestFetchTimingsDetectsConnectionReuse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	defer client.CloseIdleConnections()
+
+	fetch := func() *fetchTimings {
+		t.Helper()
+		timings := newFetchTimings()
+		req, err := http.NewRequestWithContext(timings.withClientTrace(t.Context()), "GET", server.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		// The connection only returns to the pool once the body is drained
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return timings
+	}
+
+	first := fetch()
+	second := fetch()
+	if first.ConnReused || !strings.Contains(first.String(), "conn=new") {
+		t.Errorf("expected the first fetch to dial a new connection, got %s", first)
+	}
+	if !second.ConnReused || !strings.Contains(second.String(), "conn=reused") {
+		t.Errorf("expected the second fetch to reuse the connection, got %s", second)
+	}
+	if second.Connect != 0 {
+		t.Errorf("expected no connect time on a reused connection, got %s", second.Connect)
+	}
+}
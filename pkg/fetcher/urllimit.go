@@ -0,0 +1,80 @@
+package fetcher
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Defaults for URLLimits fields left at zero
+const (
+	DefaultMaxURLLength   = 8 << 10
+	DefaultMaxQueryParams = 100
+)
+
+// URLLimits bounds the size of URLs accepted for fetching. Oversized URLs,
+// such as hallucinated multi-kilobyte query strings, waste a fetch and can
+// upset proxies along the way.
+type URLLimits struct {
+	// MaxLength is the longest URL accepted, in bytes. Zero selects
+	// DefaultMaxURLLength.
+	MaxLength int
+	// MaxQueryParams is the most query parameters a URL may carry. Zero
+	// selects DefaultMaxQueryParams.
+	MaxQueryParams int
+}
+
+// withDefaults returns a copy of l with zero fields set to their defaults
+func (l URLLimits) withDefaults() URLLimits {
+	if l.MaxLength == 0 {
+		l.MaxLength = DefaultMaxURLLength
+	}
+	if l.MaxQueryParams == 0 {
+		l.MaxQueryParams = DefaultMaxQueryParams
+	}
+	return l
+}
+
+// URLLimitError reports a URL rejected for exceeding a URLLimits bound
+type URLLimitError struct {
+	// Limit names the exceeded bound: "length" or "query parameters"
+	Limit string
+	// Actual and Max are the URL's measure and the configured maximum
+	Actual, Max int
+}
+
+// Error implements the error interface
+func (e *URLLimitError) Error() string {
+	if e.Limit == "length" {
+		return fmt.Sprintf("URL is %d bytes long, over the limit of %d bytes", e.Actual, e.Max)
+	}
+	return fmt.Sprintf("URL has %d %s, over the limit of %d", e.Actual, e.Limit, e.Max)
+}
+
+// check returns a *URLLimitError when rawURL exceeds the limits
+func (l URLLimits) check(rawURL string) error {
+	if len(rawURL) > l.MaxLength {
+		return &URLLimitError{Limit: "length", Actual: len(rawURL), Max: l.MaxLength}
+	}
+	if params := countQueryParams(rawURL); params > l.MaxQueryParams {
+		return &URLLimitError{Limit: "query parameters", Actual: params, Max: l.MaxQueryParams}
+	}
+	return nil
+}
+
+// countQueryParams counts the non-empty &-separated pairs of rawURL's query,
+// including repeated names, without parsing the rest of the URL
+func countQueryParams(rawURL string) int {
+	_, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return 0
+	}
+	query, _, _ = strings.Cut(query, "#")
+
+	count := 0
+	for pair := range strings.SplitSeq(query, "&") {
+		if pair != "" {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,83 @@
+package fetcher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestURLLimitsCheck(t *testing.T) {
+	limits := URLLimits{MaxLength: 64, MaxQueryParams: 3}.withDefaults()
+
+	tests := []struct {
+		name      string
+		url       string
+		exceeded  string
+		errSubstr string
+	}{
+		{name: "within limits", url: "https://example.com/search?q=go&page=2"},
+		{name: "empty pairs are not counted", url: "https://example.com/?a=1&&b=2&c=3&"},
+		{name: "fragment is not counted", url: "https://example.com/?a=1&b=2&c=3#d=4&e=5"},
+		{
+			name:      "too long",
+			url:       "https://example.com/" + strings.Repeat("a", 50),
+			exceeded:  "length",
+			errSubstr: "URL is 70 bytes long, over the limit of 64 bytes",
+		},
+		{
+			name:      "too many parameters",
+			url:       "https://example.com/?a=1&a=2&b&c=3",
+			exceeded:  "query parameters",
+			errSubstr: "URL has 4 query parameters, over the limit of 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := limits.check(tt.url)
+			if tt.exceeded == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var limitErr *URLLimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.exceeded {
+				t.Fatalf("expected the %s limit to be exceeded, got %v", tt.exceeded, err)
+			}
+			if err.Error() != tt.errSubstr {
+				t.Errorf("expected %q, got %q", tt.errSubstr, err.Error())
+			}
+		})
+	}
+}
+
+func TestURLLimitsDefaults(t *testing.T) {
+	limits := URLLimits{}.withDefaults()
+	if limits.MaxLength != DefaultMaxURLLength || limits.MaxQueryParams != DefaultMaxQueryParams {
+		t.Errorf("expected defaults, got %+v", limits)
+	}
+}
+
+func TestFetchURLRejectsOversizedURL(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	fetcher := createTestFetcher()
+	_, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL + "/?q=" + strings.Repeat("x", DefaultMaxURLLength)})
+	var limitErr *URLLimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, KindTooLarge) {
+		t.Fatalf("expected a too_large URLLimitError, got %v", err)
+	}
+	// Neither robots.txt nor the page was requested
+	if n := requests.Load(); n != 0 {
+		t.Errorf("expected no requests, got %d", n)
+	}
+}
@@ -0,0 +1,96 @@
+package fetcher
+
+import "strings"
+
+// WarningCode identifies a kind of warning. Codes are stable, so clients can
+// act on them without parsing messages.
+type WarningCode string
+
+// Codes of the warnings a fetch can carry
+const (
+	// WarningURLRewritten: a known file viewer page was fetched as its raw file
+	WarningURLRewritten WarningCode = "url_rewritten"
+	// WarningRobotsMalformed: the site's robots.txt is malformed, or is not a
+	// robots.txt at all and was ignored
+	WarningRobotsMalformed WarningCode = "robots_txt_malformed"
+	// WarningRobotsTimedOut: robots.txt could not be checked within its share
+	// of the deadline, so the page was fetched as if there were none
+	WarningRobotsTimedOut WarningCode = "robots_txt_timed_out"
+	// WarningEmptyResponse: the server returned no content
+	WarningEmptyResponse WarningCode = "empty_response"
+	// WarningContentTypeMismatch: the Content-Type contradicts the expected
+	// content
+	WarningContentTypeMismatch WarningCode = "content_type_mismatch"
+	// WarningLengthMismatch: the body ended before its declared Content-Length
+	WarningLengthMismatch WarningCode = "length_mismatch"
+	// WarningBodyTruncated: the download stopped at the byte limit
+	WarningBodyTruncated WarningCode = "body_truncated"
+	// WarningDegradedProcessing: processing failed part way and the content
+	// is a lesser representation of the page
+	WarningDegradedProcessing WarningCode = "degraded_processing"
+	// WarningProcessingBudget: converting the page ran over the processing
+	// budget, so the content is its plain text
+	WarningProcessingBudget WarningCode = "processing_budget_exceeded"
+	// WarningContentTruncated: only part of the content was returned
+	WarningContentTruncated WarningCode = "content_truncated"
+	// WarningOutOfRange: start_index was past the end of the content
+	WarningOutOfRange WarningCode = "out_of_range"
+	// WarningResultSplit: the result was too large for one message and was
+	// split into chunks
+	WarningResultSplit WarningCode = "result_split"
+)
+
+// WarningCodes lists every warning code
+var WarningCodes = []WarningCode{
+	WarningURLRewritten,
+	WarningRobotsMalformed,
+	WarningRobotsTimedOut,
+	WarningEmptyResponse,
+	WarningContentTypeMismatch,
+	WarningLengthMismatch,
+	WarningBodyTruncated,
+	WarningDegradedProcessing,
+	WarningProcessingBudget,
+	WarningContentTruncated,
+	WarningOutOfRange,
+	WarningResultSplit,
+}
+
+// Warning describes a condition worth reporting that did not fail the fetch
+type Warning struct {
+	Code WarningCode
+	// Message explains the condition in a sentence
+	Message string
+	// Detail holds specifics such as the values involved, and may be empty
+	Detail string
+}
+
+// Warnings collects the warnings of a fetch as it passes through the
+// pipeline
+type Warnings []Warning
+
+// Add records a warning
+func (w *Warnings) Add(code WarningCode, message, detail string) {
+	*w = append(*w, Warning{Code: code, Message: message, Detail: detail})
+}
+
+// Has reports whether a warning with code was recorded
+func (w Warnings) Has(code WarningCode) bool {
+	for _, warning := range w {
+		if warning.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary lists the distinct codes recorded, in order, separated by commas
+func (w Warnings) Summary() string {
+	codes := make([]string, 0, len(w))
+	for i, warning := range w {
+		if !w[:i].Has(warning.Code) {
+			codes = append(codes, string(warning.Code))
+		}
+	}
+	return strings.Join(codes, ", ")
+}
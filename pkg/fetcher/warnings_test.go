@@ -0,0 +1,67 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestWarningCodesUnique(t *testing.T) {
+	snakeCase := regexp.MustCompile(`^[a-z]+(_[a-z]+)*$`)
+	seen := make(map[WarningCode]bool)
+	for _, code := range WarningCodes {
+		if seen[code] {
+			t.Errorf("duplicate warning code %q", code)
+		}
+		seen[code] = true
+		if !snakeCase.MatchString(string(code)) {
+			t.Errorf("warning code %q is not snake_case", code)
+		}
+	}
+}
+
+func TestWarningsSummary(t *testing.T) {
+	var warnings Warnings
+	if summary := warnings.Summary(); summary != "" {
+		t.Errorf("expected an empty summary, got %q", summary)
+	}
+
+	warnings.Add(WarningLengthMismatch, "short body", "")
+	warnings.Add(WarningContentTypeMismatch, "expected json", "text/html")
+	warnings.Add(WarningLengthMismatch, "short again", "")
+	if summary := warnings.Summary(); summary != "length_mismatch, content_type_mismatch" {
+		t.Errorf("expected each code once in order, got %q", summary)
+	}
+	if !warnings.Has(WarningContentTypeMismatch) || warnings.Has(WarningOutOfRange) {
+		t.Errorf("unexpected Has results for %v", warnings)
+	}
+}
+
+func TestFetchURLPagingWarnings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	fetcher := New(WithRobots(allowAll{}))
+	maxLength, start, past := 4, 2, 20
+
+	result, err := fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL, MaxLength: &maxLength, StartIndex: &start})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Code != WarningContentTruncated ||
+		result.Warnings[0].Message != "returned 4 of 10 characters" || result.Warnings[0].Detail != "next_start_index=6" {
+		t.Errorf("expected a truncation warning, got %v", result.Warnings)
+	}
+
+	result, err = fetcher.FetchURL(t.Context(), &FetchRequest{URL: server.URL, StartIndex: &past})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Code != WarningOutOfRange {
+		t.Errorf("expected an out of range warning, got %v", result.Warnings)
+	}
+}
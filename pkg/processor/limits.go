@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Limits on the documents converted to markdown. Readability and the markdown
+// converter take seconds on pathological pages, so larger or deeper documents
+// are reduced to their plain text instead.
+const (
+	// MaxProcessSize is the largest HTML document, in bytes, that is parsed
+	MaxProcessSize = 5 << 20
+	// MaxNodes is the most nodes a parsed document may have
+	MaxNodes = 200_000
+	// MaxDepth is the deepest element nesting a parsed document may have
+	MaxDepth = 256
+)
+
+// treeLimitExceeded describes how doc exceeds MaxNodes or MaxDepth, or
+// returns an empty string when it does not. The walk stops as soon as a
+// limit is crossed.
+func treeLimitExceeded(doc *html.Node) string {
+	type frame struct {
+		node  *html.Node
+		depth int
+	}
+
+	nodes := 0
+	stack := []frame{{node: doc}}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		nodes++
+		if nodes > MaxNodes {
+			return fmt.Sprintf("more than %d nodes", MaxNodes)
+		}
+		if current.depth > MaxDepth {
+			return fmt.Sprintf("elements nested more than %d deep", MaxDepth)
+		}
+		for child := current.node.FirstChild; child != nil; child = child.NextSibling {
+			stack = append(stack, frame{node: child, depth: current.depth + 1})
+		}
+	}
+	return ""
+}
+
+// PlainTextFallback returns the text of an HTML document that is too large
+// or too complex to convert, preceded by a note saying why, and the warning
+// ProcessHTML reports for it. Extracting the text is cheap whatever the
+// document's structure.
+func PlainTextFallback(htmlContent, reason string) (content, warning string) {
+	log.Printf("HTML document too complex to convert (%s), extracting plain text", reason)
+	note := fmt.Sprintf("> Note: this page is too complex to convert to markdown (%s), so only its plain text is shown.\n\n", reason)
+	return note + plainText(htmlContent), fmt.Sprintf("the page is too complex to convert to markdown (%s)", reason)
+}
+
+// plainText extracts the visible text of an HTML document with a streaming
+// tokenizer, so its cost does not depend on how the document is nested.
+// Block elements start new lines.
+func plainText(htmlContent string) string {
+	var text strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(htmlContent))
+	skipping := 0
+	newline := func() {
+		if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+			text.WriteByte('\n')
+		}
+	}
+
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			if !errors.Is(tokenizer.Err(), io.EOF) {
+				log.Printf("Stopped extracting plain text: %v", tokenizer.Err())
+			}
+			return strings.TrimSpace(text.String())
+		case html.StartTagToken, html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := atom.Lookup(name)
+			if hiddenElements[tag] {
+				if tokenType == html.StartTagToken {
+					skipping++
+				} else if skipping > 0 {
+					skipping--
+				}
+			}
+			if blockElements[tag] {
+				newline()
+			}
+		case html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			if blockElements[atom.Lookup(name)] {
+				newline()
+			}
+		case html.TextToken:
+			if skipping > 0 {
+				continue
+			}
+			if words := strings.Fields(string(tokenizer.Text())); len(words) > 0 {
+				if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+					text.WriteByte(' ')
+				}
+				text.WriteString(strings.Join(words, " "))
+			}
+		}
+	}
+}
+
+// hiddenElements hold no visible text. Their end tags are required, so
+// skipping up to them cannot swallow the rest of the page.
+var hiddenElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+}
+
+// blockElements start a new line of plain text
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true, atom.Tr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Section: true, atom.Article: true, atom.Header: true, atom.Footer: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Table: true, atom.Ul: true, atom.Ol: true,
+}
@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcessHTMLFallsBackOnPathologicalDocuments(t *testing.T) {
+	tests := []struct {
+		name   string
+		html   string
+		reason string
+	}{
+		{
+			name:   "oversized document",
+			html:   "<html><body><p>Start of a huge page</p>" + strings.Repeat("<p>filler text</p>", MaxProcessSize/18+1) + "</body></html>",
+			reason: "byte limit",
+		},
+		{
+			name:   "too many nodes",
+			html:   "<html><body><p>Start of a busy page</p>" + strings.Repeat("<span>x</span>", MaxNodes/2+1) + "</body></html>",
+			reason: "more than 200000 nodes",
+		},
+		{
+			name:   "too deeply nested",
+			html:   "<html><body><p>Start of a deep page</p>" + strings.Repeat("<div>", MaxDepth+10) + "deep" + strings.Repeat("</div>", MaxDepth+10) + "</body></html>",
+			reason: "nested more than 256 deep",
+		},
+		{
+			name:   "nested beyond the parser limit",
+			html:   "<html><body><p>Start of a deeper page</p>" + strings.Repeat("<div>", 1000) + "deep" + "</body></html>",
+			reason: "open stack of elements exceeds",
+		},
+	}
+
+	processor := NewContentProcessor(Options{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, warning := processor.ProcessHTML(tt.html, "https://example.com/")
+			if !strings.HasPrefix(result, "> Note: this page is too complex") || !strings.Contains(result, tt.reason) {
+				t.Errorf("expected a note naming %q, got %.200q", tt.reason, result)
+			}
+			if !strings.Contains(warning, tt.reason) {
+				t.Errorf("expected a warning naming %q, got %q", tt.reason, warning)
+			}
+			if !strings.Contains(result, "Start of a") {
+				t.Errorf("expected the plain text of the page, got %.200q", result)
+			}
+			if strings.Contains(result, "<p>") || strings.Contains(result, "<div>") {
+				t.Errorf("expected markup to be removed, got %.200q", result)
+			}
+		})
+	}
+}
+
+func TestProcessHTMLWithinLimitsIsConverted(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("<div>", 50) + "<p>Nested but fine</p>" + strings.Repeat("</div>", 50) + "</body></html>"
+	result, warning := NewContentProcessor(Options{DisableTitleHeader: true}).ProcessHTML(page, "")
+	if strings.Contains(result, "Note:") || !strings.Contains(result, "Nested but fine") || warning != "" {
+		t.Errorf("expected a clean conversion, got %q (warning %q)", result, warning)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	page := `<html><head><title>Title</title><style>p { color: red }</style></head>` +
+		`<body><h1>Heading</h1><p>First   paragraph <b>bold</b></p><script>var x = 1;</script>` +
+		`<ul><li>one</li><li>two<br>lines</li></ul></body></html>`
+	expected := "Title\nHeading\nFirst paragraph bold\none\ntwo\nlines"
+	if got := plainText(page); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
@@ -2,65 +2,313 @@
 package processor
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
 	"strings"
 
-	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/base"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/commonmark"
 	"github.com/go-shiori/go-readability"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // ContentProcessor handles HTML processing and content formatting
 type ContentProcessor struct {
-	// No longer need to store a converter instance in v2
+	// titleHeader prepends the page title and source URL to converted pages
+	titleHeader bool
+	// readability extracts the main content of pages before converting them
+	readability bool
+	// convert turns HTML into markdown, giving up once ctx is done. Tests
+	// replace it to force failures.
+	convert func(ctx context.Context, html string) (string, error)
 }
 
-// NewContentProcessor creates a new content processor instance
-func NewContentProcessor() *ContentProcessor {
-	return &ContentProcessor{}
+// Options selects how a ContentProcessor converts pages. The zero value
+// gives the defaults: a title header, readability extraction and no inline
+// HTML.
+type Options struct {
+	// DisableTitleHeader leaves out the page title, which converted pages
+	// otherwise start with as an H1, followed by the source URL as a
+	// blockquote
+	DisableTitleHeader bool
+	// DisableReadability converts whole pages rather than extracting their
+	// main content and dropping the rest
+	DisableReadability bool
+	// AllowInlineHTML passes a few formatting elements through into
+	// markdown, without their attributes. Either way no event handler or
+	// javascript: URL survives.
+	AllowInlineHTML bool
 }
 
-// ProcessHTML converts HTML content to readable markdown
-func (*ContentProcessor) ProcessHTML(htmlContent string) string {
+// NewContentProcessor creates a new content processor instance converting
+// pages as opts selects
+func NewContentProcessor(opts Options) *ContentProcessor {
+	return &ContentProcessor{
+		titleHeader: !opts.DisableTitleHeader,
+		readability: !opts.DisableReadability,
+		convert: func(ctx context.Context, htmlContent string) (string, error) {
+			return convertMarkdown(ctx, htmlContent, opts.AllowInlineHTML)
+		},
+	}
+}
+
+// convertMarkdown converts sanitized HTML to markdown with the default
+// options. Once ctx is done every remaining node is skipped, so an abandoned
+// conversion stops promptly, and ctx's error is returned.
+func convertMarkdown(ctx context.Context, htmlContent string, inlineHTML bool) (string, error) {
+	conv := converter.NewConverter(converter.WithPlugins(base.NewBasePlugin(), commonmark.NewCommonmarkPlugin()))
+	registerSanitizer(conv, inlineHTML)
+	conv.Register.Renderer(func(ctx converter.Context, _ converter.Writer, _ *html.Node) converter.RenderStatus {
+		if ctx.Err() != nil {
+			return converter.RenderSuccess
+		}
+		return converter.RenderTryNext
+	}, 0)
+
+	markdown, err := conv.ConvertString(htmlContent, converter.WithContext(ctx))
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return "", ctxErr
+	}
+	return markdown, err
+}
+
+// ProcessHTML converts HTML content fetched from sourceURL to readable
+// markdown. Relative links in the extracted content are resolved against
+// sourceURL when it is an absolute URL. Documents beyond MaxProcessSize,
+// MaxNodes or MaxDepth are reduced to their plain text, with a note saying so.
+//
+// Processing never fails: when a step does, the best representation still
+// available is returned together with a warning describing what failed. The
+// warning is empty for a clean conversion.
+func (p *ContentProcessor) ProcessHTML(htmlContent, sourceURL string) (content, warning string) {
+	return p.ProcessHTMLContext(context.Background(), []byte(htmlContent), sourceURL)
+}
+
+// ProcessHTMLContext is ProcessHTML for a document held as bytes, such as a
+// response body, giving up once ctx is done, in which case it returns no
+// content and ctx's error as the warning. Readability extraction cannot be
+// interrupted, so ctx is checked around it. htmlContent is only read, and
+// only copied when the document has to be converted whole.
+func (p *ContentProcessor) ProcessHTMLContext(ctx context.Context, htmlContent []byte, sourceURL string) (content, warning string) {
+	if len(htmlContent) > MaxProcessSize {
+		return PlainTextFallback(string(htmlContent), fmt.Sprintf("%d bytes, over the %d byte limit", len(htmlContent), MaxProcessSize))
+	}
+
 	// Parse HTML document
-	doc, err := html.Parse(strings.NewReader(htmlContent))
+	doc, err := html.Parse(bytes.NewReader(htmlContent))
 	if err != nil {
-		return htmlContent
+		// The parser refuses some pathological documents, such as ones
+		// nested beyond its own depth limit
+		return PlainTextFallback(string(htmlContent), err.Error())
+	}
+	if reason := treeLimitExceeded(doc); reason != "" {
+		return PlainTextFallback(string(htmlContent), reason)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err.Error()
+	}
+	// Sanitized before extraction too, as the extracted HTML is returned
+	// when conversion fails
+	sanitizeHTML(doc)
+
+	var pageURL *url.URL
+	if parsed, err := url.Parse(sourceURL); err == nil && parsed.IsAbs() {
+		pageURL = parsed
 	}
 
-	// Extract readable content using readability
-	article, err := readability.FromDocument(doc, nil)
-	if err == nil && article.Content != "" {
-		htmlContent = article.Content
+	// Extract readable content using readability. Pages it finds nothing in
+	// are converted whole, which is expected for short pages.
+	var title, source string
+	extracted := false
+	if p.readability {
+		article, err := readability.FromDocument(doc, pageURL)
+		switch {
+		case err != nil:
+			warning = fmt.Sprintf("readability extraction failed (%v), so the whole page was converted", err)
+		case article.Content != "":
+			source = article.Content
+			title = article.Title
+			extracted = true
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err.Error()
+		}
+	} else {
+		title = documentTitle(doc)
+		if pageURL != nil {
+			resolveLinks(doc, pageURL)
+		}
+	}
+	if source == "" {
+		// The sanitized document, never the raw bytes
+		var rendered strings.Builder
+		if err := html.Render(&rendered, doc); err != nil {
+			return PlainTextFallback(string(htmlContent), err.Error())
+		}
+		source = rendered.String()
 	}
 
-	// Convert to markdown using the new v2 API
-	markdown, err := htmltomarkdown.ConvertString(htmlContent)
+	markdown, err := p.convert(ctx, source)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return "", ctxErr.Error()
+	}
 	if err != nil {
-		return htmlContent
+		if extracted {
+			return source, fmt.Sprintf("markdown conversion failed (%v), so the extracted HTML is returned", err)
+		}
+		return plainText(source), fmt.Sprintf("markdown conversion failed (%v), so only the plain text is returned", err)
+	}
+
+	if p.titleHeader {
+		markdown = titleHeader(title, sourceURL) + stripLeadingTitle(markdown, title)
+	}
+	return markdown, warning
+}
+
+// documentTitle returns the text of doc's first <title> element, or an
+// empty string when it has none
+func documentTitle(doc *html.Node) string {
+	for node := range doc.Descendants() {
+		if node.Type == html.ElementNode && node.DataAtom == atom.Title {
+			var title strings.Builder
+			for child := range node.ChildNodes() {
+				if child.Type == html.TextNode {
+					title.WriteString(child.Data)
+				}
+			}
+			return strings.TrimSpace(title.String())
+		}
 	}
+	return ""
+}
+
+// resolveLinks makes the link and image URLs of doc absolute against
+// pageURL, as readability does for the content it extracts
+func resolveLinks(doc *html.Node, pageURL *url.URL) {
+	for node := range doc.Descendants() {
+		if node.Type != html.ElementNode {
+			continue
+		}
+		for i, attr := range node.Attr {
+			if attr.Namespace != "" || (attr.Key != "href" && attr.Key != "src") {
+				continue
+			}
+			if ref, err := url.Parse(strings.TrimSpace(attr.Val)); err == nil {
+				node.Attr[i].Val = pageURL.ResolveReference(ref).String()
+			}
+		}
+	}
+}
+
+// titleHeader renders the header prepended to converted pages
+func titleHeader(title, sourceURL string) string {
+	var header strings.Builder
+	if title = strings.TrimSpace(title); title != "" {
+		header.WriteString("# " + title + "\n\n")
+	}
+	if sourceURL != "" {
+		header.WriteString("> Source: " + sourceURL + "\n\n")
+	}
+	return header.String()
+}
+
+// stripLeadingTitle removes a leading H1 identical to title, which the header
+// already repeats
+func stripLeadingTitle(markdown, title string) string {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return markdown
+	}
+
+	trimmed := strings.TrimLeft(markdown, "\n")
+	firstLine, rest, _ := strings.Cut(trimmed, "\n")
+	heading, ok := strings.CutPrefix(strings.TrimSpace(firstLine), "# ")
+	if !ok || !strings.EqualFold(strings.TrimSpace(heading), title) {
+		return markdown
+	}
+	return strings.TrimLeft(rest, "\n")
+}
+
+// PageInfo describes the window of content returned by FormatContent
+type PageInfo struct {
+	// StartIndex is the effective start offset into the content
+	StartIndex int
+	// TotalLength is the length of the full content before pagination
+	TotalLength int
+	// Returned is the number of characters of content returned, excluding any footer
+	Returned int
+	// Truncated reports whether max_length cut the content short
+	Truncated bool
+	// NextIndex is the start_index to use for the next page when Truncated is set
+	NextIndex int
+	// OutOfRange reports that a non-zero start_index was at or past the end of
+	// the content, so there was nothing left to return
+	OutOfRange bool
+}
+
+// truncationFooter is appended to content cut short by max_length
+const truncationFooter = "\n\n[Content truncated. Use start_index to get more content.]"
 
-	return markdown
+// OutOfRangeNote is the text returned in place of content when start_index
+// is past the end of the content
+func OutOfRangeNote(startIndex, totalLength int) string {
+	return fmt.Sprintf("[start_index %d is past the end of the content (total length %d).]", startIndex, totalLength)
 }
 
-// FormatContent applies pagination and truncation to content
-func (*ContentProcessor) FormatContent(content string, startIndex, maxLength *int) string {
+// ValidatePage rejects a negative start_index or max_length
+func ValidatePage(startIndex, maxLength *int) error {
+	if startIndex != nil && *startIndex < 0 {
+		return fmt.Errorf("invalid start_index %d: must not be negative", *startIndex)
+	}
+	if maxLength != nil && *maxLength < 0 {
+		return fmt.Errorf("invalid max_length %d: must not be negative", *maxLength)
+	}
+	return nil
+}
+
+// FormatContent applies pagination and truncation to content. Only the
+// returned window is copied, so paging through a large document costs memory
+// proportional to max_length rather than to the document. Negative values are
+// treated as zero; callers are expected to reject them beforehand. A start
+// index at or past the end of the content returns OutOfRangeNote instead
+// of an empty page; a zero start index on empty content is not out of range.
+func (*ContentProcessor) FormatContent(content string, startIndex, maxLength *int) (string, PageInfo) {
+	info := PageInfo{TotalLength: len(content)}
+
 	// Apply start index offset
 	start := 0
 	if startIndex != nil {
-		start = *startIndex
+		start = max(*startIndex, 0)
 	}
 
-	if start > len(content) {
-		start = len(content)
+	if start > 0 && start >= len(content) {
+		info.StartIndex = len(content)
+		info.OutOfRange = true
+		return OutOfRangeNote(start, len(content)), info
 	}
 
+	info.StartIndex = start
 	content = content[start:]
 
 	// Apply length limit
-	if maxLength != nil && len(content) > *maxLength {
-		content = content[:*maxLength]
-		content += "\n\n[Content truncated. Use start_index to get more content.]"
+	if maxLength != nil && len(content) > max(*maxLength, 0) {
+		limit := max(*maxLength, 0)
+		window := content[:limit]
+		info.Truncated = true
+		info.NextIndex = start + limit
+		info.Returned = len(window)
+
+		var page strings.Builder
+		page.Grow(len(window) + len(truncationFooter))
+		page.WriteString(window)
+		page.WriteString(truncationFooter)
+		return page.String(), info
 	}
 
-	return content
+	info.Returned = len(content)
+	return content, info
 }
@@ -1,11 +1,14 @@
 package processor
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 )
 
 func TestNewContentProcessor(t *testing.T) {
-	processor := NewContentProcessor()
+	processor := NewContentProcessor(Options{DisableTitleHeader: true})
 
 	if processor == nil {
 		t.Error("expected processor to be initialized")
@@ -13,7 +16,7 @@ func TestNewContentProcessor(t *testing.T) {
 }
 
 func TestFormatContent(t *testing.T) {
-	processor := NewContentProcessor()
+	processor := NewContentProcessor(Options{DisableTitleHeader: true})
 
 	tests := []struct {
 		name       string
@@ -55,6 +58,20 @@ func TestFormatContent(t *testing.T) {
 			content:    "Hello",
 			startIndex: intPtr(10),
 			maxLength:  nil,
+			expected:   "[start_index 10 is past the end of the content (total length 5).]",
+		},
+		{
+			name:       "start index equal to content length",
+			content:    "Hello",
+			startIndex: intPtr(5),
+			maxLength:  nil,
+			expected:   "[start_index 5 is past the end of the content (total length 5).]",
+		},
+		{
+			name:       "empty content",
+			content:    "",
+			startIndex: intPtr(0),
+			maxLength:  intPtr(10),
 			expected:   "",
 		},
 		{
@@ -68,7 +85,7 @@ func TestFormatContent(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := processor.FormatContent(tt.content, tt.startIndex, tt.maxLength)
+			result, _ := processor.FormatContent(tt.content, tt.startIndex, tt.maxLength)
 			if result != tt.expected {
 				t.Errorf("expected %q, got %q", tt.expected, result)
 			}
@@ -76,8 +93,107 @@ func TestFormatContent(t *testing.T) {
 	}
 }
 
+func TestFormatContentPageInfo(t *testing.T) {
+	processor := NewContentProcessor(Options{DisableTitleHeader: true})
+
+	tests := []struct {
+		name       string
+		content    string
+		startIndex *int
+		maxLength  *int
+		expected   PageInfo
+	}{
+		{
+			name:     "not truncated",
+			content:  "Hello, World!",
+			expected: PageInfo{TotalLength: 13, Returned: 13},
+		},
+		{
+			name:      "max length equal to content is not truncated",
+			content:   "Hello",
+			maxLength: intPtr(5),
+			expected:  PageInfo{TotalLength: 5, Returned: 5},
+		},
+		{
+			name:      "truncated by max length",
+			content:   "Hello, World!",
+			maxLength: intPtr(5),
+			expected:  PageInfo{TotalLength: 13, Returned: 5, Truncated: true, NextIndex: 5},
+		},
+		{
+			name:       "truncated with start index",
+			content:    "Hello, World!",
+			startIndex: intPtr(7),
+			maxLength:  intPtr(3),
+			expected:   PageInfo{StartIndex: 7, TotalLength: 13, Returned: 3, Truncated: true, NextIndex: 10},
+		},
+		{
+			name:       "start index beyond content length",
+			content:    "Hello",
+			startIndex: intPtr(10),
+			expected:   PageInfo{StartIndex: 5, TotalLength: 5, OutOfRange: true},
+		},
+		{
+			name:       "start index equal to content length",
+			content:    "Hello",
+			startIndex: intPtr(5),
+			maxLength:  intPtr(3),
+			expected:   PageInfo{StartIndex: 5, TotalLength: 5, OutOfRange: true},
+		},
+		{
+			name:     "empty content is not out of range",
+			content:  "",
+			expected: PageInfo{},
+		},
+		{
+			name:       "start index past empty content",
+			content:    "",
+			startIndex: intPtr(1),
+			expected:   PageInfo{TotalLength: 0, OutOfRange: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, info := processor.FormatContent(tt.content, tt.startIndex, tt.maxLength)
+			if info != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, info)
+			}
+		})
+	}
+}
+
+func TestValidatePage(t *testing.T) {
+	tests := []struct {
+		name       string
+		startIndex *int
+		maxLength  *int
+		wantErr    string
+	}{
+		{name: "unset"},
+		{name: "zero", startIndex: intPtr(0), maxLength: intPtr(0)},
+		{name: "negative start index", startIndex: intPtr(-1), wantErr: "invalid start_index -1: must not be negative"},
+		{name: "negative max length", maxLength: intPtr(-5), wantErr: "invalid max_length -5: must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePage(tt.startIndex, tt.maxLength)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestProcessHTML(t *testing.T) {
-	processor := NewContentProcessor()
+	processor := NewContentProcessor(Options{DisableTitleHeader: true})
 
 	tests := []struct {
 		name     string
@@ -103,7 +219,7 @@ func TestProcessHTML(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := processor.ProcessHTML(tt.input)
+			result, _ := processor.ProcessHTML(tt.input, "")
 
 			// For HTML processing, we'll just check that we get some output
 			// The exact markdown conversion may vary between library versions
@@ -122,3 +238,150 @@ func TestProcessHTML(t *testing.T) {
 func intPtr(i int) *int {
 	return &i
 }
+
+func TestProcessHTMLTitleHeader(t *testing.T) {
+	const paragraph = "<p>Readability needs a reasonable amount of text before it treats a block as the main " +
+		"article, so this paragraph keeps going for a while with ordinary prose about nothing in particular.</p>"
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "title added",
+			input:    "<html><head><title>Release notes</title></head><body><article>" + paragraph + "</article></body></html>",
+			expected: "# Release notes\n\n> Source: https://example.com/notes\n\nReadability needs",
+		},
+		{
+			name: "identical leading heading deduplicated",
+			input: "<html><head><title>Release notes</title></head><body><article><h1>Release notes</h1>" +
+				paragraph + "</article></body></html>",
+			expected: "# Release notes\n\n> Source: https://example.com/notes\n\nReadability needs",
+		},
+	}
+
+	processor := NewContentProcessor(Options{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := processor.ProcessHTML(tt.input, "https://example.com/notes")
+			if !strings.HasPrefix(result, tt.expected) {
+				t.Errorf("expected result to start with %q, got %q", tt.expected, result)
+			}
+			if strings.Count(result, "Release notes") != 1 {
+				t.Errorf("expected the title exactly once, got %q", result)
+			}
+		})
+	}
+}
+
+func TestProcessHTMLDegradesWhenConversionFails(t *testing.T) {
+	const article = "<html><body><article><p>Readability needs a reasonable amount of text before it treats a " +
+		"block as the main article, so this paragraph keeps going for a while with ordinary prose that is " +
+		"long enough to count.</p></article></body></html>"
+	const empty = "<html><head><title>Only a title &amp; nothing else</title><script>var x;</script></head><body></body></html>"
+
+	processor := NewContentProcessor(Options{})
+	processor.convert = func(context.Context, string) (string, error) { return "", errors.New("converter exploded") }
+
+	result, warning := processor.ProcessHTML(article, "https://example.com/")
+	if !strings.Contains(result, "<p>Readability needs") || !strings.Contains(warning, "converter exploded") ||
+		!strings.Contains(warning, "extracted HTML") {
+		t.Errorf("expected the extracted HTML with a warning, got %q (warning %q)", result, warning)
+	}
+
+	result, warning = processor.ProcessHTML(empty, "https://example.com/")
+	if result != "Only a title & nothing else" || !strings.Contains(warning, "plain text") {
+		t.Errorf("expected the plain text with a warning, got %q (warning %q)", result, warning)
+	}
+}
+
+func TestProcessHTMLWithoutTitleHeader(t *testing.T) {
+	result, _ := NewContentProcessor(Options{DisableTitleHeader: true}).ProcessHTML(
+		"<html><head><title>Notes</title></head><body><p>Body</p></body></html>", "https://example.com/")
+	if strings.Contains(result, "Source:") {
+		t.Errorf("expected no header when disabled, got %q", result)
+	}
+}
+
+func TestProcessHTMLWithoutReadability(t *testing.T) {
+	const page = "<html><head><title>API reference</title></head><body><nav><a href=\"/\">Home</a></nav><article>" +
+		"<p>Readability needs a reasonable amount of text before it treats a block as the main article, so this " +
+		"paragraph keeps going for a while with ordinary prose about nothing in particular.</p></article>" +
+		"<footer>Endpoint index</footer></body></html>"
+
+	extracted, _ := NewContentProcessor(Options{}).ProcessHTML(page, "https://example.com/api")
+	if strings.Contains(extracted, "Endpoint index") {
+		t.Fatalf("expected readability to drop the footer, got %q", extracted)
+	}
+
+	whole, warning := NewContentProcessor(Options{DisableReadability: true}).ProcessHTML(page, "https://example.com/api")
+	if warning != "" {
+		t.Errorf("unexpected warning: %s", warning)
+	}
+	for _, want := range []string{"# API reference\n\n> Source: https://example.com/api", "[Home](https://example.com/)",
+		"Readability needs", "Endpoint index"} {
+		if !strings.Contains(whole, want) {
+			t.Errorf("expected %q in the whole page, got %q", want, whole)
+		}
+	}
+}
+
+func TestProcessHTMLResolvesRelativeLinks(t *testing.T) {
+	const page = "<html><body><article><p>Readability needs a reasonable amount of text before it treats a " +
+		"block as the main article, so this paragraph links to <a href=\"../guide/setup.html\">the setup guide</a> " +
+		"and keeps going for a while with ordinary prose.</p></article></body></html>"
+	processor := NewContentProcessor(Options{DisableTitleHeader: true})
+
+	if result, _ := processor.ProcessHTML(page, "https://example.com/docs/intro/"); !strings.Contains(result,
+		"(https://example.com/docs/guide/setup.html)") {
+		t.Errorf("expected link resolved against the source URL, got %q", result)
+	}
+	if result, _ := processor.ProcessHTML(page, ""); !strings.Contains(result, "(../guide/setup.html)") {
+		t.Errorf("expected link left relative without a source URL, got %q", result)
+	}
+}
+
+func TestStripLeadingTitle(t *testing.T) {
+	tests := []struct {
+		markdown string
+		title    string
+		expected string
+	}{
+		{"# Notes\n\nBody", "Notes", "Body"},
+		{"\n# notes \n\nBody", "Notes", "Body"},
+		{"# Other\n\nBody", "Notes", "# Other\n\nBody"},
+		{"## Notes\n\nBody", "Notes", "## Notes\n\nBody"},
+		{"Body", "", "Body"},
+	}
+
+	for _, tt := range tests {
+		if got := stripLeadingTitle(tt.markdown, tt.title); got != tt.expected {
+			t.Errorf("stripLeadingTitle(%q, %q) = %q, expected %q", tt.markdown, tt.title, got, tt.expected)
+		}
+	}
+}
+
+func BenchmarkFormatContentPage(b *testing.B) {
+	content := strings.Repeat("Large documents are paged through a few thousand characters at a time. ", 64<<10)
+	processor := NewContentProcessor(Options{DisableTitleHeader: true})
+	startIndex, maxLength := len(content)/2, 5000
+
+	b.ReportAllocs()
+	for b.Loop() {
+		processor.FormatContent(content, &startIndex, &maxLength)
+	}
+}
+
+func TestProcessHTMLContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	result, warning := NewContentProcessor(Options{}).ProcessHTMLContext(ctx, []byte("<html><body><p>Hello</p></body></html>"), "")
+	if result != "" || warning != context.Canceled.Error() {
+		t.Errorf("expected no content and the context error, got %q (warning %q)", result, warning)
+	}
+	if _, err := convertMarkdown(ctx, "<p>Hello</p>", false); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the conversion to stop with the context error, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// rstAdornmentChars are the characters section titles are adorned with
+const rstAdornmentChars = "=-~^\"'*+#`_"
+
+// rstCodeDirective matches directives introducing a code block
+var rstCodeDirective = regexp.MustCompile(`^\.\.\s+(?:code-block|code|sourcecode)::\s*(\S*)\s*$`)
+
+// Inline markup rewritten by RSTToMarkdown
+var (
+	rstLink          = regexp.MustCompile("`([^`<]+?)\\s*<([^`>]+)>`__?")
+	rstInlineLiteral = regexp.MustCompile("``([^`]+)``")
+	rstRole          = regexp.MustCompile(":[a-z][a-z0-9:+-]*:`([^`]+)`")
+)
+
+// rstStyle is how a section title is adorned. Levels are assigned in the
+// order styles first appear, as reStructuredText does.
+type rstStyle struct {
+	char     byte
+	overline bool
+}
+
+// RSTToMarkdown converts the common constructs of a reStructuredText document
+// to markdown: section titles, literal and code blocks, inline literals,
+// roles and hyperlinks. It is a best-effort conversion for reading, not a
+// full reStructuredText implementation; anything else is kept as written.
+func RSTToMarkdown(rst string) string {
+	lines := strings.Split(strings.ReplaceAll(rst, "\r\n", "\n"), "\n")
+	var out []string
+	var styles []rstStyle
+
+	level := func(style rstStyle) int {
+		for i, known := range styles {
+			if known == style {
+				return min(i+1, 6)
+			}
+		}
+		styles = append(styles, style)
+		return min(len(styles), 6)
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		// Overlined title: adornment, title, adornment
+		if i+2 < len(lines) && isRSTAdornment(line) && trimmed != "" &&
+			strings.TrimSpace(lines[i+1]) != "" && strings.TrimSpace(lines[i+2]) == trimmed {
+			title := strings.TrimSpace(lines[i+1])
+			out = append(out, strings.Repeat("#", level(rstStyle{char: line[0], overline: true}))+" "+rstInline(title))
+			i += 2
+			continue
+		}
+
+		// Underlined title: title, adornment at least as long
+		if i+1 < len(lines) && trimmed != "" && line == strings.TrimLeft(line, " \t") && !isRSTAdornment(line) {
+			next := strings.TrimRight(lines[i+1], " \t")
+			if isRSTAdornment(next) && len(next) >= len(trimmed) {
+				out = append(out, strings.Repeat("#", level(rstStyle{char: next[0]}))+" "+rstInline(trimmed))
+				i++
+				continue
+			}
+		}
+
+		// Code directives and paragraphs ending in "::" introduce an
+		// indented block that is kept verbatim
+		language, isCode := "", false
+		if match := rstCodeDirective.FindStringSubmatch(trimmed); match != nil {
+			language, isCode = match[1], true
+		} else if strings.HasSuffix(trimmed, "::") {
+			isCode = true
+			switch text := strings.TrimSuffix(trimmed, "::"); {
+			case text == "":
+			case strings.HasSuffix(text, " "):
+				out = append(out, rstInline(strings.TrimRight(line, " :")))
+			default:
+				out = append(out, rstInline(strings.TrimSuffix(strings.TrimRight(line, " "), ":")))
+			}
+		}
+		if isCode {
+			block, end := rstIndentedBlock(lines, i+1)
+			if len(block) > 0 {
+				out = append(out, "", "```"+language)
+				out = append(out, block...)
+				out = append(out, "```")
+				i = end - 1
+				continue
+			}
+			if language == "" {
+				// The paragraph text, if any, was already written
+				continue
+			}
+		}
+
+		out = append(out, rstInline(line))
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// isRSTAdornment reports whether line is a section title underline or
+// overline: one adornment character repeated
+func isRSTAdornment(line string) bool {
+	if len(line) < 2 || !strings.ContainsRune(rstAdornmentChars, rune(line[0])) {
+		return false
+	}
+	return strings.Count(line, line[:1]) == len(line)
+}
+
+// rstIndentedBlock returns the indented block starting at lines[start],
+// skipping leading blank lines and directive options, dedented, along with
+// the index of the first line after it
+func rstIndentedBlock(lines []string, start int) ([]string, int) {
+	i := start
+	for i < len(lines) {
+		trimmed := strings.TrimSpace(lines[i])
+		isOption := strings.HasPrefix(trimmed, ":") && lines[i] != trimmed
+		if trimmed != "" && !isOption {
+			break
+		}
+		i++
+	}
+
+	var block []string
+	indent := -1
+	end := i
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			block = append(block, "")
+			continue
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if lineIndent == 0 {
+			break
+		}
+		if indent < 0 || lineIndent < indent {
+			indent = lineIndent
+		}
+		block = append(block, line)
+		end = i + 1
+	}
+
+	// Trailing blank lines belong to the text after the block
+	block = block[:max(0, len(block)-(i-end))]
+	for j, line := range block {
+		if len(line) >= indent && indent > 0 {
+			block[j] = line[indent:]
+		}
+	}
+	return block, end
+}
+
+// rstInline rewrites inline literals, roles and hyperlinks in one line
+func rstInline(line string) string {
+	line = rstInlineLiteral.ReplaceAllString(line, "`$1`")
+	line = rstLink.ReplaceAllString(line, "[$1]($2)")
+	return rstRole.ReplaceAllString(line, "`$1`")
+}
@@ -0,0 +1,50 @@
+package processor
+
+import "testing"
+
+func TestRSTToMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "section levels follow first appearance",
+			input:    "=====\nTitle\n=====\n\nIntro\n\nUsage\n-----\n\nDetails\n~~~~~~~\n\nMore\n----",
+			expected: "# Title\n\nIntro\n\n## Usage\n\n### Details\n\n## More",
+		},
+		{
+			name:     "literal block after a paragraph",
+			input:    "Run it like this::\n\n    gofetch fetch URL\n      --raw\n\nDone.",
+			expected: "Run it like this:\n\n```\ngofetch fetch URL\n  --raw\n```\n\nDone.",
+		},
+		{
+			name:     "expanded form drops the colons",
+			input:    "Example ::\n\n  x = 1\n",
+			expected: "Example\n\n```\nx = 1\n```\n",
+		},
+		{
+			name:     "code directive with options",
+			input:    ".. code-block:: python\n   :linenos:\n\n   print('hi')\n\nAfter",
+			expected: "\n```python\nprint('hi')\n```\n\nAfter",
+		},
+		{
+			name:     "inline markup",
+			input:    "Use ``fetch`` or :func:`explain`, see `the docs <https://example.com/docs>`_.",
+			expected: "Use `fetch` or `explain`, see [the docs](https://example.com/docs).",
+		},
+		{
+			name:     "paragraph ending in colons without a block",
+			input:    "Nothing follows::\nNext",
+			expected: "Nothing follows:\nNext",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RSTToMarkdown(tt.input); got != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
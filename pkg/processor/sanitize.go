@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"golang.org/x/net/html"
+)
+
+// inlineHTMLElements are the elements kept as bare HTML tags when inline HTML
+// is allowed, mapped to whether they are blocks. Markdown has no syntax for
+// them, and none of them can run code or load anything. Every other element
+// is converted to markdown or dropped, keeping only its text.
+var inlineHTMLElements = map[string]bool{
+	"sup":     false,
+	"sub":     false,
+	"u":       false,
+	"mark":    false,
+	"ins":     false,
+	"details": true,
+	"summary": true,
+}
+
+// sanitizeHTML removes from the tree under node every event handler
+// attribute, such as onclick, and every attribute whose value is a URL with
+// a scheme that can run code, such as javascript:, so none can reach a link,
+// an image or passed-through HTML
+func sanitizeHTML(node *html.Node) {
+	for n := range node.Descendants() {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		kept := n.Attr[:0]
+		for _, attr := range n.Attr {
+			if strings.HasPrefix(strings.ToLower(attr.Key), "on") || unsafeURL(attr.Val) {
+				continue
+			}
+			kept = append(kept, attr)
+		}
+		n.Attr = kept
+	}
+}
+
+// unsafeURL reports whether value is a URL whose scheme can run code.
+// Browsers ignore whitespace and control characters inside a scheme, so
+// they are dropped before it is compared. Data URLs are only safe as raster
+// images.
+func unsafeURL(value string) bool {
+	scheme := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+	scheme = strings.ToLower(scheme)
+	switch {
+	case strings.HasPrefix(scheme, "javascript:"), strings.HasPrefix(scheme, "vbscript:"):
+		return true
+	case strings.HasPrefix(scheme, "data:"):
+		return !strings.HasPrefix(scheme, "data:image/") || strings.HasPrefix(scheme, "data:image/svg")
+	}
+	return false
+}
+
+// registerSanitizer makes conv sanitize every document before converting it
+// and, when inlineHTML is set, keep the inlineHTMLElements as bare tags
+// around their converted content
+func registerSanitizer(conv *converter.Converter, inlineHTML bool) {
+	conv.Register.PreRenderer(func(_ converter.Context, doc *html.Node) {
+		sanitizeHTML(doc)
+	}, converter.PriorityEarly)
+	if !inlineHTML {
+		return
+	}
+
+	for name, block := range inlineHTMLElements {
+		tagType := converter.TagTypeInline
+		if block {
+			tagType = converter.TagTypeBlock
+		}
+		conv.Register.RendererFor(name, tagType, renderBareTag, converter.PriorityEarly)
+	}
+}
+
+// renderBareTag renders an element as its tag without attributes, around its
+// content converted to markdown. Blocks get blank lines around their tags,
+// which markdown renderers need to convert the content inside.
+func renderBareTag(ctx converter.Context, w converter.Writer, node *html.Node) converter.RenderStatus {
+	separator := ""
+	if inlineHTMLElements[node.Data] {
+		separator = "\n\n"
+	}
+	w.WriteString(separator + "<" + node.Data + ">" + separator)
+	ctx.RenderChildNodes(ctx, w, node)
+	w.WriteString(separator + "</" + node.Data + ">" + separator)
+	return converter.RenderSuccess
+}
@@ -0,0 +1,142 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// hostilePayloads are fragments that try to get script into converted
+// markdown
+var hostilePayloads = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC="https://evil.example/x.js"></SCRIPT>`,
+	`<a href="javascript:alert(1)">click</a>`,
+	`<a href=" JaVaScRiPt:alert(1)">click</a>`,
+	`<a href="java&#x09;script:alert(1)">click</a>`,
+	`<a href="&#106;avascript:alert(1)">click</a>`,
+	`<a href="vbscript:msgbox(1)">click</a>`,
+	`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">click</a>`,
+	`<a href="https://example.com/" title="javascript:alert(1)" onmouseover="alert(1)">link</a>`,
+	`<img src="x" onerror="alert(1)" alt="pic">`,
+	`<img src="javascript:alert(1)" alt="pic">`,
+	`<img src="data:image/svg+xml;base64,PHN2Zz48L3N2Zz4=" alt="svg">`,
+	`<svg onload="alert(1)"><script>alert(1)</script></svg>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<div align="center" style="color:red" onclick="alert(1)"><b>bold</b></div>`,
+	`<sup onclick="alert(1)">1</sup>`,
+	`<details ontoggle="alert(1)" open><summary onclick="alert(1)">more</summary>hidden</details>`,
+	`<sup><a href="javascript:alert(1)">note</a></sup>`,
+	`<table><tr><td onclick="alert(1)"><a href="javascript:alert(1)">cell</a></td></tr></table>`,
+	`<form action="javascript:alert(1)"><button formaction="javascript:alert(1)">go</button></form>`,
+	`<math><mi xlink:href="javascript:alert(1)">m</mi></math>`,
+	`<object data="javascript:alert(1)"></object><embed src="javascript:alert(1)">`,
+	`<body onload="alert(1)"><p>text</p></body>`,
+}
+
+// hostileWrappers place a payload in different parts of a page
+var hostileWrappers = []string{
+	`%s`,
+	`<p>Some text before %s and after.</p>`,
+	`<ul><li>%s</li></ul>`,
+	`<blockquote><sup>%s</sup></blockquote>`,
+	`<details><summary>s</summary>%s</details>`,
+}
+
+// scriptInOutput matches what must never appear in converted output
+var scriptInOutput = regexp.MustCompile(`(?i)<script|javascript:|vbscript:|data:text|data:image/svg|\son[a-z]+\s*=`)
+
+func TestProcessHTMLNeverPassesScript(t *testing.T) {
+	for _, inlineHTML := range []bool{false, true} {
+		for _, readability := range []bool{false, true} {
+			p := NewContentProcessor(Options{DisableReadability: !readability, AllowInlineHTML: inlineHTML})
+			for _, payload := range hostilePayloads {
+				for _, wrapper := range hostileWrappers {
+					page := "<html><head><title>Page</title></head><body><article>" + fmt.Sprintf(wrapper, payload) +
+						"</article></body></html>"
+					content, _ := p.ProcessHTML(page, "https://example.com/page")
+					if match := scriptInOutput.FindString(content); match != "" {
+						t.Errorf("inline HTML %v, readability %v: %q survived converting %s:\n%s",
+							inlineHTML, readability, match, page, content)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestProcessHTMLWholePageIsSanitized(t *testing.T) {
+	// Without readability or an absolute source URL the whole page is
+	// converted, and when conversion fails its plain text is returned
+	p := NewContentProcessor(Options{DisableReadability: true, DisableTitleHeader: true})
+	var converted string
+	p.convert = func(_ context.Context, html string) (string, error) {
+		converted = html
+		return "", errors.New("converter exploded")
+	}
+	for _, sourceURL := range []string{"", "page.html"} {
+		for _, payload := range hostilePayloads {
+			page := "<html><body><p>" + payload + "</p></body></html>"
+			content, _ := p.ProcessHTML(page, sourceURL)
+			// Script elements are left for the converter to drop
+			if match := scriptInOutput.FindString(converted); match != "" && !strings.EqualFold(match, "<script") {
+				t.Errorf("source URL %q: %q reached the converter from %s:\n%s", sourceURL, match, page, converted)
+			}
+			if match := scriptInOutput.FindString(content); match != "" {
+				t.Errorf("source URL %q: %q survived the fallback for %s:\n%s", sourceURL, match, page, content)
+			}
+		}
+	}
+}
+
+func TestConvertMarkdownInlineHTML(t *testing.T) {
+	const page = `<div align="center" style="color:red"><p>E = mc<sup class="x">2</sup> and H<sub>2</sub>O</p></div>` +
+		`<details open><summary>More</summary><p>Some <b>bold</b> text</p></details>`
+
+	dropped, err := convertMarkdown(context.Background(), page, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(dropped, "<") {
+		t.Errorf("expected no HTML by default, got %q", dropped)
+	}
+
+	kept, err := convertMarkdown(context.Background(), page, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"mc<sup>2</sup>", "H<sub>2</sub>O", "<details>", "<summary>", "More", "**bold**", "</details>"} {
+		if !strings.Contains(kept, want) {
+			t.Errorf("expected %q in %q", want, kept)
+		}
+	}
+	for _, unwanted := range []string{"<div", "align", "style", "class", "open"} {
+		if strings.Contains(kept, unwanted) {
+			t.Errorf("expected no %q in %q", unwanted, kept)
+		}
+	}
+}
+
+func TestUnsafeURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.com/":          false,
+		"/relative/path":                false,
+		"mailto:someone@example.com":    false,
+		"data:image/png;base64,iVBOR":   false,
+		"javascript:alert(1)":           true,
+		"  JavaScript:alert(1)":         true,
+		"java\tscript:alert(1)":         true,
+		"java\x00script:alert(1)":       true,
+		"vbscript:msgbox(1)":            true,
+		"data:text/html,<script>":       true,
+		"data:image/svg+xml;base64,PHN": true,
+	}
+	for value, want := range tests {
+		if got := unsafeURL(value); got != want {
+			t.Errorf("unsafeURL(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package redact
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// urlIdent matches identifiers that hold a URL, such as url, targetURL or req.URL
+var urlIdent = regexp.MustCompile(`(?i)url$`)
+
+// TestLogCallsRedactURLs makes sure no log call in the module prints a URL
+// directly. URLs must go through a function such as Redactor.URL first; any
+// call wrapping the value is accepted, so the check stays syntactic.
+func TestLogCallsRedactURLs(t *testing.T) {
+	root := filepath.Join("..", "..")
+	fset := token.NewFileSet()
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == "vendor" || strings.HasPrefix(d.Name(), ".")) && path != root {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || !isLogCall(call) {
+				return true
+			}
+			for _, arg := range call.Args {
+				if name, found := rawURLArg(arg); found {
+					t.Errorf("%s: log call prints %s without redacting it", fset.Position(arg.Pos()), name)
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to scan sources: %v", err)
+	}
+}
+
+// isLogCall reports whether call invokes a function of the standard log package
+func isLogCall(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "log"
+}
+
+// rawURLArg looks for a URL-holding identifier in expr that is not wrapped in
+// a function call
+func rawURLArg(expr ast.Expr) (string, bool) {
+	var name string
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if name != "" {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			// Conversions such as string(x) and String methods do not redact anything
+			if ident, ok := n.Fun.(*ast.Ident); ok && ident.Name == "string" {
+				return true
+			}
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "String" {
+				return true
+			}
+			return false
+		case *ast.SelectorExpr:
+			if urlIdent.MatchString(n.Sel.Name) {
+				name = n.Sel.Name
+			}
+			return false
+		case *ast.Ident:
+			if urlIdent.MatchString(n.Name) {
+				name = n.Name
+			}
+		}
+		return true
+	})
+	return name, name != ""
+}
+
+func TestRawURLArg(t *testing.T) {
+	tests := map[string]bool{
+		`url`:                  true,
+		`req.URL`:              true,
+		`"prefix " + finalURL`: true,
+		`string(targetURL)`:    true,
+		`f.logURL(url)`:        false,
+		`r.URL(rawURL)`:        false,
+		`resp.StatusCode`:      false,
+		`host`:                 false,
+	}
+
+	for src, expected := range tests {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", src, err)
+		}
+		if _, found := rawURLArg(expr); found != expected {
+			t.Errorf("rawURLArg(%s) = %v, expected %v", src, found, expected)
+		}
+	}
+}
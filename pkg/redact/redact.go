@@ -0,0 +1,83 @@
+// Package redact provides helpers for removing secrets from URLs before they
+// are written to logs.
+package redact
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Mask replaces the value of a redacted query parameter
+const Mask = "…"
+
+// DefaultSensitiveParams lists the query parameter name fragments that are
+// redacted when no explicit list is configured
+var DefaultSensitiveParams = []string{"token", "key", "secret", "password", "signature"}
+
+// Redactor strips credentials from URLs. A nil *Redactor uses DefaultSensitiveParams.
+type Redactor struct {
+	params []string
+}
+
+// New creates a redactor that masks query parameters whose names contain any
+// of the given fragments (case-insensitive). An empty list selects the defaults.
+func New(params []string) *Redactor {
+	if len(params) == 0 {
+		params = DefaultSensitiveParams
+	}
+
+	normalized := make([]string, 0, len(params))
+	for _, p := range params {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			normalized = append(normalized, p)
+		}
+	}
+	return &Redactor{params: normalized}
+}
+
+// URL returns rawURL with userinfo and fragment removed and sensitive query
+// parameter values replaced by Mask. URLs that cannot be parsed are replaced
+// entirely, since their secrets cannot be located reliably.
+func (r *Redactor) URL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "[unparseable URL]"
+	}
+
+	parsed.User = nil
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	if parsed.RawQuery != "" {
+		pairs := strings.Split(parsed.RawQuery, "&")
+		for i, pair := range pairs {
+			rawName, _, _ := strings.Cut(pair, "=")
+			name := rawName
+			if unescaped, err := url.QueryUnescape(rawName); err == nil {
+				name = unescaped
+			}
+			if r.isSensitive(name) {
+				pairs[i] = rawName + "=" + Mask
+			}
+		}
+		parsed.RawQuery = strings.Join(pairs, "&")
+	}
+
+	return parsed.String()
+}
+
+// isSensitive reports whether a query parameter name matches a sensitive fragment
+func (r *Redactor) isSensitive(name string) bool {
+	params := DefaultSensitiveParams
+	if r != nil {
+		params = r.params
+	}
+
+	name = strings.ToLower(name)
+	for _, p := range params {
+		if strings.Contains(name, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package robots
+
+import (
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+)
+
+// MaxLineLength is the longest robots.txt line read as a directive. Longer
+// lines are ignored.
+const MaxLineLength = 4096
+
+// byteOrderMark is the UTF-8 encoding of U+FEFF, which some editors put at
+// the start of files and which hides the first directive from the parser
+const byteOrderMark = "\ufeff"
+
+var (
+	// directivePattern matches the standard robots.txt directives
+	directivePattern = regexp.MustCompile(`(?i)^(user-agent|disallow|allow|crawl-delay|sitemap)\s*:`)
+	// fieldPattern matches any "name: value" line, which includes the
+	// extensions some crawlers understand, such as Clean-param
+	fieldPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z-]*\s*:`)
+)
+
+// robotsFile is a downloaded robots.txt prepared for matching
+type robotsFile struct {
+	// content is the file to match rules against, without a byte order mark
+	// and with overlong lines blanked so line numbers are kept
+	content string
+	// anomalies describe what was malformed about the file
+	anomalies []string
+	// recognized is false when the file does not look like a robots.txt at
+	// all, such as an HTML error page served in its place
+	recognized bool
+}
+
+// inspectRobots checks a robots.txt served with contentType for signs that
+// it is malformed and prepares it for matching. Malformed files are still
+// used as far as they can be parsed; files that are not robots.txt at all
+// are reported as not recognized.
+func inspectRobots(content, contentType string) robotsFile {
+	file := robotsFile{recognized: true}
+
+	if stripped, ok := strings.CutPrefix(content, byteOrderMark); ok {
+		content = stripped
+		file.anomalies = append(file.anomalies, "starts with a byte order mark")
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	start := strings.ToLower(strings.TrimSpace(content[:min(len(content), 512)]))
+	switch {
+	case mediaType == "text/html":
+		file.anomalies = append(file.anomalies, "served as text/html instead of a text file")
+		file.recognized = false
+	case strings.HasPrefix(start, "<!doctype html") || strings.HasPrefix(start, "<html"):
+		file.anomalies = append(file.anomalies, "content is an HTML page")
+		file.recognized = false
+	}
+
+	lines := strings.Split(content, "\n")
+	long, directives, other := 0, 0, 0
+	for i, line := range lines {
+		if len(line) > MaxLineLength {
+			lines[i] = ""
+			long++
+			continue
+		}
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case directivePattern.MatchString(line):
+			directives++
+		case fieldPattern.MatchString(line):
+		default:
+			other++
+		}
+	}
+	if long > 0 {
+		content = strings.Join(lines, "\n")
+		file.anomalies = append(file.anomalies,
+			fmt.Sprintf("%d lines longer than %d bytes were ignored", long, MaxLineLength))
+	}
+	if other > 0 {
+		file.anomalies = append(file.anomalies, fmt.Sprintf("%d lines are not robots.txt directives", other))
+	}
+	if directives == 0 && other > 0 && file.recognized {
+		file.anomalies = append(file.anomalies, "no robots.txt directives found")
+		file.recognized = false
+	}
+
+	file.content = content
+	return file
+}
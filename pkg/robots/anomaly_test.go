@@ -0,0 +1,142 @@
+package robots
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInspectRobots(t *testing.T) {
+	errorPage, err := os.ReadFile(filepath.Join("testdata", "error_page.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name               string
+		content            string
+		contentType        string
+		expectedAnomalies  []string
+		expectedRecognized bool
+	}{
+		{
+			name:               "clean file",
+			content:            "User-agent: *\nDisallow: /private/ # staff only\n\nSitemap: https://example.com/sitemap.xml\n",
+			contentType:        "text/plain; charset=utf-8",
+			expectedRecognized: true,
+		},
+		{
+			name:               "crawler extensions",
+			content:            "User-agent: Yandex\nClean-param: ref /articles/\nHost: example.com\n",
+			contentType:        "text/plain",
+			expectedRecognized: true,
+		},
+		{
+			name:               "byte order mark",
+			content:            byteOrderMark + "User-agent: *\nDisallow: /\n",
+			contentType:        "text/plain",
+			expectedAnomalies:  []string{"starts with a byte order mark"},
+			expectedRecognized: true,
+		},
+		{
+			name:               "overlong line",
+			content:            "User-agent: *\nDisallow: /" + strings.Repeat("a", MaxLineLength) + "\nDisallow: /private/\n",
+			contentType:        "text/plain",
+			expectedAnomalies:  []string{"1 lines longer than 4096 bytes were ignored"},
+			expectedRecognized: true,
+		},
+		{
+			name:               "stray lines",
+			content:            "User-agent: *\nDisallow /private/\nDisallow: /admin/\n",
+			contentType:        "text/plain",
+			expectedAnomalies:  []string{"1 lines are not robots.txt directives"},
+			expectedRecognized: true,
+		},
+		{
+			name:              "HTML error page",
+			content:           string(errorPage),
+			contentType:       "text/plain",
+			expectedAnomalies: []string{"content is an HTML page", "15 lines are not robots.txt directives"},
+		},
+		{
+			name:              "served as HTML",
+			content:           "User-agent: *\nDisallow: /\n",
+			contentType:       "text/html; charset=utf-8",
+			expectedAnomalies: []string{"served as text/html instead of a text file"},
+		},
+		{
+			name:              "no directives",
+			content:           "Service temporarily unavailable\nPlease try again later\n",
+			contentType:       "text/plain",
+			expectedAnomalies: []string{"2 lines are not robots.txt directives", "no robots.txt directives found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := inspectRobots(tt.content, tt.contentType)
+			if !reflect.DeepEqual(file.anomalies, tt.expectedAnomalies) {
+				t.Errorf("expected anomalies %q, got %q", tt.expectedAnomalies, file.anomalies)
+			}
+			if file.recognized != tt.expectedRecognized {
+				t.Errorf("expected recognized %v, got %v", tt.expectedRecognized, file.recognized)
+			}
+			if strings.HasPrefix(file.content, byteOrderMark) {
+				t.Error("expected the byte order mark to be stripped")
+			}
+		})
+	}
+}
+
+func TestDecideMalformedRobots(t *testing.T) {
+	errorPage, err := os.ReadFile(filepath.Join("testdata", "error_page.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		body         []byte
+		path         string
+		expected     bool
+		unrecognized bool
+	}{
+		{name: "HTML error page", body: errorPage, path: "/page", expected: true, unrecognized: true},
+		{name: "byte order mark", body: []byte(byteOrderMark + "User-agent: *\nDisallow: /private/\n"), path: "/private/page"},
+		{name: "overlong line", body: []byte("User-agent: *\nDisallow: /" + strings.Repeat("a", MaxLineLength) + "\nDisallow: /private/\n"), path: "/private/page"},
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			checker := NewChecker("TestBot/1.0", "", false, false, client)
+			decision := checker.Decide(server.URL + tt.path)
+			if decision.Allowed != tt.expected || decision.Unrecognized != tt.unrecognized {
+				t.Errorf("expected allowed %v and unrecognized %v, got %+v", tt.expected, tt.unrecognized, decision)
+			}
+			if len(decision.Anomalies) == 0 {
+				t.Error("expected the anomalies to be reported")
+			}
+
+			explanation, err := checker.Explain(server.URL, []string{tt.path})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if explanation.Paths[0].Allowed != tt.expected || explanation.Unrecognized != tt.unrecognized ||
+				!reflect.DeepEqual(explanation.Anomalies, decision.Anomalies) {
+				t.Errorf("expected the explanation to agree with %+v, got %+v", decision, explanation)
+			}
+		})
+	}
+}
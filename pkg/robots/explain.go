@@ -0,0 +1,114 @@
+package robots
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// PathDecision explains the robots.txt decision for a single path
+type PathDecision struct {
+	Path    string `json:"path"`
+	Allowed bool   `json:"allowed"`
+	// Rule is the Disallow rule that denied the path; nil when it is allowed
+	Rule *Rule `json:"rule,omitempty"`
+}
+
+// Explanation describes how robots.txt applies to a set of paths on a site
+type Explanation struct {
+	RobotsURL string `json:"robots_url"`
+	// UserAgent is sent with requests, and RobotsUserAgent selects the
+	// robots.txt groups that apply
+	UserAgent       string `json:"user_agent"`
+	RobotsUserAgent string `json:"robots_user_agent"`
+	// Found reports whether robots.txt could be fetched. Without one, every
+	// path is allowed.
+	Found bool `json:"found"`
+	// Enforced is false when the server is configured to ignore robots.txt,
+	// in which case the decisions are informational only
+	Enforced bool `json:"enforced"`
+	// Anomalies describe what was malformed about robots.txt
+	Anomalies []string `json:"anomalies,omitempty"`
+	// Unrecognized reports that what was served as robots.txt was not one,
+	// so like a missing robots.txt it allows every path
+	Unrecognized bool `json:"unrecognized"`
+	// Source describes the robots.txt response; nil when none was received
+	Source *Source `json:"source,omitempty"`
+	// CrawlDelay is the effective Crawl-delay value, empty when none applies
+	CrawlDelay     string         `json:"crawl_delay,omitempty"`
+	CrawlDelayRule *Rule          `json:"crawl_delay_rule,omitempty"`
+	Paths          []PathDecision `json:"paths"`
+}
+
+// Explain fetches robots.txt for domain once and reports, for each path, the
+// decision IsAllowed would make and the rule that produced it. domain may be
+// a bare host such as example.com, which is assumed to use https, or a URL
+// whose scheme and host are used.
+func (c *Checker) Explain(domain string, paths []string) (*Explanation, error) {
+	siteURL, err := parseSite(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &Explanation{
+		RobotsURL:       robotsURLFor(siteURL),
+		UserAgent:       c.userAgent,
+		RobotsUserAgent: c.robotsUserAgent,
+		Enforced:        !c.ignoreRobots,
+		Paths:           make([]PathDecision, 0, len(paths)),
+	}
+
+	file, source, err := c.fetchRobotsContent(context.Background(), siteURL)
+	explanation.Source = source
+	explanation.Found = err == nil
+	explanation.Anomalies = file.anomalies
+	explanation.Unrecognized = explanation.Found && !file.recognized
+	usable := explanation.Found && file.recognized
+
+	if usable {
+		if rule, delay, ok := c.crawlDelay(file.content); ok {
+			explanation.CrawlDelay = delay
+			explanation.CrawlDelayRule = &rule
+		}
+	}
+
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		decision := PathDecision{Path: path, Allowed: true}
+		if usable {
+			if rule, denied := c.matchRule(file.content, path); denied {
+				decision.Allowed = false
+				decision.Rule = &rule
+			}
+		}
+		explanation.Paths = append(explanation.Paths, decision)
+	}
+
+	return explanation, nil
+}
+
+// parseSite parses a domain or URL into a URL with a scheme and host
+func parseSite(domain string) (*url.URL, error) {
+	domain = strings.TrimSpace(domain)
+	if !strings.Contains(domain, "://") {
+		domain = "https://" + domain
+	}
+
+	siteURL, err := url.Parse(domain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid domain %q: %w", domain, err)
+	}
+	if siteURL.Scheme != "http" && siteURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid domain %q: scheme must be http or https", domain)
+	}
+	if siteURL.Host == "" {
+		return nil, fmt.Errorf("invalid domain %q: missing host", domain)
+	}
+	if strings.Contains(siteURL.Hostname(), "%") {
+		return nil, fmt.Errorf("invalid domain %q: IPv6 zone identifiers are not allowed", domain)
+	}
+	return siteURL, nil
+}
@@ -0,0 +1,103 @@
+package robots
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExplain(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		requests.Add(1)
+		w.Write([]byte("User-agent: *\nDisallow: /private/\nCrawl-delay: 5\n\nUser-agent: TestBot\nDisallow: /blocked/\n"))
+	}))
+	defer server.Close()
+
+	checker := NewChecker("TestBot/1.0", "", false, false, &http.Client{Timeout: 5 * time.Second})
+	explanation, err := checker.Explain(server.URL, []string{"/public", "private/data", "/blocked/page"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if requests.Load() != 1 {
+		t.Errorf("expected robots.txt to be fetched once, got %d", requests.Load())
+	}
+	if !explanation.Found || !explanation.Enforced {
+		t.Errorf("expected found and enforced, got %+v", explanation)
+	}
+	if source := explanation.Source; source == nil || source.Status != http.StatusOK || source.Size != 90 || time.Since(source.FetchedAt) > time.Minute {
+		t.Errorf("unexpected source %+v", source)
+	}
+	if explanation.RobotsURL != server.URL+"/robots.txt" {
+		t.Errorf("unexpected robots URL %q", explanation.RobotsURL)
+	}
+	if explanation.CrawlDelay != "5" || explanation.CrawlDelayRule == nil || explanation.CrawlDelayRule.Line != 3 {
+		t.Errorf("unexpected crawl delay %q (%+v)", explanation.CrawlDelay, explanation.CrawlDelayRule)
+	}
+
+	expected := []PathDecision{
+		{Path: "/public", Allowed: true},
+		{Path: "/private/data", Rule: &Rule{Line: 2, Text: "Disallow: /private/", Group: "*"}},
+		{Path: "/blocked/page", Rule: &Rule{Line: 6, Text: "Disallow: /blocked/", Group: "TestBot"}},
+	}
+	if !reflect.DeepEqual(explanation.Paths, expected) {
+		t.Errorf("expected %+v, got %+v", expected, explanation.Paths)
+	}
+
+	// Explanations must agree with the decisions IsAllowed makes
+	for _, decision := range explanation.Paths {
+		if allowed := checker.IsAllowed(server.URL + decision.Path); allowed != decision.Allowed {
+			t.Errorf("%s: IsAllowed=%v but explanation says %v", decision.Path, allowed, decision.Allowed)
+		}
+	}
+}
+
+func TestExplainWithoutRobotsTxt(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	checker := NewChecker("TestBot/1.0", "", true, false, &http.Client{Timeout: 5 * time.Second})
+	explanation, err := checker.Explain(server.URL, []string{"/anything"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if explanation.Found || explanation.Enforced {
+		t.Errorf("expected robots.txt to be missing and not enforced, got %+v", explanation)
+	}
+	if source := explanation.Source; source == nil || source.Status != http.StatusNotFound || source.Size != 0 {
+		t.Errorf("expected the 404 to be described, got %+v", source)
+	}
+	if len(explanation.Paths) != 1 || !explanation.Paths[0].Allowed {
+		t.Errorf("expected every path to be allowed, got %+v", explanation.Paths)
+	}
+}
+
+func TestExplainInvalidDomain(t *testing.T) {
+	checker := NewChecker("TestBot/1.0", "", false, false, &http.Client{Timeout: 5 * time.Second})
+
+	for _, domain := range []string{"", "ftp://example.com", "http://[::1", "http://[fe80::1%25eth0]"} {
+		if _, err := checker.Explain(domain, []string{"/"}); err == nil || !strings.Contains(err.Error(), "invalid domain") {
+			t.Errorf("Explain(%q): expected invalid domain error, got %v", domain, err)
+		}
+	}
+}
+
+func TestParseSite(t *testing.T) {
+	siteURL, err := parseSite("example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if siteURL.Scheme != "https" || siteURL.Host != "example.com" {
+		t.Errorf("expected https://example.com, got %s", siteURL)
+	}
+}
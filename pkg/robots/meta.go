@@ -0,0 +1,102 @@
+package robots
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// blockingDirectives are the per-page directives that withhold content when
+// robots meta checking is enabled
+var blockingDirectives = map[string]bool{
+	"noindex": true,
+	"none":    true,
+	"noai":    true,
+}
+
+// PageDirective reports whether a fetched page opts out of being fetched
+// through an X-Robots-Tag header or a robots meta tag, and if so names the
+// directive, e.g. `X-Robots-Tag "noindex"`. It always allows the page unless
+// the checker was created with respectMeta. Meta tags are only looked for in
+// HTML documents.
+func (c *Checker) PageDirective(header http.Header, contentType string, body []byte) (string, bool) {
+	if !c.respectMeta {
+		return "", false
+	}
+
+	for _, value := range header.Values("X-Robots-Tag") {
+		if directive, ok := c.blockingDirective(value); ok {
+			return fmt.Sprintf("X-Robots-Tag %q", directive), true
+		}
+	}
+
+	if !strings.Contains(contentType, "html") {
+		return "", false
+	}
+	for _, content := range metaRobotsContents(body) {
+		if directive, ok := c.blockingDirective(content); ok {
+			return fmt.Sprintf("meta robots %q", directive), true
+		}
+	}
+	return "", false
+}
+
+// blockingDirective returns the first blocking directive in a comma-separated
+// directive list. A list may be scoped to a crawler, as in "googlebot: noindex",
+// in which case it only applies when the scope matches our robots user agent.
+func (c *Checker) blockingDirective(value string) (string, bool) {
+	if scope, rest, ok := strings.Cut(value, ":"); ok {
+		scope = strings.TrimSpace(scope)
+		if !strings.Contains(scope, ",") && !strings.EqualFold(scope, "unavailable_after") {
+			if scope != "*" && !strings.Contains(strings.ToLower(c.robotsUserAgent), strings.ToLower(scope)) {
+				return "", false
+			}
+			value = rest
+		}
+	}
+
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if blockingDirectives[directive] {
+			return directive, true
+		}
+	}
+	return "", false
+}
+
+// metaRobotsContents returns the content of every <meta name="robots"> tag
+// before the document body
+func metaRobotsContents(body []byte) []string {
+	var contents []string
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return contents
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.DataAtom {
+			case atom.Body:
+				return contents
+			case atom.Meta:
+				var name, content string
+				for _, attr := range token.Attr {
+					switch strings.ToLower(attr.Key) {
+					case "name":
+						name = attr.Val
+					case "content":
+						content = attr.Val
+					}
+				}
+				if strings.EqualFold(strings.TrimSpace(name), "robots") {
+					contents = append(contents, content)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package robots
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPageDirective(t *testing.T) {
+	tests := []struct {
+		name        string
+		respectMeta bool
+		header      http.Header
+		contentType string
+		body        string
+		expected    string
+		blocked     bool
+	}{
+		{
+			name:        "disabled",
+			header:      http.Header{"X-Robots-Tag": {"noindex"}},
+			contentType: "text/html",
+			body:        `<meta name="robots" content="noai">`,
+		},
+		{
+			name:        "header noindex",
+			respectMeta: true,
+			header:      http.Header{"X-Robots-Tag": {"noarchive, NoIndex"}},
+			expected:    `X-Robots-Tag "noindex"`,
+			blocked:     true,
+		},
+		{
+			name:        "header none",
+			respectMeta: true,
+			header:      http.Header{"X-Robots-Tag": {"none"}},
+			expected:    `X-Robots-Tag "none"`,
+			blocked:     true,
+		},
+		{
+			name:        "header scoped to our agent",
+			respectMeta: true,
+			header:      http.Header{"X-Robots-Tag": {"testbot: noindex"}},
+			expected:    `X-Robots-Tag "noindex"`,
+			blocked:     true,
+		},
+		{
+			name:        "header scoped to another agent",
+			respectMeta: true,
+			header:      http.Header{"X-Robots-Tag": {"googlebot: noindex"}},
+		},
+		{
+			name:        "header without blocking directive",
+			respectMeta: true,
+			header:      http.Header{"X-Robots-Tag": {"nofollow, unavailable_after: 25 Jun 2010 15:00:00 PST"}},
+		},
+		{
+			name:        "meta noai",
+			respectMeta: true,
+			contentType: "text/html; charset=utf-8",
+			body:        `<html><head><META NAME="Robots" CONTENT="noai, noimageai"></head><body></body></html>`,
+			expected:    `meta robots "noai"`,
+			blocked:     true,
+		},
+		{
+			name:        "meta in body ignored",
+			respectMeta: true,
+			contentType: "text/html",
+			body:        `<html><head></head><body><meta name="robots" content="noindex"></body></html>`,
+		},
+		{
+			name:        "meta for another name ignored",
+			respectMeta: true,
+			contentType: "text/html",
+			body:        `<meta name="description" content="noindex">`,
+		},
+		{
+			name:        "meta in non-HTML ignored",
+			respectMeta: true,
+			contentType: "text/plain",
+			body:        `<meta name="robots" content="noindex">`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker("TestBot/1.0", "", false, tt.respectMeta, nil)
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+
+			directive, blocked := checker.PageDirective(header, tt.contentType, []byte(tt.body))
+			if blocked != tt.blocked || directive != tt.expected {
+				t.Errorf("expected (%q, %v), got (%q, %v)", tt.expected, tt.blocked, directive, blocked)
+			}
+		})
+	}
+}
@@ -2,89 +2,273 @@
 package robots
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Checker handles robots.txt validation for web crawling
 type Checker struct {
-	userAgent    string
-	ignoreRobots bool
-	httpClient   *http.Client
+	// userAgent is sent with robots.txt requests, and robotsUserAgent is
+	// matched against robots.txt groups and robots meta tag scopes
+	userAgent       string
+	robotsUserAgent string
+	ignoreRobots    bool
+	respectMeta     bool
+	httpClient      *http.Client
+
+	mu       sync.Mutex
+	inflight map[string]*robotsFlight
+}
+
+// robotsFlight is a robots.txt download shared by every lookup for the same
+// site that starts while it is in progress
+type robotsFlight struct {
+	done   chan struct{}
+	file   robotsFile
+	source *Source
+	err    error
+	// waiters counts the lookups that joined the download after it started
+	waiters int
 }
 
-// NewChecker creates a new robots.txt checker
-func NewChecker(userAgent string, ignoreRobots bool, httpClient *http.Client) *Checker {
+// NewChecker creates a new robots.txt checker. userAgent is sent with
+// robots.txt requests and robotsUserAgent selects the robots.txt groups that
+// apply; an empty robotsUserAgent uses userAgent. When respectMeta is set,
+// pages are also checked for X-Robots-Tag headers and robots meta tags.
+func NewChecker(userAgent, robotsUserAgent string, ignoreRobots, respectMeta bool, httpClient *http.Client) *Checker {
+	if robotsUserAgent == "" {
+		robotsUserAgent = userAgent
+	}
 	return &Checker{
-		userAgent:    userAgent,
-		ignoreRobots: ignoreRobots,
-		httpClient:   httpClient,
+		userAgent:       userAgent,
+		robotsUserAgent: robotsUserAgent,
+		ignoreRobots:    ignoreRobots,
+		respectMeta:     respectMeta,
+		httpClient:      httpClient,
+		inflight:        make(map[string]*robotsFlight),
 	}
 }
 
+// Source describes the robots.txt download a decision was made from. The
+// checker keeps no robots.txt cache: every lookup not sharing a download in
+// progress makes its own, so there is no expiry to report.
+type Source struct {
+	// FetchedAt is when the response was received
+	FetchedAt time.Time `json:"fetched_at"`
+	// Status is the HTTP status of the response
+	Status int `json:"status"`
+	// Size is the length of the body in bytes, 0 unless Status is 200
+	Size int `json:"size"`
+}
+
+// Decision is the robots.txt verdict for a URL together with what produced
+// it, so a refusal can tell the client how much of the site is off-limits
+type Decision struct {
+	Allowed bool `json:"allowed"`
+	// RobotsURL is the robots.txt that was consulted, empty when none was
+	RobotsURL string `json:"robots_url,omitempty"`
+	// Rule is the Disallow rule that denied the URL; nil when it is allowed
+	Rule *Rule `json:"rule,omitempty"`
+	// HostWide reports that the rule ("Disallow: /") denies every path on the
+	// host, so trying another page there is pointless
+	HostWide bool `json:"host_wide"`
+	// CrawlDelay is the Crawl-delay value that applies to our user agent,
+	// empty when none does
+	CrawlDelay string `json:"crawl_delay,omitempty"`
+	// Anomalies describe what was malformed about robots.txt
+	Anomalies []string `json:"anomalies,omitempty"`
+	// Unrecognized reports that what was served as robots.txt, such as an
+	// HTML error page, was not one. It is then treated like a robots.txt
+	// that could not be fetched, which allows every path.
+	Unrecognized bool `json:"unrecognized,omitempty"`
+	// TimedOut reports that the lookup was given up when its context was
+	// done. Like a robots.txt that could not be fetched, it allows every path.
+	TimedOut bool `json:"timed_out,omitempty"`
+	// Source describes the robots.txt response; nil when none was received
+	Source *Source `json:"source,omitempty"`
+}
+
 // IsAllowed checks if the URL can be accessed according to robots.txt
 func (c *Checker) IsAllowed(targetURL string) bool {
+	return c.Decide(targetURL).Allowed
+}
+
+// Decide checks the URL against robots.txt like IsAllowed and reports the
+// rule behind the decision
+func (c *Checker) Decide(targetURL string) Decision {
+	return c.DecideContext(context.Background(), targetURL)
+}
+
+// DecideContext is Decide giving up once ctx is done, in which case the URL
+// is allowed as when robots.txt cannot be fetched and TimedOut is set. The
+// download carries on for other lookups of the same site.
+func (c *Checker) DecideContext(ctx context.Context, targetURL string) Decision {
 	if c.ignoreRobots {
-		return true
+		return Decision{Allowed: true}
 	}
 
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
-		return false
+		return Decision{}
 	}
 
-	robotsContent, err := c.fetchRobotsContent(parsedURL)
+	decision := Decision{Allowed: true, RobotsURL: robotsURLFor(parsedURL)}
+	file, source, err := c.fetchRobotsContent(ctx, parsedURL)
+	decision.Source = source
 	if err != nil {
 		// If we can't fetch robots.txt, allow access
-		return true
+		decision.TimedOut = ctx.Err() != nil
+		return decision
+	}
+	decision.Anomalies = file.anomalies
+	if !file.recognized {
+		// Nor when what was served is not a robots.txt
+		decision.Unrecognized = true
+		return decision
 	}
 
-	return c.parseRobotsRules(robotsContent, parsedURL.Path)
+	if _, delay, ok := c.crawlDelay(file.content); ok {
+		decision.CrawlDelay = delay
+	}
+	if rule, denied := c.matchRule(file.content, parsedURL.Path); denied {
+		decision.Allowed = false
+		decision.Rule = &rule
+		decision.HostWide = rule.Path() == "/"
+	}
+	return decision
 }
 
-// fetchRobotsContent retrieves the robots.txt file for a given URL
-func (c *Checker) fetchRobotsContent(parsedURL *url.URL) (string, error) {
-	robotsURL := fmt.Sprintf("%s://%s/robots.txt", parsedURL.Scheme, parsedURL.Host)
+// robotsURLFor returns the robots.txt URL of the site serving parsedURL. The
+// host is lowercased and loses any trailing dot, so example.com. shares the
+// robots.txt of example.com; IPv6 literals keep their brackets.
+func robotsURLFor(parsedURL *url.URL) string {
+	host := strings.ToLower(parsedURL.Hostname())
+	if trimmed := strings.TrimSuffix(host, "."); trimmed != "" {
+		host = trimmed
+	}
+	if port := parsedURL.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return (&url.URL{Scheme: strings.ToLower(parsedURL.Scheme), Host: host, Path: "/robots.txt"}).String()
+}
+
+// fetchRobotsContent retrieves the robots.txt file for a given URL and
+// describes the response, if one was received. Concurrent lookups for the
+// same site share a single download, and all of them receive its result. A
+// lookup whose ctx is done first returns ctx's error, leaving the download
+// to the others; it is bounded by the checker's HTTP client timeout.
+func (c *Checker) fetchRobotsContent(ctx context.Context, parsedURL *url.URL) (robotsFile, *Source, error) {
+	robotsURL := robotsURLFor(parsedURL)
 
+	c.mu.Lock()
+	flight, ok := c.inflight[robotsURL]
+	if ok {
+		flight.waiters++
+	} else {
+		flight = &robotsFlight{done: make(chan struct{})}
+		c.inflight[robotsURL] = flight
+		go c.download(robotsURL, flight)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-flight.done:
+		return flight.file, flight.source, flight.err
+	case <-ctx.Done():
+		return robotsFile{}, nil, ctx.Err()
+	}
+}
+
+// download runs flight's robots.txt request and releases its waiters
+func (c *Checker) download(robotsURL string, flight *robotsFlight) {
+	flight.file, flight.source, flight.err = c.downloadRobots(robotsURL)
+
+	c.mu.Lock()
+	delete(c.inflight, robotsURL)
+	c.mu.Unlock()
+	close(flight.done)
+}
+
+// downloadRobots performs a single robots.txt request
+func (c *Checker) downloadRobots(robotsURL string) (robotsFile, *Source, error) {
 	req, err := http.NewRequest("GET", robotsURL, nil)
 	if err != nil {
-		return "", err
+		return robotsFile{}, nil, err
 	}
 
 	req.Header.Set("User-Agent", c.userAgent)
 
 	resp, err := c.httpClient.Do(req) //nolint:gosec // Fetching robots.txt for user-provided URLs is expected behavior
-	if err != nil || resp.StatusCode != 200 {
-		return "", fmt.Errorf("failed to fetch robots.txt")
+	if err != nil {
+		return robotsFile{}, nil, fmt.Errorf("failed to fetch robots.txt")
 	}
 	defer resp.Body.Close()
 
+	source := &Source{FetchedAt: time.Now(), Status: resp.StatusCode}
+	if resp.StatusCode != 200 {
+		return robotsFile{}, source, fmt.Errorf("failed to fetch robots.txt")
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return robotsFile{}, source, err
 	}
+	source.Size = len(body)
 
-	return string(body), nil
+	return inspectRobots(string(body), resp.Header.Get("Content-Type")), source, nil
 }
 
 // parseRobotsRules parses robots.txt content and checks if access is allowed
 func (c *Checker) parseRobotsRules(robotsContent, targetPath string) bool {
-	userAgentPattern := regexp.MustCompile(`(?i)^User-agent:\s*(.+)$`)
-	disallowPattern := regexp.MustCompile(`(?i)^Disallow:\s*(.*)$`) // Allow empty disallow rules
+	_, denied := c.matchRule(robotsContent, targetPath)
+	return !denied
+}
+
+var (
+	userAgentPattern  = regexp.MustCompile(`(?i)^User-agent:\s*(.+)$`)
+	disallowPattern   = regexp.MustCompile(`(?i)^Disallow:\s*(.*)$`) // Allow empty disallow rules
+	crawlDelayPattern = regexp.MustCompile(`(?i)^Crawl-delay:\s*(.*)$`)
+)
 
+// Rule identifies a robots.txt line that decided access to a path
+type Rule struct {
+	// Line is the 1-based line number in robots.txt
+	Line int `json:"line"`
+	// Text is the rule as written, e.g. "Disallow: /private/"
+	Text string `json:"text"`
+	// Group is the user agent of the group the rule applied through
+	Group string `json:"group"`
+}
+
+// Path returns the path a Disallow rule applies to
+func (r Rule) Path() string {
+	if match := disallowPattern.FindStringSubmatch(r.Text); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return ""
+}
+
+// matchRule returns the Disallow rule that denies targetPath, if any
+func (c *Checker) matchRule(robotsContent, targetPath string) (Rule, bool) {
 	lines := strings.Split(robotsContent, "\n")
 	var currentUserAgents []string
 
-	for _, line := range lines {
+	for i, line := range lines {
 		line = strings.TrimSpace(line)
 
 		if userAgentMatch := userAgentPattern.FindStringSubmatch(line); userAgentMatch != nil {
 			userAgent := strings.TrimSpace(userAgentMatch[1])
-			if userAgent == "*" || strings.Contains(c.userAgent, userAgent) {
+			if userAgent == "*" || strings.Contains(c.robotsUserAgent, userAgent) {
 				currentUserAgents = append(currentUserAgents, userAgent)
 			}
 		} else if disallowMatch := disallowPattern.FindStringSubmatch(line); disallowMatch != nil && len(currentUserAgents) > 0 {
@@ -94,10 +278,31 @@ func (c *Checker) parseRobotsRules(robotsContent, targetPath string) bool {
 				continue
 			}
 			if disallowPath == "/" || strings.HasPrefix(targetPath, disallowPath) {
-				return false
+				return Rule{Line: i + 1, Text: line, Group: currentUserAgents[len(currentUserAgents)-1]}, true
+			}
+		}
+	}
+
+	return Rule{}, false
+}
+
+// crawlDelay returns the first Crawl-delay rule that applies to our user agent
+func (c *Checker) crawlDelay(robotsContent string) (Rule, string, bool) {
+	var currentUserAgents []string
+
+	for i, line := range strings.Split(robotsContent, "\n") {
+		line = strings.TrimSpace(line)
+
+		if userAgentMatch := userAgentPattern.FindStringSubmatch(line); userAgentMatch != nil {
+			userAgent := strings.TrimSpace(userAgentMatch[1])
+			if userAgent == "*" || strings.Contains(c.robotsUserAgent, userAgent) {
+				currentUserAgents = append(currentUserAgents, userAgent)
 			}
+		} else if delayMatch := crawlDelayPattern.FindStringSubmatch(line); delayMatch != nil && len(currentUserAgents) > 0 {
+			rule := Rule{Line: i + 1, Text: line, Group: currentUserAgents[len(currentUserAgents)-1]}
+			return rule, strings.TrimSpace(delayMatch[1]), true
 		}
 	}
 
-	return true
+	return Rule{}, "", false
 }
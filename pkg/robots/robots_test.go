@@ -1,8 +1,13 @@
 package robots
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -28,7 +33,7 @@ Disallow: /blocked/`
 
 func TestNewChecker(t *testing.T) {
 	client := &http.Client{Timeout: 5 * time.Second}
-	checker := NewChecker("TestBot/1.0", false, client)
+	checker := NewChecker("TestBot/1.0", "", false, false, client)
 
 	if checker.userAgent != "TestBot/1.0" {
 		t.Errorf("expected userAgent %q, got %q", "TestBot/1.0", checker.userAgent)
@@ -95,7 +100,7 @@ func TestIsAllowed(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			checker := NewChecker(tt.userAgent, tt.ignoreRobots, client)
+			checker := NewChecker(tt.userAgent, "", tt.ignoreRobots, false, client)
 			result := checker.IsAllowed(tt.targetURL)
 			if result != tt.expected {
 				t.Errorf("expected %v, got %v", tt.expected, result)
@@ -106,7 +111,7 @@ func TestIsAllowed(t *testing.T) {
 
 func TestParseRobotsRules(t *testing.T) {
 	client := &http.Client{Timeout: 5 * time.Second}
-	checker := NewChecker("TestBot/1.0", false, client)
+	checker := NewChecker("TestBot/1.0", "", false, false, client)
 
 	tests := []struct {
 		name          string
@@ -159,3 +164,221 @@ Disallow: /anything`,
 		})
 	}
 }
+
+func TestDecide(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: GreedyBot\nDisallow: /\n\nUser-agent: *\nCrawl-delay: 5\nDisallow: /private/\n"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	robotsURL := server.URL + "/robots.txt"
+
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		expected  Decision
+	}{
+		{
+			name:      "allowed path",
+			userAgent: "TestBot/1.0",
+			path:      "/public",
+			expected:  Decision{Allowed: true, RobotsURL: robotsURL, CrawlDelay: "5"},
+		},
+		{
+			name:      "path rule",
+			userAgent: "TestBot/1.0",
+			path:      "/private/page",
+			expected: Decision{
+				RobotsURL:  robotsURL,
+				Rule:       &Rule{Line: 6, Text: "Disallow: /private/", Group: "*"},
+				CrawlDelay: "5",
+			},
+		},
+		{
+			name:      "host-wide rule",
+			userAgent: "GreedyBot/2.0",
+			path:      "/public",
+			expected: Decision{
+				RobotsURL:  robotsURL,
+				Rule:       &Rule{Line: 2, Text: "Disallow: /", Group: "GreedyBot"},
+				HostWide:   true,
+				CrawlDelay: "5",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(tt.userAgent, "", false, false, client)
+			got := checker.Decide(server.URL + tt.path)
+			if got.Source == nil || got.Source.Status != http.StatusOK {
+				t.Errorf("expected the robots.txt response to be described, got %+v", got.Source)
+			}
+			got.Source = nil
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsAllowedSharesConcurrentRobotsDownloads(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expected bool
+	}{
+		{name: "download succeeds", status: http.StatusOK, expected: false},
+		{name: "download fails", status: http.StatusInternalServerError, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				hits.Add(1)
+				<-release
+				w.WriteHeader(tt.status)
+				w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+			}))
+			defer server.Close()
+
+			checker := NewChecker("TestBot/1.0", "", false, false, &http.Client{Timeout: 5 * time.Second})
+			const lookups = 50
+			results := make([]bool, lookups)
+			var wg sync.WaitGroup
+			for i := range lookups {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					results[i] = checker.IsAllowed(server.URL + "/private/page")
+				}()
+			}
+
+			// Hold the download until every lookup has joined it
+			deadline := time.Now().Add(5 * time.Second)
+			for !joined(checker, lookups-1) {
+				if time.Now().After(deadline) {
+					t.Fatal("timed out waiting for lookups to share the download")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			close(release)
+			wg.Wait()
+
+			if got := hits.Load(); got != 1 {
+				t.Errorf("expected robots.txt to be downloaded once, got %d", got)
+			}
+			for i, allowed := range results {
+				if allowed != tt.expected {
+					t.Errorf("lookup %d: expected %v, got %v", i, tt.expected, allowed)
+				}
+			}
+			if len(checker.inflight) != 0 {
+				t.Errorf("expected no download in flight, got %d", len(checker.inflight))
+			}
+		})
+	}
+}
+
+// joined reports whether n lookups are waiting on an in-flight download
+func joined(checker *Checker, n int) bool {
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+	for _, flight := range checker.inflight {
+		if flight.waiters >= n {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDecideContextGivesUp(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+	}))
+	defer server.Close()
+
+	checker := NewChecker("TestBot/1.0", "", false, false, &http.Client{Timeout: 5 * time.Second})
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	decision := checker.DecideContext(ctx, server.URL+"/private/page")
+	if !decision.Allowed || !decision.TimedOut {
+		t.Errorf("expected a timed out lookup to allow the URL, got %+v", decision)
+	}
+
+	// The download carries on for lookups that wait for it
+	done := make(chan Decision)
+	go func() { done <- checker.Decide(server.URL + "/private/page") }()
+	deadline := time.Now().Add(5 * time.Second)
+	for !joined(checker, 1) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the lookup to join the download")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if decision := <-done; decision.Allowed || decision.TimedOut {
+		t.Errorf("expected the completed download to refuse the URL, got %+v", decision)
+	}
+}
+
+func TestRobotsURLFor(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/page":          "https://example.com/robots.txt",
+		"HTTPS://EXAMPLE.com./page":         "https://example.com/robots.txt",
+		"http://example.com.:8080/":         "http://example.com:8080/robots.txt",
+		"http://[2606:4700::1111]/":         "http://[2606:4700::1111]/robots.txt",
+		"http://[2001:DB8::1]:8443/a?b=c#d": "http://[2001:db8::1]:8443/robots.txt",
+		"http://192.0.2.1/":                 "http://192.0.2.1/robots.txt",
+	}
+	for rawURL, want := range tests {
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := robotsURLFor(parsed); got != want {
+			t.Errorf("robotsURLFor(%s) = %s, want %s", rawURL, got, want)
+		}
+	}
+}
+
+func TestCheckerRobotsUserAgent(t *testing.T) {
+	var requestAgent atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestAgent.Store(r.UserAgent())
+		w.Write([]byte("User-agent: CompanyBot\nDisallow: /blocked/\n"))
+	}))
+	defer server.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	tests := []struct {
+		name            string
+		robotsUserAgent string
+		allowed         bool
+	}{
+		{name: "robots user agent selects the group", robotsUserAgent: "CompanyBot/1.0", allowed: false},
+		{name: "empty robots user agent uses the user agent", robotsUserAgent: "", allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker("Mozilla/5.0 (X11; Linux x86_64)", tt.robotsUserAgent, false, false, client)
+			decision := checker.Decide(server.URL + "/blocked/page")
+			if decision.Allowed != tt.allowed {
+				t.Errorf("expected allowed %t, got %+v", tt.allowed, decision)
+			}
+			if !tt.allowed && (decision.Rule == nil || decision.Rule.Group != "CompanyBot") {
+				t.Errorf("expected the CompanyBot group to apply, got %+v", decision.Rule)
+			}
+			if got := requestAgent.Load(); got != "Mozilla/5.0 (X11; Linux x86_64)" {
+				t.Errorf("expected robots.txt requested with the user agent, got %q", got)
+			}
+		})
+	}
+}
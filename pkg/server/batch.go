@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/fetcher"
+	"github.com/stackloklabs/gofetch/pkg/processor"
+)
+
+// Statuses of the entries of a fetch_batch result
+const (
+	batchOK            = "ok"
+	batchError         = "error"
+	batchSkippedPolicy = "skipped_policy"
+	batchSkippedRobots = "skipped_robots"
+)
+
+// FetchBatchParams defines the input parameters for the fetch_batch tool.
+// The options apply to every URL.
+type FetchBatchParams struct {
+	URLs            []string `json:"urls" mcp:"URLs to fetch, in order; a URL listed twice is fetched once"`
+	MaxLength       *int     `json:"max_length,omitempty" mcp:"Maximum number of characters to return per URL"`
+	Raw             bool     `json:"raw,omitempty" mcp:"Get the actual HTML content without simplification"`
+	ExpectedContent string   `json:"expected_content,omitempty" mcp:"Expected content: html (default), json, text, markdown or any"`
+	MaxBytes        *int     `json:"max_bytes,omitempty" mcp:"Maximum number of response body bytes to download per URL"`
+}
+
+// FetchBatchOutput is the structured result of the fetch_batch tool
+type FetchBatchOutput struct {
+	// Results holds one entry per URL, in the order the URLs were given
+	Results []BatchEntry `json:"results"`
+	Summary BatchSummary `json:"summary"`
+}
+
+// BatchEntry is the result of one URL of a batch
+type BatchEntry struct {
+	URL string `json:"url"`
+	// Status is ok, error, skipped_policy or skipped_robots
+	Status string `json:"status"`
+	// Content and Fetch are the text and structured output the fetch tool
+	// returns, when Status is ok
+	Content string       `json:"content,omitempty"`
+	Fetch   *FetchOutput `json:"fetch,omitempty"`
+	// Error says why the URL was not fetched, and Kind classifies it as
+	// fetch errors are classified, when Status is not ok
+	Error string `json:"error,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+	// DuplicateOf is the index of the earlier entry for the same URL. The
+	// entry shares its status but not its content, bytes or duration.
+	DuplicateOf *int  `json:"duplicate_of,omitempty"`
+	DurationMS  int64 `json:"duration_ms"`
+	Bytes       int64 `json:"bytes"`
+}
+
+// BatchSummary totals a batch. OK, Errors and Skipped count entries,
+// duplicates included, so they add up to URLs.
+type BatchSummary struct {
+	URLs       int   `json:"urls"`
+	OK         int   `json:"ok"`
+	Errors     int   `json:"errors"`
+	Skipped    int   `json:"skipped"`
+	Duplicates int   `json:"duplicates"`
+	Bytes      int64 `json:"bytes"`
+	// ByteCapReached reports that -max-batch-bytes cut a download short or
+	// skipped the URLs after it
+	ByteCapReached bool  `json:"byte_cap_reached"`
+	DurationMS     int64 `json:"duration_ms"`
+}
+
+// handleFetchBatchTool processes fetch_batch tool requests. URLs are fetched
+// one after another, each as the fetch tool would, so the byte cap is
+// applied in the order given. The call fails only when its input is invalid
+// or no URL could be fetched; otherwise failures are reported per URL.
+func (fs *FetchServer) handleFetchBatchTool(
+	ctx context.Context,
+	req *mcp.CallToolRequest,
+	params FetchBatchParams,
+) (*mcp.CallToolResult, *FetchBatchOutput, error) {
+	if len(params.URLs) == 0 {
+		return nil, nil, errors.New("urls must list at least one URL")
+	}
+	if len(params.URLs) > fs.config.MaxBatchURLs {
+		return nil, nil, fmt.Errorf("too many urls: %d given, at most %d allowed", len(params.URLs), fs.config.MaxBatchURLs)
+	}
+	if err := processor.ValidatePage(nil, params.MaxLength); err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	output := &FetchBatchOutput{Results: make([]BatchEntry, len(params.URLs))}
+	summary := &output.Summary
+	first := make(map[string]int, len(params.URLs))
+	for i, rawURL := range params.URLs {
+		rawURL = strings.TrimSpace(rawURL)
+		entry := &output.Results[i]
+		entry.URL = rawURL
+
+		if original, ok := first[rawURL]; ok {
+			*entry = BatchEntry{
+				URL:         rawURL,
+				Status:      output.Results[original].Status,
+				Error:       output.Results[original].Error,
+				Kind:        output.Results[original].Kind,
+				DuplicateOf: &original,
+			}
+			summary.Duplicates++
+			continue
+		}
+		first[rawURL] = i
+
+		remaining := fs.config.MaxBatchBytes - summary.Bytes
+		switch {
+		case ctx.Err() != nil:
+			entry.Status, entry.Error = batchError, ctx.Err().Error()
+			continue
+		case remaining <= 0:
+			entry.Status, entry.Kind = batchSkippedPolicy, string(fetcher.KindPolicy)
+			entry.Error = fmt.Sprintf("the batch already downloaded its limit of %d bytes", fs.config.MaxBatchBytes)
+			summary.ByteCapReached = true
+			continue
+		}
+
+		fetchParams := FetchParams{
+			URL:             rawURL,
+			MaxLength:       params.MaxLength,
+			Raw:             params.Raw,
+			ExpectedContent: params.ExpectedContent,
+			MaxBytes:        params.MaxBytes,
+		}
+		capped := false
+		if limit, _ := fs.effectiveMaxBytes(params.MaxBytes); limit <= 0 || int64(limit) > remaining {
+			budget := int(remaining)
+			fetchParams.MaxBytes, capped = &budget, true
+		}
+
+		fetchStart := time.Now()
+		result, fetchOutput, bytes, err := fs.fetchPage(ctx, req, fetchParams)
+		entry.DurationMS = time.Since(fetchStart).Milliseconds()
+		entry.Bytes = bytes
+		summary.Bytes += bytes
+		if err != nil {
+			entry.Status, entry.Error = batchStatus(err), err.Error()
+			var fetchErr *fetcher.FetchError
+			if errors.As(err, &fetchErr) {
+				entry.Kind = string(fetchErr.Kind)
+			}
+			continue
+		}
+		entry.Status = batchOK
+		entry.Content = result.Content[0].(*mcp.TextContent).Text
+		entry.Fetch = fetchOutput
+		if capped && fetchOutput.BodyTruncated {
+			summary.ByteCapReached = true
+		}
+	}
+
+	summary.URLs = len(output.Results)
+	for _, entry := range output.Results {
+		switch entry.Status {
+		case batchOK:
+			summary.OK++
+		case batchError:
+			summary.Errors++
+		default:
+			summary.Skipped++
+		}
+	}
+	summary.DurationMS = time.Since(start).Milliseconds()
+
+	// Called without an MCP request in tests; keep the interface nil
+	var identity mcp.Request
+	if req != nil {
+		identity = req
+	}
+	sessionID, client := requestIdentity(identity)
+	log.Printf("Batch of %d URLs (%d duplicates): ok=%d errors=%d skipped=%d bytes=%d in %s (session=%s client=%q)",
+		summary.URLs, summary.Duplicates, summary.OK, summary.Errors, summary.Skipped, summary.Bytes,
+		time.Since(start), sessionID, client)
+
+	// The structured output is returned as the text too; a batch where
+	// nothing was fetched is a failed call, still describing every URL
+	return &mcp.CallToolResult{IsError: summary.OK == 0}, output, nil
+}
+
+// batchStatus classifies a failed fetch of a batch
+func batchStatus(err error) string {
+	switch {
+	case errors.Is(err, fetcher.KindRobotsBlocked):
+		return batchSkippedRobots
+	case errors.Is(err, fetcher.KindPolicy):
+		return batchSkippedPolicy
+	default:
+		return batchError
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+func newBatchSite(t *testing.T) *httptest.Server {
+	t.Helper()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/a", "/c", "/private":
+			w.Write([]byte("0123456789"))
+		case "/big":
+			w.Write([]byte(strings.Repeat("x", 100)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+func callFetchBatch(t *testing.T, session *mcp.ClientSession, urls ...string) (*mcp.CallToolResult, FetchBatchOutput) {
+	t.Helper()
+	result, err := session.CallTool(t.Context(), &mcp.CallToolParams{
+		Name:      "fetch_batch",
+		Arguments: map[string]any{"urls": urls},
+	})
+	if err != nil {
+		t.Fatalf("tool call failed: %v", err)
+	}
+	var output FetchBatchOutput
+	if result.StructuredContent != nil {
+		data, err := json.Marshal(result.StructuredContent)
+		if err != nil {
+			t.Fatalf("failed to marshal structured content: %v", err)
+		}
+		if err := json.Unmarshal(data, &output); err != nil {
+			t.Fatalf("invalid structured content %s: %v", data, err)
+		}
+	}
+	return result, output
+}
+
+func TestFetchBatchPartialSuccess(t *testing.T) {
+	site := newBatchSite(t)
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP, MaxBatchBytes: 25})
+	session := connectTestClient(t, fs)
+
+	result, output := callFetchBatch(t, session,
+		site.URL+"/a", site.URL+"/private", " "+site.URL+"/a", site.URL+"/missing", site.URL+"/big", site.URL+"/c")
+	if result.IsError {
+		t.Fatalf("expected the batch to succeed in part, got %+v", result.Content)
+	}
+
+	expected := []struct {
+		path, status, kind string
+		bytes              int64
+	}{
+		{"/a", batchOK, "", 10},
+		{"/private", batchSkippedRobots, "robots_blocked", 0},
+		{"/a", batchOK, "", 0},
+		{"/missing", batchError, "http_status", 0},
+		{"/big", batchOK, "", 15},
+		{"/c", batchSkippedPolicy, "policy", 0},
+	}
+	if len(output.Results) != len(expected) {
+		t.Fatalf("expected %d entries, got %+v", len(expected), output.Results)
+	}
+	for i, want := range expected {
+		entry := output.Results[i]
+		if entry.URL != site.URL+want.path || entry.Status != want.status || entry.Kind != want.kind || entry.Bytes != want.bytes {
+			t.Errorf("entry %d: expected %s %s %q with %d bytes, got %+v", i, want.path, want.status, want.kind, want.bytes, entry)
+		}
+		if (entry.Status == batchOK) != (entry.Error == "") {
+			t.Errorf("entry %d: expected an error exactly when not ok, got %+v", i, entry)
+		}
+	}
+
+	if first := output.Results[0]; first.Content != "0123456789" || first.Fetch == nil || first.Fetch.StatusCode != http.StatusOK {
+		t.Errorf("expected the first entry to carry the content and fetch output, got %+v", first)
+	}
+	if duplicate := output.Results[2]; duplicate.DuplicateOf == nil || *duplicate.DuplicateOf != 0 || duplicate.Content != "" {
+		t.Errorf("expected the repeated URL to point at the first entry, got %+v", duplicate)
+	}
+	if big := output.Results[4]; big.Fetch == nil || !big.Fetch.BodyTruncated || !strings.HasPrefix(big.Content, strings.Repeat("x", 15)+"\n") {
+		t.Errorf("expected the download to stop at the batch's remaining bytes, got %+v", big)
+	}
+	if !strings.Contains(output.Results[5].Error, "limit of 25 bytes") {
+		t.Errorf("expected the skipped URL to name the byte cap, got %q", output.Results[5].Error)
+	}
+
+	summary := output.Summary
+	if summary.URLs != 6 || summary.OK != 3 || summary.Errors != 1 || summary.Skipped != 2 ||
+		summary.Duplicates != 1 || summary.Bytes != 25 || !summary.ByteCapReached {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestFetchBatchFailsWhenNothingFetched(t *testing.T) {
+	site := newBatchSite(t)
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP})
+	session := connectTestClient(t, fs)
+
+	result, output := callFetchBatch(t, session, site.URL+"/missing", site.URL+"/private")
+	if !result.IsError {
+		t.Fatal("expected the call to fail when no URL was fetched")
+	}
+	if len(output.Results) != 2 || output.Results[0].Status != batchError || output.Results[1].Status != batchSkippedRobots {
+		t.Errorf("expected every URL still described, got %+v", output.Results)
+	}
+	if summary := output.Summary; summary.OK != 0 || summary.Errors != 1 || summary.Skipped != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestFetchBatchValidatesInput(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP, MaxBatchURLs: 2})
+	session := connectTestClient(t, fs)
+
+	tests := map[string]map[string]any{
+		"urls must list at least one URL":    {"urls": []string{}},
+		"too many urls: 3 given, at most 2":  {"urls": []string{"https://a.example/", "https://b.example/", "https://c.example/"}},
+		"invalid max_length -1: must not be": {"urls": []string{"https://a.example/"}, "max_length": -1},
+	}
+	for want, arguments := range tests {
+		result, err := session.CallTool(t.Context(), &mcp.CallToolParams{Name: "fetch_batch", Arguments: arguments})
+		if err != nil {
+			t.Fatalf("tool call failed: %v", err)
+		}
+		if !result.IsError || result.StructuredContent != nil {
+			t.Errorf("%v: expected the call to fail without results, got %+v", arguments, result)
+			continue
+		}
+		if text := result.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, want) {
+			t.Errorf("expected %q in %q", want, text)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+	"github.com/stackloklabs/gofetch/pkg/fetcher"
+)
+
+// capabilitiesKey is the experimental MCP capability the capabilities are
+// also published under
+const capabilitiesKey = "gofetch"
+
+// Capabilities describes what this server offers, for deployment tooling
+// that cannot start an MCP session. Fields are only ever added, so tooling
+// can rely on the ones it knows.
+type Capabilities struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Transport is the MCP transport served, sse or streamable-http
+	Transport string `json:"transport"`
+	// Endpoints maps each HTTP endpoint, such as mcp or healthz, to its path
+	Endpoints map[string]string `json:"endpoints"`
+	// Auth is none: the server does not authenticate clients
+	Auth string `json:"auth"`
+	// Tools and Resources name the registered MCP tools and resource
+	// templates
+	Tools     []string `json:"tools"`
+	Resources []string `json:"resources"`
+	// WarningCodes lists the codes fetch warnings can carry
+	WarningCodes []string           `json:"warning_codes"`
+	Features     CapabilityFeatures `json:"features"`
+	Limits       CapabilityLimits   `json:"limits"`
+}
+
+// CapabilityFeatures reports which optional behaviors are enabled
+type CapabilityFeatures struct {
+	Readability       bool `json:"readability"`
+	TitleHeader       bool `json:"title_header"`
+	InlineHTML        bool `json:"inline_html"`
+	RobotsTxt         bool `json:"robots_txt"`
+	RobotsMeta        bool `json:"robots_meta"`
+	RewriteKnownHosts bool `json:"rewrite_known_hosts"`
+	StripTracking     bool `json:"strip_tracking_params"`
+	Proxy             bool `json:"proxy"`
+	CircuitBreaker    bool `json:"circuit_breaker"`
+	HostProfiles      bool `json:"host_profiles"`
+	ResultResources   bool `json:"result_resources"`
+	RateLimit         bool `json:"rate_limit"`
+	OverloadShedding  bool `json:"overload_shedding"`
+	SessionByteQuota  bool `json:"session_byte_quota"`
+}
+
+// CapabilityLimits reports the limits clients are held to. Zero means no
+// limit.
+type CapabilityLimits struct {
+	DefaultMaxLength int `json:"default_max_length"`
+	MaxMaxLength     int `json:"max_max_length"`
+	MaxBytes         int `json:"max_bytes"`
+	MaxResultSize    int `json:"max_result_size"`
+	// FetchTimeout and RobotsTimeout are Go durations
+	FetchTimeout     string `json:"fetch_timeout"`
+	RobotsTimeout    string `json:"robots_timeout"`
+	RateLimit        int    `json:"rate_limit_per_minute"`
+	SessionByteQuota int64  `json:"session_byte_quota"`
+	// MaxBatchURLs and MaxBatchBytes bound each fetch_batch call
+	MaxBatchURLs  int   `json:"max_batch_urls"`
+	MaxBatchBytes int64 `json:"max_batch_bytes"`
+}
+
+// capabilities describes the server as configured, with the tools and
+// resources registered so far
+func (fs *FetchServer) capabilities() *Capabilities {
+	cfg := fs.config
+	endpoints := map[string]string{
+		"healthz":      fs.route("/healthz"),
+		"capabilities": fs.route("/capabilities"),
+	}
+	if cfg.Transport == config.TransportStreamableHTTP {
+		endpoints["mcp"] = fs.route("/mcp")
+	} else {
+		endpoints["sse"] = fs.route("/sse")
+		endpoints["messages"] = fs.route("/messages")
+	}
+
+	warningCodes := make([]string, 0, len(fetcher.WarningCodes))
+	for _, code := range fetcher.WarningCodes {
+		warningCodes = append(warningCodes, string(code))
+	}
+
+	return &Capabilities{
+		Name:         config.ServerName,
+		Version:      config.ServerVersion,
+		Transport:    cfg.Transport,
+		Endpoints:    endpoints,
+		Auth:         "none",
+		Tools:        append([]string{}, fs.tools...),
+		Resources:    append([]string{}, fs.resources...),
+		WarningCodes: warningCodes,
+		Features: CapabilityFeatures{
+			Readability:       !cfg.DisableReadability,
+			TitleHeader:       !cfg.DisableTitleHeader,
+			InlineHTML:        cfg.AllowInlineHTML,
+			RobotsTxt:         !cfg.IgnoreRobots,
+			RobotsMeta:        cfg.RespectRobotsMeta,
+			RewriteKnownHosts: cfg.RewriteKnownHosts,
+			StripTracking:     cfg.StripTrackingParams,
+			Proxy:             cfg.ProxyURL != "",
+			CircuitBreaker:    cfg.CircuitFailures > 0,
+			HostProfiles:      fs.profiles != nil,
+			ResultResources:   cfg.MaxResultSize > 0,
+			RateLimit:         cfg.RateLimit > 0,
+			OverloadShedding:  fs.overload != nil,
+			SessionByteQuota:  cfg.SessionByteQuota > 0,
+		},
+		Limits: CapabilityLimits{
+			DefaultMaxLength: cfg.DefaultMaxLength,
+			MaxMaxLength:     cfg.MaxMaxLength,
+			MaxBytes:         cfg.MaxBytes,
+			MaxResultSize:    cfg.MaxResultSize,
+			FetchTimeout:     cfg.FetchTimeout.String(),
+			RobotsTimeout:    cfg.RobotsTimeout.String(),
+			RateLimit:        cfg.RateLimit,
+			SessionByteQuota: cfg.SessionByteQuota,
+			MaxBatchURLs:     cfg.MaxBatchURLs,
+			MaxBatchBytes:    cfg.MaxBatchBytes,
+		},
+	}
+}
+
+// addTool registers a tool with the MCP server and records its name for the
+// capabilities
+func addTool[In, Out any](fs *FetchServer, tool *mcp.Tool, handler mcp.ToolHandlerFor[In, Out]) {
+	mcp.AddTool(fs.mcpServer, tool, handler)
+	fs.tools = append(fs.tools, tool.Name)
+}
+
+// handleCapabilities serves the capabilities as JSON. It needs no session,
+// but is rate limited like the MCP endpoints.
+func (fs *FetchServer) handleCapabilities(w http.ResponseWriter, _ *http.Request) {
+	body, err := json.MarshalIndent(fs.capabilities(), "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode capabilities: %v", err)
+		http.Error(w, "failed to encode capabilities", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
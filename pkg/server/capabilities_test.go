@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// goldenCapabilities is the capabilities document of the golden config
+var goldenCapabilities = filepath.Join("testdata", "capabilities.json")
+
+// goldenConfig enables a representative set of features
+func goldenConfig() config.Config {
+	return config.Config{
+		Transport:         config.TransportStreamableHTTP,
+		BasePath:          "/tools",
+		RespectRobotsMeta: true,
+		RewriteKnownHosts: true,
+		CircuitFailures:   5,
+		DefaultMaxLength:  20000,
+		MaxResultSize:     100000,
+		RateLimit:         60,
+	}
+}
+
+func TestCapabilitiesGolden(t *testing.T) {
+	fs := newTestServer(t, goldenConfig())
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/tools/capabilities", nil)
+	req.RemoteAddr = "203.0.113.5:4000"
+	fs.streamableHTTPMux().ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON document, got %d %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	if *update {
+		if err := os.WriteFile(goldenCapabilities, recorder.Body.Bytes(), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := os.ReadFile(goldenCapabilities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recorder.Body.Bytes(), golden) {
+		t.Errorf("capabilities differ from %s; if the change is intended, rerun with -update\ngot:\n%s",
+			goldenCapabilities, recorder.Body.String())
+	}
+}
+
+func TestCapabilitiesInMCPInitialize(t *testing.T) {
+	fs := newTestServer(t, goldenConfig())
+	session := connectTestClient(t, fs)
+
+	// The client decodes the capability as a map, so compare it decoded
+	data, err := json.Marshal(session.InitializeResult().Capabilities.Experimental[capabilitiesKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var published, expected Capabilities
+	if err := json.Unmarshal(data, &published); err != nil {
+		t.Fatalf("invalid capability %s: %v", data, err)
+	}
+	golden, err := os.ReadFile(goldenCapabilities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(golden, &expected); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(published, expected) {
+		t.Errorf("expected the experimental capability to match %s, got %s", goldenCapabilities, data)
+	}
+}
+
+func TestCapabilitiesRateLimited(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportSSE, RateLimit: 1})
+	mux := fs.sseMux()
+
+	codes := make([]int, 2)
+	for i := range codes {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/capabilities", nil)
+		req.RemoteAddr = "203.0.113.5:4000"
+		mux.ServeHTTP(recorder, req)
+		codes[i] = recorder.Code
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("expected the second request to be rate limited, got %v", codes)
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/stackloklabs/gofetch/pkg/fetcher"
+)
+
+// reportURL prepares a URL for the tool result, removing tracking parameters
+// when the server is configured to
+func (fs *FetchServer) reportURL(rawURL string) string {
+	if !fs.config.StripTrackingParams {
+		return rawURL
+	}
+	return stripTrackingParams(rawURL)
+}
+
+// stripTrackingParams removes utm_* and other tracking parameters from rawURL,
+// keeping the remaining parameters in their original order and encoding.
+// URLs that cannot be parsed are returned unchanged.
+func stripTrackingParams(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.RawQuery == "" {
+		return rawURL
+	}
+
+	var kept []string
+	for _, pair := range strings.Split(parsed.RawQuery, "&") {
+		rawName, _, _ := strings.Cut(pair, "=")
+		name := rawName
+		if unescaped, err := url.QueryUnescape(rawName); err == nil {
+			name = unescaped
+		}
+		if fetcher.IsTrackingParam(name) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+
+	parsed.RawQuery = strings.Join(kept, "&")
+	parsed.ForceQuery = false
+	return parsed.String()
+}
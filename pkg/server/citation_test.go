@@ -0,0 +1,21 @@
+package server
+
+import "testing"
+
+func TestStripTrackingParams(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/a":                                      "https://example.com/a",
+		"https://example.com/a?id=1":                                 "https://example.com/a?id=1",
+		"https://example.com/a?utm_source=x&utm_campaign=y":          "https://example.com/a",
+		"https://example.com/a?b=2&UTM_Medium=x&a=1":                 "https://example.com/a?b=2&a=1",
+		"https://example.com/a?fbclid=x&q=go%20lang&gclid=y#section": "https://example.com/a?q=go%20lang#section",
+		"https://example.com/a?utm=keep":                             "https://example.com/a?utm=keep",
+		"http://[::1":                                                "http://[::1",
+	}
+
+	for input, expected := range tests {
+		if got := stripTrackingParams(input); got != expected {
+			t.Errorf("stripTrackingParams(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
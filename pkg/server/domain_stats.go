@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultDomainStatsLimit is how many domains domain_stats lists when the
+// client gives no limit
+const defaultDomainStatsLimit = 20
+
+// DomainStatsParams defines the input parameters for the domain_stats tool
+type DomainStatsParams struct {
+	Limit int `json:"limit,omitempty" mcp:"Maximum number of domains to list (default 20)"`
+}
+
+// DomainStatsOutput is the structured result of the domain_stats tool
+type DomainStatsOutput struct {
+	Domains []DomainStatsEntry `json:"domains"`
+	// TrackedDomains counts every domain with statistics, listed or not
+	TrackedDomains int `json:"tracked_domains"`
+}
+
+// DomainStatsEntry describes the fetches made to one domain since the server
+// started
+type DomainStatsEntry struct {
+	Domain       string `json:"domain"`
+	Fetches      int64  `json:"fetches"`
+	Bytes        int64  `json:"bytes"`
+	Errors       int64  `json:"errors"`
+	RobotsBlocks int64  `json:"robots_blocks"`
+	NotModified  int64  `json:"not_modified"`
+	// CachedFailures counts failures answered from the negative cache
+	CachedFailures int64 `json:"cached_failures"`
+	// BudgetBreaches counts pages that ran over -processing-budget
+	BudgetBreaches int64 `json:"budget_breaches"`
+	// DecompressionAborts counts responses that expanded past
+	// -max-decompression-ratio or -max-decompressed-bytes
+	DecompressionAborts int64 `json:"decompression_aborts"`
+	// HeaderLimitAborts counts responses whose headers exceeded
+	// -max-response-header-bytes or -max-response-headers
+	HeaderLimitAborts int64 `json:"header_limit_aborts"`
+	// CircuitOpens counts the times the circuit breaker opened for the
+	// domain, and CircuitRejections the fetches it failed while open
+	CircuitOpens      int64 `json:"circuit_opens"`
+	CircuitRejections int64 `json:"circuit_rejections"`
+	// LengthMismatches counts responses shorter than their Content-Length
+	LengthMismatches int64 `json:"length_mismatches"`
+	// RobotsAnomalies counts fetches that found robots.txt malformed
+	RobotsAnomalies int64 `json:"robots_anomalies"`
+	// BotChallenges counts fetches answered with a bot protection challenge
+	BotChallenges int64 `json:"bot_challenges"`
+	// Circuit is closed, open or half_open
+	Circuit   string    `json:"circuit"`
+	LastFetch time.Time `json:"last_fetch"`
+}
+
+// handleDomainStatsTool processes domain_stats tool requests
+func (fs *FetchServer) handleDomainStatsTool(
+	_ context.Context,
+	_ *mcp.CallToolRequest,
+	params DomainStatsParams,
+) (*mcp.CallToolResult, *DomainStatsOutput, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultDomainStatsLimit
+	}
+
+	stats, tracked := fs.fetcher.DomainStats(limit)
+	output := &DomainStatsOutput{Domains: make([]DomainStatsEntry, 0, len(stats)), TrackedDomains: tracked}
+	for _, domain := range stats {
+		output.Domains = append(output.Domains, DomainStatsEntry{
+			Domain:              domain.Domain,
+			Fetches:             domain.Fetches,
+			Bytes:               domain.Bytes,
+			Errors:              domain.Errors,
+			RobotsBlocks:        domain.RobotsBlocks,
+			NotModified:         domain.NotModified,
+			CachedFailures:      domain.CachedFailures,
+			BudgetBreaches:      domain.BudgetBreaches,
+			DecompressionAborts: domain.DecompressionAborts,
+			HeaderLimitAborts:   domain.HeaderLimitAborts,
+			CircuitOpens:        domain.CircuitOpens,
+			CircuitRejections:   domain.CircuitRejections,
+			LengthMismatches:    domain.LengthMismatches,
+			RobotsAnomalies:     domain.RobotsAnomalies,
+			BotChallenges:       domain.BotChallenges,
+			Circuit:             domain.Circuit,
+			LastFetch:           domain.LastFetch,
+		})
+	}
+
+	return nil, output, nil
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+func TestDomainStatsTool(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	}))
+	defer site.Close()
+
+	fs := newTestServer(t, config.Config{IgnoreRobots: true, Transport: config.TransportStreamableHTTP})
+	session := connectTestClient(t, fs)
+
+	for range 2 {
+		if _, err := session.CallTool(t.Context(), &mcp.CallToolParams{
+			Name:      "fetch",
+			Arguments: map[string]any{"url": site.URL},
+		}); err != nil {
+			t.Fatalf("fetch failed: %v", err)
+		}
+	}
+
+	result, err := session.CallTool(t.Context(), &mcp.CallToolParams{
+		Name:      "domain_stats",
+		Arguments: map[string]any{"limit": 5},
+	})
+	if err != nil {
+		t.Fatalf("tool call failed: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+
+	data, err := json.Marshal(result.StructuredContent)
+	if err != nil {
+		t.Fatalf("failed to marshal structured content: %v", err)
+	}
+	var output DomainStatsOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		t.Fatalf("invalid structured content %s: %v", data, err)
+	}
+	if output.TrackedDomains != 1 || len(output.Domains) != 1 {
+		t.Fatalf("expected one domain, got %s", data)
+	}
+	if domain := output.Domains[0]; domain.Domain != "127.0.0.1" || domain.Fetches != 2 || domain.Bytes != 10 {
+		t.Errorf("unexpected statistics: %s", data)
+	}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// eventStore is an in-memory mcp.EventStore that lets streamable HTTP clients
+// resume a dropped stream with Last-Event-ID. Each session may retain at most
+// maxBytes of event data, and events are kept for at most ttl. Sessions that
+// stay idle for longer than ttl are dropped even if SessionClosed is never
+// called, so memory use stays bounded.
+type eventStore struct {
+	maxBytes int
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*sessionEvents
+}
+
+// sessionEvents holds the retained events of one session
+type sessionEvents struct {
+	streams    map[string]*streamEvents
+	bytes      int
+	lastActive time.Time
+	// appended counts the events appended to the session, ordering events
+	// across streams when their timestamps are equal
+	appended uint64
+}
+
+// streamEvents holds the retained events of one stream. first is the stream
+// index of events[0].
+type streamEvents struct {
+	first  int
+	events []storedEvent
+}
+
+// storedEvent is the data of one event and when it was appended. seq is its
+// position among all events appended to the session.
+type storedEvent struct {
+	data []byte
+	at   time.Time
+	seq  uint64
+}
+
+var _ mcp.EventStore = (*eventStore)(nil)
+
+// newEventStore creates an event store retaining up to maxBytes of events per
+// session for at most ttl
+func newEventStore(maxBytes int, ttl time.Duration) *eventStore {
+	return &eventStore{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		now:      time.Now,
+		sessions: make(map[string]*sessionEvents),
+	}
+}
+
+// Open implements mcp.EventStore
+func (s *eventStore) Open(_ context.Context, sessionID, streamID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictIdleSessions()
+	s.stream(sessionID, streamID)
+	return nil
+}
+
+// Append implements mcp.EventStore
+func (s *eventStore) Append(_ context.Context, sessionID, streamID string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session := s.session(sessionID)
+	stream := s.stream(sessionID, streamID)
+	session.appended++
+	stream.events = append(stream.events, storedEvent{data: data, at: s.now(), seq: session.appended})
+	session.bytes += len(data)
+
+	s.expire(session)
+	// Keep at least the event just appended, even if it alone exceeds the limit
+	for session.bytes > s.maxBytes {
+		if !s.dropOldest(session, stream) {
+			break
+		}
+	}
+	return nil
+}
+
+// After implements mcp.EventStore
+func (s *eventStore) After(_ context.Context, sessionID, streamID string, index int) iter.Seq2[[]byte, error] {
+	events, err := s.eventsAfter(sessionID, streamID, index)
+
+	return func(yield func([]byte, error) bool) {
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, data := range events {
+			if !yield(data, nil) {
+				return
+			}
+		}
+	}
+}
+
+// eventsAfter copies the data of the events following index
+func (s *eventStore) eventsAfter(sessionID, streamID string, index int) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("unknown session %q", sessionID)
+	}
+	stream, ok := session.streams[streamID]
+	if !ok {
+		return nil, fmt.Errorf("unknown stream %q in session %q", streamID, sessionID)
+	}
+
+	session.lastActive = s.now()
+	s.expire(session)
+
+	start := index + 1
+	if start < stream.first {
+		return nil, fmt.Errorf("stream %q in session %q after index %d: %w", streamID, sessionID, index, mcp.ErrEventsPurged)
+	}
+
+	var data [][]byte
+	for _, event := range stream.events[min(start-stream.first, len(stream.events)):] {
+		data = append(data, slices.Clone(event.data))
+	}
+	return data, nil
+}
+
+// SessionClosed implements mcp.EventStore by evicting every event of the session
+func (s *eventStore) SessionClosed(_ context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+// session returns the events of sessionID, creating them if needed, and marks
+// the session as active. It must be called with s.mu held.
+func (s *eventStore) session(sessionID string) *sessionEvents {
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		session = &sessionEvents{streams: make(map[string]*streamEvents)}
+		s.sessions[sessionID] = session
+	}
+	session.lastActive = s.now()
+	return session
+}
+
+// stream returns the events of a stream, creating them if needed. It must be
+// called with s.mu held.
+func (s *eventStore) stream(sessionID, streamID string) *streamEvents {
+	session := s.session(sessionID)
+	stream, ok := session.streams[streamID]
+	if !ok {
+		stream = &streamEvents{}
+		session.streams[streamID] = stream
+	}
+	return stream
+}
+
+// expire drops the events of session that are older than the ttl. It must be
+// called with s.mu held.
+func (s *eventStore) expire(session *sessionEvents) {
+	cutoff := s.now().Add(-s.ttl)
+	for _, stream := range session.streams {
+		for len(stream.events) > 0 && stream.events[0].at.Before(cutoff) {
+			session.bytes -= stream.removeFirst()
+		}
+	}
+}
+
+// dropOldest removes the oldest event of session other than the last event of
+// keep, reporting whether anything was removed. It must be called with s.mu held.
+func (s *eventStore) dropOldest(session *sessionEvents, keep *streamEvents) bool {
+	var oldest *streamEvents
+	for _, stream := range session.streams {
+		removable := len(stream.events)
+		if stream == keep {
+			removable--
+		}
+		if removable > 0 && (oldest == nil || stream.events[0].seq < oldest.events[0].seq) {
+			oldest = stream
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	session.bytes -= oldest.removeFirst()
+	return true
+}
+
+// evictIdleSessions drops sessions that have been idle for longer than the
+// ttl. It must be called with s.mu held.
+func (s *eventStore) evictIdleSessions() {
+	cutoff := s.now().Add(-s.ttl)
+	for id, session := range s.sessions {
+		if session.lastActive.Before(cutoff) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// removeFirst drops the oldest event of the stream and returns its size
+func (st *streamEvents) removeFirst() int {
+	size := len(st.events[0].data)
+	st.events[0] = storedEvent{}
+	st.events = st.events[1:]
+	st.first++
+	return size
+}
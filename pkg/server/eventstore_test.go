@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+// newTestEventStore returns an event store with a clock the test controls
+func newTestEventStore(maxBytes int, ttl time.Duration) (*eventStore, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newEventStore(maxBytes, ttl)
+	store.now = func() time.Time { return now }
+	return store, &now
+}
+
+// collectEvents drains After into strings, returning the first error
+func collectEvents(store *eventStore, sessionID, streamID string, index int) ([]string, error) {
+	var events []string
+	for data, err := range store.After(context.Background(), sessionID, streamID, index) {
+		if err != nil {
+			return events, err
+		}
+		events = append(events, string(data))
+	}
+	return events, nil
+}
+
+func appendEvents(t *testing.T, store *eventStore, sessionID, streamID string, events ...string) {
+	t.Helper()
+	for _, event := range events {
+		if err := store.Append(t.Context(), sessionID, streamID, []byte(event)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+}
+
+func TestEventStoreReplaysAfterIndex(t *testing.T) {
+	store, _ := newTestEventStore(1024, time.Minute)
+	if err := store.Open(t.Context(), "s1", "a"); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	appendEvents(t, store, "s1", "a", "e0", "e1", "e2")
+
+	events, err := collectEvents(store, "s1", "a", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(events, ",") != "e1,e2" {
+		t.Errorf("expected events after index 0, got %v", events)
+	}
+
+	if events, err := collectEvents(store, "s1", "a", 2); err != nil || len(events) != 0 {
+		t.Errorf("expected nothing after the last event, got %v (%v)", events, err)
+	}
+	if _, err := collectEvents(store, "s1", "missing", 0); err == nil {
+		t.Error("expected error for unknown stream")
+	}
+	if _, err := collectEvents(store, "missing", "a", 0); err == nil {
+		t.Error("expected error for unknown session")
+	}
+}
+
+func TestEventStoreByteLimit(t *testing.T) {
+	store, _ := newTestEventStore(6, time.Minute)
+	appendEvents(t, store, "s1", "a", "e0", "e1")
+	appendEvents(t, store, "s1", "b", "e2", "e3")
+
+	// The oldest event of the session is purged, whichever stream it is on
+	if _, err := collectEvents(store, "s1", "a", -1); !errors.Is(err, mcp.ErrEventsPurged) {
+		t.Errorf("expected ErrEventsPurged, got %v", err)
+	}
+	if events, err := collectEvents(store, "s1", "a", 0); err != nil || strings.Join(events, ",") != "e1" {
+		t.Errorf("expected e1 to be retained, got %v (%v)", events, err)
+	}
+	if events, err := collectEvents(store, "s1", "b", -1); err != nil || strings.Join(events, ",") != "e2,e3" {
+		t.Errorf("expected stream b to be retained, got %v (%v)", events, err)
+	}
+
+	// Other sessions have their own budget
+	appendEvents(t, store, "s2", "a", "e0")
+	if events, err := collectEvents(store, "s2", "a", -1); err != nil || len(events) != 1 {
+		t.Errorf("expected separate budget per session, got %v (%v)", events, err)
+	}
+
+	// An oversized event is kept on its own
+	appendEvents(t, store, "s3", "a", "e0", "oversized")
+	if events, err := collectEvents(store, "s3", "a", 0); err != nil || strings.Join(events, ",") != "oversized" {
+		t.Errorf("expected the oversized event to be kept, got %v (%v)", events, err)
+	}
+	if got := store.sessions["s3"].bytes; got != len("oversized") {
+		t.Errorf("expected byte count %d, got %d", len("oversized"), got)
+	}
+}
+
+func TestEventStoreExpiresOldEvents(t *testing.T) {
+	store, now := newTestEventStore(1024, time.Minute)
+	appendEvents(t, store, "s1", "a", "e0")
+	*now = now.Add(45 * time.Second)
+	appendEvents(t, store, "s1", "a", "e1")
+	*now = now.Add(30 * time.Second)
+
+	if _, err := collectEvents(store, "s1", "a", -1); !errors.Is(err, mcp.ErrEventsPurged) {
+		t.Errorf("expected ErrEventsPurged for expired event, got %v", err)
+	}
+	if events, err := collectEvents(store, "s1", "a", 0); err != nil || strings.Join(events, ",") != "e1" {
+		t.Errorf("expected e1 to be retained, got %v (%v)", events, err)
+	}
+	if got := store.sessions["s1"].bytes; got != len("e1") {
+		t.Errorf("expected byte count %d, got %d", len("e1"), got)
+	}
+}
+
+func TestEventStoreEvictsSessions(t *testing.T) {
+	store, now := newTestEventStore(1024, time.Minute)
+	appendEvents(t, store, "closed", "a", "e0")
+	appendEvents(t, store, "idle", "a", "e0")
+
+	if err := store.SessionClosed(t.Context(), "closed"); err != nil {
+		t.Fatalf("session closed failed: %v", err)
+	}
+	if _, ok := store.sessions["closed"]; ok {
+		t.Error("expected closed session to be evicted")
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if err := store.Open(t.Context(), "active", "a"); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if _, ok := store.sessions["idle"]; ok {
+		t.Error("expected idle session to be evicted")
+	}
+	if _, ok := store.sessions["active"]; !ok {
+		t.Error("expected opened session to be retained")
+	}
+}
+
+func TestStreamableHTTPResumesDroppedStream(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP})
+
+	// A tool that reports progress, then finishes after the client has dropped
+	release := make(chan struct{})
+	mcp.AddTool(fs.mcpServer, &mcp.Tool{Name: "slow"}, func(
+		ctx context.Context, req *mcp.CallToolRequest, _ struct{},
+	) (*mcp.CallToolResult, any, error) {
+		err := req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+			ProgressToken: req.Params.GetProgressToken(),
+			Message:       "started",
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		<-release
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "finished"}}}, nil, nil
+	})
+
+	httpServer := httptest.NewServer(fs.streamableHTTPMux())
+	defer httpServer.Close()
+	endpoint := httpServer.URL + "/mcp"
+
+	resp := postMessage(t, endpoint, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":`+
+		`{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test-client","version":"1.0.0"}}}`)
+	sessionID := resp.Header.Get("Mcp-Session-Id")
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if sessionID == "" {
+		t.Fatal("expected a session ID")
+	}
+	resp = postMessage(t, endpoint, sessionID, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	resp.Body.Close()
+
+	// Read the progress notification, then drop the stream
+	resp = postMessage(t, endpoint, sessionID, `{"jsonrpc":"2.0","id":2,"method":"tools/call",`+
+		`"params":{"name":"slow","arguments":{},"_meta":{"progressToken":"p1"}}}`)
+	events := bufio.NewScanner(resp.Body)
+	lastEventID, data := nextEvent(t, events)
+	resp.Body.Close()
+	if lastEventID == "" || !strings.Contains(data, "notifications/progress") {
+		t.Fatalf("expected progress event with an ID, got id=%q data=%s", lastEventID, data)
+	}
+	close(release)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	req.Header.Set("Last-Event-ID", lastEventID)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("resume request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected resume to succeed, got status %d", resp.StatusCode)
+	}
+
+	if _, data := nextEvent(t, bufio.NewScanner(resp.Body)); !strings.Contains(data, `"id":2`) ||
+		!strings.Contains(data, "finished") {
+		t.Errorf("expected the tool result to be replayed, got %s", data)
+	}
+}
+
+// postMessage POSTs a JSON-RPC message to a streamable HTTP endpoint
+func postMessage(t *testing.T, endpoint, sessionID, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		resp.Body.Close()
+		t.Fatalf("unexpected status %d for %s", resp.StatusCode, body)
+	}
+	return resp
+}
+
+// nextEvent reads the ID and data of the next server-sent event
+func nextEvent(t *testing.T, scanner *bufio.Scanner) (id, data string) {
+	t.Helper()
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" && data != "" {
+			return id, data
+		}
+		if value, ok := strings.CutPrefix(line, "id: "); ok {
+			id = value
+		}
+		if value, ok := strings.CutPrefix(line, "data: "); ok {
+			data += value
+		}
+	}
+	t.Fatalf("stream ended before an event was received: %v", scanner.Err())
+	return "", ""
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/stackloklabs/gofetch/pkg/processor"
+)
+
+// maxConvertHTMLBytes bounds the HTML a single html_to_markdown call may convert
+const maxConvertHTMLBytes = 5 << 20
+
+// HTMLToMarkdownParams defines the input parameters for the html_to_markdown tool
+type HTMLToMarkdownParams struct {
+	HTML       string `json:"html" mcp:"HTML to convert (at most 5 MiB)"`
+	BaseURL    string `json:"base_url,omitempty" mcp:"Absolute URL the HTML came from, used to resolve relative links"`
+	MaxLength  *int   `json:"max_length,omitempty" mcp:"Maximum number of characters to return"`
+	StartIndex *int   `json:"start_index,omitempty" mcp:"Start index for truncated content"`
+}
+
+// HTMLToMarkdownOutput is the structured result of the html_to_markdown tool.
+// It describes which part of the converted content was returned, like
+// FetchOutput does for fetched pages.
+type HTMLToMarkdownOutput struct {
+	BaseURL        string `json:"base_url,omitempty"`
+	StartIndex     int    `json:"start_index"`
+	TotalLength    int    `json:"total_length"`
+	ReturnedLength int    `json:"returned_length"`
+	Truncated      bool   `json:"truncated"`
+	NextStartIndex int    `json:"next_start_index,omitempty"`
+	// OutOfRange reports that start_index was past the end of the content
+	OutOfRange bool `json:"out_of_range"`
+	// MaxLength is the limit actually applied, after defaults and clamping
+	MaxLength               int  `json:"max_length,omitempty"`
+	DefaultMaxLengthApplied bool `json:"default_max_length_applied"`
+	MaxLengthClamped        bool `json:"max_length_clamped"`
+	// Degraded reports that conversion failed part way, and Warning says how
+	Degraded bool   `json:"degraded"`
+	Warning  string `json:"warning,omitempty"`
+}
+
+// handleHTMLToMarkdownTool processes html_to_markdown tool requests. The HTML
+// goes through the same pipeline as fetched pages, without any network access
+// or robots.txt check.
+func (fs *FetchServer) handleHTMLToMarkdownTool(
+	_ context.Context,
+	_ *mcp.CallToolRequest,
+	params HTMLToMarkdownParams,
+) (*mcp.CallToolResult, *HTMLToMarkdownOutput, error) {
+	if params.HTML == "" {
+		return nil, nil, errors.New("html must not be empty")
+	}
+	if len(params.HTML) > maxConvertHTMLBytes {
+		return nil, nil, fmt.Errorf("html too large: %d bytes given, at most %d allowed", len(params.HTML), maxConvertHTMLBytes)
+	}
+	if params.BaseURL != "" {
+		if parsed, err := url.Parse(params.BaseURL); err != nil || !parsed.IsAbs() {
+			return nil, nil, fmt.Errorf("invalid base_url %q: must be an absolute URL", params.BaseURL)
+		}
+	}
+
+	if err := processor.ValidatePage(params.StartIndex, params.MaxLength); err != nil {
+		return nil, nil, err
+	}
+
+	maxLength, defaulted, clamped := fs.effectiveMaxLength(params.MaxLength)
+
+	markdown, warning := fs.processor.ProcessHTML(params.HTML, params.BaseURL)
+	if warning != "" {
+		log.Printf("Conversion degraded (source=html_to_markdown): %s", warning)
+	}
+	content, page := fs.processor.FormatContent(markdown, params.StartIndex, maxLength)
+	log.Printf("Converted %d bytes of HTML (source=html_to_markdown), returning %d characters",
+		len(params.HTML), page.Returned)
+
+	output := &HTMLToMarkdownOutput{
+		BaseURL:                 params.BaseURL,
+		StartIndex:              page.StartIndex,
+		TotalLength:             page.TotalLength,
+		ReturnedLength:          page.Returned,
+		Truncated:               page.Truncated,
+		OutOfRange:              page.OutOfRange,
+		DefaultMaxLengthApplied: defaulted,
+		MaxLengthClamped:        clamped,
+		Degraded:                warning != "",
+		Warning:                 warning,
+	}
+	if page.Truncated {
+		output.NextStartIndex = page.NextIndex
+	}
+	if maxLength != nil {
+		output.MaxLength = *maxLength
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: content}},
+	}, output, nil
+}
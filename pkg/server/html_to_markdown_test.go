@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+func TestHTMLToMarkdownTool(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP})
+	session := connectTestClient(t, fs)
+
+	page := "<html><head><title>Quarterly update</title></head><body><article><p>Readability needs a reasonable " +
+		"amount of text before it treats a block as the main article, so this paragraph links to " +
+		`<a href="/reports/q3">the full report</a> and keeps going with ordinary prose.</p></article></body></html>`
+	result, err := session.CallTool(t.Context(), &mcp.CallToolParams{
+		Name:      "html_to_markdown",
+		Arguments: map[string]any{"html": page, "base_url": "https://example.com/news/", "max_length": 1000},
+	})
+	if err != nil {
+		t.Fatalf("tool call failed: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+
+	text := result.Content[0].(*mcp.TextContent).Text
+	for _, want := range []string{
+		"# Quarterly update",
+		"> Source: https://example.com/news/",
+		"[the full report](https://example.com/reports/q3)",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in converted content, got %q", want, text)
+		}
+	}
+
+	data, err := json.Marshal(result.StructuredContent)
+	if err != nil {
+		t.Fatalf("failed to marshal structured content: %v", err)
+	}
+	var output HTMLToMarkdownOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		t.Fatalf("invalid structured content %s: %v", data, err)
+	}
+	if output.Truncated || output.ReturnedLength != output.TotalLength || output.MaxLength != 1000 {
+		t.Errorf("unexpected page description: %s", data)
+	}
+}
+
+func TestHTMLToMarkdownToolWithoutReadability(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP, DisableReadability: true})
+	session := connectTestClient(t, fs)
+
+	tools, err := session.ListTools(t.Context(), nil)
+	if err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+	for _, tool := range tools.Tools {
+		switch tool.Name {
+		case "fetch":
+			if !strings.Contains(tool.Description, "does not extract their main content") {
+				t.Errorf("expected the fetch description to mention whole-page conversion, got %q", tool.Description)
+			}
+		case "html_to_markdown":
+			if strings.Contains(tool.Description, "readability") {
+				t.Errorf("expected the html_to_markdown description not to promise readability, got %q", tool.Description)
+			}
+		}
+	}
+
+	page := "<html><body><nav>Site menu</nav><article><p>Readability needs a reasonable amount of text before it " +
+		"treats a block as the main article, so this paragraph keeps going with ordinary prose.</p></article></body></html>"
+	result, err := session.CallTool(t.Context(), &mcp.CallToolParams{
+		Name:      "html_to_markdown",
+		Arguments: map[string]any{"html": page},
+	})
+	if err != nil {
+		t.Fatalf("tool call failed: %v", err)
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "Site menu") {
+		t.Errorf("expected the whole page to be converted, got %q", text)
+	}
+}
+
+func TestHTMLToMarkdownToolRejectsInvalidInput(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP})
+
+	tests := []struct {
+		name        string
+		params      HTMLToMarkdownParams
+		expectedErr string
+	}{
+		{
+			name:        "empty html",
+			params:      HTMLToMarkdownParams{},
+			expectedErr: "html must not be empty",
+		},
+		{
+			name:        "html too large",
+			params:      HTMLToMarkdownParams{HTML: strings.Repeat("a", maxConvertHTMLBytes+1)},
+			expectedErr: "html too large",
+		},
+		{
+			name:        "relative base url",
+			params:      HTMLToMarkdownParams{HTML: "<p>hi</p>", BaseURL: "/news/"},
+			expectedErr: "invalid base_url",
+		},
+		{
+			name:        "negative start index",
+			params:      HTMLToMarkdownParams{HTML: "<p>hi</p>", StartIndex: intPtr(-1)},
+			expectedErr: "invalid start_index -1",
+		},
+		{
+			name:        "negative max length",
+			params:      HTMLToMarkdownParams{HTML: "<p>hi</p>", MaxLength: intPtr(-1)},
+			expectedErr: "invalid max_length -1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := fs.handleHTMLToMarkdownTool(t.Context(), nil, tt.params)
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Errorf("expected error containing %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestHTMLToMarkdownToolAppliesMaxLength(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP, MaxMaxLength: 10})
+
+	_, output, err := fs.handleHTMLToMarkdownTool(t.Context(), nil, HTMLToMarkdownParams{
+		HTML: "<p>" + strings.Repeat("word ", 20) + "</p>",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !output.Truncated || output.ReturnedLength != 10 || output.NextStartIndex != 10 || !output.DefaultMaxLengthApplied {
+		t.Errorf("expected the ceiling to apply, got %+v", output)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// logMCPRequests is receiving middleware that logs every MCP request and
+// notification the server handles: the method (with the tool name for
+// tools/call), the session and client it came from, how long it took and,
+// when it failed, the class of error. Handlers therefore need no logging of
+// their own to be observable.
+func logMCPRequests(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		start := time.Now()
+		result, err := next(ctx, method, req)
+		duration := time.Since(start)
+
+		name := method
+		if params, ok := req.GetParams().(*mcp.CallToolParamsRaw); ok && params != nil {
+			name += " " + params.Name
+		}
+		sessionID, client := requestIdentity(req)
+
+		if class := errorClass(ctx, result, err); class != "" {
+			log.Printf("MCP %s (session=%s client=%q) failed in %s: class=%s", name, sessionID, client, duration, class)
+		} else {
+			log.Printf("MCP %s (session=%s client=%q) completed in %s", name, sessionID, client, duration)
+		}
+		return result, err
+	}
+}
+
+// errorClass classifies the outcome of an MCP request, returning an empty
+// string for success. Tool failures are reported to clients as results with
+// IsError set rather than as protocol errors, so they get their own class.
+// A request cancelled by its client is classed canceled whatever its handler
+// returned: the client stopped waiting, so it is not a failure of the server
+// and must not be mistaken for one.
+func errorClass(ctx context.Context, result mcp.Result, err error) string {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return "canceled"
+	}
+	if err == nil {
+		if toolResult, ok := result.(*mcp.CallToolResult); ok && toolResult != nil && toolResult.IsError {
+			return "tool_error"
+		}
+		return ""
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "deadline_exceeded"
+	}
+
+	var wireErr *jsonrpc.Error
+	if errors.As(err, &wireErr) {
+		switch wireErr.Code {
+		case jsonrpc.CodeParseError:
+			return "parse_error"
+		case jsonrpc.CodeInvalidRequest:
+			return "invalid_request"
+		case jsonrpc.CodeMethodNotFound:
+			return "method_not_found"
+		case jsonrpc.CodeInvalidParams:
+			return "invalid_params"
+		case jsonrpc.CodeInternalError:
+			return "internal_error"
+		}
+	}
+	return "other"
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+func TestLogMCPRequestsCoversEveryMethod(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP})
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	session := connectTestClient(t, fs)
+	if _, err := session.ListTools(t.Context(), nil); err != nil {
+		t.Fatalf("list tools failed: %v", err)
+	}
+	if err := session.Ping(t.Context(), nil); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	// An invalid URL makes the tool fail without touching the network
+	if _, err := session.CallTool(t.Context(), &mcp.CallToolParams{
+		Name:      "fetch",
+		Arguments: map[string]any{"url": "://invalid"},
+	}); err != nil {
+		t.Fatalf("tool call failed: %v", err)
+	}
+
+	logs := buf.String()
+	for _, want := range []string{
+		"MCP initialize (session=",
+		fmt.Sprintf("MCP tools/list (session=%s client=%q) completed in", session.ID(), "test-client"),
+		fmt.Sprintf("MCP ping (session=%s client=%q) completed in", session.ID(), "test-client"),
+		"MCP tools/call fetch (session=" + session.ID(),
+		"class=tool_error",
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("expected %q in logs:\n%s", want, logs)
+		}
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name     string
+		canceled bool
+		result   mcp.Result
+		err      error
+		expected string
+	}{
+		{name: "success", result: &mcp.CallToolResult{}},
+		{name: "tool error", result: &mcp.CallToolResult{IsError: true}, expected: "tool_error"},
+		{name: "canceled", err: fmt.Errorf("wrapped: %w", context.Canceled), expected: "canceled"},
+		{name: "deadline", err: context.DeadlineExceeded, expected: "deadline_exceeded"},
+		{name: "client abort", canceled: true, result: &mcp.CallToolResult{IsError: true}, expected: "canceled"},
+		{name: "client abort after success", canceled: true, result: &mcp.CallToolResult{}, expected: "canceled"},
+		{name: "invalid params", err: &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams}, expected: "invalid_params"},
+		{name: "method not found", err: &jsonrpc.Error{Code: jsonrpc.CodeMethodNotFound}, expected: "method_not_found"},
+		{name: "other", err: errors.New("boom"), expected: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(t.Context())
+			if tt.canceled {
+				cancel()
+			}
+			defer cancel()
+			if got := errorClass(ctx, tt.result, tt.err); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
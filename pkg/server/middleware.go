@@ -0,0 +1,60 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before delegating
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records an implicit 200 status before delegating
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer so http.ResponseController can flush
+// streaming responses through the wrapper
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// logRequests wraps the transport mux and logs each HTTP request once it
+// completes. Requests are identified by the matched route pattern rather than
+// the raw path, and long-lived SSE streams are logged when the connection closes.
+func logRequests(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		mux.ServeHTTP(recorder, r)
+
+		// ServeMux sets the matched pattern on the request during routing
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		//nolint:gosec // Method is a validated HTTP token and route is a registered mux pattern
+		log.Printf("HTTP %s %s %d %s", r.Method, route, status, time.Since(start))
+	})
+}
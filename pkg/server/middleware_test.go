@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogRequestsUsesRoutePattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp/", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	server := httptest.NewServer(logRequests(mux))
+	defer server.Close()
+
+	for _, path := range []string{"/mcp/session-abc", "/unknown"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("request to %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+
+	logs := buf.String()
+	for _, want := range []string{"HTTP GET /mcp/ 202", "HTTP GET unmatched 404"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("expected %q in logs:\n%s", want, logs)
+		}
+	}
+	if strings.Contains(logs, "session-abc") {
+		t.Errorf("expected raw path not to be logged:\n%s", logs)
+	}
+}
+
+func TestStatusRecorderSupportsFlush(t *testing.T) {
+	recorder := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+
+	if err := http.NewResponseController(recorder).Flush(); err != nil {
+		t.Errorf("expected flush through the wrapper to succeed, got %v", err)
+	}
+}
+
+func TestStatusRecorderImplicitOK(t *testing.T) {
+	recorder := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+
+	recorder.Write([]byte("body"))
+	recorder.WriteHeader(http.StatusTeapot)
+
+	if recorder.status != http.StatusOK {
+		t.Errorf("expected status 200 after implicit write, got %d", recorder.status)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// overloadRetryAfter is the retry hint given to refused tool calls and sessions
+const overloadRetryAfter = 5 * time.Second
+
+// overloadDetector refuses new work while the server is saturated, so
+// clients are told to back off at once instead of queueing until their
+// requests time out. The server is overloaded while maxInFlight fetches are
+// running, or while a fetch has been queued behind the per-host connection
+// limit for longer than maxQueueWait. A zero threshold is not checked.
+type overloadDetector struct {
+	maxInFlight  int
+	maxQueueWait time.Duration
+	// queueWait reports how long the longest queued fetch has waited
+	queueWait func() time.Duration
+
+	mu         sync.Mutex
+	inFlight   int
+	overloaded bool
+}
+
+// newOverloadDetector creates a detector for the given thresholds
+func newOverloadDetector(maxInFlight int, maxQueueWait time.Duration, queueWait func() time.Duration) *overloadDetector {
+	return &overloadDetector{maxInFlight: maxInFlight, maxQueueWait: maxQueueWait, queueWait: queueWait}
+}
+
+// enter admits a fetch unless the server is overloaded, in which case it
+// returns why. Every admitted fetch must be paired with a leave.
+func (d *overloadDetector) enter() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if reason := d.update(); reason != "" {
+		return fmt.Errorf("the server is overloaded (%s); retry after %s", reason, overloadRetryAfter)
+	}
+	d.inFlight++
+	return nil
+}
+
+// leave records that an admitted fetch finished
+func (d *overloadDetector) leave() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.inFlight--
+	d.update()
+}
+
+// check reports why the server is overloaded, or an empty string when it
+// is not
+func (d *overloadDetector) check() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.update()
+}
+
+// update re-evaluates the thresholds and logs when the server enters or
+// leaves the overloaded state. It must be called with d.mu held.
+func (d *overloadDetector) update() string {
+	var reason string
+	switch {
+	case d.maxInFlight > 0 && d.inFlight >= d.maxInFlight:
+		reason = fmt.Sprintf("%d fetches in progress", d.inFlight)
+	case d.maxQueueWait > 0:
+		if wait := d.queueWait(); wait > d.maxQueueWait {
+			reason = fmt.Sprintf("a fetch has been queued for %s", wait.Round(time.Millisecond))
+		}
+	}
+
+	if overloaded := reason != ""; overloaded != d.overloaded {
+		d.overloaded = overloaded
+		if overloaded {
+			log.Printf("Server overloaded, refusing new fetches and sessions: %s", reason)
+		} else {
+			log.Printf("Server no longer overloaded (%d fetches in progress)", d.inFlight)
+		}
+	}
+	return reason
+}
+
+// middleware refuses requests that would start a new MCP session with 503
+// Service Unavailable and a Retry-After header while the server is
+// overloaded. Requests of existing sessions, which carry an Mcp-Session-Id
+// header or an SSE sessionid parameter, are let through.
+func (d *overloadDetector) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		newSession := r.Header.Get("Mcp-Session-Id") == "" && r.URL.Query().Get("sessionid") == ""
+		if newSession {
+			if reason := d.check(); reason != "" {
+				log.Printf("Refused new session on %s: server overloaded (%s)", r.Pattern, reason)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(overloadRetryAfter.Seconds()))))
+				http.Error(w, "server overloaded", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
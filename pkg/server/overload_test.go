@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+func TestOverloadDetectorInFlight(t *testing.T) {
+	detector := newOverloadDetector(2, 0, nil)
+
+	for range 2 {
+		if err := detector.enter(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	err := detector.enter()
+	if err == nil || !strings.Contains(err.Error(), "2 fetches in progress") || !strings.Contains(err.Error(), "retry after 5s") {
+		t.Fatalf("expected an overload error with a retry hint, got %v", err)
+	}
+
+	detector.leave()
+	if err := detector.enter(); err != nil {
+		t.Errorf("expected a fetch to be admitted once one finished, got %v", err)
+	}
+}
+
+func TestOverloadDetectorQueueWait(t *testing.T) {
+	var wait time.Duration
+	detector := newOverloadDetector(0, time.Second, func() time.Duration { return wait })
+
+	if reason := detector.check(); reason != "" {
+		t.Fatalf("expected no overload, got %q", reason)
+	}
+	wait = 2 * time.Second
+	if reason := detector.check(); !strings.Contains(reason, "queued for 2s") {
+		t.Errorf("expected a queue wait overload, got %q", reason)
+	}
+	wait = 0
+	if reason := detector.check(); reason != "" {
+		t.Errorf("expected the overload to clear, got %q", reason)
+	}
+}
+
+// newSlowOrigin returns a server whose pages block until release is called
+func newSlowOrigin(t *testing.T) (origin *httptest.Server, release func()) {
+	t.Helper()
+	unblock := make(chan struct{})
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nAllow: /\n"))
+			return
+		}
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("done"))
+	}))
+	var once sync.Once
+	release = func() { once.Do(func() { close(unblock) }) }
+	t.Cleanup(origin.Close)
+	t.Cleanup(release)
+	return origin, release
+}
+
+// startFetches runs n fetches of url in the background and returns a
+// function waiting for them
+func startFetches(fs *FetchServer, url string, n int) (wait func()) {
+	var wg sync.WaitGroup
+	for range n {
+		wg.Go(func() {
+			fs.handleFetchTool(context.Background(), nil, FetchParams{URL: url})
+		})
+	}
+	return wg.Wait
+}
+
+// waitFor polls cond until it holds or a few seconds have passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the server to saturate")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandleFetchToolRefusesWhenOverloaded(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		saturate    int
+		saturated   func(fs *FetchServer) bool
+		expectedErr string
+	}{
+		{
+			name:     "in flight",
+			cfg:      config.Config{Transport: config.TransportStreamableHTTP, OverloadMaxInFlight: 2},
+			saturate: 2,
+			saturated: func(fs *FetchServer) bool {
+				fs.overload.mu.Lock()
+				defer fs.overload.mu.Unlock()
+				return fs.overload.inFlight == 2
+			},
+			expectedErr: "2 fetches in progress",
+		},
+		{
+			name: "queue wait",
+			cfg: config.Config{
+				Transport: config.TransportStreamableHTTP, MaxConnsPerHost: 1, OverloadQueueWait: 50 * time.Millisecond,
+			},
+			saturate: 2,
+			saturated: func(fs *FetchServer) bool {
+				return fs.fetcher.QueueWait() > 50*time.Millisecond
+			},
+			expectedErr: "a fetch has been queued for",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin, release := newSlowOrigin(t)
+			fs := newTestServer(t, tt.cfg)
+
+			wait := startFetches(fs, origin.URL, tt.saturate)
+			waitFor(t, func() bool { return tt.saturated(fs) })
+
+			start := time.Now()
+			_, _, err := fs.handleFetchTool(t.Context(), nil, FetchParams{URL: origin.URL})
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) || !strings.Contains(err.Error(), "retry after") {
+				t.Errorf("expected an overload error, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected the overloaded call to be refused at once, took %s", elapsed)
+			}
+
+			release()
+			wait()
+			if _, _, err := fs.handleFetchTool(t.Context(), nil, FetchParams{URL: origin.URL}); err != nil {
+				t.Errorf("expected fetches to be admitted once the load cleared, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOverloadRefusesNewSessions(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP, OverloadMaxInFlight: 1})
+	mux := fs.streamableHTTPMux()
+	if err := fs.overload.enter(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for a new session, got %d", recorder.Code)
+	}
+	if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != "5" {
+		t.Errorf("expected Retry-After 5, got %q", retryAfter)
+	}
+
+	// Existing sessions keep working
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.Header.Set("Mcp-Session-Id", "existing")
+	mux.ServeHTTP(recorder, req)
+	if recorder.Code == http.StatusServiceUnavailable {
+		t.Error("expected a request of an existing session to pass")
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected /healthz to keep answering, got %d", recorder.Code)
+	}
+
+	fs.overload.leave()
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+	if recorder.Code == http.StatusServiceUnavailable {
+		t.Error("expected new sessions once the load cleared")
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitWindow is the period a client's request budget refills over
+const rateLimitWindow = time.Minute
+
+// ipRateLimiter caps the requests each client IP may make per minute. Every
+// IP gets a token bucket holding up to limit requests that refills evenly
+// over rateLimitWindow, so short bursts are allowed but sustained load is not.
+type ipRateLimiter struct {
+	limit          int
+	trustedProxies []netip.Prefix
+	now            func() time.Time
+
+	mu        sync.Mutex
+	clients   map[netip.Addr]*ipBucket
+	lastSweep time.Time
+}
+
+// ipBucket is the remaining request budget of one client IP
+type ipBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newIPRateLimiter creates a limiter allowing limit requests per minute per
+// client IP. X-Forwarded-For is only believed on connections from
+// trustedProxies.
+func newIPRateLimiter(limit int, trustedProxies []netip.Prefix) *ipRateLimiter {
+	return &ipRateLimiter{
+		limit:          limit,
+		trustedProxies: trustedProxies,
+		now:            time.Now,
+		clients:        make(map[netip.Addr]*ipBucket),
+	}
+}
+
+// middleware refuses requests over the limit with 429 Too Many Requests and
+// a Retry-After header
+func (l *ipRateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := l.clientIP(r)
+		if retryAfter, ok := l.allow(ip); !ok {
+			seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+			log.Printf("Rate limited %s on %s (limit=%d/min retry_after=%ss)", ip, r.Pattern, l.limit, seconds)
+			w.Header().Set("Retry-After", seconds)
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow takes one request from ip's budget. When the budget is spent it
+// reports how long until the next request is allowed.
+func (l *ipRateLimiter) allow(ip netip.Addr) (retryAfter time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.evictIdle(now)
+
+	perToken := rateLimitWindow / time.Duration(l.limit)
+	bucket, found := l.clients[ip]
+	if !found {
+		bucket = &ipBucket{tokens: float64(l.limit), updated: now}
+		l.clients[ip] = bucket
+	}
+	bucket.tokens = min(float64(l.limit), bucket.tokens+float64(now.Sub(bucket.updated))/float64(perToken))
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) * float64(perToken)), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+// evictIdle forgets clients whose budget has fully refilled, since a fresh
+// bucket would be identical. It sweeps at most once per window so memory is
+// bounded by the clients seen in roughly the last two windows. It must be
+// called with l.mu held.
+func (l *ipRateLimiter) evictIdle(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitWindow {
+		return
+	}
+	l.lastSweep = now
+	for ip, bucket := range l.clients {
+		if now.Sub(bucket.updated) >= rateLimitWindow {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// clientIP returns the address a request is attributed to. Requests arriving
+// through a trusted proxy are attributed to the nearest untrusted address in
+// X-Forwarded-For, read from the right since clients can prepend anything.
+func (l *ipRateLimiter) clientIP(r *http.Request) netip.Addr {
+	remote := remoteAddr(r)
+	if !l.trusted(remote) {
+		return remote
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for _, entry := range slices.Backward(forwarded) {
+		addr, err := netip.ParseAddr(strings.TrimSpace(entry))
+		if err != nil {
+			break
+		}
+		addr = addr.Unmap()
+		if !l.trusted(addr) {
+			return addr
+		}
+		remote = addr
+	}
+	return remote
+}
+
+// trusted reports whether addr belongs to a trusted proxy
+func (l *ipRateLimiter) trusted(addr netip.Addr) bool {
+	for _, prefix := range l.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses proxy addresses given as single IPs or CIDR
+// ranges. The entries are validated with the configuration, so invalid ones
+// are skipped.
+func parseTrustedProxies(entries []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes
+}
+
+// remoteAddr parses the address of the connection a request arrived on
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap().WithZone("")
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+func TestIPRateLimiterAllow(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newIPRateLimiter(3, nil)
+	limiter.now = clock.Now
+
+	client := netip.MustParseAddr("192.0.2.1")
+	for i := range 3 {
+		if _, ok := limiter.allow(client); !ok {
+			t.Fatalf("request %d: expected the burst to be allowed", i)
+		}
+	}
+	retryAfter, ok := limiter.allow(client)
+	if ok || retryAfter != 20*time.Second {
+		t.Fatalf("expected a refusal with a 20s retry, got ok=%v retryAfter=%s", ok, retryAfter)
+	}
+
+	// Other clients have their own budget
+	if _, ok := limiter.allow(netip.MustParseAddr("192.0.2.2")); !ok {
+		t.Error("expected another client to be allowed")
+	}
+
+	// One request refills every 20 seconds
+	clock.Advance(20 * time.Second)
+	if _, ok := limiter.allow(client); !ok {
+		t.Error("expected a request to be allowed after the refill")
+	}
+	if _, ok := limiter.allow(client); ok {
+		t.Error("expected the refilled request to be spent")
+	}
+}
+
+func TestIPRateLimiterEvictsIdleClients(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newIPRateLimiter(10, nil)
+	limiter.now = clock.Now
+
+	for i := range 100 {
+		limiter.allow(netip.AddrFrom4([4]byte{192, 0, 2, byte(i)}))
+	}
+	clock.Advance(rateLimitWindow)
+	limiter.allow(netip.MustParseAddr("198.51.100.1"))
+
+	if n := len(limiter.clients); n != 1 {
+		t.Errorf("expected idle clients to be evicted, got %d tracked", n)
+	}
+}
+
+func TestIPRateLimiterClientIP(t *testing.T) {
+	limiter := newIPRateLimiter(1, parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.10"}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.5:4000", expected: "203.0.113.5"},
+		{
+			name:       "untrusted peer cannot forward",
+			remoteAddr: "203.0.113.5:4000",
+			forwarded:  []string{"198.51.100.7"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.1.2.3:4000",
+			forwarded:  []string{"198.51.100.7"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "spoofed entries before the proxy chain are ignored",
+			remoteAddr: "10.1.2.3:4000",
+			forwarded:  []string{"1.1.1.1, 198.51.100.7", "192.0.2.10"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "only proxies",
+			remoteAddr: "10.1.2.3:4000",
+			forwarded:  []string{"10.9.9.9"},
+			expected:   "10.9.9.9",
+		},
+		{
+			name:       "garbage stops the walk",
+			remoteAddr: "10.1.2.3:4000",
+			forwarded:  []string{"198.51.100.7, unknown"},
+			expected:   "10.1.2.3",
+		},
+		{name: "ipv4 mapped ipv6", remoteAddr: "[::ffff:203.0.113.5]:4000", expected: "203.0.113.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := limiter.clientIP(req); got.String() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitedEndpoints(t *testing.T) {
+	for _, transport := range []string{config.TransportStreamableHTTP, config.TransportSSE} {
+		t.Run(transport, func(t *testing.T) {
+			fs := newTestServer(t, config.Config{Transport: transport, RateLimit: 1})
+			mux := fs.streamableHTTPMux()
+			path := "/mcp"
+			if transport == config.TransportSSE {
+				mux = fs.sseMux()
+				path = "/messages"
+			}
+
+			send := func() *httptest.ResponseRecorder {
+				recorder := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPost, path, nil)
+				req.RemoteAddr = "203.0.113.5:4000"
+				mux.ServeHTTP(recorder, req)
+				return recorder
+			}
+
+			if status := send().Code; status == http.StatusTooManyRequests {
+				t.Fatal("expected the first request to pass the limiter")
+			}
+			recorder := send()
+			if recorder.Code != http.StatusTooManyRequests {
+				t.Fatalf("expected 429, got %d", recorder.Code)
+			}
+			if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != "60" {
+				t.Errorf("expected Retry-After 60, got %q", retryAfter)
+			}
+		})
+	}
+}
+
+func TestRateLimitDisabledByDefault(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP})
+	if fs.rateLimiter != nil {
+		t.Error("expected no rate limiter without -rate-limit")
+	}
+}
+
+func TestHealthzIsNotRateLimited(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP, RateLimit: 1, BasePath: "/tools"})
+	mux := fs.streamableHTTPMux()
+
+	for i := range 3 {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/tools/healthz", nil)
+		req.RemoteAddr = "203.0.113.5:4000"
+		mux.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK || recorder.Body.String() != "ok\n" {
+			t.Fatalf("probe %d: expected 200 ok, got %d %q", i, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Fetch results too large for one message are kept as chunks readable at
+// resultURIPrefix/{id}/{chunk}, numbered from 1
+const (
+	resultURIPrefix   = "gofetch://results/"
+	resultURITemplate = resultURIPrefix + "{id}/{chunk}"
+	// maxStoredResults bounds the results kept; the oldest is dropped first
+	maxStoredResults = 16
+)
+
+// resultStore keeps the most recent oversized fetch results, split into
+// chunks, so clients can read the parts that did not fit in the tool result
+type resultStore struct {
+	mu      sync.Mutex
+	results map[string][]string
+	// order holds result IDs from oldest to newest
+	order []string
+}
+
+// newResultStore returns an empty store
+func newResultStore() *resultStore {
+	return &resultStore{results: make(map[string][]string)}
+}
+
+// put splits content into chunks of at most chunkSize bytes and stores them,
+// returning the ID they are read with and the chunks
+func (s *resultStore) put(content string, chunkSize int) (string, []string) {
+	chunks := splitChunks(content, chunkSize)
+	id := strings.ToLower(rand.Text())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.order) == maxStoredResults {
+		delete(s.results, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.results[id] = chunks
+	s.order = append(s.order, id)
+	return id, chunks
+}
+
+// chunk returns chunk n, counted from 1, of the result with the given ID
+func (s *resultStore) chunk(id string, n int) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chunks, ok := s.results[id]
+	if !ok || n < 1 || n > len(chunks) {
+		return "", false
+	}
+	return chunks[n-1], true
+}
+
+// splitChunks splits content into chunks of at most size bytes, moving each
+// cut back so that no UTF-8 sequence is split
+func splitChunks(content string, size int) []string {
+	var chunks []string
+	for len(content) > size {
+		cut := size
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = size
+		}
+		chunks = append(chunks, content[:cut])
+		content = content[cut:]
+	}
+	return append(chunks, content)
+}
+
+// resultChunkURI returns the URI chunk n of a stored result is read from
+func resultChunkURI(id string, n int) string {
+	return fmt.Sprintf("%s%s/%d", resultURIPrefix, id, n)
+}
+
+// handleReadResult serves a chunk of a stored fetch result
+func (fs *FetchServer) handleReadResult(_ context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "gofetch" || parsed.Host != "results" {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	id, chunk, ok := strings.Cut(strings.TrimPrefix(parsed.Path, "/"), "/")
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	n, err := strconv.Atoi(chunk)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	text, ok := fs.results.chunk(id, n)
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{{URI: uri, MIMEType: "text/markdown", Text: text}},
+	}, nil
+}
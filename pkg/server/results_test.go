@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		size     int
+		expected []string
+	}{
+		{"fits", "abc", 5, []string{"abc"}},
+		{"exact multiple", "abcdef", 3, []string{"abc", "def"}},
+		{"remainder", "abcdefg", 3, []string{"abc", "def", "g"}},
+		{"cut moved before a multibyte rune", "ab€cd", 3, []string{"ab", "€", "cd"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitChunks(tt.content, tt.size)
+			if strings.Join(chunks, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("expected %q, got %q", tt.expected, chunks)
+			}
+			for _, chunk := range chunks {
+				if !utf8.ValidString(chunk) {
+					t.Errorf("chunk %q is not valid UTF-8", chunk)
+				}
+			}
+		})
+	}
+}
+
+func TestResultStoreEvictsOldest(t *testing.T) {
+	store := newResultStore()
+	first, _ := store.put("first", 10)
+	for range maxStoredResults {
+		store.put("later", 10)
+	}
+
+	if _, ok := store.chunk(first, 1); ok {
+		t.Error("expected the oldest result to be evicted")
+	}
+	if len(store.results) != maxStoredResults || len(store.order) != maxStoredResults {
+		t.Errorf("expected %d results, got %d (order %d)", maxStoredResults, len(store.results), len(store.order))
+	}
+}
+
+func TestHandleFetchToolHandsOffLargeResults(t *testing.T) {
+	page := strings.Repeat("a", 100) + strings.Repeat("b", 100) + strings.Repeat("c", 50)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(page))
+	}))
+	defer testServer.Close()
+
+	tests := []struct {
+		name     string
+		limit    int
+		handoff  bool
+		chunks   int
+		returned int
+	}{
+		{name: "disabled", limit: 0, returned: 250},
+		{name: "result fits", limit: 250, returned: 250},
+		{name: "result exceeds the limit", limit: 100, handoff: true, chunks: 3, returned: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newTestServer(t, config.Config{
+				Transport:     config.TransportStreamableHTTP,
+				IgnoreRobots:  true,
+				MaxResultSize: tt.limit,
+			})
+			session := connectTestClient(t, fs)
+
+			result, err := session.CallTool(t.Context(), &mcp.CallToolParams{
+				Name:      "fetch",
+				Arguments: map[string]any{"url": testServer.URL},
+			})
+			if err != nil {
+				t.Fatalf("tool call failed: %v", err)
+			}
+			if result.IsError {
+				t.Fatalf("unexpected tool error: %+v", result.Content)
+			}
+
+			data, err := json.Marshal(result.StructuredContent)
+			if err != nil {
+				t.Fatalf("failed to marshal structured content: %v", err)
+			}
+			var output FetchOutput
+			if err := json.Unmarshal(data, &output); err != nil {
+				t.Fatalf("invalid structured content %s: %v", data, err)
+			}
+			if output.ReturnedLength != tt.returned || output.TotalLength != len(page) {
+				t.Errorf("expected %d of %d characters returned, got %s", tt.returned, len(page), data)
+			}
+
+			text := result.Content[0].(*mcp.TextContent).Text
+			if !tt.handoff {
+				if text != page || output.ResultURI != "" || len(result.Content) != 1 {
+					t.Errorf("expected the whole result in one message, got %s", data)
+				}
+				return
+			}
+
+			if output.ResultChunks != tt.chunks || !strings.HasPrefix(output.ResultURI, resultURIPrefix) {
+				t.Errorf("expected %d chunks under %s, got %s", tt.chunks, resultURIPrefix, data)
+			}
+			if !output.Truncated || output.TruncationReason != "max_result_size" || output.NextStartIndex != 100 {
+				t.Errorf("expected the result to be truncated at 100 characters, got %s", data)
+			}
+			if !strings.HasPrefix(text, strings.Repeat("a", 100)+"\n\n[Result too large") ||
+				!strings.Contains(text, "start_index=100") {
+				t.Errorf("expected the first chunk followed by instructions, got %q", text)
+			}
+			if len(output.Warnings) != 1 || output.Warnings[0].Code != "result_split" ||
+				!strings.HasSuffix(text, "\n\n[Warnings: result_split]") {
+				t.Errorf("expected a result_split warning, got %s", data)
+			}
+			if len(result.Content) != tt.chunks {
+				t.Fatalf("expected links to the other %d chunks, got %d content items", tt.chunks-1, len(result.Content)-1)
+			}
+
+			// Reading the linked chunks reassembles the result
+			rest := ""
+			for _, item := range result.Content[1:] {
+				link, ok := item.(*mcp.ResourceLink)
+				if !ok {
+					t.Fatalf("expected a resource link, got %T", item)
+				}
+				read, err := session.ReadResource(t.Context(), &mcp.ReadResourceParams{URI: link.URI})
+				if err != nil {
+					t.Fatalf("failed to read %s: %v", link.URI, err)
+				}
+				rest += read.Contents[0].Text
+			}
+			if rest != page[100:] {
+				t.Errorf("expected the remaining chunks to hold the rest of the result, got %q", rest)
+			}
+
+			if _, err := session.ReadResource(t.Context(), &mcp.ReadResourceParams{
+				URI: output.ResultURI + "/9",
+			}); err == nil {
+				t.Error("expected reading a chunk past the end to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+// maxExplainPaths bounds how many paths a single robots_explain call may check
+const maxExplainPaths = 50
+
+// RobotsExplainParams defines the input parameters for the robots_explain tool
+type RobotsExplainParams struct {
+	Domain string   `json:"domain" mcp:"Domain or site URL whose robots.txt to evaluate, e.g. example.com"`
+	Paths  []string `json:"paths" mcp:"Paths to check, e.g. /private/page (at most 50)"`
+}
+
+// handleRobotsExplainTool processes robots_explain tool requests
+func (fs *FetchServer) handleRobotsExplainTool(
+	_ context.Context,
+	_ *mcp.CallToolRequest,
+	params RobotsExplainParams,
+) (*mcp.CallToolResult, *robots.Explanation, error) {
+	if len(params.Paths) == 0 {
+		return nil, nil, errors.New("paths must list at least one path")
+	}
+	if len(params.Paths) > maxExplainPaths {
+		return nil, nil, fmt.Errorf("too many paths: %d given, at most %d allowed", len(params.Paths), maxExplainPaths)
+	}
+
+	explanation, err := fs.robotsChecker.Explain(params.Domain, params.Paths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nil, explanation, nil
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/config"
+	"github.com/stackloklabs/gofetch/pkg/robots"
+)
+
+func TestRobotsExplainTool(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+	}))
+	defer site.Close()
+
+	fs := newTestServer(t, config.Config{UserAgent: "test-agent", Transport: config.TransportStreamableHTTP})
+	session := connectTestClient(t, fs)
+
+	result, err := session.CallTool(t.Context(), &mcp.CallToolParams{
+		Name:      "robots_explain",
+		Arguments: map[string]any{"domain": site.URL, "paths": []string{"/", "/private/x"}},
+	})
+	if err != nil {
+		t.Fatalf("tool call failed: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+
+	data, err := json.Marshal(result.StructuredContent)
+	if err != nil {
+		t.Fatalf("failed to marshal structured content: %v", err)
+	}
+	var explanation robots.Explanation
+	if err := json.Unmarshal(data, &explanation); err != nil {
+		t.Fatalf("invalid structured content %s: %v", data, err)
+	}
+
+	if len(explanation.Paths) != 2 || !explanation.Paths[0].Allowed || explanation.Paths[1].Allowed {
+		t.Errorf("unexpected decisions: %s", data)
+	}
+	if rule := explanation.Paths[1].Rule; rule == nil || rule.Text != "Disallow: /private/" || rule.Group != "*" {
+		t.Errorf("expected the matching rule to be reported, got %s", data)
+	}
+}
+
+func TestRobotsExplainToolTooManyPaths(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP})
+
+	paths := make([]string, maxExplainPaths+1)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/page/%d", i)
+	}
+
+	_, _, err := fs.handleRobotsExplainTool(t.Context(), nil, RobotsExplainParams{Domain: "example.com", Paths: paths})
+	if err == nil || !strings.Contains(err.Error(), "too many paths") {
+		t.Errorf("expected too many paths error, got %v", err)
+	}
+
+	_, _, err = fs.handleRobotsExplainTool(t.Context(), nil, RobotsExplainParams{Domain: "example.com"})
+	if err == nil || !strings.Contains(err.Error(), "at least one path") {
+		t.Errorf("expected missing paths error, got %v", err)
+	}
+}
+
+func TestRobotsUserAgent(t *testing.T) {
+	var pageAgent string
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: CompanyBot\nDisallow: /private/\n"))
+			return
+		}
+		pageAgent = r.UserAgent()
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("public"))
+	}))
+	defer site.Close()
+
+	fs := newTestServer(t, config.Config{
+		UserAgent:       "Mozilla/5.0 (X11; Linux x86_64)",
+		RobotsUserAgent: "CompanyBot/1.0",
+		Transport:       config.TransportStreamableHTTP,
+	})
+
+	if _, _, err := fs.Fetch(t.Context(), FetchParams{URL: site.URL + "/public"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pageAgent != "Mozilla/5.0 (X11; Linux x86_64)" {
+		t.Errorf("expected the page requested with the user agent, got %q", pageAgent)
+	}
+	if _, _, err := fs.Fetch(t.Context(), FetchParams{URL: site.URL + "/private/page"}); err == nil {
+		t.Error("expected the robots user agent's group to block the fetch")
+	}
+
+	explanation, err := fs.robotsChecker.Explain(site.URL, []string{"/private/page"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if explanation.UserAgent != "Mozilla/5.0 (X11; Linux x86_64)" || explanation.RobotsUserAgent != "CompanyBot/1.0" {
+		t.Errorf("expected both user agents reported, got %q and %q", explanation.UserAgent, explanation.RobotsUserAgent)
+	}
+	if explanation.Paths[0].Allowed {
+		t.Errorf("expected the path disallowed for the robots user agent, got %+v", explanation.Paths[0])
+	}
+}
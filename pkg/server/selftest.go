@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+// Statuses of a self-test check
+const (
+	selfTestPass = "pass"
+	selfTestFail = "fail"
+	selfTestSkip = "skip"
+)
+
+// SelfTestReport is the result of SelfTest, printed as JSON by -self-test
+type SelfTestReport struct {
+	// OK reports that no check failed
+	OK         bool            `json:"ok"`
+	Checks     []SelfTestCheck `json:"checks"`
+	DurationMS int64           `json:"duration_ms"`
+}
+
+// SelfTestCheck is the result of one check of a self-test
+type SelfTestCheck struct {
+	// Name is config, server, listener or canary
+	Name string `json:"name"`
+	// Status is pass, fail or skip
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// SelfTest checks that a server can run with cfg without serving: the
+// configuration is validated, the server is built, its port is bound and
+// released, and cfg.SelfTestURL, when set, is fetched as the fetch tool
+// would, under every fetch policy. A check that cannot run because an
+// earlier one failed is skipped.
+func SelfTest(ctx context.Context, cfg config.Config) *SelfTestReport {
+	start := time.Now()
+	report := &SelfTestReport{OK: true}
+	// blocked says why the remaining checks cannot run
+	var blocked string
+	skip := func(name, detail string) {
+		report.Checks = append(report.Checks, SelfTestCheck{Name: name, Status: selfTestSkip, Detail: detail})
+	}
+	check := func(name string, run func() (string, error)) {
+		if blocked != "" {
+			skip(name, blocked)
+			return
+		}
+		checkStart := time.Now()
+		detail, err := run()
+		result := SelfTestCheck{Name: name, Status: selfTestPass, Detail: detail,
+			DurationMS: time.Since(checkStart).Milliseconds()}
+		if err != nil {
+			result.Status, result.Detail = selfTestFail, err.Error()
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	check("config", func() (string, error) {
+		if err := cfg.WithDefaults().Validate(); err != nil {
+			blocked = "the configuration is invalid"
+			return "", err
+		}
+		return "", nil
+	})
+
+	var fs *FetchServer
+	check("server", func() (string, error) {
+		var err error
+		if fs, err = NewFetchServer(cfg); err != nil {
+			blocked = "the server could not be built"
+			return "", err
+		}
+		return "", nil
+	})
+
+	check("listener", func() (string, error) {
+		listener, err := net.Listen("tcp", ":"+strconv.Itoa(fs.config.Port))
+		if err != nil {
+			return "", err
+		}
+		address := listener.Addr().String()
+		if err := listener.Close(); err != nil {
+			return "", err
+		}
+		return "bound and released " + address, nil
+	})
+
+	if cfg.SelfTestURL == "" && blocked == "" {
+		skip("canary", "no -self-test-url given")
+	} else {
+		check("canary", func() (string, error) {
+			content, output, err := fs.Fetch(ctx, FetchParams{URL: cfg.SelfTestURL})
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("HTTP %d, %d characters of %s", output.StatusCode, len(content), output.ContentType), nil
+		})
+	}
+
+	report.DurationMS = time.Since(start).Milliseconds()
+	return report
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+func TestSelfTest(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("canary"))
+	}))
+	defer site.Close()
+
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	valid := config.Config{Transport: config.TransportStreamableHTTP}
+	tests := []struct {
+		name   string
+		modify func(*config.Config)
+		ok     bool
+		// statuses of the config, server, listener and canary checks
+		statuses [4]string
+		detail   string
+	}{
+		{
+			name:     "canary fetched",
+			modify:   func(c *config.Config) { c.SelfTestURL = site.URL + "/page" },
+			ok:       true,
+			statuses: [4]string{selfTestPass, selfTestPass, selfTestPass, selfTestPass},
+			detail:   "HTTP 200, 6 characters of text/plain",
+		},
+		{
+			name:     "no canary",
+			modify:   func(c *config.Config) {},
+			ok:       true,
+			statuses: [4]string{selfTestPass, selfTestPass, selfTestPass, selfTestSkip},
+			detail:   "no -self-test-url given",
+		},
+		{
+			name:     "canary refused by robots.txt",
+			modify:   func(c *config.Config) { c.SelfTestURL = site.URL + "/private" },
+			statuses: [4]string{selfTestPass, selfTestPass, selfTestPass, selfTestFail},
+			detail:   "robots.txt",
+		},
+		{
+			name: "canary refused by content type policy",
+			modify: func(c *config.Config) {
+				c.SelfTestURL = site.URL + "/page"
+				c.AllowedContentTypes = []string{"text/html"}
+			},
+			statuses: [4]string{selfTestPass, selfTestPass, selfTestPass, selfTestFail},
+			detail:   "text/plain",
+		},
+		{
+			name:     "port in use",
+			modify:   func(c *config.Config) { c.Port = busyPort },
+			statuses: [4]string{selfTestPass, selfTestPass, selfTestFail, selfTestSkip},
+			detail:   "no -self-test-url given",
+		},
+		{
+			name: "invalid configuration",
+			modify: func(c *config.Config) {
+				c.Port = -1
+				c.SelfTestURL = site.URL + "/page"
+			},
+			statuses: [4]string{selfTestFail, selfTestSkip, selfTestSkip, selfTestSkip},
+			detail:   "the configuration is invalid",
+		},
+		{
+			name: "server cannot be built",
+			modify: func(c *config.Config) {
+				c.HostProfilesFile = t.TempDir() + "/missing.json"
+			},
+			statuses: [4]string{selfTestPass, selfTestFail, selfTestSkip, selfTestSkip},
+			detail:   "the server could not be built",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			report := SelfTest(t.Context(), cfg)
+
+			if report.OK != tt.ok {
+				t.Errorf("expected ok %t, got %+v", tt.ok, report)
+			}
+			if len(report.Checks) != 4 {
+				t.Fatalf("expected 4 checks, got %+v", report.Checks)
+			}
+			for i, name := range []string{"config", "server", "listener", "canary"} {
+				check := report.Checks[i]
+				if check.Name != name || check.Status != tt.statuses[i] {
+					t.Errorf("expected %s to %s, got %+v", name, tt.statuses[i], check)
+				}
+			}
+			if last := report.Checks[3]; !strings.Contains(last.Detail, tt.detail) {
+				t.Errorf("expected the canary detail to mention %q, got %q", tt.detail, last.Detail)
+			}
+		})
+	}
+
+}
@@ -3,90 +3,246 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/stackloklabs/gofetch/pkg/config"
 	"github.com/stackloklabs/gofetch/pkg/fetcher"
 	"github.com/stackloklabs/gofetch/pkg/processor"
+	"github.com/stackloklabs/gofetch/pkg/redact"
 	"github.com/stackloklabs/gofetch/pkg/robots"
 )
 
+// minReportedQueueWait is the shortest wait for the host reported in
+// FetchOutput; shorter waits are not worth a client's attention
+const minReportedQueueWait = 250 * time.Millisecond
+
 // FetchParams defines the input parameters for the fetch tool
 type FetchParams struct {
-	URL        string `json:"url" mcp:"URL to fetch"`
-	MaxLength  *int   `json:"max_length,omitempty" mcp:"Maximum number of characters to return"`
-	StartIndex *int   `json:"start_index,omitempty" mcp:"Start index for truncated content"`
-	Raw        bool   `json:"raw,omitempty" mcp:"Get the actual HTML content without simplification"`
+	URL             string `json:"url" mcp:"URL to fetch"`
+	MaxLength       *int   `json:"max_length,omitempty" mcp:"Maximum number of characters to return"`
+	StartIndex      *int   `json:"start_index,omitempty" mcp:"Start index for truncated content"`
+	Raw             bool   `json:"raw,omitempty" mcp:"Get the actual HTML content without simplification"`
+	ExpectedContent string `json:"expected_content,omitempty" mcp:"Expected content: html (default), json, text, markdown or any"`
+	MaxBytes        *int   `json:"max_bytes,omitempty" mcp:"Maximum number of response body bytes to download"`
+	Strict          bool   `json:"strict,omitempty" mcp:"Fail instead of returning degraded content when processing fails"`
+	ConvertRST      bool   `json:"convert_rst,omitempty" mcp:"Convert reStructuredText documents to markdown"`
+	IfNoneMatch     string `json:"if_none_match,omitempty" mcp:"ETag of a cached copy; the content is only returned if it changed"`
+	IfModifiedSince string `json:"if_modified_since,omitempty" mcp:"HTTP date of a cached copy, e.g. Mon, 02 Jan 2006 15:04:05 GMT"`
 }
 
 // FetchServer represents the MCP server for fetching web content
 type FetchServer struct {
-	config    config.Config
-	fetcher   *fetcher.HTTPFetcher
+	config        config.Config
+	fetcher       *fetcher.HTTPFetcher
+	robotsChecker *robots.Checker
+	processor     *processor.ContentProcessor
+	// profiles is nil when no -host-profiles file is set
+	profiles  *fetcher.HostProfiles
 	mcpServer *mcp.Server
+	sessions  *sessionReaper
+	// rateLimiter is nil when HTTP requests are not rate limited
+	rateLimiter *ipRateLimiter
+	// overload is nil when no overload thresholds are configured
+	overload *overloadDetector
+	// results is nil when results are sent whole
+	results *resultStore
+	usage   *sessionUsage
+	// tools and resources name what is registered, for the capabilities
+	// and the startup log
+	tools     []string
+	resources []string
+
+	mu         sync.Mutex
+	httpServer *http.Server
+	// shuttingDown is set by Shutdown, so a server it beat to starting
+	// never serves
+	shuttingDown bool
 }
 
-// NewFetchServer creates a new fetch server instance
-func NewFetchServer(cfg config.Config) *FetchServer {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+// newResolver returns the resolver fetches look hosts up with, or nil for
+// the system's. DNS over HTTPS queries go through the proxy when one is set,
+// so that -require-proxy still holds, and resolve the endpoint's own host
+// with the system's resolvers.
+func newResolver(cfg config.Config, proxyURL *url.URL) *net.Resolver {
+	switch {
+	case cfg.DNSServer != "":
+		return fetcher.NewResolver(cfg.DNSServer)
+	case cfg.DNSOverHTTPS != "":
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if proxyURL != nil {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+		return fetcher.NewDoHResolver(cfg.DNSOverHTTPS, &http.Client{Transport: transport})
+	default:
+		return nil
 	}
+}
+
+// NewFetchServer creates a new fetch server instance after validating cfg
+func NewFetchServer(cfg config.Config) (*FetchServer, error) {
+	cfg = cfg.WithDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
 
 	// Configure proxy if provided
+	var proxyURLParsed *url.URL
 	if cfg.ProxyURL != "" {
-		if proxyURLParsed, err := url.Parse(cfg.ProxyURL); err == nil {
-			client.Transport = &http.Transport{
-				Proxy: http.ProxyURL(proxyURLParsed),
-			}
+		var err error
+		proxyURLParsed, err = url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURLParsed)
+	} else {
+		// Align the connection pool with the fetcher's per-host limit. Behind a
+		// proxy every plain HTTP fetch shares the proxy connection, so the
+		// limit is left to the fetcher there.
+		transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}
+
+	// Bind the dialer first; the dial policies below wrap it
+	if cfg.SourceAddress != "" {
+		if err := fetcher.BindSourceAddress(transport, netip.MustParseAddr(cfg.SourceAddress)); err != nil {
+			return nil, err
 		}
 	}
 
+	// Cloud metadata services are refused unless explicitly allowed. The
+	// guard resolves hosts itself, so it takes any configured resolver.
+	resolver := newResolver(cfg, proxyURLParsed)
+	var roundTripper http.RoundTripper = transport
+	switch {
+	case !cfg.AllowMetadataEndpoints && resolver != nil:
+		roundTripper = fetcher.GuardMetadataEndpointsWithResolver(transport, resolver)
+	case !cfg.AllowMetadataEndpoints:
+		roundTripper = fetcher.GuardMetadataEndpoints(transport)
+	case resolver != nil:
+		fetcher.ResolveWith(transport, resolver)
+	}
+
+	// Every response, redirects and robots.txt lookups included, passes the
+	// header limits
+	roundTripper = fetcher.LimitResponseHeaders(transport, roundTripper,
+		fetcher.HeaderLimits{MaxBytes: cfg.MaxResponseHeaderBytes, MaxCount: cfg.MaxResponseHeaders})
+
+	// Refuse direct connections last so the other dial policies still apply
+	// to the connection to the proxy
+	if cfg.RequireProxy {
+		fetcher.RequireProxy(transport, proxyURLParsed)
+	}
+
+	// Create HTTP client with timeout
+	client := &http.Client{
+		Transport: roundTripper,
+		Timeout:   cfg.FetchTimeout,
+	}
+
+	// robots.txt lookups share the transport but have their own, shorter timeout
+	robotsClient := &http.Client{
+		Transport: client.Transport,
+		Timeout:   cfg.RobotsTimeout,
+	}
+
+	var profiles *fetcher.HostProfiles
+	if cfg.HostProfilesFile != "" {
+		loaded, err := fetcher.LoadHostProfiles(cfg.HostProfilesFile)
+		if err != nil {
+			return nil, err
+		}
+		profiles = loaded
+	}
+
+	processingRules, err := fetcher.ParseProcessingRules(cfg.ContentProcessors)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -content-processors: %w", err)
+	}
+
 	// Create components
-	robotsChecker := robots.NewChecker(cfg.UserAgent, cfg.IgnoreRobots, client)
-	contentProcessor := processor.NewContentProcessor()
-	httpFetcher := fetcher.NewHTTPFetcher(client, robotsChecker, contentProcessor, cfg.UserAgent)
+	robotsChecker := robots.NewChecker(cfg.UserAgent, cfg.RobotsUserAgent, cfg.IgnoreRobots, cfg.RespectRobotsMeta, robotsClient)
+	contentProcessor := processor.NewContentProcessor(processor.Options{
+		DisableTitleHeader: cfg.DisableTitleHeader,
+		DisableReadability: cfg.DisableReadability,
+		AllowInlineHTML:    cfg.AllowInlineHTML,
+	})
+	fetcherOptions := []fetcher.Option{
+		fetcher.WithHTTPClient(client),
+		fetcher.WithRobots(robotsChecker),
+		fetcher.WithProcessor(contentProcessor),
+		fetcher.WithUserAgent(cfg.UserAgent),
+		fetcher.WithRedactor(redact.New(cfg.RedactQueryParams)),
+		fetcher.WithStallTimeout(cfg.StallTimeout),
+		fetcher.WithMaxConnsPerHost(cfg.MaxConnsPerHost),
+		fetcher.WithURLLimits(fetcher.URLLimits{MaxLength: cfg.MaxURLLength, MaxQueryParams: cfg.MaxQueryParams}),
+		fetcher.WithAllowedContentTypes(cfg.AllowedContentTypes...),
+		fetcher.WithNegativeCacheTTL(cfg.NegativeCacheTTL),
+		fetcher.WithProcessingBudget(cfg.ProcessingBudget),
+		fetcher.WithDecompressionLimits(fetcher.DecompressionLimits{MaxRatio: cfg.MaxDecompressionRatio, MaxBytes: cfg.MaxDecompressedBytes}),
+		fetcher.WithCircuitBreaker(fetcher.CircuitBreaker{Failures: cfg.CircuitFailures, Window: cfg.CircuitWindow, Cooldown: cfg.CircuitCooldown}),
+		fetcher.WithHostProfiles(profiles),
+		fetcher.WithProcessingRules(processingRules...),
+	}
+	if cfg.DebugHeaders {
+		fetcherOptions = append(fetcherOptions, fetcher.WithDebugHeaders(cfg.DebugHeaderNames...))
+	}
+	httpFetcher := fetcher.New(fetcherOptions...)
 
 	fs := &FetchServer{
-		config:  cfg,
-		fetcher: httpFetcher,
+		config:        cfg,
+		fetcher:       httpFetcher,
+		profiles:      profiles,
+		robotsChecker: robotsChecker,
+		processor:     contentProcessor,
+		sessions:      newSessionReaper(cfg.SessionIdleTimeout, cfg.SessionPingTimeout),
+		usage:         newSessionUsage(),
+	}
+	if cfg.RateLimit > 0 {
+		fs.rateLimiter = newIPRateLimiter(cfg.RateLimit, parseTrustedProxies(cfg.TrustedProxies))
+	}
+	if cfg.OverloadMaxInFlight > 0 || cfg.OverloadQueueWait > 0 {
+		fs.overload = newOverloadDetector(cfg.OverloadMaxInFlight, cfg.OverloadQueueWait, httpFetcher.QueueWait)
 	}
 
 	// Create MCP server with proper implementation details
 	// Capabilities are automatically generated based on registered tools/resources
+	serverCapabilities := &mcp.ServerCapabilities{Logging: &mcp.LoggingCapabilities{}}
 	mcpServer := mcp.NewServer(&mcp.Implementation{
 		Name:    config.ServerName,
 		Version: config.ServerVersion,
 	}, &mcp.ServerOptions{
 		InitializedHandler: fs.handleInitialized,
+		Capabilities:       serverCapabilities,
 	})
 
+	mcpServer.AddReceivingMiddleware(logMCPRequests, fs.sessions.trackActivity)
 	fs.mcpServer = mcpServer
 
 	// Setup tools
 	fs.setupTools()
+	fs.setupResources()
+
+	// Published once everything is registered, before any session starts
+	serverCapabilities.Experimental = map[string]any{capabilitiesKey: fs.capabilities()}
 
-	return fs
+	return fs, nil
 }
 
 // handleInitialized sends an endpoint event to the client after initialization
 func (fs *FetchServer) handleInitialized(ctx context.Context, initRequest *mcp.InitializedRequest) {
-	// Build the endpoint URI based on the current server configuration
-	var endpointURI string
-	switch fs.config.Transport {
-	case config.TransportSSE:
-		endpointURI = fmt.Sprintf("http://localhost:%d/messages", fs.config.Port)
-	case config.TransportStreamableHTTP:
-		endpointURI = fmt.Sprintf("http://localhost:%d/mcp", fs.config.Port)
-	default:
-		endpointURI = fmt.Sprintf("http://localhost:%d/messages", fs.config.Port)
-	}
+	endpointURI := fs.endpointURI()
 
 	// Send endpoint event as a log message with structured data
 	err := initRequest.Session.Log(ctx, &mcp.LoggingMessageParams{
@@ -106,47 +262,482 @@ func (fs *FetchServer) handleInitialized(ctx context.Context, initRequest *mcp.I
 	}
 }
 
-// setupTools registers the fetch tool with the MCP server
+// endpointURI returns the URI clients must use to send messages for the
+// configured transport, including any base path
+func (fs *FetchServer) endpointURI() string {
+	path := "/messages"
+	if fs.config.Transport == config.TransportStreamableHTTP {
+		path = "/mcp"
+	}
+	return fmt.Sprintf("http://localhost:%d%s", fs.config.Port, fs.route(path))
+}
+
+// route prefixes an endpoint path with the configured base path
+func (fs *FetchServer) route(path string) string {
+	return fs.config.BasePath + path
+}
+
+// setupTools registers the tools with the MCP server
 func (fs *FetchServer) setupTools() {
+	// Clients cannot override the server's readability setting, so the
+	// descriptions say which conversion they get
+	conversion := "readability extraction"
+	fetchDescription := "Fetches a URL from the internet and optionally extracts its contents as markdown."
+	if fs.config.DisableReadability {
+		conversion = "whole-page conversion"
+		fetchDescription += " Whole pages are converted; this server does not extract their main content."
+	}
+
 	fetchTool := &mcp.Tool{
 		Name:        "fetch",
-		Description: "Fetches a URL from the internet and optionally extracts its contents as markdown.",
+		Description: fetchDescription,
+	}
+
+	addTool(fs, fetchTool, fs.handleFetchTool)
+
+	fetchBatchTool := &mcp.Tool{
+		Name: "fetch_batch",
+		Description: fmt.Sprintf("Fetches up to %d URLs in order, like fetch, returning one entry per URL with its "+
+			"status (ok, error, skipped_policy or skipped_robots), content or error, duration and bytes, and a summary. "+
+			"It fails only when no URL could be fetched.", fs.config.MaxBatchURLs),
 	}
 
-	mcp.AddTool(fs.mcpServer, fetchTool, fs.handleFetchTool)
+	addTool(fs, fetchBatchTool, fs.handleFetchBatchTool)
+
+	robotsExplainTool := &mcp.Tool{
+		Name: "robots_explain",
+		Description: "Explains how a site's robots.txt applies to this server's user agent: " +
+			"for each path, whether it is allowed, the rule and group that decided it, and the crawl-delay.",
+	}
+
+	addTool(fs, robotsExplainTool, fs.handleRobotsExplainTool)
+
+	htmlToMarkdownTool := &mcp.Tool{
+		Name: "html_to_markdown",
+		Description: "Converts HTML you already have to markdown using the same " + conversion + " as fetch, " +
+			"without fetching anything.",
+	}
+
+	addTool(fs, htmlToMarkdownTool, fs.handleHTMLToMarkdownTool)
+
+	domainStatsTool := &mcp.Tool{
+		Name: "domain_stats",
+		Description: "Lists the domains this server has fetched from since it started, busiest first, " +
+			"with their fetch, byte, error and robots.txt block counts.",
+	}
+
+	addTool(fs, domainStatsTool, fs.handleDomainStatsTool)
+
+	usageStatsTool := &mcp.Tool{
+		Name: "usage_stats",
+		Description: "Lists the response bytes downloaded by the fetches of each open session, and per client name, " +
+			"most first.",
+	}
+
+	addTool(fs, usageStatsTool, fs.handleUsageStatsTool)
+}
+
+// setupResources registers the resources with the MCP server
+func (fs *FetchServer) setupResources() {
+	if fs.config.MaxResultSize == 0 {
+		return
+	}
+	fs.results = newResultStore()
+
+	resultTemplate := &mcp.ResourceTemplate{
+		Name:        "fetch_result",
+		URITemplate: resultURITemplate,
+		Description: "A chunk of a recent fetch result that was too large to return in one message.",
+		MIMEType:    "text/markdown",
+	}
+	fs.mcpServer.AddResourceTemplate(resultTemplate, fs.handleReadResult)
+	fs.resources = append(fs.resources, resultTemplate.Name)
+}
+
+// FetchOutput is the structured result of the fetch tool. It describes which
+// part of the processed content was returned so clients can page through it.
+type FetchOutput struct {
+	URL string `json:"url"`
+	// RewrittenURL is the raw file -rewrite-known-hosts fetched in place of
+	// the page at URL
+	RewrittenURL string `json:"rewritten_url,omitempty"`
+	// FinalURL is where the content was served from after redirects
+	FinalURL string `json:"final_url"`
+	// CanonicalURL is the page's declared canonical URL. Prefer it over
+	// FinalURL when citing the page.
+	CanonicalURL string `json:"canonical_url,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	StatusCode   int    `json:"status_code"`
+	// Empty reports that the server returned no body, as with 204 No Content
+	Empty bool `json:"empty"`
+	// Unchanged reports a 304 Not Modified answer to if_none_match or
+	// if_modified_since: the client's copy is current and there is no content
+	Unchanged bool `json:"unchanged"`
+	// ETag and LastModified are the response's validators, for a later
+	// if_none_match or if_modified_since
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// CacheHeaders holds the response's etag, last-modified, cache-control,
+	// expires, age and content-language headers, for clients deciding when
+	// to fetch again. No other response header is included.
+	CacheHeaders map[string]string `json:"cache_headers,omitempty"`
+	// BodySHA256 fingerprints the response bytes before charset transcoding
+	BodySHA256 string `json:"body_sha256"`
+	// ContentSHA256 fingerprints the processed content across all pages
+	ContentSHA256  string `json:"content_sha256"`
+	StartIndex     int    `json:"start_index"`
+	TotalLength    int    `json:"total_length"`
+	ReturnedLength int    `json:"returned_length"`
+	Truncated      bool   `json:"truncated"`
+	NextStartIndex int    `json:"next_start_index,omitempty"`
+	// OutOfRange reports that start_index was past the end of the content;
+	// the text then says so and TotalLength gives the actual length
+	OutOfRange bool `json:"out_of_range"`
+	// MaxLength is the limit actually applied, after defaults and clamping
+	MaxLength               int  `json:"max_length,omitempty"`
+	DefaultMaxLengthApplied bool `json:"default_max_length_applied"`
+	MaxLengthClamped        bool `json:"max_length_clamped"`
+	// MaxBytes is the download limit actually applied, after clamping
+	MaxBytes        int  `json:"max_bytes,omitempty"`
+	MaxBytesClamped bool `json:"max_bytes_clamped"`
+	// BodyTruncated reports that the download stopped at MaxBytes, so the
+	// content is only the beginning of the document
+	BodyTruncated bool `json:"body_truncated"`
+	// LengthMismatch reports that the body ended before its declared
+	// Content-Length, so the content is what was received and may be
+	// incomplete
+	LengthMismatch bool `json:"length_mismatch"`
+	// TruncationReason is max_bytes when the download was cut short and
+	// max_length when only the returned content was, so clients can tell a
+	// page that ended from a cap that was hit
+	TruncationReason string `json:"truncation_reason,omitempty"`
+	// SourceFormat is markdown or rst when the document was served as
+	// lightweight markup instead of HTML
+	SourceFormat string `json:"source_format,omitempty"`
+	// AlreadyMarkdown reports markdown that was served as such or converted
+	// from reStructuredText, which clients should not process again
+	AlreadyMarkdown bool `json:"already_markdown"`
+	// Degraded reports that processing failed part way and the content is a
+	// lesser representation of the page; Warning says what failed
+	Degraded bool   `json:"degraded"`
+	Warning  string `json:"warning,omitempty"`
+	// ResultURI is set when the result exceeded -max-result-size. Only its
+	// first chunk is returned; ResultURI/{n} reads chunk n of ResultChunks.
+	ResultURI    string `json:"result_uri,omitempty"`
+	ResultChunks int    `json:"result_chunks,omitempty"`
+	// Warnings describe conditions that did not fail the fetch, such as a
+	// response type that contradicts expected_content
+	Warnings []FetchWarning `json:"warnings,omitempty"`
+	// QueueWaitMS is how long the fetch waited behind other fetches to the
+	// same host, or for the pace its profile sets, before it was sent. It
+	// is only reported from 250ms, so that a slow result is not blamed on
+	// the site.
+	QueueWaitMS int64 `json:"queue_wait_ms,omitempty"`
+}
+
+// FetchWarning is a condition worth reporting that did not fail the fetch.
+// Code is one of a fixed set that clients can rely on; see
+// fetcher.WarningCodes.
+type FetchWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
 }
 
 // handleFetchTool processes fetch tool requests
 func (fs *FetchServer) handleFetchTool(
-	_ context.Context,
-	_ *mcp.CallToolRequest,
+	ctx context.Context,
+	req *mcp.CallToolRequest,
 	params FetchParams,
-) (*mcp.CallToolResult, any, error) {
-	log.Printf("Tool call received: fetch")
+) (*mcp.CallToolResult, *FetchOutput, error) {
+	result, output, _, err := fs.fetchPage(ctx, req, params)
+	return result, output, err
+}
+
+// fetchPage runs one fetch for the fetch and fetch_batch tools, returning
+// the response body bytes downloaded along with the tool result
+func (fs *FetchServer) fetchPage(
+	ctx context.Context,
+	req *mcp.CallToolRequest,
+	params FetchParams,
+) (*mcp.CallToolResult, *FetchOutput, int64, error) {
+	// Fetch, used outside MCP, passes no request and has no session to account
+	var session *mcp.ServerSession
+	if req != nil {
+		session = req.Session
+	}
+	if quota := fs.config.SessionByteQuota; quota > 0 && session != nil {
+		if used := fs.usage.used(session); used >= quota {
+			log.Printf("Refused fetch for session %s: byte quota used (%d of %d bytes)", session.ID(), used, quota)
+			return nil, nil, 0, fmt.Errorf("this session has used its byte quota: %d of %d bytes downloaded", used, quota)
+		}
+	}
+
+	// Refused before queueing, so clients of a saturated server back off
+	if fs.overload != nil {
+		if err := fs.overload.enter(); err != nil {
+			return nil, nil, 0, err
+		}
+		defer fs.overload.leave()
+	}
+
+	// Checked before clamping, which would otherwise replace a negative
+	// max_length with the ceiling
+	if err := processor.ValidatePage(params.StartIndex, params.MaxLength); err != nil {
+		return nil, nil, 0, err
+	}
+	maxLength, defaulted, clamped := fs.effectiveMaxLength(params.MaxLength)
+	maxBytes, maxBytesClamped := fs.effectiveMaxBytes(params.MaxBytes)
 
 	// Convert to fetcher request
 	fetchReq := &fetcher.FetchRequest{
-		URL: params.URL,
-		Raw: params.Raw,
+		URL:             params.URL,
+		MaxLength:       maxLength,
+		StartIndex:      params.StartIndex,
+		Raw:             params.Raw,
+		ExpectedContent: params.ExpectedContent,
+		MaxBytes:        int64(maxBytes),
+		Strict:          params.Strict,
+		ConvertRST:      params.ConvertRST,
+		IfNoneMatch:     params.IfNoneMatch,
+		IfModifiedSince: params.IfModifiedSince,
+
+		RewriteKnownHosts: fs.config.RewriteKnownHosts,
+	}
+	// Fetch the content, abandoned when the call is cancelled. The
+	// robots.txt check takes its share of whatever time the call has.
+	result, err := fs.fetcher.FetchURL(ctx, fetchReq)
+	if err != nil {
+		return nil, nil, 0, fetchFailure(req, err)
+	}
+	if session != nil {
+		_, client := requestIdentity(req)
+		fs.usage.add(session, client, result.BodyBytes)
 	}
 
-	if params.MaxLength != nil {
-		fetchReq.MaxLength = params.MaxLength
+	output := &FetchOutput{
+		URL:                     params.URL,
+		RewrittenURL:            result.RewrittenURL,
+		FinalURL:                fs.reportURL(result.FinalURL),
+		CanonicalURL:            fs.reportURL(result.CanonicalURL),
+		ContentType:             result.ContentType,
+		StatusCode:              result.StatusCode,
+		Empty:                   result.Empty,
+		Unchanged:               result.NotModified,
+		ETag:                    result.ETag,
+		LastModified:            result.LastModified,
+		CacheHeaders:            result.CacheHeaders,
+		BodySHA256:              result.BodySHA256,
+		ContentSHA256:           result.ContentSHA256,
+		StartIndex:              result.Page.StartIndex,
+		TotalLength:             result.Page.TotalLength,
+		ReturnedLength:          result.Page.Returned,
+		Truncated:               result.Page.Truncated,
+		OutOfRange:              result.Page.OutOfRange,
+		DefaultMaxLengthApplied: defaulted,
+		MaxLengthClamped:        clamped,
+		MaxBytes:                maxBytes,
+		MaxBytesClamped:         maxBytesClamped,
+		BodyTruncated:           result.BodyTruncated,
+		TruncationReason:        result.TruncationReason,
+		LengthMismatch:          result.LengthMismatch,
+		SourceFormat:            result.SourceFormat,
+		AlreadyMarkdown:         result.AlreadyMarkdown,
+		Degraded:                result.Warning != "",
+		Warning:                 result.Warning,
 	}
+	if result.Page.Truncated {
+		output.NextStartIndex = result.Page.NextIndex
+	}
+	if maxLength != nil {
+		output.MaxLength = *maxLength
+	}
+	if result.QueueWait >= minReportedQueueWait {
+		output.QueueWaitMS = result.QueueWait.Milliseconds()
+	}
+
+	// An empty text block reads as a silent success, so say there was nothing
+	text := result.Content
+	switch {
+	case result.NotModified:
+		text = "The content has not changed since the cached copy (status 304)."
+	case result.Empty:
+		text = fmt.Sprintf("The server returned no content (status %d).", result.StatusCode)
+	}
+
+	warnings := result.Warnings
+	content := []mcp.Content{&mcp.TextContent{Text: text}}
+	if fs.results != nil && len(text) > fs.config.MaxResultSize {
+		content = fs.handOffResult(text, output)
+		warnings.Add(fetcher.WarningResultSplit,
+			fmt.Sprintf("the result was split into %d chunks", output.ResultChunks), output.ResultURI)
+	}
+
+	// Clients reading only the text get the codes, the rest are in output
+	if len(warnings) > 0 {
+		first := content[0].(*mcp.TextContent)
+		first.Text += fmt.Sprintf("\n\n[Warnings: %s]", warnings.Summary())
+		for _, warning := range warnings {
+			output.Warnings = append(output.Warnings, FetchWarning{
+				Code:    string(warning.Code),
+				Message: warning.Message,
+				Detail:  warning.Detail,
+			})
+		}
+	}
+
+	return &mcp.CallToolResult{Content: content}, output, result.BodyBytes, nil
+}
 
-	if params.StartIndex != nil {
-		fetchReq.StartIndex = params.StartIndex
+// handOffResult stores a result too large for one message and returns its
+// first chunk, followed by links to the others, updating output to describe
+// what was returned. Clients that cannot read resources can still page
+// through the rest with start_index.
+func (fs *FetchServer) handOffResult(text string, output *FetchOutput) []mcp.Content {
+	id, chunks := fs.results.put(text, fs.config.MaxResultSize)
+	first := chunks[0]
+
+	// The first chunk may end inside a footer the page already carried
+	returned := min(len(first), output.ReturnedLength)
+	output.ReturnedLength = returned
+	output.Truncated = true
+	output.NextStartIndex = output.StartIndex + returned
+	if !output.BodyTruncated {
+		output.TruncationReason = "max_result_size"
 	}
+	output.ResultURI = resultURIPrefix + id
+	output.ResultChunks = len(chunks)
+	log.Printf("Result of %d characters exceeds -max-result-size, returning the first of %d chunks", len(text), len(chunks))
+
+	notice := fmt.Sprintf("\n\n[Result too large for one message: showing %d of %d characters. "+
+		"Read the rest from the resources %s to %s, or fetch again with start_index=%d.]",
+		len(first), len(text), resultChunkURI(id, 2), resultChunkURI(id, len(chunks)), output.NextStartIndex)
+	content := []mcp.Content{&mcp.TextContent{Text: first + notice}}
+	for n := 2; n <= len(chunks); n++ {
+		content = append(content, &mcp.ResourceLink{
+			URI:      resultChunkURI(id, n),
+			Name:     fmt.Sprintf("chunk %d of %d", n, len(chunks)),
+			MIMEType: "text/markdown",
+		})
+	}
+	return content
+}
 
-	// Fetch the content
-	content, err := fs.fetcher.FetchURL(fetchReq)
+// Fetch runs a fetch the way the fetch tool does, applying the configured
+// length limits and URL reporting, without an MCP session. It returns the
+// content the tool would send along with its structured output.
+func (fs *FetchServer) Fetch(ctx context.Context, params FetchParams) (string, *FetchOutput, error) {
+	result, output, err := fs.handleFetchTool(ctx, nil, params)
 	if err != nil {
-		return nil, nil, err
+		return "", nil, err
 	}
+	return result.Content[0].(*mcp.TextContent).Text, output, nil
+}
 
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{&mcp.TextContent{Text: content}},
-	}, nil, nil
+// fetchFailureMessages explain each kind of fetch failure to the client
+var fetchFailureMessages = map[fetcher.ErrorKind]string{
+	fetcher.KindRobotsBlocked:  "the site does not allow this page to be fetched",
+	fetcher.KindHTTPStatus:     "the site answered with an error",
+	fetcher.KindNetwork:        "the site could not be reached or stopped responding",
+	fetcher.KindDNSFailure:     "the site's host name could not be resolved",
+	fetcher.KindPolicy:         "this server's policy does not allow the fetch",
+	fetcher.KindTooLarge:       "the request exceeds this server's limits",
+	fetcher.KindProcessing:     "the page was downloaded but could not be processed",
+	fetcher.KindInvalidURL:     "the URL is not valid",
+	fetcher.KindInvalidRequest: "the request is not valid",
+	fetcher.KindCircuitOpen:    "the site has been failing and is not being fetched from for now",
+	fetcher.KindBotProtection:  "the site's bot protection refused the fetch",
+	fetcher.KindCanceled:       "the fetch was cancelled before it completed",
+}
+
+// fetchFailure logs a failed fetch with its kind and returns the error shown
+// to the client, which leads with an explanation of the kind of failure
+func fetchFailure(req *mcp.CallToolRequest, err error) error {
+	var fetchErr *fetcher.FetchError
+	if !errors.As(err, &fetchErr) {
+		return err
+	}
+
+	// Fetch, used outside MCP, passes no request; keep the interface nil
+	var identity mcp.Request
+	if req != nil {
+		identity = req
+	}
+	sessionID, client := requestIdentity(identity)
+	var metadataErr *fetcher.MetadataEndpointError
+	if errors.As(err, &metadataErr) {
+		log.Printf("Blocked cloud metadata access to %s (session=%s client=%q)", metadataErr.Host, sessionID, client)
+	}
+	log.Printf("Fetch failed: kind=%s status=%d cached=%t (session=%s client=%q)",
+		fetchErr.Kind, fetchErr.StatusCode, fetchErr.Cached, sessionID, client)
+
+	if message, ok := fetchFailureMessages[fetchErr.Kind]; ok {
+		return fmt.Errorf("%s: %w", message, err)
+	}
+	return err
+}
+
+// effectiveMaxLength resolves the max_length to apply to a request. An omitted
+// value falls back to the configured default (or the ceiling when only that is
+// set), and any value above the configured ceiling is clamped to it.
+func (fs *FetchServer) effectiveMaxLength(requested *int) (maxLength *int, defaulted, clamped bool) {
+	ceiling := fs.config.MaxMaxLength
+
+	if requested == nil {
+		switch {
+		case fs.config.DefaultMaxLength > 0:
+			limit := fs.config.DefaultMaxLength
+			return &limit, true, false
+		case ceiling > 0:
+			limit := ceiling
+			return &limit, true, false
+		default:
+			return nil, false, false
+		}
+	}
+
+	limit := *requested
+	if ceiling > 0 && (limit <= 0 || limit > ceiling) {
+		limit = ceiling
+		clamped = true
+	}
+	return &limit, false, clamped
+}
+
+// effectiveMaxBytes resolves the download limit to apply to a request. An
+// omitted or non-positive value falls back to the configured -max-bytes, and
+// any value above it is clamped to it. Zero means the whole body is read.
+func (fs *FetchServer) effectiveMaxBytes(requested *int) (maxBytes int, clamped bool) {
+	ceiling := fs.config.MaxBytes
+	if requested == nil || *requested <= 0 {
+		return ceiling, false
+	}
+	if ceiling > 0 && *requested > ceiling {
+		return ceiling, true
+	}
+	return *requested, false
+}
+
+// requestIdentity returns the MCP session ID and the client name reported at
+// initialization for a request, so that log lines can be attributed to the
+// session that issued them
+func requestIdentity(req mcp.Request) (sessionID, client string) {
+	sessionID, client = "none", "unknown"
+	if req == nil {
+		return sessionID, client
+	}
+
+	session, ok := req.GetSession().(*mcp.ServerSession)
+	if !ok || session == nil {
+		return sessionID, client
+	}
+	if id := session.ID(); id != "" {
+		sessionID = id
+	}
+	if initParams := session.InitializeParams(); initParams != nil && initParams.ClientInfo != nil {
+		client = initParams.ClientInfo.Name
+	}
+	return sessionID, client
 }
 
 // Start starts the MCP server following the MCP specification
@@ -169,32 +760,38 @@ func (fs *FetchServer) Start() error {
 
 // startSSEServer starts the server with SSE transport
 func (fs *FetchServer) startSSEServer() error {
+	return fs.listenAndServe(fs.sseMux())
+}
+
+// sseMux returns the routes for the SSE transport
+func (fs *FetchServer) sseMux() *http.ServeMux {
 	mux := http.NewServeMux()
 
-	// Create SSE handler according to MCP specification
+	// Create SSE handler according to MCP specification. The endpoint event
+	// it sends is derived from the request path, so it carries the base path.
 	sseHandler := mcp.NewSSEHandler(func(_ *http.Request) *mcp.Server {
 		return fs.mcpServer
 	}, &mcp.SSEOptions{})
 
 	// Handle SSE endpoint
-	mux.Handle("/sse", sseHandler)
+	mux.Handle(fs.route("/sse"), fs.rateLimit(fs.shedLoad(sseHandler)))
 
 	// HTTP POST endpoint for client-to-server communication
-	mux.Handle("/messages", sseHandler)
+	mux.Handle(fs.route("/messages"), fs.rateLimit(fs.shedLoad(sseHandler)))
 
-	// Start HTTP server
-	server := &http.Server{
-		Addr:              ":" + strconv.Itoa(fs.config.Port),
-		Handler:           mux,
-		ReadHeaderTimeout: 30 * time.Second,
-	}
+	mux.HandleFunc("GET "+fs.route("/healthz"), handleHealthz)
+	mux.Handle("GET "+fs.route("/capabilities"), fs.rateLimit(http.HandlerFunc(fs.handleCapabilities)))
 
-	log.Printf("Server listening on %d", fs.config.Port)
-	return server.ListenAndServe()
+	return mux
 }
 
 // startStreamableHTTPServer starts the server with streamable HTTP transport
 func (fs *FetchServer) startStreamableHTTPServer() error {
+	return fs.listenAndServe(fs.streamableHTTPMux())
+}
+
+// streamableHTTPMux returns the routes for the streamable HTTP transport
+func (fs *FetchServer) streamableHTTPMux() *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// Create streamable HTTP handler according to MCP specification
@@ -203,44 +800,223 @@ func (fs *FetchServer) startStreamableHTTPServer() error {
 			return fs.mcpServer
 		},
 		&mcp.StreamableHTTPOptions{
-			// Configure any specific options here if needed
+			// Retain events so clients can resume dropped streams with Last-Event-ID
+			EventStore: newEventStore(fs.config.EventRetentionBytes, fs.config.EventRetention),
 		},
 	)
 
 	// Handle the message endpoint
-	mux.Handle("/mcp", streamableHandler)
+	mux.Handle(fs.route("/mcp"), fs.rateLimit(fs.shedLoad(streamableHandler)))
 
-	// Start HTTP server
+	mux.HandleFunc("GET "+fs.route("/healthz"), handleHealthz)
+	mux.Handle("GET "+fs.route("/capabilities"), fs.rateLimit(http.HandlerFunc(fs.handleCapabilities)))
+
+	return mux
+}
+
+// handleHealthz reports that the server is up and serving HTTP. It is not
+// rate limited so probes keep working while clients are throttled.
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// rateLimit applies the per-client-IP rate limit, if configured, to an MCP
+// endpoint
+func (fs *FetchServer) rateLimit(handler http.Handler) http.Handler {
+	if fs.rateLimiter == nil {
+		return handler
+	}
+	return fs.rateLimiter.middleware(handler)
+}
+
+// shedLoad refuses new sessions on an MCP endpoint while the server is
+// overloaded, if overload thresholds are configured
+func (fs *FetchServer) shedLoad(handler http.Handler) http.Handler {
+	if fs.overload == nil {
+		return handler
+	}
+	return fs.overload.middleware(handler)
+}
+
+// listenAndServe starts the HTTP server for the given mux and blocks until
+// it stops. A server stopped through Shutdown returns nil, and one that
+// Shutdown was called for before it started returns http.ErrServerClosed
+// without serving.
+func (fs *FetchServer) listenAndServe(mux *http.ServeMux) error {
 	server := &http.Server{
 		Addr:              ":" + strconv.Itoa(fs.config.Port),
-		Handler:           mux,
+		Handler:           logRequests(mux),
 		ReadHeaderTimeout: 30 * time.Second,
 	}
 
+	fs.mu.Lock()
+	if fs.shuttingDown {
+		fs.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	fs.httpServer = server
+	fs.mu.Unlock()
+
+	// Close sessions that stop responding for as long as the server runs
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fs.sessions.run(ctx, fs.mcpServer.Sessions)
+
 	log.Printf("Server listening on %d", fs.config.Port)
-	return server.ListenAndServe()
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown logs a final usage snapshot, as the per-session totals are only
+// kept in memory, then gracefully stops the HTTP server, waiting for active
+// connections until ctx is done. A server that has not started yet never
+// will. It returns every error encountered while shutting down.
+func (fs *FetchServer) Shutdown(ctx context.Context) error {
+	var errs []error
+	if err := fs.logUsageSnapshot(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	fs.mu.Lock()
+	fs.shuttingDown = true
+	server := fs.httpServer
+	fs.mu.Unlock()
+
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shut down HTTP server: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReloadHostProfiles reads the -host-profiles file again, keeping the
+// profiles in use when it is invalid. Without the option there is nothing
+// to reload.
+func (fs *FetchServer) ReloadHostProfiles() error {
+	if fs.profiles == nil {
+		return nil
+	}
+	if err := fs.profiles.Reload(); err != nil {
+		return err
+	}
+	log.Printf("Reloaded %d host profiles from %s", fs.profiles.Len(), fs.config.HostProfilesFile)
+	return nil
 }
 
 // logServerStartup prints startup information
 func (fs *FetchServer) logServerStartup() {
 	log.Printf("=== Starting MCP gofetch Server ===")
-	log.Printf("Server port: %d", fs.config.Port)
-	log.Printf("Transport: %s", fs.config.Transport)
-	log.Printf("User agent: %s", fs.config.UserAgent)
-	log.Printf("Ignore robots.txt: %v", fs.config.IgnoreRobots)
-	if fs.config.ProxyURL != "" {
-		log.Printf("Using proxy: %s", fs.config.ProxyURL)
+	if fs.config.Debug {
+		// The dump covers every setting the summary would
+		log.Printf("Configuration: %s", fs.config)
+	} else {
+		fs.logSettings()
+	}
+	if fs.profiles != nil {
+		log.Printf("Host profiles: %d from %s", fs.profiles.Len(), fs.config.HostProfilesFile)
+	}
+	if fs.config.AllowMetadataEndpoints {
+		log.Printf("WARNING: cloud metadata endpoints may be fetched")
 	}
-	log.Printf("Available tools: fetch")
+	log.Printf("Available tools: %s", strings.Join(fs.tools, ", "))
 
 	// Log endpoint based on transport
 	switch fs.config.Transport {
 	case config.TransportSSE:
-		log.Printf("SSE endpoint (server-to-client): http://localhost:%d/sse", fs.config.Port)
-		log.Printf("Messages endpoint (client-to-server): http://localhost:%d/messages", fs.config.Port)
+		log.Printf("SSE endpoint (server-to-client): http://localhost:%d%s", fs.config.Port, fs.route("/sse"))
+		log.Printf("Messages endpoint (client-to-server): http://localhost:%d%s", fs.config.Port, fs.route("/messages"))
 	case config.TransportStreamableHTTP:
-		log.Printf("MCP endpoint (streaming and commands): http://localhost:%d/mcp", fs.config.Port)
+		log.Printf("MCP endpoint (streaming and commands): http://localhost:%d%s", fs.config.Port, fs.route("/mcp"))
 	}
+	log.Printf("Health endpoint: http://localhost:%d%s", fs.config.Port, fs.route("/healthz"))
 
 	log.Printf("=== Server starting ===")
 }
+
+// logSettings prints a summary of the main settings
+func (fs *FetchServer) logSettings() {
+	log.Printf("Server port: %d", fs.config.Port)
+	log.Printf("Transport: %s", fs.config.Transport)
+	log.Printf("User agent: %s", fs.config.UserAgent)
+	robotsUserAgent := fs.config.RobotsUserAgent
+	if robotsUserAgent == "" {
+		robotsUserAgent = fs.config.UserAgent
+	}
+	log.Printf("Robots user agent: %s", robotsUserAgent)
+	log.Printf("Ignore robots.txt: %v", fs.config.IgnoreRobots)
+	log.Printf("Readability extraction: %v", !fs.config.DisableReadability)
+	log.Printf("Fetch timeout: %s", fs.config.FetchTimeout)
+	log.Printf("Robots timeout: %s", fs.config.RobotsTimeout)
+	log.Printf("Stall timeout: %s", fs.config.StallTimeout)
+	if fs.config.ProcessingBudget > 0 {
+		log.Printf("Processing budget per page: %s", fs.config.ProcessingBudget)
+	}
+	if fs.config.NegativeCacheTTL > 0 {
+		log.Printf("Failed fetches are cached for %s", fs.config.NegativeCacheTTL)
+	}
+	log.Printf("Max connections per host: %d", fs.config.MaxConnsPerHost)
+	log.Printf("URL limits: %d bytes, %d query parameters", fs.config.MaxURLLength, fs.config.MaxQueryParams)
+	log.Printf("Decompression limits: %d:1 ratio, %d bytes", fs.config.MaxDecompressionRatio, fs.config.MaxDecompressedBytes)
+	log.Printf("Response header limits: %d bytes, %d headers", fs.config.MaxResponseHeaderBytes, fs.config.MaxResponseHeaders)
+	log.Printf("Batch limits: %d URLs, %d bytes", fs.config.MaxBatchURLs, fs.config.MaxBatchBytes)
+	if fs.config.CircuitFailures > 0 {
+		log.Printf("Circuit breaker: opens after %d failures within %s, cools down for %s",
+			fs.config.CircuitFailures, fs.config.CircuitWindow, fs.config.CircuitCooldown)
+	}
+	if fs.config.OverloadMaxInFlight > 0 {
+		log.Printf("Overloaded at %d fetches in progress", fs.config.OverloadMaxInFlight)
+	}
+	if fs.config.OverloadQueueWait > 0 {
+		log.Printf("Overloaded when a fetch is queued for more than %s", fs.config.OverloadQueueWait)
+	}
+	if fs.config.RateLimit > 0 {
+		log.Printf("Rate limit: %d requests per minute per client IP", fs.config.RateLimit)
+	}
+	if len(fs.config.ContentProcessors) > 0 {
+		log.Printf("Content processors: %s", strings.Join(fs.config.ContentProcessors, ", "))
+	}
+	if len(fs.config.AllowedContentTypes) > 0 {
+		log.Printf("Allowed content types: %s", strings.Join(fs.config.AllowedContentTypes, ", "))
+	}
+	if fs.config.Transport == config.TransportStreamableHTTP {
+		log.Printf("Event retention: %s, %d bytes per session", fs.config.EventRetention, fs.config.EventRetentionBytes)
+	}
+	log.Printf("Session idle timeout: %s, ping timeout: %s", fs.config.SessionIdleTimeout, fs.config.SessionPingTimeout)
+	log.Printf("Default max_length: %s", formatLimit(fs.config.DefaultMaxLength))
+	log.Printf("Max max_length: %s", formatLimit(fs.config.MaxMaxLength))
+	log.Printf("Max bytes per fetch: %s", formatLimit(fs.config.MaxBytes))
+	log.Printf("Max result size: %s", formatLimit(fs.config.MaxResultSize))
+	if fs.config.SessionByteQuota > 0 {
+		log.Printf("Session byte quota: %d bytes", fs.config.SessionByteQuota)
+	}
+	if fs.config.ProxyURL != "" {
+		log.Printf("Using proxy: %s", redact.New(fs.config.RedactQueryParams).URL(fs.config.ProxyURL))
+	}
+	if fs.config.SourceAddress != "" {
+		log.Printf("Connecting from source address %s", fs.config.SourceAddress)
+	}
+	if fs.config.DNSServer != "" {
+		log.Printf("Resolving hosts with DNS server %s", fs.config.DNSServer)
+	}
+	if fs.config.DNSOverHTTPS != "" {
+		log.Printf("Resolving hosts with DNS over HTTPS endpoint %s", redact.New(fs.config.RedactQueryParams).URL(fs.config.DNSOverHTTPS))
+	}
+	if fs.config.RequireProxy {
+		log.Printf("Direct connections are refused; fetches fail when the proxy cannot be used")
+	}
+	if fs.config.DebugHeaders {
+		log.Printf("Logging request and response headers of every fetch")
+	}
+}
+
+// formatLimit renders a character limit for logging, where zero means no limit
+func formatLimit(limit int) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(limit)
+}
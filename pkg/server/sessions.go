@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"iter"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// sessionReaper closes sessions that stop responding. A session that has
+// sent nothing for idle is pinged, and closed if it does not answer within
+// pingTimeout, which releases the state the SDK and the event store hold for it.
+type sessionReaper struct {
+	idle        time.Duration
+	pingTimeout time.Duration
+	now         func() time.Time
+
+	mu         sync.Mutex
+	lastActive map[*mcp.ServerSession]time.Time
+}
+
+// newSessionReaper creates a reaper pinging sessions after idle and closing
+// them when a ping is not answered within pingTimeout
+func newSessionReaper(idle, pingTimeout time.Duration) *sessionReaper {
+	return &sessionReaper{
+		idle:        idle,
+		pingTimeout: pingTimeout,
+		now:         time.Now,
+		lastActive:  make(map[*mcp.ServerSession]time.Time),
+	}
+}
+
+// trackActivity is MCP receiving middleware recording when each session last
+// sent a message
+func (r *sessionReaper) trackActivity(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if session, ok := req.GetSession().(*mcp.ServerSession); ok {
+			r.touch(session)
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// run reaps idle sessions every half idle period until ctx is done
+func (r *sessionReaper) run(ctx context.Context, sessions func() iter.Seq[*mcp.ServerSession]) {
+	ticker := time.NewTicker(r.idle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reap(ctx, sessions())
+		}
+	}
+}
+
+// reap pings every session idle for longer than r.idle and closes those that
+// do not answer. It returns once all pings have completed.
+func (r *sessionReaper) reap(ctx context.Context, sessions iter.Seq[*mcp.ServerSession]) {
+	var wg sync.WaitGroup
+	for _, session := range r.idleSessions(sessions) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.ping(ctx, session)
+		}()
+	}
+	wg.Wait()
+}
+
+// idleSessions returns the open sessions that have been idle for too long,
+// and forgets sessions that are no longer open
+func (r *sessionReaper) idleSessions(sessions iter.Seq[*mcp.ServerSession]) []*mcp.ServerSession {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	open := make(map[*mcp.ServerSession]bool)
+	var idle []*mcp.ServerSession
+	for session := range sessions {
+		open[session] = true
+		last, ok := r.lastActive[session]
+		if !ok {
+			r.lastActive[session] = now
+			continue
+		}
+		if now.Sub(last) >= r.idle {
+			idle = append(idle, session)
+		}
+	}
+	for session := range r.lastActive {
+		if !open[session] {
+			delete(r.lastActive, session)
+		}
+	}
+	return idle
+}
+
+// ping checks that an idle session is still alive, closing it if not
+func (r *sessionReaper) ping(ctx context.Context, session *mcp.ServerSession) {
+	pingCtx, cancel := context.WithTimeout(ctx, r.pingTimeout)
+	defer cancel()
+
+	err := session.Ping(pingCtx, nil)
+	if err == nil {
+		r.touch(session)
+		return
+	}
+	if ctx.Err() != nil {
+		// The reaper is stopping; the session did not fail
+		return
+	}
+
+	log.Printf("Closing idle session %s: no answer to ping within %s: %v", session.ID(), r.pingTimeout, err)
+	r.mu.Lock()
+	delete(r.lastActive, session)
+	r.mu.Unlock()
+	if err := session.Close(); err != nil {
+		log.Printf("Failed to close idle session %s: %v", session.ID(), err)
+	}
+}
+
+// touch marks session as active now
+func (r *sessionReaper) touch(session *mcp.ServerSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastActive[session] = r.now()
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+func TestSessionReaperClosesUnresponsiveSessions(t *testing.T) {
+	fs := newTestServer(t, config.Config{
+		Transport:          config.TransportStreamableHTTP,
+		SessionIdleTimeout: time.Minute,
+		SessionPingTimeout: 50 * time.Millisecond,
+	})
+	clock := newFakeClock()
+	fs.sessions.now = clock.Now
+
+	// A client that answers pings
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	responsive, err := fs.mcpServer.Connect(t.Context(), serverTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect server: %v", err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "1.0.0"}, nil)
+	clientSession, err := client.Connect(t.Context(), clientTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect client: %v", err)
+	}
+	defer clientSession.Close()
+
+	// A client that reads messages but never answers
+	serverTransport, clientTransport = mcp.NewInMemoryTransports()
+	silent, err := fs.mcpServer.Connect(t.Context(), serverTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect server: %v", err)
+	}
+	conn, err := clientTransport.Connect(t.Context())
+	if err != nil {
+		t.Fatalf("failed to connect transport: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		for {
+			if _, err := conn.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Neither session is idle yet
+	fs.sessions.reap(t.Context(), fs.mcpServer.Sessions())
+	fs.sessions.mu.Lock()
+	tracked := len(fs.sessions.lastActive)
+	fs.sessions.mu.Unlock()
+	if tracked != 2 {
+		t.Fatalf("expected both sessions to be tracked, got %d", tracked)
+	}
+
+	clock.Advance(2 * time.Minute)
+	fs.sessions.reap(t.Context(), fs.mcpServer.Sessions())
+
+	done := make(chan struct{})
+	go func() {
+		silent.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the silent session to be closed")
+	}
+
+	for session := range fs.mcpServer.Sessions() {
+		if session == silent {
+			t.Error("expected the silent session to be removed from the server")
+		}
+	}
+	if err := clientSession.Ping(t.Context(), nil); err != nil {
+		t.Errorf("expected the responsive session to stay open, got %v", err)
+	}
+	fs.sessions.mu.Lock()
+	last := fs.sessions.lastActive[responsive]
+	fs.sessions.mu.Unlock()
+	if !last.Equal(clock.Now()) {
+		t.Errorf("expected an answered ping to count as activity, got %s", last)
+	}
+
+	// Closed sessions are forgotten on the next pass
+	fs.sessions.reap(t.Context(), fs.mcpServer.Sessions())
+	fs.sessions.mu.Lock()
+	defer fs.sessions.mu.Unlock()
+	if _, ok := fs.sessions.lastActive[silent]; ok {
+		t.Error("expected the closed session to be forgotten")
+	}
+}
+
+func TestSessionReaperTracksActivity(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP})
+	clock := newFakeClock()
+	fs.sessions.now = clock.Now
+
+	session := connectTestClient(t, fs)
+	clock.Advance(time.Minute)
+	if _, err := session.ListTools(t.Context(), nil); err != nil {
+		t.Fatalf("list tools failed: %v", err)
+	}
+
+	fs.sessions.mu.Lock()
+	defer fs.sessions.mu.Unlock()
+	if len(fs.sessions.lastActive) != 1 {
+		t.Fatalf("expected one tracked session, got %d", len(fs.sessions.lastActive))
+	}
+	for _, last := range fs.sessions.lastActive {
+		if !last.Equal(clock.Now()) {
+			t.Errorf("expected last activity %s, got %s", clock.Now(), last)
+		}
+	}
+}
+
+// fakeClock is a clock that only moves when the test advances it
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultUsageStatsLimit is how many sessions and clients usage_stats lists
+// when the client gives no limit
+const defaultUsageStatsLimit = 20
+
+// sessionUsage accounts the response bytes downloaded by the fetches of each
+// open MCP session. A session's totals, and so its quota, are dropped when
+// it ends. It is safe for concurrent use.
+type sessionUsage struct {
+	mu       sync.Mutex
+	sessions map[*mcp.ServerSession]*SessionUsageEntry
+}
+
+// newSessionUsage returns empty accounting
+func newSessionUsage() *sessionUsage {
+	return &sessionUsage{sessions: make(map[*mcp.ServerSession]*SessionUsageEntry)}
+}
+
+// used returns the bytes session has downloaded so far
+func (u *sessionUsage) used(session *mcp.ServerSession) int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if entry, ok := u.sessions[session]; ok {
+		return entry.Bytes
+	}
+	return 0
+}
+
+// add records a fetch by session, run by client, that downloaded bytes. The
+// first fetch of a session starts watching for its end.
+func (u *sessionUsage) add(session *mcp.ServerSession, client string, bytes int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	entry, ok := u.sessions[session]
+	if !ok {
+		entry = &SessionUsageEntry{SessionID: session.ID(), Client: client}
+		u.sessions[session] = entry
+		go func() {
+			session.Wait()
+			u.forget(session)
+		}()
+	}
+	entry.Fetches++
+	entry.Bytes += bytes
+}
+
+// forget drops the totals of a session that ended
+func (u *sessionUsage) forget(session *mcp.ServerSession) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.sessions, session)
+}
+
+// snapshot returns the totals of the limit sessions and clients that
+// downloaded the most, along with how many of each there are
+func (u *sessionUsage) snapshot(limit int) *UsageStatsOutput {
+	u.mu.Lock()
+	sessions := make([]SessionUsageEntry, 0, len(u.sessions))
+	for _, entry := range u.sessions {
+		sessions = append(sessions, *entry)
+	}
+	u.mu.Unlock()
+
+	byClient := make(map[string]*ClientUsageEntry)
+	for _, entry := range sessions {
+		client, ok := byClient[entry.Client]
+		if !ok {
+			client = &ClientUsageEntry{Client: entry.Client}
+			byClient[entry.Client] = client
+		}
+		client.Sessions++
+		client.Fetches += entry.Fetches
+		client.Bytes += entry.Bytes
+	}
+	clients := make([]ClientUsageEntry, 0, len(byClient))
+	for _, client := range byClient {
+		clients = append(clients, *client)
+	}
+
+	slices.SortFunc(sessions, func(a, b SessionUsageEntry) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), strings.Compare(a.SessionID, b.SessionID))
+	})
+	slices.SortFunc(clients, func(a, b ClientUsageEntry) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), strings.Compare(a.Client, b.Client))
+	})
+
+	output := &UsageStatsOutput{OpenSessions: len(sessions), TotalClients: len(clients)}
+	output.Sessions = sessions[:min(limit, len(sessions))]
+	output.Clients = clients[:min(limit, len(clients))]
+	return output
+}
+
+// UsageStatsParams defines the input parameters for the usage_stats tool
+type UsageStatsParams struct {
+	Limit int `json:"limit,omitempty" mcp:"Maximum number of sessions and of clients to list (default 20)"`
+}
+
+// UsageStatsOutput is the structured result of the usage_stats tool
+type UsageStatsOutput struct {
+	Sessions []SessionUsageEntry `json:"sessions"`
+	Clients  []ClientUsageEntry  `json:"clients"`
+	// OpenSessions and TotalClients count every session and client with
+	// usage, listed or not
+	OpenSessions int `json:"open_sessions"`
+	TotalClients int `json:"total_clients"`
+	// SessionByteQuota is the configured -session-byte-quota, zero for none
+	SessionByteQuota int64 `json:"session_byte_quota"`
+}
+
+// SessionUsageEntry is the usage of one open session
+type SessionUsageEntry struct {
+	SessionID string `json:"session_id"`
+	// Client is the name the client reported at initialization
+	Client  string `json:"client"`
+	Fetches int64  `json:"fetches"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// ClientUsageEntry is the usage of the open sessions of one client name
+type ClientUsageEntry struct {
+	Client   string `json:"client"`
+	Sessions int    `json:"sessions"`
+	Fetches  int64  `json:"fetches"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// handleUsageStatsTool processes usage_stats tool requests
+func (fs *FetchServer) handleUsageStatsTool(
+	_ context.Context,
+	_ *mcp.CallToolRequest,
+	params UsageStatsParams,
+) (*mcp.CallToolResult, *UsageStatsOutput, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultUsageStatsLimit
+	}
+	return nil, fs.usageStats(limit), nil
+}
+
+// usageStats returns the usage_stats output listing limit sessions and
+// clients
+func (fs *FetchServer) usageStats(limit int) *UsageStatsOutput {
+	output := fs.usage.snapshot(limit)
+	output.SessionByteQuota = fs.config.SessionByteQuota
+	return output
+}
+
+// logUsageSnapshot logs what usage_stats returns by default, unless ctx is
+// already done
+func (fs *FetchServer) logUsageSnapshot(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to log the final usage snapshot: %w", err)
+	}
+	data, err := json.Marshal(fs.usageStats(defaultUsageStatsLimit))
+	if err != nil {
+		return fmt.Errorf("failed to log the final usage snapshot: %w", err)
+	}
+	log.Printf("Final usage: %s", data)
+	return nil
+}
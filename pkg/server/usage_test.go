@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stackloklabs/gofetch/pkg/config"
+)
+
+func TestSessionByteQuota(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("0123456789"))
+	}))
+	defer site.Close()
+
+	fs := newTestServer(t, config.Config{
+		IgnoreRobots:     true,
+		Transport:        config.TransportStreamableHTTP,
+		SessionByteQuota: 25,
+	})
+	session := connectTestClient(t, fs)
+
+	fetch := func() *mcp.CallToolResult {
+		t.Helper()
+		result, err := session.CallTool(t.Context(), &mcp.CallToolParams{
+			Name:      "fetch",
+			Arguments: map[string]any{"url": site.URL},
+		})
+		if err != nil {
+			t.Fatalf("tool call failed: %v", err)
+		}
+		return result
+	}
+
+	// The quota is checked before each fetch, so the one crossing it succeeds
+	for i := range 3 {
+		if result := fetch(); result.IsError {
+			t.Fatalf("fetch %d: unexpected tool error: %+v", i+1, result.Content)
+		}
+	}
+	result := fetch()
+	if !result.IsError {
+		t.Fatal("expected the fetch after the quota was used to fail")
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "30 of 25 bytes") {
+		t.Errorf("expected the error to report the usage, got %q", text)
+	}
+
+	usage := readUsageStats(t, session)
+	if usage.OpenSessions != 1 || len(usage.Sessions) != 1 || usage.SessionByteQuota != 25 {
+		t.Fatalf("expected one session with the quota reported, got %+v", usage)
+	}
+	if entry := usage.Sessions[0]; entry.Bytes != 30 || entry.Fetches != 3 || entry.Client != "test-client" {
+		t.Errorf("expected 30 bytes over 3 fetches by test-client, got %+v", entry)
+	}
+	if len(usage.Clients) != 1 || usage.Clients[0].Sessions != 1 || usage.Clients[0].Bytes != 30 {
+		t.Errorf("expected the client totals to match the session, got %+v", usage.Clients)
+	}
+
+	// A new session starts with a fresh quota, and the ended one is dropped
+	session.Close()
+	second := connectTestClient(t, fs)
+	if result, err := second.CallTool(t.Context(), &mcp.CallToolParams{
+		Name:      "fetch",
+		Arguments: map[string]any{"url": site.URL},
+	}); err != nil || result.IsError {
+		t.Fatalf("expected a new session to fetch, got %v %+v", err, result)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		usage = readUsageStats(t, second)
+		if usage.OpenSessions == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if usage.OpenSessions != 1 || usage.Sessions[0].Bytes != 10 {
+		t.Errorf("expected only the new session with 10 bytes, got %+v", usage)
+	}
+}
+
+// readUsageStats calls the usage_stats tool and decodes its output
+func readUsageStats(t *testing.T, session *mcp.ClientSession) UsageStatsOutput {
+	t.Helper()
+	result, err := session.CallTool(t.Context(), &mcp.CallToolParams{Name: "usage_stats"})
+	if err != nil {
+		t.Fatalf("tool call failed: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected tool error: %+v", result.Content)
+	}
+	data, err := json.Marshal(result.StructuredContent)
+	if err != nil {
+		t.Fatalf("failed to marshal structured content: %v", err)
+	}
+	var output UsageStatsOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		t.Fatalf("invalid structured content %s: %v", data, err)
+	}
+	return output
+}
+
+func TestShutdownLogsUsageSnapshot(t *testing.T) {
+	fs := newTestServer(t, config.Config{Transport: config.TransportStreamableHTTP, SessionByteQuota: 100})
+	fs.usage.sessions[&mcp.ServerSession{}] = &SessionUsageEntry{SessionID: "s1", Client: "test-client", Fetches: 2, Bytes: 30}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	err := fs.Shutdown(t.Context())
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatalf("expected a clean shutdown, got %v", err)
+	}
+
+	_, data, ok := strings.Cut(strings.TrimSpace(buf.String()), "Final usage: ")
+	var usage UsageStatsOutput
+	if !ok || json.Unmarshal([]byte(data), &usage) != nil {
+		t.Fatalf("expected the final usage logged as JSON, got %q", buf.String())
+	}
+	if usage.OpenSessions != 1 || usage.SessionByteQuota != 100 || len(usage.Sessions) != 1 || usage.Sessions[0].Bytes != 30 {
+		t.Errorf("expected the session's usage in the snapshot, got %+v", usage)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := fs.Shutdown(ctx); err == nil || !strings.Contains(err.Error(), "final usage snapshot") {
+		t.Errorf("expected an expired shutdown context to be reported, got %v", err)
+	}
+}